@@ -0,0 +1,175 @@
+package h264
+
+import "github.com/pkg/errors"
+
+// AccessUnit is a set of NAL units which contains exactly one primary coded
+// picture.
+type AccessUnit struct {
+	NALUnits []NALUnit
+}
+
+// IsIDR tells whether the primary coded picture is an IDR picture.
+func (m AccessUnit) IsIDR() bool {
+	for i := range m.NALUnits {
+		if m.NALUnits[i].NALUnitType == NALUnitTypeIDRSlice {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessUnitAssembler groups NAL units in decoding order into access units.
+// SPS and PPS NAL units passed to it are kept in ParameterSets to decode
+// slice headers.
+type AccessUnitAssembler struct {
+	ParameterSets ParameterSets
+
+	nalUnits []NALUnit
+	// hasVCL is true after the first VCL NAL unit of the primary coded
+	// picture.
+	hasVCL bool
+	// ended is true after end of sequence or end of stream.
+	ended     bool
+	prevSlice *accessUnitSlice
+}
+
+// accessUnitSlice holds the values compared in 7.4.1.2.4 to detect the first
+// VCL NAL unit of a primary coded picture.
+type accessUnitSlice struct {
+	nalRefIDC       uint8
+	idrPicFlag      bool
+	picOrderCntType uint64
+	header          SliceHeader
+}
+
+func NewAccessUnitAssembler() *AccessUnitAssembler {
+	return &AccessUnitAssembler{}
+}
+
+// Push adds nal and returns the preceding access unit when nal starts a new
+// one.
+func (a *AccessUnitAssembler) Push(nal NALUnit) (AccessUnit, bool, error) {
+	if err := a.ParameterSets.Update(nal); err != nil {
+		return AccessUnit{}, false, err
+	}
+
+	startsNew := a.ended
+	switch nal.NALUnitType {
+	case NALUnitTypeAccessUnitDelimiter,
+		NALUnitTypeSEI,
+		NALUnitTypeSequenceParameterSet,
+		NALUnitTypePictureParameterSet,
+		NALUnitTypePrefix,
+		NALUnitTypeSubsetSequenceParameterSet,
+		NALUnitTypeDepthParameterSet,
+		17, 18:
+		startsNew = startsNew || a.hasVCL
+	case NALUnitTypeNonIDRSlice, NALUnitTypeSliceDataPartitionA, NALUnitTypeIDRSlice:
+		slice, first, err := a.detectFirstVCL(nal)
+		if err != nil {
+			return AccessUnit{}, false, err
+		}
+		startsNew = startsNew || a.hasVCL && first
+		a.prevSlice = slice
+	case NALUnitTypeAuxiliarySlice, NALUnitTypeSliceExtension, NALUnitTypeSliceExtensionForDepthView:
+		// auxiliary coded pictures and the view components of the other
+		// views follow the primary coded picture in its access unit
+		// (7.4.1.2.3, H.7.4.1.2.3)
+	}
+
+	var au AccessUnit
+	completed := false
+	if startsNew && len(a.nalUnits) > 0 {
+		au = AccessUnit{NALUnits: a.nalUnits}
+		completed = true
+		a.nalUnits = nil
+		a.hasVCL = false
+	}
+	a.ended = false
+
+	a.nalUnits = append(a.nalUnits, nal)
+	switch nal.NALUnitType {
+	case NALUnitTypeNonIDRSlice, NALUnitTypeSliceDataPartitionA, NALUnitTypeIDRSlice:
+		a.hasVCL = true
+	case NALUnitTypeEndOfSequence, NALUnitTypeEndOfStream:
+		a.ended = true
+	}
+
+	return au, completed, nil
+}
+
+// Flush returns the access unit being assembled.
+func (a *AccessUnitAssembler) Flush() (AccessUnit, bool) {
+	if len(a.nalUnits) == 0 {
+		return AccessUnit{}, false
+	}
+	au := AccessUnit{NALUnits: a.nalUnits}
+	a.nalUnits = nil
+	a.hasVCL = false
+	a.ended = false
+	a.prevSlice = nil
+	return au, true
+}
+
+// detectFirstVCL tells whether nal is the first VCL NAL unit of a primary
+// coded picture (7.4.1.2.4). When the parameter sets are not available, a
+// slice with first_mb_in_slice equal to 0 is taken as the first one.
+func (a *AccessUnitAssembler) detectFirstVCL(nal NALUnit) (*accessUnitSlice, bool, error) {
+	if nal.NALUnitType == NALUnitTypeSliceDataPartitionA {
+		// slice_data_partition_a_layer_rbsp begins with slice_header() too,
+		// while UnmarshalNALUnit accepts only slice NAL units.
+		nal.NALUnitType = NALUnitTypeNonIDRSlice
+	}
+
+	header := SliceHeader{}
+	if err := header.UnmarshalNALUnit(nal, a.ParameterSets.SequenceParameterSet, a.ParameterSets.PictureParameterSet); err != nil {
+		g, gerr := readExponentialGolombCoding(newBitReader(nal.RBSPByte))
+		if gerr != nil {
+			return nil, false, errors.Wrap(err, "failed to read slice header")
+		}
+		// the previous slice is kept to compare with the following slices
+		return a.prevSlice, GolombCodeNumToUint64(g) == 0, nil
+	}
+	pps, _ := a.ParameterSets.PictureParameterSet(header.PictureParameterSetID)
+	sps, _ := a.ParameterSets.SequenceParameterSet(pps.SequenceParameterSetID)
+
+	slice := &accessUnitSlice{
+		nalRefIDC:       nal.NALRefIDC,
+		idrPicFlag:      IDRPicFlag(nal),
+		picOrderCntType: sps.PicOrderCntType,
+		header:          header,
+	}
+	// redundant coded pictures follow the primary coded picture
+	if header.RedundantPicCnt > 0 {
+		return a.prevSlice, false, nil
+	}
+	if a.prevSlice == nil {
+		return slice, true, nil
+	}
+	return slice, slice.differsFrom(*a.prevSlice), nil
+}
+
+func (m accessUnitSlice) differsFrom(prev accessUnitSlice) bool {
+	switch {
+	case m.header.FrameNum != prev.header.FrameNum,
+		m.header.PictureParameterSetID != prev.header.PictureParameterSetID,
+		m.header.FieldPicFlag != prev.header.FieldPicFlag,
+		m.header.FieldPicFlag && m.header.BottomFieldFlag != prev.header.BottomFieldFlag,
+		m.nalRefIDC != prev.nalRefIDC && (m.nalRefIDC == 0 || prev.nalRefIDC == 0),
+		m.idrPicFlag != prev.idrPicFlag,
+		m.idrPicFlag && m.header.IDRPicID != prev.header.IDRPicID:
+		return true
+	}
+	if m.picOrderCntType == 0 && prev.picOrderCntType == 0 {
+		if m.header.PicOrderCntLsb != prev.header.PicOrderCntLsb ||
+			m.header.DeltaPicOrderCntBottom != prev.header.DeltaPicOrderCntBottom {
+			return true
+		}
+	}
+	if m.picOrderCntType == 1 && prev.picOrderCntType == 1 {
+		if m.header.DeltaPicOrderCnt != prev.header.DeltaPicOrderCnt {
+			return true
+		}
+	}
+	return false
+}
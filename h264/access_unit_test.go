@@ -0,0 +1,259 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessUnitAssembler_Push(t *testing.T) {
+	sps := SequenceParameterSet{
+		ProfileIDC:                66,
+		FrameMbsOnlyFlag:          true,
+		PicWidthInMbsMinus1:       3,
+		PicHeightInMapUnitsMinus1: 2,
+	}
+	spsNAL := NALUnit{}
+	require.NoError(t, spsNAL.UnmarshalBinary(mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, sps)))
+	ppsNAL := NALUnit{}
+	require.NoError(t, ppsNAL.UnmarshalBinary(mustMarshalParameterSetNALUnit(t, NALUnitTypePictureParameterSet, PictureParameterSet{})))
+
+	nals := []NALUnit{
+		{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0x10}},
+		spsNAL,
+		ppsNAL,
+		{NALUnitType: NALUnitTypeSEI, RBSPByte: []byte{0x06, 0x01, 0x84, 0x80}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: mustBitToBytes(
+			l,                   // first_mb_in_slice = 0
+			o, o, o, l, o, o, o, // slice_type = 7
+			l,          // pic_parameter_set_id = 0
+			o, o, o, o, // frame_num = 0
+			l,          // idr_pic_id = 0
+			o, o, o, o, // pic_order_cnt_lsb = 0
+			o, o, // dec_ref_pic_marking
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: mustBitToBytes(
+			o, l, o, // first_mb_in_slice = 1
+			o, o, o, l, o, o, o, // slice_type = 7
+			l,          // pic_parameter_set_id = 0
+			o, o, o, o, // frame_num = 0
+			l,          // idr_pic_id = 0
+			o, o, o, o, // pic_order_cnt_lsb = 0
+			o, o, // dec_ref_pic_marking
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: mustBitToBytes(
+			l,             // first_mb_in_slice = 0
+			o, o, l, l, o, // slice_type = 5
+			l,          // pic_parameter_set_id = 0
+			o, o, o, l, // frame_num = 1
+			o, o, l, o, // pic_order_cnt_lsb = 2
+			o, // num_ref_idx_active_override_flag
+			o, // ref_pic_list_modification_flag_l0
+			o, // adaptive_ref_pic_marking_mode_flag
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: mustBitToBytes(
+			o, l, o, // first_mb_in_slice = 1
+			o, o, l, l, o, // slice_type = 5
+			l,          // pic_parameter_set_id = 0
+			o, o, o, l, // frame_num = 1
+			o, o, l, o, // pic_order_cnt_lsb = 2
+			o, // num_ref_idx_active_override_flag
+			o, // ref_pic_list_modification_flag_l0
+			o, // adaptive_ref_pic_marking_mode_flag
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: mustBitToBytes(
+			l,             // first_mb_in_slice = 0
+			o, o, l, l, o, // slice_type = 5
+			l,          // pic_parameter_set_id = 0
+			o, o, l, o, // frame_num = 2
+			o, l, o, o, // pic_order_cnt_lsb = 4
+			o, // num_ref_idx_active_override_flag
+			o, // ref_pic_list_modification_flag_l0
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: mustBitToBytes(
+			l,             // first_mb_in_slice = 0
+			o, o, l, l, o, // slice_type = 5
+			l,          // pic_parameter_set_id = 0
+			o, o, l, o, // frame_num = 2
+			o, l, l, o, // pic_order_cnt_lsb = 6
+			o, // num_ref_idx_active_override_flag
+			o, // ref_pic_list_modification_flag_l0
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: mustBitToBytes(
+			o, l, o, // first_mb_in_slice = 1 (arbitrary slice order)
+			o, o, l, l, o, // slice_type = 5
+			l,          // pic_parameter_set_id = 0
+			o, o, l, l, // frame_num = 3
+			l, o, o, o, // pic_order_cnt_lsb = 8
+			o, // num_ref_idx_active_override_flag
+			o, // ref_pic_list_modification_flag_l0
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALUnitType: NALUnitTypeEndOfSequence},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: mustBitToBytes(
+			l,                   // first_mb_in_slice = 0
+			o, o, o, l, o, o, o, // slice_type = 7
+			l,          // pic_parameter_set_id = 0
+			o, o, o, o, // frame_num = 0
+			o, l, o, // idr_pic_id = 1
+			o, o, o, o, // pic_order_cnt_lsb = 0
+			o, o, // dec_ref_pic_marking
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: mustBitToBytes(
+			l,                   // first_mb_in_slice = 0
+			o, o, o, l, o, o, o, // slice_type = 7
+			l,          // pic_parameter_set_id = 0
+			o, o, o, o, // frame_num = 0
+			o, l, l, // idr_pic_id = 2
+			o, o, o, o, // pic_order_cnt_lsb = 0
+			o, o, // dec_ref_pic_marking
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+	}
+
+	a := NewAccessUnitAssembler()
+	var aus []AccessUnit
+	for _, nal := range nals {
+		au, ok, err := a.Push(nal)
+		require.NoError(t, err)
+		if ok {
+			aus = append(aus, au)
+		}
+	}
+	au, ok := a.Flush()
+	require.True(t, ok)
+	aus = append(aus, au)
+
+	assert.Equal(t, []AccessUnit{
+		{NALUnits: nals[0:6]},
+		{NALUnits: nals[6:8]},
+		{NALUnits: nals[8:9]},
+		{NALUnits: nals[9:10]},
+		{NALUnits: nals[10:12]},
+		{NALUnits: nals[12:13]},
+		{NALUnits: nals[13:14]},
+	}, aus)
+
+	_, ok = a.Flush()
+	assert.False(t, ok)
+}
+
+func TestAccessUnitAssembler_Push_WithoutParameterSets(t *testing.T) {
+	nals := []NALUnit{
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}}, // first_mb_in_slice = 0
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x48, 0x84}}, // first_mb_in_slice = 1
+		{NALUnitType: NALUnitTypeFillerData, RBSPByte: []byte{0xff, 0x80}},
+		{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a}}, // first_mb_in_slice = 0
+	}
+
+	a := NewAccessUnitAssembler()
+	var aus []AccessUnit
+	for _, nal := range nals {
+		au, ok, err := a.Push(nal)
+		require.NoError(t, err)
+		if ok {
+			aus = append(aus, au)
+		}
+	}
+	au, ok := a.Flush()
+	require.True(t, ok)
+	aus = append(aus, au)
+
+	assert.Equal(t, []AccessUnit{
+		{NALUnits: nals[0:3]},
+		{NALUnits: nals[3:4]},
+	}, aus)
+}
+
+func TestAccessUnitAssembler_Push_CorruptSliceHeader(t *testing.T) {
+	spsNAL := NALUnit{}
+	require.NoError(t, spsNAL.UnmarshalBinary(mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, SequenceParameterSet{
+		ProfileIDC:       66,
+		FrameMbsOnlyFlag: true,
+	})))
+	ppsNAL := NALUnit{}
+	require.NoError(t, ppsNAL.UnmarshalBinary(mustMarshalParameterSetNALUnit(t, NALUnitTypePictureParameterSet, PictureParameterSet{})))
+	idrSlice := func(firstMbInSlice ...Bit) NALUnit {
+		return NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: mustBitToBytes(append(firstMbInSlice,
+			o, o, o, l, o, o, o, // slice_type = 7
+			l,          // pic_parameter_set_id = 0
+			o, o, o, o, // frame_num = 0
+			l,          // idr_pic_id = 0
+			o, o, o, o, // pic_order_cnt_lsb = 0
+			o, o, // dec_ref_pic_marking
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)...)}
+	}
+
+	nals := []NALUnit{
+		spsNAL,
+		ppsNAL,
+		idrSlice(l), // first_mb_in_slice = 0
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: mustBitToBytes(
+			o, l, o, // first_mb_in_slice = 1
+			o, o, o, l, o, l, l, // slice_type = 10
+			l,
+		)},
+		idrSlice(o, l, l), // first_mb_in_slice = 2
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeSliceExtension, MVCExtension: &NALUnitHeaderMVCExtension{ViewID: 1}, RBSPByte: []byte{0x88, 0x84}},
+		{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: mustBitToBytes(
+			l,             // first_mb_in_slice = 0
+			o, o, l, l, o, // slice_type = 5
+			l,          // pic_parameter_set_id = 0
+			o, o, o, l, // frame_num = 1
+			o, o, l, o, // pic_order_cnt_lsb = 2
+			o, // num_ref_idx_active_override_flag
+			o, // ref_pic_list_modification_flag_l0
+			o, // adaptive_ref_pic_marking_mode_flag
+			l, // slice_qp_delta = 0
+			l, // slice_data
+		)},
+	}
+
+	a := NewAccessUnitAssembler()
+	var aus []AccessUnit
+	for _, nal := range nals {
+		au, ok, err := a.Push(nal)
+		require.NoError(t, err)
+		if ok {
+			aus = append(aus, au)
+		}
+	}
+	au, ok := a.Flush()
+	require.True(t, ok)
+	aus = append(aus, au)
+
+	assert.Equal(t, []AccessUnit{
+		{NALUnits: nals[0:6]},
+		{NALUnits: nals[6:7]},
+	}, aus)
+}
+
+func TestAccessUnit_IsIDR(t *testing.T) {
+	assert.True(t, AccessUnit{NALUnits: []NALUnit{
+		{NALUnitType: NALUnitTypeAccessUnitDelimiter},
+		{NALUnitType: NALUnitTypeIDRSlice},
+	}}.IsIDR())
+	assert.False(t, AccessUnit{NALUnits: []NALUnit{
+		{NALUnitType: NALUnitTypeAccessUnitDelimiter},
+		{NALUnitType: NALUnitTypeNonIDRSlice},
+	}}.IsIDR())
+}
@@ -0,0 +1,145 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// AnnexBToAVCC converts an Annex B byte stream into length-prefixed samples,
+// one per access unit. SPS and PPS NAL units are moved out of the samples
+// into the returned AVCDecoderConfigurationRecord. NAL units are copied as
+// they are in the stream, keeping emulation prevention bytes such as the ones
+// of cabac_zero_words.
+func AnnexBToAVCC(r io.Reader) (AVCDecoderConfigurationRecord, [][]byte, error) {
+	var spss, ppss [][]byte
+	var samples [][]byte
+	// raws holds the bytes of the NAL units pushed to the assembler, which
+	// are taken by the access units in the same order.
+	var raws [][]byte
+
+	appendSample := func(au AccessUnit) error {
+		var nals [][]byte
+		for i, nal := range au.NALUnits {
+			b := raws[i]
+			switch nal.NALUnitType {
+			case NALUnitTypeSequenceParameterSet:
+				spss = appendUniqueBytes(spss, b)
+			case NALUnitTypePictureParameterSet:
+				ppss = appendUniqueBytes(ppss, b)
+			default:
+				nals = append(nals, b)
+			}
+		}
+		raws = raws[len(au.NALUnits):]
+		if len(nals) == 0 {
+			return nil
+		}
+		sample, err := JoinLengthPrefixed(nals, 4)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, sample)
+		return nil
+	}
+
+	ar := NewAnnexBReader(r)
+	assembler := NewAccessUnitAssembler()
+	for {
+		b, offset, err := ar.ReadRaw()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return AVCDecoderConfigurationRecord{}, nil, err
+		}
+		raw := append([]byte{}, b...)
+		nal := NALUnit{}
+		if err := nal.UnmarshalBinary(raw); err != nil {
+			return AVCDecoderConfigurationRecord{}, nil, errors.Wrapf(err, "failed to unmarshal NAL unit: offset=%d", offset)
+		}
+		au, ok, err := assembler.Push(nal)
+		if err != nil {
+			return AVCDecoderConfigurationRecord{}, nil, err
+		}
+		if ok {
+			if err := appendSample(au); err != nil {
+				return AVCDecoderConfigurationRecord{}, nil, err
+			}
+		}
+		raws = append(raws, raw)
+	}
+	if au, ok := assembler.Flush(); ok {
+		if err := appendSample(au); err != nil {
+			return AVCDecoderConfigurationRecord{}, nil, err
+		}
+	}
+
+	record, err := NewAVCDecoderConfigurationRecord(spss, ppss)
+	if err != nil {
+		return AVCDecoderConfigurationRecord{}, nil, err
+	}
+
+	return record, samples, nil
+}
+
+func appendUniqueBytes(s [][]byte, b []byte) [][]byte {
+	for i := range s {
+		if bytes.Equal(s[i], b) {
+			return s
+		}
+	}
+	return append(s, b)
+}
+
+// AVCCToAnnexB converts a length-prefixed sample into an Annex B byte stream
+// of one access unit. SPS and PPS NAL units of record are inserted before
+// the first IDR slice unless the sample already carries them.
+func AVCCToAnnexB(record AVCDecoderConfigurationRecord, sample []byte) ([]byte, error) {
+	nals, err := SplitLengthPrefixed(sample, record.LengthSize())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	w := NewAnnexBWriter(buf)
+	first := true
+	write := func(b []byte) error {
+		err := w.WriteRaw(b, first)
+		first = false
+		return err
+	}
+
+	hasSPS, hasPPS := false, false
+	for _, b := range nals {
+		switch b[0] & 0x1f {
+		case NALUnitTypeSequenceParameterSet:
+			hasSPS = true
+		case NALUnitTypePictureParameterSet:
+			hasPPS = true
+		case NALUnitTypeIDRSlice:
+			if !hasSPS {
+				for _, ps := range record.SequenceParameterSetNALUnits {
+					if err := write(ps); err != nil {
+						return nil, err
+					}
+				}
+				hasSPS = true
+			}
+			if !hasPPS {
+				for _, ps := range record.PictureParameterSetNALUnits {
+					if err := write(ps); err != nil {
+						return nil, err
+					}
+				}
+				hasPPS = true
+			}
+		}
+		if err := write(b); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
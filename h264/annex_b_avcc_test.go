@@ -0,0 +1,134 @@
+package h264
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnexBToAVCC(t *testing.T) {
+	stream := []byte{
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40,
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x38, 0x80,
+		0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, // first_mb_in_slice = 0
+		0x00, 0x00, 0x01, 0x65, 0x48, 0x84, // first_mb_in_slice = 1
+		0x00, 0x00, 0x00, 0x01, 0x41, 0x9a,
+		0x00, 0x00, 0x00, 0x01, 0x06, 0x05, 0x01, 0x00, 0x80,
+		0x00, 0x00, 0x01, 0x41, 0x9b,
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40,
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x38, 0x80,
+		0x00, 0x00, 0x01, 0x65, 0x88, 0x80,
+	}
+
+	record, samples, err := AnnexBToAVCC(bytes.NewReader(stream))
+	require.NoError(t, err)
+	assert.Equal(t, AVCDecoderConfigurationRecord{
+		ConfigurationVersion:         1,
+		AVCProfileIndication:         0x42,
+		ProfileCompatibility:         0xc0,
+		AVCLevelIndication:           0x1e,
+		LengthSizeMinusOne:           3,
+		SequenceParameterSetNALUnits: [][]byte{{0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40}},
+		PictureParameterSetNALUnits:  [][]byte{{0x68, 0xce, 0x38, 0x80}},
+	}, record)
+	assert.Equal(t, [][]byte{
+		{
+			0x00, 0x00, 0x00, 0x03, 0x65, 0x88, 0x84,
+			0x00, 0x00, 0x00, 0x03, 0x65, 0x48, 0x84,
+		},
+		{
+			0x00, 0x00, 0x00, 0x02, 0x41, 0x9a,
+		},
+		{
+			0x00, 0x00, 0x00, 0x05, 0x06, 0x05, 0x01, 0x00, 0x80,
+			0x00, 0x00, 0x00, 0x02, 0x41, 0x9b,
+		},
+		{
+			0x00, 0x00, 0x00, 0x03, 0x65, 0x88, 0x80,
+		},
+	}, samples)
+
+	t.Run("cabac_zero_words", func(t *testing.T) {
+		_, samples, err := AnnexBToAVCC(bytes.NewReader([]byte{
+			0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40,
+			0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x38, 0x80,
+			0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{
+			{0x00, 0x00, 0x00, 0x09, 0x65, 0x88, 0x84, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03},
+		}, samples)
+	})
+
+	t.Run("without parameter sets", func(t *testing.T) {
+		_, _, err := AnnexBToAVCC(bytes.NewReader([]byte{0x00, 0x00, 0x01, 0x65, 0x88, 0x84}))
+		assert.Error(t, err)
+	})
+}
+
+func TestAVCCToAnnexB(t *testing.T) {
+	record := AVCDecoderConfigurationRecord{
+		LengthSizeMinusOne:           1,
+		SequenceParameterSetNALUnits: [][]byte{{0x67, 0x42, 0xc0, 0x1e}},
+		PictureParameterSetNALUnits:  [][]byte{{0x68, 0xce}},
+	}
+
+	for _, tt := range []struct {
+		Name     string
+		Sample   []byte
+		Expected []byte
+	}{
+		{
+			Name: "IDR access unit",
+			Sample: []byte{
+				0x00, 0x02, 0x09, 0x10,
+				0x00, 0x03, 0x65, 0x88, 0x84,
+				0x00, 0x03, 0x65, 0x48, 0x84,
+			},
+			Expected: []byte{
+				0x00, 0x00, 0x00, 0x01, 0x09, 0x10,
+				0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xc0, 0x1e,
+				0x00, 0x00, 0x00, 0x01, 0x68, 0xce,
+				0x00, 0x00, 0x01, 0x65, 0x88, 0x84,
+				0x00, 0x00, 0x01, 0x65, 0x48, 0x84,
+			},
+		},
+		{
+			Name: "IDR access unit with in-band parameter sets",
+			Sample: []byte{
+				0x00, 0x04, 0x67, 0x42, 0xc0, 0x1f,
+				0x00, 0x02, 0x68, 0xcf,
+				0x00, 0x03, 0x65, 0x88, 0x84,
+			},
+			Expected: []byte{
+				0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xc0, 0x1f,
+				0x00, 0x00, 0x00, 0x01, 0x68, 0xcf,
+				0x00, 0x00, 0x01, 0x65, 0x88, 0x84,
+			},
+		},
+		{
+			Name: "non-IDR access unit",
+			Sample: []byte{
+				0x00, 0x05, 0x06, 0x05, 0x01, 0x00, 0x80,
+				0x00, 0x02, 0x41, 0x9a,
+			},
+			Expected: []byte{
+				0x00, 0x00, 0x00, 0x01, 0x06, 0x05, 0x01, 0x00, 0x80,
+				0x00, 0x00, 0x01, 0x41, 0x9a,
+			},
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := AVCCToAnnexB(record, tt.Sample)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Expected, b)
+		})
+	}
+
+	t.Run("truncated sample", func(t *testing.T) {
+		_, err := AVCCToAnnexB(record, []byte{0x00, 0x03, 0x65, 0x88})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,171 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultAnnexBMaxNALUnitSize = 32 << 20
+
+	annexBReaderBufSize = 64 << 10
+)
+
+// AnnexBReader reads NAL units from a byte stream defined in Annex B.
+type AnnexBReader struct {
+	// MaxNALUnitSize bounds the size of a single NAL unit, and so the memory
+	// held by the reader.
+	MaxNALUnitSize int
+
+	r   io.Reader
+	buf []byte
+	// offset in the byte stream of buf[0]
+	bufOffset int64
+	// index of unconsumed bytes in buf
+	pos int
+	eof bool
+	// true when pos is just after a start code prefix
+	synced bool
+}
+
+func NewAnnexBReader(r io.Reader) *AnnexBReader {
+	return &AnnexBReader{
+		MaxNALUnitSize: DefaultAnnexBMaxNALUnitSize,
+		r:              r,
+		buf:            make([]byte, 0, annexBReaderBufSize),
+	}
+}
+
+// ReadNALUnit returns the next NAL unit and the byte offset of its first
+// byte in the stream. It returns io.EOF when no more NAL unit remains.
+func (r *AnnexBReader) ReadNALUnit() (NALUnit, int64, error) {
+	b, offset, err := r.ReadRaw()
+	if err != nil {
+		return NALUnit{}, 0, err
+	}
+	nal := NALUnit{}
+	if err := nal.UnmarshalBinary(b); err != nil {
+		return NALUnit{}, 0, errors.Wrapf(err, "failed to unmarshal NAL unit: offset=%d", offset)
+	}
+	return nal, offset, nil
+}
+
+// ReadRaw returns the bytes of the next NAL unit without the start code
+// prefix, and the byte offset of its first byte in the stream. The returned
+// bytes are not retained by the reader.
+func (r *AnnexBReader) ReadRaw() ([]byte, int64, error) {
+	for {
+		if !r.synced {
+			if err := r.sync(); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		end, err := r.scanNALUnitEnd()
+		if err != nil {
+			return nil, 0, err
+		}
+		r.synced = false
+		if end == r.pos {
+			// empty NAL unit between two start codes
+			continue
+		}
+
+		b := make([]byte, end-r.pos)
+		copy(b, r.buf[r.pos:end])
+		offset := r.bufOffset + int64(r.pos)
+		r.pos = end
+		return b, offset, nil
+	}
+}
+
+// sync skips zero_byte, leading_zero_8bits and trailing_zero_8bits up to and
+// including the next start_code_prefix_one_3bytes.
+func (r *AnnexBReader) sync() error {
+	startCode := []byte{0x00, 0x00, 0x01}
+	for {
+		if i := bytes.Index(r.buf[r.pos:], startCode); i >= 0 {
+			r.pos += i + len(startCode)
+			r.synced = true
+			return nil
+		}
+		if r.eof {
+			r.pos = len(r.buf)
+			return io.EOF
+		}
+		// keep a partial start code
+		if len(r.buf)-r.pos > 2 {
+			r.pos = len(r.buf) - 2
+		}
+		if err := r.fill(); err != nil {
+			return err
+		}
+	}
+}
+
+// scanNALUnitEnd returns the index in buf just after the last byte of the NAL
+// unit starting at pos.
+func (r *AnnexBReader) scanNALUnitEnd() (int, error) {
+	// scanned is relative to pos since fill moves the buffer.
+	scanned := 0
+	for {
+		for {
+			i := bytes.Index(r.buf[r.pos+scanned:], []byte{0x00, 0x00})
+			if i < 0 {
+				if n := len(r.buf) - r.pos; n > 0 && r.buf[len(r.buf)-1] == 0x00 {
+					scanned = n - 1
+				} else {
+					scanned = n
+				}
+				break
+			}
+			j := r.pos + scanned + i
+			if j+2 >= len(r.buf) {
+				scanned = j - r.pos
+				break
+			}
+			if r.buf[j+2] <= 0x01 {
+				return j, nil
+			}
+			scanned += i + 1
+		}
+
+		if r.eof {
+			end := len(r.buf)
+			for end > r.pos && r.buf[end-1] == 0x00 {
+				end--
+			}
+			return end, nil
+		}
+		if len(r.buf)-r.pos > r.MaxNALUnitSize {
+			return 0, errors.Errorf("NAL unit exceeds max size: offset=%d, max=%d", r.bufOffset+int64(r.pos), r.MaxNALUnitSize)
+		}
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// fill discards consumed bytes and reads more bytes into buf.
+func (r *AnnexBReader) fill() error {
+	if r.pos > 0 {
+		n := copy(r.buf, r.buf[r.pos:])
+		r.buf = r.buf[:n]
+		r.bufOffset += int64(r.pos)
+		r.pos = 0
+	}
+	if len(r.buf) == cap(r.buf) {
+		b := make([]byte, len(r.buf), 2*cap(r.buf))
+		copy(b, r.buf)
+		r.buf = b
+	}
+	n, err := r.r.Read(r.buf[len(r.buf):cap(r.buf)])
+	r.buf = r.buf[:len(r.buf)+n]
+	if err == io.EOF {
+		r.eof = true
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type annexBRawUnit struct {
+	Binary []byte
+	Offset int64
+}
+
+var AnnexBReaderTestData = []struct {
+	Name   string
+	Stream []byte
+	Units  []annexBRawUnit
+}{
+	{
+		Name:   "empty stream",
+		Stream: []byte{},
+		Units:  nil,
+	},
+	{
+		Name: "3-byte start codes",
+		Stream: []byte{
+			0x00, 0x00, 0x01, 0x09, 0xf0,
+			0x00, 0x00, 0x01, 0x65, 0x88, 0x84,
+		},
+		Units: []annexBRawUnit{
+			{Binary: []byte{0x09, 0xf0}, Offset: 3},
+			{Binary: []byte{0x65, 0x88, 0x84}, Offset: 8},
+		},
+	},
+	{
+		Name: "4-byte start codes",
+		Stream: []byte{
+			0x00, 0x00, 0x00, 0x01, 0x67, 0x42,
+			0x00, 0x00, 0x00, 0x01, 0x68, 0xce,
+		},
+		Units: []annexBRawUnit{
+			{Binary: []byte{0x67, 0x42}, Offset: 4},
+			{Binary: []byte{0x68, 0xce}, Offset: 10},
+		},
+	},
+	{
+		Name: "leading and trailing zero bytes",
+		Stream: []byte{
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x09, 0xf0,
+			0x00, 0x00, // trailing_zero_8bits
+			0x00, 0x00, 0x01, 0x65, 0x80,
+			0x00, 0x00, // trailing_zero_8bits
+		},
+		Units: []annexBRawUnit{
+			{Binary: []byte{0x09, 0xf0}, Offset: 6},
+			{Binary: []byte{0x65, 0x80}, Offset: 13},
+		},
+	},
+	{
+		Name: "emulation prevention bytes are kept",
+		Stream: []byte{
+			0x00, 0x00, 0x01, 0x06, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x00, 0x80,
+		},
+		Units: []annexBRawUnit{
+			{Binary: []byte{0x06, 0x00, 0x00, 0x03, 0x01, 0x00, 0x00, 0x03, 0x00, 0x80}, Offset: 3},
+		},
+	},
+	{
+		Name: "empty NAL unit is skipped",
+		Stream: []byte{
+			0x00, 0x00, 0x01,
+			0x00, 0x00, 0x01, 0x09, 0xf0,
+		},
+		Units: []annexBRawUnit{
+			{Binary: []byte{0x09, 0xf0}, Offset: 6},
+		},
+	},
+	{
+		Name:   "no start code",
+		Stream: []byte{0x01, 0x02, 0x03, 0x00, 0x00},
+		Units:  nil,
+	},
+}
+
+func readAllAnnexBRaw(t *testing.T, r *AnnexBReader) []annexBRawUnit {
+	var units []annexBRawUnit
+	for {
+		b, offset, err := r.ReadRaw()
+		if err == io.EOF {
+			return units
+		}
+		require.NoError(t, err)
+		units = append(units, annexBRawUnit{Binary: b, Offset: offset})
+	}
+}
+
+func TestAnnexBReader_ReadRaw(t *testing.T) {
+	for _, tt := range AnnexBReaderTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			r := NewAnnexBReader(bytes.NewReader(tt.Stream))
+			assert.Equal(t, tt.Units, readAllAnnexBRaw(t, r))
+		})
+		t.Run(tt.Name+" with one byte reads", func(t *testing.T) {
+			r := NewAnnexBReader(iotest.OneByteReader(bytes.NewReader(tt.Stream)))
+			assert.Equal(t, tt.Units, readAllAnnexBRaw(t, r))
+		})
+	}
+
+	t.Run("NAL units larger than the buffer", func(t *testing.T) {
+		first := bytes.Repeat([]byte{0x65, 0x00, 0x00, 0x03}, annexBReaderBufSize)
+		second := bytes.Repeat([]byte{0x41, 0xff}, annexBReaderBufSize)
+		stream := append(append(append([]byte{0x00, 0x00, 0x00, 0x01}, first...), 0x00, 0x00, 0x01), second...)
+
+		r := NewAnnexBReader(bytes.NewReader(stream))
+		assert.Equal(t, []annexBRawUnit{
+			{Binary: first, Offset: 4},
+			{Binary: second, Offset: int64(4 + len(first) + 3)},
+		}, readAllAnnexBRaw(t, r))
+	})
+
+	t.Run("NAL unit exceeds max size", func(t *testing.T) {
+		stream := append([]byte{0x00, 0x00, 0x01}, bytes.Repeat([]byte{0x65}, 4*annexBReaderBufSize)...)
+
+		r := NewAnnexBReader(bytes.NewReader(stream))
+		r.MaxNALUnitSize = annexBReaderBufSize
+		_, _, err := r.ReadRaw()
+		assert.Error(t, err)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		r := NewAnnexBReader(iotest.TimeoutReader(bytes.NewReader([]byte{0x00, 0x00, 0x01, 0x09, 0xf0})))
+		_, _, err := r.ReadRaw()
+		assert.Equal(t, iotest.ErrTimeout, err)
+	})
+}
+
+func TestAnnexBReader_ReadNALUnit(t *testing.T) {
+	stream := []byte{
+		0x00, 0x00, 0x00, 0x01, 0x09, 0xf0,
+		0x00, 0x00, 0x01, 0x06, 0x05, 0x00, 0x00, 0x03, 0x01, 0x80,
+	}
+	r := NewAnnexBReader(bytes.NewReader(stream))
+
+	nal, offset, err := r.ReadNALUnit()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), offset)
+	assert.Equal(t, NALUnit{
+		NALUnitType: NALUnitTypeAccessUnitDelimiter,
+		RBSPByte:    []byte{0xf0},
+	}, nal)
+
+	nal, offset, err = r.ReadNALUnit()
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), offset)
+	assert.Equal(t, NALUnit{
+		NALUnitType: NALUnitTypeSEI,
+		RBSPByte:    []byte{0x05, 0x00, 0x00, 0x01, 0x80},
+	}, nal)
+
+	_, _, err = r.ReadNALUnit()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAnnexBReader_ReadNALUnit_TruncatedHeaderExtension(t *testing.T) {
+	r := NewAnnexBReader(bytes.NewReader([]byte{0x00, 0x00, 0x01, 0x2e}))
+	_, _, err := r.ReadNALUnit()
+	assert.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
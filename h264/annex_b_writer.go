@@ -0,0 +1,62 @@
+package h264
+
+import "io"
+
+// AnnexBWriter writes NAL units as a byte stream defined in Annex B.
+type AnnexBWriter struct {
+	w io.Writer
+}
+
+func NewAnnexBWriter(w io.Writer) *AnnexBWriter {
+	return &AnnexBWriter{w: w}
+}
+
+// WriteNALUnit writes nal with its start code prefix. firstInAccessUnit
+// tells whether nal is the first NAL unit of an access unit.
+func (w *AnnexBWriter) WriteNALUnit(nal NALUnit, firstInAccessUnit bool) error {
+	b, err := nal.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.WriteRaw(b, firstInAccessUnit)
+}
+
+// WriteAccessUnit writes nals as one access unit.
+func (w *AnnexBWriter) WriteAccessUnit(nals []NALUnit) error {
+	for i := range nals {
+		if err := w.WriteNALUnit(nals[i], i == 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteRaw writes b, the bytes of a NAL unit including the NAL unit header
+// and emulation prevention bytes, with its start code prefix.
+func (w *AnnexBWriter) WriteRaw(b []byte, firstInAccessUnit bool) error {
+	startCode := []byte{0x00, 0x00, 0x01}
+	if len(b) > 0 && hasAnnexBZeroByte(b[0]&0x1f, firstInAccessUnit) {
+		startCode = []byte{0x00, 0x00, 0x00, 0x01}
+	}
+	if _, err := w.w.Write(startCode); err != nil {
+		return err
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+// hasAnnexBZeroByte tells whether zero_byte precedes the start code prefix
+// (B.1.2).
+func hasAnnexBZeroByte(nalUnitType uint8, firstInAccessUnit bool) bool {
+	if firstInAccessUnit {
+		return true
+	}
+	switch nalUnitType {
+	case NALUnitTypeSequenceParameterSet,
+		NALUnitTypePictureParameterSet,
+		NALUnitTypeSubsetSequenceParameterSet,
+		NALUnitTypeDepthParameterSet:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnexBWriter_WriteAccessUnit(t *testing.T) {
+	accessUnits := [][]NALUnit{
+		{
+			{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0x10}},
+			{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: []byte{0x42, 0x00, 0x1e}},
+			{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xce}},
+			{NALUnitType: NALUnitTypeSEI, RBSPByte: []byte{0x05, 0x00, 0x00, 0x01, 0x80}},
+			{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}},
+		},
+		{
+			{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a}},
+			{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9b}},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	w := NewAnnexBWriter(buf)
+	for _, au := range accessUnits {
+		require.NoError(t, w.WriteAccessUnit(au))
+	}
+
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x01, 0x09, 0x10,
+		0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x1e,
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xce,
+		0x00, 0x00, 0x01, 0x06, 0x05, 0x00, 0x00, 0x03, 0x01, 0x80,
+		0x00, 0x00, 0x01, 0x65, 0x88, 0x84,
+		0x00, 0x00, 0x00, 0x01, 0x41, 0x9a,
+		0x00, 0x00, 0x01, 0x41, 0x9b,
+	}, buf.Bytes())
+
+	r := NewAnnexBReader(buf)
+	for _, au := range accessUnits {
+		for _, want := range au {
+			got, _, err := r.ReadNALUnit()
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		}
+	}
+	_, _, err := r.ReadNALUnit()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAnnexBWriter_WriteRaw(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewAnnexBWriter(buf)
+	require.NoError(t, w.WriteRaw([]byte{0x41, 0x9a}, false))
+	require.NoError(t, w.WriteRaw([]byte{0x41, 0x9b}, true))
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x01, 0x41, 0x9a,
+		0x00, 0x00, 0x00, 0x01, 0x41, 0x9b,
+	}, buf.Bytes())
+}
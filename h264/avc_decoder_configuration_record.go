@@ -1,6 +1,7 @@
 package h264
 
 import (
+	"bytes"
 	"encoding/binary"
 
 	"github.com/pkg/errors"
@@ -14,6 +15,167 @@ type AVCDecoderConfigurationRecord struct {
 	LengthSizeMinusOne           uint8
 	SequenceParameterSetNALUnits [][]byte
 	PictureParameterSetNALUnits  [][]byte
+	// HighProfileExtension is present only when AVCProfileIndication is 100,
+	// 110, 122 or 144.
+	HighProfileExtension *AVCDecoderConfigurationRecordHighProfileExtension
+}
+
+type AVCDecoderConfigurationRecordHighProfileExtension struct {
+	ChromaFormat                    uint8
+	BitDepthLumaMinus8              uint8
+	BitDepthChromaMinus8            uint8
+	SequenceParameterSetExtNALUnits [][]byte
+}
+
+func hasAVCDecoderConfigurationRecordHighProfileExtension(profileIndication uint8) bool {
+	switch profileIndication {
+	case 100, 110, 122, 144:
+		return true
+	}
+	return false
+}
+
+// NewAVCDecoderConfigurationRecord returns a record built from SPS and PPS
+// NAL units. SPS extension NAL units may be included in spsNALUnits. NAL
+// units with the same parameter set ID are deduplicated, keeping the last.
+func NewAVCDecoderConfigurationRecord(spsNALUnits, ppsNALUnits [][]byte) (AVCDecoderConfigurationRecord, error) {
+	m := AVCDecoderConfigurationRecord{
+		ConfigurationVersion: 1,
+		LengthSizeMinusOne:   3,
+	}
+
+	var spss []SequenceParameterSet
+	var spsExts [][]byte
+	spsIndex := map[uint64]int{}
+	for _, b := range spsNALUnits {
+		nal := NALUnit{}
+		if err := nal.UnmarshalBinary(b); err != nil {
+			return AVCDecoderConfigurationRecord{}, err
+		}
+		switch nal.NALUnitType {
+		case NALUnitTypeSequenceParameterSet:
+		case NALUnitTypeSequenceParameterSetExtension:
+			spsExts = append(spsExts, b)
+			continue
+		default:
+			return AVCDecoderConfigurationRecord{}, errors.Errorf("not a sequence parameter set: nal_unit_type=%d", nal.NALUnitType)
+		}
+		sps := SequenceParameterSet{}
+		if err := sps.UnmarshalBinary(nal.RBSPByte); err != nil {
+			return AVCDecoderConfigurationRecord{}, errors.Wrap(err, "failed to unmarshal sequence parameter set")
+		}
+		if i, ok := spsIndex[sps.SequenceParamterSetID]; ok {
+			spss[i] = sps
+			m.SequenceParameterSetNALUnits[i] = b
+			continue
+		}
+		spsIndex[sps.SequenceParamterSetID] = len(spss)
+		spss = append(spss, sps)
+		m.SequenceParameterSetNALUnits = append(m.SequenceParameterSetNALUnits, b)
+	}
+	if len(spss) == 0 {
+		return AVCDecoderConfigurationRecord{}, errors.New("sequence parameter set is not found")
+	}
+
+	m.AVCProfileIndication = spss[0].ProfileIDC
+	m.ProfileCompatibility = 0xff
+	for i, sps := range spss {
+		if sps.ProfileIDC != m.AVCProfileIndication {
+			return AVCDecoderConfigurationRecord{}, errors.Errorf("profile_idc mismatch: index=%d, profile_idc=%d, expected=%d", i, sps.ProfileIDC, m.AVCProfileIndication)
+		}
+		m.ProfileCompatibility &= profileCompatibility(sps)
+		if sps.LevelIDC > m.AVCLevelIndication {
+			m.AVCLevelIndication = sps.LevelIDC
+		}
+	}
+	if hasAVCDecoderConfigurationRecordHighProfileExtension(m.AVCProfileIndication) {
+		m.HighProfileExtension = &AVCDecoderConfigurationRecordHighProfileExtension{
+			ChromaFormat:                    uint8(spss[0].ChromaFormatIDC),
+			BitDepthLumaMinus8:              uint8(spss[0].BitDepthLumaMinus8),
+			BitDepthChromaMinus8:            uint8(spss[0].BitDepthChromaMinus8),
+			SequenceParameterSetExtNALUnits: spsExts,
+		}
+	}
+
+	spsLookup := func(id uint64) (SequenceParameterSet, bool) {
+		i, ok := spsIndex[id]
+		if !ok {
+			return SequenceParameterSet{}, false
+		}
+		return spss[i], true
+	}
+	ppsIndex := map[uint64]int{}
+	for _, b := range ppsNALUnits {
+		nal := NALUnit{}
+		if err := nal.UnmarshalBinary(b); err != nil {
+			return AVCDecoderConfigurationRecord{}, err
+		}
+		if nal.NALUnitType != NALUnitTypePictureParameterSet {
+			return AVCDecoderConfigurationRecord{}, errors.Errorf("not a picture parameter set: nal_unit_type=%d", nal.NALUnitType)
+		}
+		pps := PictureParameterSet{}
+		if err := pps.UnmarshalBinaryWithSPS(nal.RBSPByte, spsLookup); err != nil {
+			return AVCDecoderConfigurationRecord{}, errors.Wrap(err, "failed to unmarshal picture parameter set")
+		}
+		if i, ok := ppsIndex[pps.PictureParameterSetID]; ok {
+			m.PictureParameterSetNALUnits[i] = b
+			continue
+		}
+		ppsIndex[pps.PictureParameterSetID] = len(m.PictureParameterSetNALUnits)
+		m.PictureParameterSetNALUnits = append(m.PictureParameterSetNALUnits, b)
+	}
+
+	return m, nil
+}
+
+// profileCompatibility returns the byte between profile_idc and level_idc of
+// sps.
+func profileCompatibility(sps SequenceParameterSet) uint8 {
+	var b uint8
+	for i, flag := range []bool{
+		sps.ConstraintSet0Flag,
+		sps.ConstraintSet1Flag,
+		sps.ConstraintSet2Flag,
+		sps.ConstraintSet3Flag,
+		sps.ConstraintSet4Flag,
+		sps.ConstraintSet5Flag,
+	} {
+		if flag {
+			b |= 0x80 >> uint(i)
+		}
+	}
+	return b
+}
+
+// checkParameterSets returns an error when an SPS or PPS NAL unit of nals is
+// not one of the parameter sets of m, that is, the stream updates them.
+func (m AVCDecoderConfigurationRecord) checkParameterSets(nals []NALUnit) error {
+	for _, nal := range nals {
+		var raws [][]byte
+		switch nal.NALUnitType {
+		case NALUnitTypeSequenceParameterSet:
+			raws = m.SequenceParameterSetNALUnits
+		case NALUnitTypePictureParameterSet:
+			raws = m.PictureParameterSetNALUnits
+		default:
+			continue
+		}
+		b, err := nal.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, raw := range raws {
+			if bytes.Equal(raw, b) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Errorf("parameter set differs from the configuration record: nal_unit_type=%d", nal.NALUnitType)
+		}
+	}
+	return nil
 }
 
 func (m AVCDecoderConfigurationRecord) MarshalBinary() ([]byte, error) {
@@ -24,6 +186,12 @@ func (m AVCDecoderConfigurationRecord) MarshalBinary() ([]byte, error) {
 	for i := range m.PictureParameterSetNALUnits {
 		l += 2 + len(m.PictureParameterSetNALUnits[i])
 	}
+	if m.HighProfileExtension != nil {
+		l += 4
+		for i := range m.HighProfileExtension.SequenceParameterSetExtNALUnits {
+			l += 2 + len(m.HighProfileExtension.SequenceParameterSetExtNALUnits[i])
+		}
+	}
 
 	b := make([]byte, l)
 	b[0] = m.ConfigurationVersion
@@ -50,6 +218,20 @@ func (m AVCDecoderConfigurationRecord) MarshalBinary() ([]byte, error) {
 		ind += len(m.PictureParameterSetNALUnits[i])
 	}
 
+	if ext := m.HighProfileExtension; ext != nil {
+		b[ind] = 0xfc | ext.ChromaFormat
+		b[ind+1] = 0xf8 | ext.BitDepthLumaMinus8
+		b[ind+2] = 0xf8 | ext.BitDepthChromaMinus8
+		b[ind+3] = byte(len(ext.SequenceParameterSetExtNALUnits))
+		ind += 4
+		for i := range ext.SequenceParameterSetExtNALUnits {
+			binary.BigEndian.PutUint16(b[ind:ind+2], uint16(len(ext.SequenceParameterSetExtNALUnits[i])))
+			ind += 2
+			copy(b[ind:ind+len(ext.SequenceParameterSetExtNALUnits[i])], ext.SequenceParameterSetExtNALUnits[i])
+			ind += len(ext.SequenceParameterSetExtNALUnits[i])
+		}
+	}
+
 	return b, nil
 }
 
@@ -71,27 +253,72 @@ func (m *AVCDecoderConfigurationRecord) UnmarshalBinary(b []byte) error {
 	if numOfSequenceParameterSets > 0 {
 		m.SequenceParameterSetNALUnits = make([][]byte, numOfSequenceParameterSets)
 		for i := uint8(0); i < numOfSequenceParameterSets; i++ {
+			if len(b)-ind < 2 {
+				return errors.Errorf("invalid sequence parameter set length: index=%d", i)
+			}
 			l := int(binary.BigEndian.Uint16(b[ind : ind+2]))
 			ind += 2
-			m.SequenceParameterSetNALUnits[i] = make([]byte, l)
+			if len(b)-ind < l {
+				return errors.Errorf("invalid sequence parameter set length: index=%d, len=%d", i, l)
+			}
 			m.SequenceParameterSetNALUnits[i] = b[ind : ind+l]
 			ind += l
 		}
 	}
 
+	if ind == len(b) {
+		return errors.New("numOfPictureParameterSets is not found")
+	}
 	numOfPictureParameterSets := b[ind]
 	ind += 1
 
 	if numOfPictureParameterSets > 0 {
 		m.PictureParameterSetNALUnits = make([][]byte, numOfPictureParameterSets)
 		for i := uint8(0); i < numOfPictureParameterSets; i++ {
+			if len(b)-ind < 2 {
+				return errors.Errorf("invalid picture parameter set length: index=%d", i)
+			}
 			l := int(binary.BigEndian.Uint16(b[ind : ind+2]))
 			ind += 2
-			m.PictureParameterSetNALUnits[i] = make([]byte, l)
+			if len(b)-ind < l {
+				return errors.Errorf("invalid picture parameter set length: index=%d, len=%d", i, l)
+			}
 			m.PictureParameterSetNALUnits[i] = b[ind : ind+l]
 			ind += l
 		}
 	}
 
+	// Some writers omit the extension even for high profiles.
+	if !hasAVCDecoderConfigurationRecordHighProfileExtension(m.AVCProfileIndication) || ind == len(b) {
+		return nil
+	}
+	if len(b)-ind < 4 {
+		return errors.Errorf("invalid high profile extension length: len=%d", len(b)-ind)
+	}
+	ext := &AVCDecoderConfigurationRecordHighProfileExtension{
+		ChromaFormat:         b[ind] & 0x03,
+		BitDepthLumaMinus8:   b[ind+1] & 0x07,
+		BitDepthChromaMinus8: b[ind+2] & 0x07,
+	}
+	numOfSequenceParameterSetExt := b[ind+3]
+	ind += 4
+
+	if numOfSequenceParameterSetExt > 0 {
+		ext.SequenceParameterSetExtNALUnits = make([][]byte, numOfSequenceParameterSetExt)
+		for i := uint8(0); i < numOfSequenceParameterSetExt; i++ {
+			if len(b)-ind < 2 {
+				return errors.Errorf("invalid sequence parameter set ext length: index=%d", i)
+			}
+			l := int(binary.BigEndian.Uint16(b[ind : ind+2]))
+			ind += 2
+			if len(b)-ind < l {
+				return errors.Errorf("invalid sequence parameter set ext length: index=%d, len=%d", i, l)
+			}
+			ext.SequenceParameterSetExtNALUnits[i] = b[ind : ind+l]
+			ind += l
+		}
+	}
+	m.HighProfileExtension = ext
+
 	return nil
 }
@@ -44,6 +44,70 @@ var AVCDecoderConfigurationRecordTestData = []struct {
 			0x00, 0x04, 0x0b, 0x0c, 0x0d, 0x0e,
 		},
 	},
+	{
+		Name: "high profile with extension",
+		Struct: AVCDecoderConfigurationRecord{
+			ConfigurationVersion: 1,
+			AVCProfileIndication: 100,
+			ProfileCompatibility: 0,
+			AVCLevelIndication:   40,
+			LengthSizeMinusOne:   3,
+			SequenceParameterSetNALUnits: [][]byte{
+				{0x67, 0x64, 0x00, 0x28},
+			},
+			PictureParameterSetNALUnits: [][]byte{
+				{0x68, 0xee, 0x3c, 0xb0},
+			},
+			HighProfileExtension: &AVCDecoderConfigurationRecordHighProfileExtension{
+				ChromaFormat:         1,
+				BitDepthLumaMinus8:   2,
+				BitDepthChromaMinus8: 2,
+				SequenceParameterSetExtNALUnits: [][]byte{
+					{0x6d, 0x08},
+				},
+			},
+		},
+		Binary: []byte{
+			0x01, 0x64, 0x00, 0x28, 0xff,
+			// SequenceParameterSetNALUnits
+			0xe1,
+			0x00, 0x04, 0x67, 0x64, 0x00, 0x28,
+			// PictureParameterSetNALUnits
+			0x01,
+			0x00, 0x04, 0x68, 0xee, 0x3c, 0xb0,
+			// HighProfileExtension
+			0xfd, /* 0b11111100 | 1 */
+			0xfa, /* 0b11111000 | 2 */
+			0xfa, /* 0b11111000 | 2 */
+			0x01,
+			0x00, 0x02, 0x6d, 0x08,
+		},
+	},
+	{
+		Name: "high profile without extension",
+		Struct: AVCDecoderConfigurationRecord{
+			ConfigurationVersion: 1,
+			AVCProfileIndication: 100,
+			ProfileCompatibility: 0,
+			AVCLevelIndication:   40,
+			LengthSizeMinusOne:   3,
+			SequenceParameterSetNALUnits: [][]byte{
+				{0x67, 0x64, 0x00, 0x28},
+			},
+			PictureParameterSetNALUnits: [][]byte{
+				{0x68, 0xee, 0x3c, 0xb0},
+			},
+		},
+		Binary: []byte{
+			0x01, 0x64, 0x00, 0x28, 0xff,
+			// SequenceParameterSetNALUnits
+			0xe1,
+			0x00, 0x04, 0x67, 0x64, 0x00, 0x28,
+			// PictureParameterSetNALUnits
+			0x01,
+			0x00, 0x04, 0x68, 0xee, 0x3c, 0xb0,
+		},
+	},
 }
 
 func TestAVCDecoderConfigurationRecord_MarshalBinary(t *testing.T) {
@@ -65,4 +129,149 @@ func TestAVCDecoderConfigurationRecord_UnmarshalBinary(t *testing.T) {
 			assert.Equal(t, tt.Struct, s)
 		})
 	}
+
+	t.Run("truncated high profile extension", func(t *testing.T) {
+		s := AVCDecoderConfigurationRecord{}
+		err := s.UnmarshalBinary([]byte{
+			0x01, 0x64, 0x00, 0x28, 0xff,
+			0xe0,
+			0x00,
+			0xfd, 0xf8, 0xf8, 0x01,
+			0x00, 0x02, 0x6d,
+		})
+		assert.Error(t, err)
+	})
+
+	for _, tt := range []struct {
+		Name   string
+		Binary []byte
+	}{
+		{"truncated sequence parameter set", []byte{0x01, 0x42, 0xc0, 0x1e, 0xff, 0xe1, 0x00, 0x09, 0x67, 0x42}},
+		{"truncated picture parameter set", []byte{0x01, 0x42, 0xc0, 0x1e, 0xff, 0xe0, 0x01, 0x00}},
+		{"without numOfPictureParameterSets", []byte{0x01, 0x42, 0xc0, 0x1e, 0xff, 0xe1, 0x00, 0x01, 0x67}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := AVCDecoderConfigurationRecord{}
+			assert.Error(t, s.UnmarshalBinary(tt.Binary))
+		})
+	}
+}
+
+func mustMarshalParameterSetNALUnit(t *testing.T, nalUnitType uint8, ps interface {
+	MarshalBinary() ([]byte, error)
+}) []byte {
+	rbsp, err := ps.MarshalBinary()
+	require.NoError(t, err)
+	b, err := NALUnit{NALRefIDC: 3, NALUnitType: nalUnitType, RBSPByte: rbsp}.MarshalBinary()
+	require.NoError(t, err)
+	return b
+}
+
+func TestNewAVCDecoderConfigurationRecord(t *testing.T) {
+	baselineSPS := SequenceParameterSet{
+		ProfileIDC:                66,
+		ConstraintSet0Flag:        true,
+		ConstraintSet1Flag:        true,
+		LevelIDC:                  30,
+		PicOrderCntType:           2,
+		MaxNumRefFrames:           1,
+		PicWidthInMbsMinus1:       39,
+		PicHeightInMapUnitsMinus1: 29,
+		FrameMbsOnlyFlag:          true,
+	}
+	highSPS := SequenceParameterSet{
+		ProfileIDC:                  100,
+		LevelIDC:                    40,
+		ChromaFormatIDC:             1,
+		BitDepthLumaMinus8:          2,
+		BitDepthChromaMinus8:        2,
+		Log2MaxPicOrderCntLsbMinus4: 2,
+		MaxNumRefFrames:             4,
+		PicWidthInMbsMinus1:         119,
+		PicHeightInMapUnitsMinus1:   67,
+		FrameMbsOnlyFlag:            true,
+	}
+
+	t.Run("baseline profile", func(t *testing.T) {
+		sps0 := mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, baselineSPS)
+		sps1 := baselineSPS
+		sps1.SequenceParamterSetID = 1
+		sps1.ConstraintSet0Flag = false
+		sps1.LevelIDC = 31
+		sps1NAL := mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, sps1)
+		pps0 := mustMarshalParameterSetNALUnit(t, NALUnitTypePictureParameterSet, PictureParameterSet{})
+		pps0Updated := mustMarshalParameterSetNALUnit(t, NALUnitTypePictureParameterSet, PictureParameterSet{PicInitQPMinus26: -2})
+		pps1 := mustMarshalParameterSetNALUnit(t, NALUnitTypePictureParameterSet, PictureParameterSet{PictureParameterSetID: 1, SequenceParameterSetID: 1})
+
+		record, err := NewAVCDecoderConfigurationRecord(
+			[][]byte{sps0, sps1NAL, sps0},
+			[][]byte{pps0, pps1, pps0Updated},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, AVCDecoderConfigurationRecord{
+			ConfigurationVersion:         1,
+			AVCProfileIndication:         66,
+			ProfileCompatibility:         0x40,
+			AVCLevelIndication:           31,
+			LengthSizeMinusOne:           3,
+			SequenceParameterSetNALUnits: [][]byte{sps0, sps1NAL},
+			PictureParameterSetNALUnits:  [][]byte{pps0Updated, pps1},
+		}, record)
+	})
+
+	t.Run("high profile", func(t *testing.T) {
+		sps := mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, highSPS)
+		spsExt := []byte{0x6d, 0x08}
+		pps := mustMarshalParameterSetNALUnit(t, NALUnitTypePictureParameterSet, PictureParameterSet{})
+
+		record, err := NewAVCDecoderConfigurationRecord([][]byte{sps, spsExt}, [][]byte{pps})
+		require.NoError(t, err)
+		assert.Equal(t, AVCDecoderConfigurationRecord{
+			ConfigurationVersion:         1,
+			AVCProfileIndication:         100,
+			ProfileCompatibility:         0x00,
+			AVCLevelIndication:           40,
+			LengthSizeMinusOne:           3,
+			SequenceParameterSetNALUnits: [][]byte{sps},
+			PictureParameterSetNALUnits:  [][]byte{pps},
+			HighProfileExtension: &AVCDecoderConfigurationRecordHighProfileExtension{
+				ChromaFormat:                    1,
+				BitDepthLumaMinus8:              2,
+				BitDepthChromaMinus8:            2,
+				SequenceParameterSetExtNALUnits: [][]byte{spsExt},
+			},
+		}, record)
+	})
+
+	t.Run("profile mismatch", func(t *testing.T) {
+		sps1 := highSPS
+		sps1.SequenceParamterSetID = 1
+		_, err := NewAVCDecoderConfigurationRecord([][]byte{
+			mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, baselineSPS),
+			mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, sps1),
+		}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("sequence parameter set is not found", func(t *testing.T) {
+		_, err := NewAVCDecoderConfigurationRecord(nil, nil)
+		assert.Error(t, err)
+
+		_, err = NewAVCDecoderConfigurationRecord(
+			[][]byte{mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, baselineSPS)},
+			[][]byte{mustMarshalParameterSetNALUnit(t, NALUnitTypePictureParameterSet, PictureParameterSet{SequenceParameterSetID: 1})},
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid nal_unit_type", func(t *testing.T) {
+		_, err := NewAVCDecoderConfigurationRecord([][]byte{{0x65, 0x88, 0x84}}, nil)
+		assert.Error(t, err)
+
+		_, err = NewAVCDecoderConfigurationRecord(
+			[][]byte{mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, baselineSPS)},
+			[][]byte{{0x65, 0x88, 0x84}},
+		)
+		assert.Error(t, err)
+	})
 }
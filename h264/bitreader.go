@@ -1,6 +1,9 @@
 package h264
 
-import "io"
+import (
+	"io"
+	"math/bits"
+)
 
 type bitReader struct {
 	buf []byte
@@ -57,3 +60,39 @@ func (r *bitReader) ReadBytes(n int) ([]byte, error) {
 	}
 	return bb, nil
 }
+
+func (r *bitReader) ReadBits(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		b, err := r.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		v <<= 1
+		if b {
+			v |= 1
+		}
+	}
+	return v, nil
+}
+
+// MoreRBSPData reports whether any syntax element remains before the
+// rbsp_stop_one_bit, as more_rbsp_data() in 7.2.
+func (r *bitReader) MoreRBSPData() bool {
+	for i := len(r.buf) - 1; i >= 0; i-- {
+		if r.buf[i] == 0 {
+			continue
+		}
+		stopBit := i*8 + 7 - bits.TrailingZeros8(r.buf[i])
+		return r.n < stopBit
+	}
+	return false
+}
+
+func (r *bitReader) ByteAligned() bool {
+	return r.n%8 == 0
+}
+
+func (r *bitReader) BitOffset() int {
+	return r.n
+}
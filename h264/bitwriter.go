@@ -92,3 +92,17 @@ func (w *bitWriter) Bytes() []byte {
 func (w *bitWriter) BitLen() int {
 	return w.n
 }
+
+func (w *bitWriter) WriteBits(v uint64, n int) (writtenBit int, err error) {
+	for i := n - 1; i >= 0; i-- {
+		if _, err := w.WriteBit(v>>uint(i)&1 == 1); err != nil {
+			return writtenBit, err
+		}
+		writtenBit++
+	}
+	return writtenBit, nil
+}
+
+func (w *bitWriter) ByteAligned() bool {
+	return w.n%8 == 0
+}
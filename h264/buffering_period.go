@@ -0,0 +1,146 @@
+package h264
+
+import "github.com/pkg/errors"
+
+// BufferingPeriod is buffering_period(), the SEI payload whose payloadType
+// is 0. Delays are indexed by SchedSelIdx.
+type BufferingPeriod struct {
+	SequenceParameterSetID          uint64
+	NalInitialCPBRemovalDelay       []uint64
+	NalInitialCPBRemovalDelayOffset []uint64
+	VclInitialCPBRemovalDelay       []uint64
+	VclInitialCPBRemovalDelayOffset []uint64
+}
+
+func NewBufferingPeriodDecoder(lookup SequenceParameterSetLookup) SEIPayloadDecoder {
+	return func(payload []byte) (interface{}, error) {
+		m := BufferingPeriod{}
+		if err := m.UnmarshalBinaryWithSPS(payload, lookup); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+func (m BufferingPeriod) MarshalBinaryWithSPS(sps SequenceParameterSet) ([]byte, error) {
+	vui, _ := sps.VUI()
+
+	w := newBitWriter()
+
+	if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.SequenceParameterSetID)); err != nil {
+		return nil, err
+	}
+	if err := checkBufferingPeriodHRD(vui); err != nil {
+		return nil, err
+	}
+	if vui.NalHrdParametersPresentFlag {
+		if err := writeInitialCPBRemovalDelays(w, *vui.HrdNal, m.NalInitialCPBRemovalDelay, m.NalInitialCPBRemovalDelayOffset); err != nil {
+			return nil, err
+		}
+	}
+	if vui.VclHrdParametersPresentFlag {
+		if err := writeInitialCPBRemovalDelays(w, *vui.HrdVcl, m.VclInitialCPBRemovalDelay, m.VclInitialCPBRemovalDelayOffset); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeSEIPayloadAlignment(w); err != nil {
+		return nil, err
+	}
+
+	return w.Bytes(), nil
+}
+
+func (m *BufferingPeriod) UnmarshalBinaryWithSPS(b []byte, lookup SequenceParameterSetLookup) error {
+	r := newBitReader(b)
+
+	g, err := readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.SequenceParameterSetID = GolombCodeNumToUint64(g)
+	sps, ok := lookup(m.SequenceParameterSetID)
+	if !ok {
+		return errors.Errorf("sequence parameter set is not found: id=%d", m.SequenceParameterSetID)
+	}
+	vui, _ := sps.VUI()
+	if err := checkBufferingPeriodHRD(vui); err != nil {
+		return err
+	}
+
+	if vui.NalHrdParametersPresentFlag {
+		m.NalInitialCPBRemovalDelay, m.NalInitialCPBRemovalDelayOffset, err = readInitialCPBRemovalDelays(r, *vui.HrdNal)
+		if err != nil {
+			return err
+		}
+	}
+	if vui.VclHrdParametersPresentFlag {
+		m.VclInitialCPBRemovalDelay, m.VclInitialCPBRemovalDelayOffset, err = readInitialCPBRemovalDelays(r, *vui.HrdVcl)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBufferingPeriodHRD checks the HRD parameters of the present flags,
+// which may be missing in a VUI built in code.
+func checkBufferingPeriodHRD(vui VideoUsabilityInformation) error {
+	if vui.NalHrdParametersPresentFlag && vui.HrdNal == nil {
+		return errors.New("NAL HRD parameters are not found")
+	}
+	if vui.VclHrdParametersPresentFlag && vui.HrdVcl == nil {
+		return errors.New("VCL HRD parameters are not found")
+	}
+	return nil
+}
+
+func writeInitialCPBRemovalDelays(w *bitWriter, hrd HypotheticalReferenceDecoder, delays, offsets []uint64) error {
+	if len(delays) != int(hrd.CPBCntMinus1)+1 || len(offsets) != int(hrd.CPBCntMinus1)+1 {
+		return errors.Errorf("invalid initial_cpb_removal_delay count: cpb_cnt_minus1=%d, len=%d", hrd.CPBCntMinus1, len(delays))
+	}
+	v := int(hrd.InitialCPBRemovalDelayLengthMinus1) + 1
+	for i := range delays {
+		if _, err := w.WriteBits(delays[i], v); err != nil {
+			return err
+		}
+		if _, err := w.WriteBits(offsets[i], v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readInitialCPBRemovalDelays(r *bitReader, hrd HypotheticalReferenceDecoder) (delays, offsets []uint64, err error) {
+	v := int(hrd.InitialCPBRemovalDelayLengthMinus1) + 1
+	delays = make([]uint64, hrd.CPBCntMinus1+1)
+	offsets = make([]uint64, hrd.CPBCntMinus1+1)
+	for i := range delays {
+		delays[i], err = r.ReadBits(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		offsets[i], err = r.ReadBits(v)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return delays, offsets, nil
+}
+
+// writeSEIPayloadAlignment writes bit_equal_to_one and bit_equal_to_zero
+// until the payload is byte aligned.
+func writeSEIPayloadAlignment(w *bitWriter) error {
+	if w.ByteAligned() {
+		return nil
+	}
+	if _, err := w.WriteBit(BitOne); err != nil {
+		return err
+	}
+	for !w.ByteAligned() {
+		if _, err := w.WriteBit(BitZero); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var bufferingPeriodTestSPS = SequenceParameterSet{
+	VUIParametersPresentFlag: true,
+	VUIs: []VideoUsabilityInformation{
+		{
+			NalHrdParametersPresentFlag: true,
+			HrdNal: &HypotheticalReferenceDecoder{
+				CPBCntMinus1:                       1,
+				InitialCPBRemovalDelayLengthMinus1: 3,
+			},
+			VclHrdParametersPresentFlag: true,
+			HrdVcl: &HypotheticalReferenceDecoder{
+				InitialCPBRemovalDelayLengthMinus1: 7,
+			},
+		},
+	},
+}
+
+var BufferingPeriodTestData = []struct {
+	Name   string
+	SPS    SequenceParameterSet
+	Struct BufferingPeriod
+	Binary []byte
+}{
+	{
+		Name: "without HRD",
+		SPS: SequenceParameterSet{
+			SequenceParamterSetID: 1,
+		},
+		Struct: BufferingPeriod{
+			SequenceParameterSetID: 1,
+		},
+		Binary: mustBitToBytes(
+			o, l, o, // SequenceParameterSetID
+			l, o, o, o, o, // alignment
+		),
+	},
+	{
+		Name: "NAL and VCL HRD",
+		SPS:  bufferingPeriodTestSPS,
+		Struct: BufferingPeriod{
+			NalInitialCPBRemovalDelay:       []uint64{1, 2},
+			NalInitialCPBRemovalDelayOffset: []uint64{3, 4},
+			VclInitialCPBRemovalDelay:       []uint64{0xab},
+			VclInitialCPBRemovalDelayOffset: []uint64{0xcd},
+		},
+		Binary: mustBitToBytes(
+			l,          // SequenceParameterSetID
+			o, o, o, l, // NalInitialCPBRemovalDelay[0]
+			o, o, l, l, // NalInitialCPBRemovalDelayOffset[0]
+			o, o, l, o, // NalInitialCPBRemovalDelay[1]
+			o, l, o, o, // NalInitialCPBRemovalDelayOffset[1]
+			l, o, l, o, l, o, l, l, // VclInitialCPBRemovalDelay[0]
+			l, l, o, o, l, l, o, l, // VclInitialCPBRemovalDelayOffset[0]
+			l, o, o, o, o, o, o, // alignment
+		),
+	},
+}
+
+func TestBufferingPeriod_MarshalBinaryWithSPS(t *testing.T) {
+	for _, tt := range BufferingPeriodTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := tt.Struct.MarshalBinaryWithSPS(tt.SPS)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+
+	t.Run("mismatched CPB count", func(t *testing.T) {
+		_, err := BufferingPeriod{
+			NalInitialCPBRemovalDelay:       []uint64{1},
+			NalInitialCPBRemovalDelayOffset: []uint64{3},
+		}.MarshalBinaryWithSPS(bufferingPeriodTestSPS)
+		assert.Error(t, err)
+	})
+}
+
+func TestBufferingPeriod_UnmarshalBinaryWithSPS(t *testing.T) {
+	for _, tt := range BufferingPeriodTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := BufferingPeriod{}
+			err := s.UnmarshalBinaryWithSPS(tt.Binary, func(id uint64) (SequenceParameterSet, bool) {
+				return tt.SPS, id == tt.SPS.SequenceParamterSetID
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+
+	t.Run("SPS is not found", func(t *testing.T) {
+		s := BufferingPeriod{}
+		err := s.UnmarshalBinaryWithSPS([]byte{0x80}, func(id uint64) (SequenceParameterSet, bool) {
+			return SequenceParameterSet{}, false
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestNewBufferingPeriodDecoder(t *testing.T) {
+	r := SEIPayloadRegistry{}
+	r.Register(SEIPayloadTypeBufferingPeriod, NewBufferingPeriodDecoder(func(id uint64) (SequenceParameterSet, bool) {
+		return bufferingPeriodTestSPS, true
+	}))
+
+	v, err := r.Decode(SEIMessage{
+		PayloadType: SEIPayloadTypeBufferingPeriod,
+		PayloadByte: BufferingPeriodTestData[1].Binary,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, BufferingPeriodTestData[1].Struct, v)
+}
+
+func TestBufferingPeriod_withoutHRDPointer(t *testing.T) {
+	for _, vui := range []VideoUsabilityInformation{
+		{NalHrdParametersPresentFlag: true},
+		{VclHrdParametersPresentFlag: true},
+	} {
+		sps := SequenceParameterSet{
+			VUIParametersPresentFlag: true,
+			VUIs:                     []VideoUsabilityInformation{vui},
+		}
+		_, err := BufferingPeriod{}.MarshalBinaryWithSPS(sps)
+		assert.Error(t, err)
+		s := BufferingPeriod{}
+		assert.Error(t, s.UnmarshalBinaryWithSPS([]byte{0xff, 0xff}, func(id uint64) (SequenceParameterSet, bool) {
+			return sps, true
+		}))
+	}
+}
@@ -0,0 +1,189 @@
+package h264
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+// ebmlUnknownSize is the element data size of all bits set to one, which
+// means the size is unknown.
+const ebmlUnknownSize = math.MaxUint64
+
+const (
+	ebmlIDHeader             = 0x1a45dfa3
+	ebmlIDVersion            = 0x4286
+	ebmlIDReadVersion        = 0x42f7
+	ebmlIDMaxIDLength        = 0x42f2
+	ebmlIDMaxSizeLength      = 0x42f3
+	ebmlIDDocType            = 0x4282
+	ebmlIDDocTypeVersion     = 0x4287
+	ebmlIDDocTypeReadVersion = 0x4285
+)
+
+// ebmlElement is an element of EBML (RFC 8794) with the data left unparsed.
+type ebmlElement struct {
+	ID   uint32
+	Data []byte
+}
+
+// decodeEBMLVint decodes the variable-size integer at the beginning of b,
+// which is at most maxLen bytes. The length marker is kept for element IDs.
+// The data size of all bits set to one is returned as ebmlUnknownSize.
+func decodeEBMLVint(b []byte, maxLen int, keepMarker bool) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	n := bits.LeadingZeros8(b[0]) + 1
+	if n > maxLen {
+		return 0, 0, errors.Errorf("invalid EBML variable-size integer: first=%#02x", b[0])
+	}
+	if len(b) < n {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= 0xff >> n
+	}
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	if !keepMarker && v == 1<<(7*n)-1 {
+		return ebmlUnknownSize, n, nil
+	}
+	return v, n, nil
+}
+
+// appendEBMLSize appends the data size v in the shortest form.
+func appendEBMLSize(b []byte, v uint64) []byte {
+	if v == ebmlUnknownSize {
+		return append(b, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	}
+	n := 1
+	// all bits set to one are reserved for unknown sizes
+	for n < 8 && v >= 1<<(7*n)-1 {
+		n++
+	}
+	v |= 1 << (7 * n)
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
+
+// appendEBMLID appends the element ID, which includes its length marker.
+func appendEBMLID(b []byte, id uint32) []byte {
+	n := (bits.Len32(id) + 7) / 8
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(id>>(8*i)))
+	}
+	return b
+}
+
+// appendEBMLElement appends an element of id containing payloads.
+func appendEBMLElement(b []byte, id uint32, payloads ...[]byte) []byte {
+	size := 0
+	for _, p := range payloads {
+		size += len(p)
+	}
+	b = appendEBMLID(b, id)
+	b = appendEBMLSize(b, uint64(size))
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// appendEBMLUint appends an unsigned integer element in the shortest form.
+func appendEBMLUint(b []byte, id uint32, v uint64) []byte {
+	n := (bits.Len64(v) + 7) / 8
+	if n == 0 {
+		n = 1
+	}
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(v >> (8 * (n - 1 - i)))
+	}
+	return appendEBMLElement(b, id, p)
+}
+
+// ebmlUint returns the value of an unsigned integer element.
+func ebmlUint(data []byte) (uint64, error) {
+	if len(data) > 8 {
+		return 0, errors.Errorf("invalid EBML unsigned integer length: len=%d", len(data))
+	}
+	v := uint64(0)
+	for _, c := range data {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// splitEBMLElements splits b into elements. The data refers to b.
+func splitEBMLElements(b []byte) ([]ebmlElement, error) {
+	var elements []ebmlElement
+	for len(b) > 0 {
+		id, n, err := decodeEBMLVint(b, 4, true)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read EBML element ID")
+		}
+		size, m, err := decodeEBMLVint(b[n:], 8, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read EBML element size: id=%#x", id)
+		}
+		b = b[n+m:]
+		if size == ebmlUnknownSize {
+			size = uint64(len(b))
+		}
+		if size > uint64(len(b)) {
+			return nil, errors.Errorf("invalid EBML element size: id=%#x, size=%d, len=%d", id, size, len(b))
+		}
+		elements = append(elements, ebmlElement{ID: uint32(id), Data: b[:size]})
+		b = b[size:]
+	}
+	return elements, nil
+}
+
+// readEBMLElementHeader reads the ID and the data size of the next element.
+// It returns io.EOF at the end of r.
+func readEBMLElementHeader(r *bufio.Reader) (uint32, uint64, error) {
+	if _, err := r.Peek(1); err != nil {
+		return 0, 0, err
+	}
+	// the longest header of a 4 bytes ID and a 8 bytes size, which may be
+	// cut at the end of r
+	b, _ := r.Peek(12)
+	id, n, err := decodeEBMLVint(b, 4, true)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "failed to read EBML element ID")
+	}
+	size, m, err := decodeEBMLVint(b[n:], 8, false)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to read EBML element size: id=%#x", id)
+	}
+	if _, err := r.Discard(n + m); err != nil {
+		return 0, 0, err
+	}
+	return uint32(id), size, nil
+}
+
+// readEBMLElementData reads the data of size. The buffer grows while
+// reading so that a corrupted size does not allocate at once.
+func readEBMLElementData(r io.Reader, id uint32, size uint64) ([]byte, error) {
+	if size == ebmlUnknownSize {
+		return nil, errors.Errorf("unknown-sized element is not supported: id=%#x", id)
+	}
+	buf := &bytes.Buffer{}
+	n, err := io.Copy(buf, io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) < size {
+		return nil, errors.Errorf("truncated EBML element: id=%#x, size=%d, len=%d", id, size, n)
+	}
+	return buf.Bytes(), nil
+}
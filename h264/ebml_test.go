@@ -0,0 +1,114 @@
+package h264
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var EBMLSizeTestData = []struct {
+	Name   string
+	Value  uint64
+	Binary []byte
+}{
+	{"1 byte", 1, []byte{0x81}},
+	{"1 byte max", 126, []byte{0xfe}},
+	{"2 bytes for reserved 1 byte", 127, []byte{0x40, 0x7f}},
+	{"2 bytes", 0x3ffe, []byte{0x7f, 0xfe}},
+	{"3 bytes", 0x4000, []byte{0x20, 0x40, 0x00}},
+	{"unknown", ebmlUnknownSize, []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+}
+
+func TestAppendEBMLSize(t *testing.T) {
+	for _, tt := range EBMLSizeTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Binary, appendEBMLSize(nil, tt.Value))
+		})
+	}
+}
+
+func TestDecodeEBMLVint(t *testing.T) {
+	for _, tt := range EBMLSizeTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			v, n, err := decodeEBMLVint(tt.Binary, 8, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Value, v)
+			assert.Equal(t, len(tt.Binary), n)
+		})
+	}
+
+	t.Run("unknown size of 1 byte", func(t *testing.T) {
+		v, _, err := decodeEBMLVint([]byte{0xff}, 8, false)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(ebmlUnknownSize), v)
+	})
+
+	t.Run("ID with marker", func(t *testing.T) {
+		v, n, err := decodeEBMLVint([]byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f}, 4, true)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(ebmlIDHeader), v)
+		assert.Equal(t, 4, n)
+	})
+
+	t.Run("too long", func(t *testing.T) {
+		_, _, err := decodeEBMLVint([]byte{0x08, 0x00, 0x00, 0x00, 0x00}, 4, true)
+		assert.Error(t, err)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, _, err := decodeEBMLVint([]byte{0x40}, 8, false)
+		assert.Error(t, err)
+	})
+}
+
+func TestAppendEBMLUint(t *testing.T) {
+	assert.Equal(t, []byte{0xd7, 0x81, 0x00}, appendEBMLUint(nil, matroskaIDTrackNumber, 0))
+	assert.Equal(t, []byte{0x2a, 0xd7, 0xb1, 0x83, 0x0f, 0x42, 0x40}, appendEBMLUint(nil, matroskaIDTimestampScale, 1000000))
+}
+
+func TestSplitEBMLElements(t *testing.T) {
+	elements, err := splitEBMLElements([]byte{
+		0xd7, 0x81, 0x01,
+		0x86, 0x82, 'V', '_',
+		// unknown size extends to the end
+		0xe0, 0xff, 0xb0, 0x81, 0x10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []ebmlElement{
+		{ID: matroskaIDTrackNumber, Data: []byte{0x01}},
+		{ID: matroskaIDCodecID, Data: []byte("V_")},
+		{ID: matroskaIDVideo, Data: []byte{0xb0, 0x81, 0x10}},
+	}, elements)
+
+	_, err = splitEBMLElements([]byte{0xd7, 0x82, 0x01})
+	assert.Error(t, err)
+}
+
+func TestReadEBMLElementHeader(t *testing.T) {
+	r := bufio.NewReader(bytes.NewReader([]byte{
+		0x18, 0x53, 0x80, 0x67, 0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0xe7, 0x81, 0x00,
+	}))
+	id, size, err := readEBMLElementHeader(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(matroskaIDSegment), id)
+	assert.Equal(t, uint64(ebmlUnknownSize), size)
+
+	id, size, err = readEBMLElementHeader(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(matroskaIDTimestamp), id)
+	assert.Equal(t, uint64(1), size)
+	data, err := readEBMLElementData(r, id, size)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00}, data)
+
+	_, _, err = readEBMLElementHeader(r)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = readEBMLElementData(bytes.NewReader([]byte{0x00}), matroskaIDBlock, 2)
+	assert.Error(t, err)
+}
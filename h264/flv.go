@@ -0,0 +1,178 @@
+package h264
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FLVTagTypeAudio      = 8
+	FLVTagTypeVideo      = 9
+	FLVTagTypeScriptData = 18
+)
+
+const (
+	FLVTypeFlagsVideo = 0x01
+	FLVTypeFlagsAudio = 0x04
+)
+
+const (
+	flvHeaderSize    = 9
+	flvTagHeaderSize = 11
+)
+
+// FLVTag is a tag of an FLV file.
+type FLVTag struct {
+	TagType uint8
+	// Timestamp is in milliseconds including TimestampExtended.
+	Timestamp uint32
+	Data      []byte
+}
+
+// FLVReader reads tags of an FLV file.
+type FLVReader struct {
+	// TypeFlags is TypeFlagsAudio and TypeFlagsVideo of the header, which is
+	// set by the first read.
+	TypeFlags uint8
+
+	r       io.Reader
+	started bool
+}
+
+func NewFLVReader(r io.Reader) *FLVReader {
+	return &FLVReader{r: r}
+}
+
+func (r *FLVReader) readHeader() error {
+	b := make([]byte, flvHeaderSize)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return errors.Wrap(err, "failed to read FLV header")
+	}
+	if string(b[0:3]) != "FLV" {
+		return errors.Errorf("invalid FLV signature: %q", b[0:3])
+	}
+	r.TypeFlags = b[4] & (FLVTypeFlagsAudio | FLVTypeFlagsVideo)
+	dataOffset := binary.BigEndian.Uint32(b[5:9])
+	if dataOffset < flvHeaderSize {
+		return errors.Errorf("invalid FLV header size: %d", dataOffset)
+	}
+	// the rest of the header and PreviousTagSize0
+	if _, err := io.CopyN(io.Discard, r.r, int64(dataOffset-flvHeaderSize)+4); err != nil {
+		return errors.Wrap(err, "failed to read FLV header")
+	}
+	r.started = true
+	return nil
+}
+
+// ReadTag returns the next tag. It returns io.EOF at the end of the file.
+func (r *FLVReader) ReadTag() (FLVTag, error) {
+	if !r.started {
+		if err := r.readHeader(); err != nil {
+			return FLVTag{}, err
+		}
+	}
+	h := make([]byte, flvTagHeaderSize)
+	if _, err := io.ReadFull(r.r, h); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return FLVTag{}, errors.New("truncated FLV tag header")
+		}
+		return FLVTag{}, err
+	}
+	if h[0]&0x20 != 0 {
+		return FLVTag{}, errors.New("encrypted FLV tags are not supported")
+	}
+	dataSize := uint32(h[1])<<16 | uint32(h[2])<<8 | uint32(h[3])
+	tag := FLVTag{
+		TagType:   h[0] & 0x1f,
+		Timestamp: uint32(h[7])<<24 | uint32(h[4])<<16 | uint32(h[5])<<8 | uint32(h[6]),
+		Data:      make([]byte, dataSize),
+	}
+	if _, err := io.ReadFull(r.r, tag.Data); err != nil {
+		return FLVTag{}, errors.Wrapf(err, "failed to read FLV tag data: size=%d", dataSize)
+	}
+	// PreviousTagSize is not checked since some writers set it wrongly.
+	if _, err := io.ReadFull(r.r, h[:4]); err != nil {
+		return FLVTag{}, errors.Wrap(err, "failed to read PreviousTagSize")
+	}
+	return tag, nil
+}
+
+// ReadVideoTag returns the timestamp and the next video tag skipping other
+// tags. It returns io.EOF at the end of the file.
+func (r *FLVReader) ReadVideoTag() (uint32, FLVVideoTag, error) {
+	for {
+		tag, err := r.ReadTag()
+		if err != nil {
+			return 0, FLVVideoTag{}, err
+		}
+		if tag.TagType != FLVTagTypeVideo {
+			continue
+		}
+		v := FLVVideoTag{}
+		if err := v.UnmarshalBinary(tag.Data); err != nil {
+			return 0, FLVVideoTag{}, errors.Wrapf(err, "failed to unmarshal video tag: timestamp=%d", tag.Timestamp)
+		}
+		return tag.Timestamp, v, nil
+	}
+}
+
+// FLVWriter writes tags into an FLV file. The header is written before the
+// first tag.
+type FLVWriter struct {
+	// TypeFlags is TypeFlagsAudio and TypeFlagsVideo of the header.
+	TypeFlags uint8
+
+	w       io.Writer
+	started bool
+}
+
+func NewFLVWriter(w io.Writer) *FLVWriter {
+	return &FLVWriter{
+		TypeFlags: FLVTypeFlagsVideo,
+		w:         w,
+	}
+}
+
+// WriteTag writes tag followed by its PreviousTagSize.
+func (w *FLVWriter) WriteTag(tag FLVTag) error {
+	if tag.TagType > 0x1f {
+		return errors.Errorf("invalid tag type: %d", tag.TagType)
+	}
+	if len(tag.Data) >= 1<<24 {
+		return errors.Errorf("tag data is too large: len=%d", len(tag.Data))
+	}
+	var b []byte
+	if !w.started {
+		b = append(b, 'F', 'L', 'V', 0x01, w.TypeFlags)
+		b = binary.BigEndian.AppendUint32(b, flvHeaderSize)
+		// PreviousTagSize0
+		b = binary.BigEndian.AppendUint32(b, 0)
+		w.started = true
+	}
+	b = append(b,
+		tag.TagType,
+		byte(len(tag.Data)>>16), byte(len(tag.Data)>>8), byte(len(tag.Data)),
+		byte(tag.Timestamp>>16), byte(tag.Timestamp>>8), byte(tag.Timestamp),
+		byte(tag.Timestamp>>24),
+		0x00, 0x00, 0x00, // StreamID
+	)
+	b = append(b, tag.Data...)
+	b = binary.BigEndian.AppendUint32(b, uint32(flvTagHeaderSize+len(tag.Data)))
+	_, err := w.w.Write(b)
+	return err
+}
+
+// WriteVideoTag writes v as a video tag at timestamp in milliseconds.
+func (w *FLVWriter) WriteVideoTag(timestamp uint32, v FLVVideoTag) error {
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.WriteTag(FLVTag{
+		TagType:   FLVTagTypeVideo,
+		Timestamp: timestamp,
+		Data:      b,
+	})
+}
@@ -0,0 +1,82 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFLVWriter_WriteTag(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewFLVWriter(buf)
+	require.NoError(t, w.WriteTag(FLVTag{TagType: FLVTagTypeScriptData, Timestamp: 0, Data: []byte{0x02, 0x00}}))
+	require.NoError(t, w.WriteVideoTag(0x01020304, NewFLVAVCEndOfSequenceTag()))
+
+	assert.Equal(t, []byte{
+		'F', 'L', 'V', 0x01, 0x01, 0x00, 0x00, 0x00, 0x09,
+		0x00, 0x00, 0x00, 0x00,
+		// script data
+		0x12, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x02, 0x00,
+		0x00, 0x00, 0x00, 0x0d,
+		// video with TimestampExtended
+		0x09, 0x00, 0x00, 0x05, 0x02, 0x03, 0x04, 0x01, 0x00, 0x00, 0x00,
+		0x17, 0x02, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x10,
+	}, buf.Bytes())
+}
+
+func TestFLVReader_ReadVideoTag(t *testing.T) {
+	sequenceHeader, err := NewFLVAVCSequenceHeaderTag(mp4AVCSampleEntryTestConfig)
+	require.NoError(t, err)
+	nalu, err := NewFLVAVCNALUTag([]NALUnit{
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}},
+	}, 4, -33)
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	w := NewFLVWriter(buf)
+	w.TypeFlags = FLVTypeFlagsAudio | FLVTypeFlagsVideo
+	require.NoError(t, w.WriteVideoTag(0, sequenceHeader))
+	require.NoError(t, w.WriteTag(FLVTag{TagType: FLVTagTypeAudio, Timestamp: 10, Data: []byte{0xaf, 0x01}}))
+	require.NoError(t, w.WriteVideoTag(1<<24+33, nalu))
+
+	r := NewFLVReader(buf)
+	timestamp, tag, err := r.ReadVideoTag()
+	require.NoError(t, err)
+	assert.Equal(t, uint8(FLVTypeFlagsAudio|FLVTypeFlagsVideo), r.TypeFlags)
+	assert.Equal(t, uint32(0), timestamp)
+	assert.Equal(t, sequenceHeader, tag)
+
+	timestamp, tag, err = r.ReadVideoTag()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1<<24+33), timestamp)
+	assert.Equal(t, nalu, tag)
+
+	_, _, err = r.ReadVideoTag()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFLVReader_ReadTag_Error(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Binary []byte
+	}{
+		{"invalid signature", []byte{'F', 'L', 'X', 0x01, 0x01, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00}},
+		{"truncated header", []byte{'F', 'L', 'V', 0x01}},
+		{"truncated tag header", []byte{'F', 'L', 'V', 0x01, 0x01, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00, 0x09, 0x00}},
+		{"truncated tag data", []byte{
+			'F', 'L', 'V', 0x01, 0x01, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00,
+			0x09, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x17,
+		}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := NewFLVReader(bytes.NewReader(tt.Binary)).ReadTag()
+			assert.Error(t, err)
+			assert.NotEqual(t, io.EOF, err)
+		})
+	}
+}
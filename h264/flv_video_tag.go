@@ -0,0 +1,163 @@
+package h264
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	FLVFrameTypeKeyFrame             = 1
+	FLVFrameTypeInterFrame           = 2
+	FLVFrameTypeDisposableInterFrame = 3
+	FLVFrameTypeGeneratedKeyFrame    = 4
+	FLVFrameTypeVideoInfoFrame       = 5
+)
+
+const (
+	FLVCodecIDAVC = 7
+)
+
+const (
+	FLVAVCPacketTypeSequenceHeader = 0
+	FLVAVCPacketTypeNALU           = 1
+	FLVAVCPacketTypeEndOfSequence  = 2
+)
+
+// FLVVideoTag is VIDEODATA of FLV tags and RTMP video messages with the
+// AVCVIDEOPACKET of CodecID 7.
+type FLVVideoTag struct {
+	FrameType     uint8
+	CodecID       uint8
+	AVCPacketType uint8
+	// CompositionTime is the offset of the presentation time from the tag
+	// timestamp in milliseconds, which is SI24.
+	CompositionTime int32
+	// Data is an AVCDecoderConfigurationRecord for sequence headers and
+	// length-prefixed NAL units for NALU packets.
+	Data []byte
+}
+
+// NewFLVAVCSequenceHeaderTag returns the sequence header tag of record.
+func NewFLVAVCSequenceHeaderTag(record AVCDecoderConfigurationRecord) (FLVVideoTag, error) {
+	b, err := record.MarshalBinary()
+	if err != nil {
+		return FLVVideoTag{}, err
+	}
+	return FLVVideoTag{
+		FrameType:     FLVFrameTypeKeyFrame,
+		CodecID:       FLVCodecIDAVC,
+		AVCPacketType: FLVAVCPacketTypeSequenceHeader,
+		Data:          b,
+	}, nil
+}
+
+// NewFLVAVCNALUTag returns the NALU tag of an access unit whose NAL units
+// are prefixed by lengthSize bytes. FrameType is a key frame when nals
+// contains an IDR slice.
+func NewFLVAVCNALUTag(nals []NALUnit, lengthSize int, compositionTime int32) (FLVVideoTag, error) {
+	buf := &bytes.Buffer{}
+	w, err := NewLengthPrefixedWriter(buf, lengthSize)
+	if err != nil {
+		return FLVVideoTag{}, err
+	}
+	for _, nal := range nals {
+		if err := w.WriteNALUnit(nal); err != nil {
+			return FLVVideoTag{}, err
+		}
+	}
+	frameType := uint8(FLVFrameTypeInterFrame)
+	if (AccessUnit{NALUnits: nals}).IsIDR() {
+		frameType = FLVFrameTypeKeyFrame
+	}
+	return FLVVideoTag{
+		FrameType:       frameType,
+		CodecID:         FLVCodecIDAVC,
+		AVCPacketType:   FLVAVCPacketTypeNALU,
+		CompositionTime: compositionTime,
+		Data:            buf.Bytes(),
+	}, nil
+}
+
+// NewFLVAVCEndOfSequenceTag returns the end of sequence tag.
+func NewFLVAVCEndOfSequenceTag() FLVVideoTag {
+	return FLVVideoTag{
+		FrameType:     FLVFrameTypeKeyFrame,
+		CodecID:       FLVCodecIDAVC,
+		AVCPacketType: FLVAVCPacketTypeEndOfSequence,
+	}
+}
+
+func (m FLVVideoTag) MarshalBinary() ([]byte, error) {
+	if m.FrameType > 0x0f || m.CodecID > 0x0f {
+		return nil, errors.Errorf("invalid frame type or codec id: frameType=%d, codecID=%d", m.FrameType, m.CodecID)
+	}
+	b := []byte{m.FrameType<<4 | m.CodecID}
+	if m.CodecID != FLVCodecIDAVC {
+		return append(b, m.Data...), nil
+	}
+	if m.CompositionTime < -(1<<23) || m.CompositionTime >= 1<<23 {
+		return nil, errors.Errorf("composition time is out of SI24: %d", m.CompositionTime)
+	}
+	b = append(b,
+		m.AVCPacketType,
+		byte(m.CompositionTime>>16),
+		byte(m.CompositionTime>>8),
+		byte(m.CompositionTime),
+	)
+	return append(b, m.Data...), nil
+}
+
+// UnmarshalBinary parses b. Data refers to b.
+func (m *FLVVideoTag) UnmarshalBinary(b []byte) error {
+	if len(b) < 1 {
+		return errors.New("empty video tag")
+	}
+	*m = FLVVideoTag{
+		FrameType: b[0] >> 4,
+		CodecID:   b[0] & 0x0f,
+	}
+	if m.CodecID != FLVCodecIDAVC {
+		m.Data = b[1:]
+		return nil
+	}
+	if len(b) < 5 {
+		return errors.Errorf("invalid AVC video packet length: len=%d", len(b))
+	}
+	m.AVCPacketType = b[1]
+	// sign extension of SI24
+	m.CompositionTime = int32(uint32(b[2])<<24|uint32(b[3])<<16|uint32(b[4])<<8) >> 8
+	m.Data = b[5:]
+	return nil
+}
+
+// AVCDecoderConfigurationRecord returns the record of a sequence header tag.
+func (m FLVVideoTag) AVCDecoderConfigurationRecord() (AVCDecoderConfigurationRecord, error) {
+	if m.CodecID != FLVCodecIDAVC || m.AVCPacketType != FLVAVCPacketTypeSequenceHeader {
+		return AVCDecoderConfigurationRecord{}, errors.Errorf("not an AVC sequence header: codecID=%d, avcPacketType=%d", m.CodecID, m.AVCPacketType)
+	}
+	record := AVCDecoderConfigurationRecord{}
+	if err := record.UnmarshalBinary(m.Data); err != nil {
+		return AVCDecoderConfigurationRecord{}, err
+	}
+	return record, nil
+}
+
+// NALUnits returns the NAL units of a NALU tag, whose lengths are prefixed
+// by lengthSize bytes as LengthSizeMinusOne of the sequence header.
+func (m FLVVideoTag) NALUnits(lengthSize int) ([]NALUnit, error) {
+	if m.CodecID != FLVCodecIDAVC || m.AVCPacketType != FLVAVCPacketTypeNALU {
+		return nil, errors.Errorf("not an AVC NALU: codecID=%d, avcPacketType=%d", m.CodecID, m.AVCPacketType)
+	}
+	raws, err := SplitLengthPrefixed(m.Data, lengthSize)
+	if err != nil {
+		return nil, err
+	}
+	nals := make([]NALUnit, len(raws))
+	for i, raw := range raws {
+		if err := nals[i].UnmarshalBinary(raw); err != nil {
+			return nil, err
+		}
+	}
+	return nals, nil
+}
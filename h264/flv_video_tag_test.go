@@ -0,0 +1,145 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var FLVVideoTagTestData = []struct {
+	Name   string
+	Struct FLVVideoTag
+	Binary []byte
+}{
+	{
+		Name: "sequence header",
+		Struct: FLVVideoTag{
+			FrameType:     FLVFrameTypeKeyFrame,
+			CodecID:       FLVCodecIDAVC,
+			AVCPacketType: FLVAVCPacketTypeSequenceHeader,
+			Data:          []byte{0x01, 0x42, 0xc0, 0x1e},
+		},
+		Binary: []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01, 0x42, 0xc0, 0x1e},
+	},
+	{
+		Name: "NALU",
+		Struct: FLVVideoTag{
+			FrameType:       FLVFrameTypeInterFrame,
+			CodecID:         FLVCodecIDAVC,
+			AVCPacketType:   FLVAVCPacketTypeNALU,
+			CompositionTime: 66,
+			Data:            []byte{0x00, 0x00, 0x00, 0x02, 0x41, 0x9a},
+		},
+		Binary: []byte{0x27, 0x01, 0x00, 0x00, 0x42, 0x00, 0x00, 0x00, 0x02, 0x41, 0x9a},
+	},
+	{
+		Name: "negative composition time",
+		Struct: FLVVideoTag{
+			FrameType:       FLVFrameTypeInterFrame,
+			CodecID:         FLVCodecIDAVC,
+			AVCPacketType:   FLVAVCPacketTypeNALU,
+			CompositionTime: -33,
+			Data:            []byte{0x00, 0x00, 0x00, 0x02, 0x41, 0x9a},
+		},
+		Binary: []byte{0x27, 0x01, 0xff, 0xff, 0xdf, 0x00, 0x00, 0x00, 0x02, 0x41, 0x9a},
+	},
+	{
+		Name: "end of sequence",
+		Struct: FLVVideoTag{
+			FrameType:     FLVFrameTypeKeyFrame,
+			CodecID:       FLVCodecIDAVC,
+			AVCPacketType: FLVAVCPacketTypeEndOfSequence,
+			Data:          []byte{},
+		},
+		Binary: []byte{0x17, 0x02, 0x00, 0x00, 0x00},
+	},
+	{
+		Name: "other codec",
+		Struct: FLVVideoTag{
+			FrameType: FLVFrameTypeInterFrame,
+			CodecID:   2,
+			Data:      []byte{0x00, 0x84},
+		},
+		Binary: []byte{0x22, 0x00, 0x84},
+	},
+}
+
+func TestFLVVideoTag_MarshalBinary(t *testing.T) {
+	for _, tt := range FLVVideoTagTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := tt.Struct.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+
+	t.Run("composition time out of SI24", func(t *testing.T) {
+		_, err := FLVVideoTag{CodecID: FLVCodecIDAVC, CompositionTime: 1 << 23}.MarshalBinary()
+		assert.Error(t, err)
+	})
+}
+
+func TestFLVVideoTag_UnmarshalBinary(t *testing.T) {
+	for _, tt := range FLVVideoTagTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := FLVVideoTag{}
+			require.NoError(t, s.UnmarshalBinary(tt.Binary))
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+
+	t.Run("truncated AVC video packet", func(t *testing.T) {
+		s := FLVVideoTag{}
+		assert.Error(t, s.UnmarshalBinary([]byte{0x17, 0x00, 0x00}))
+	})
+}
+
+func TestNewFLVAVCSequenceHeaderTag(t *testing.T) {
+	tag, err := NewFLVAVCSequenceHeaderTag(mp4AVCSampleEntryTestConfig)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(FLVFrameTypeKeyFrame), tag.FrameType)
+
+	record, err := tag.AVCDecoderConfigurationRecord()
+	require.NoError(t, err)
+	assert.Equal(t, mp4AVCSampleEntryTestConfig, record)
+
+	_, err = tag.NALUnits(4)
+	assert.Error(t, err)
+}
+
+func TestNewFLVAVCNALUTag(t *testing.T) {
+	idr := []NALUnit{
+		{NALUnitType: NALUnitTypeSEI, RBSPByte: []byte{0x05, 0x01, 0x00, 0x80}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}},
+	}
+	p := []NALUnit{
+		{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a}},
+	}
+
+	tag, err := NewFLVAVCNALUTag(idr, 4, 0)
+	require.NoError(t, err)
+	assert.Equal(t, FLVVideoTag{
+		FrameType:     FLVFrameTypeKeyFrame,
+		CodecID:       FLVCodecIDAVC,
+		AVCPacketType: FLVAVCPacketTypeNALU,
+		Data: []byte{
+			0x00, 0x00, 0x00, 0x05, 0x06, 0x05, 0x01, 0x00, 0x80,
+			0x00, 0x00, 0x00, 0x03, 0x65, 0x88, 0x84,
+		},
+	}, tag)
+	nals, err := tag.NALUnits(4)
+	require.NoError(t, err)
+	assert.Equal(t, idr, nals)
+
+	tag, err = NewFLVAVCNALUTag(p, 2, 33)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(FLVFrameTypeInterFrame), tag.FrameType)
+	assert.Equal(t, int32(33), tag.CompositionTime)
+	assert.Equal(t, []byte{0x00, 0x02, 0x41, 0x9a}, tag.Data)
+
+	_, err = tag.AVCDecoderConfigurationRecord()
+	assert.Error(t, err)
+	_, err = NewFLVAVCEndOfSequenceTag().NALUnits(4)
+	assert.Error(t, err)
+}
@@ -0,0 +1,183 @@
+package h264
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// mp4SampleFlagsSync is sample_depends_on 2 of a sync sample.
+	mp4SampleFlagsSync = 0x02000000
+	// mp4SampleFlagsNonSync is sample_depends_on 1 and
+	// sample_is_non_sync_sample.
+	mp4SampleFlagsNonSync = 0x01010000
+
+	fmp4TrackID = 1
+)
+
+// FMP4Segmenter produces the init segment and media segments of a
+// fragmented MP4 (CMAF) track. Media segments begin with an IDR access unit
+// and are split at the first IDR access unit after TargetDuration.
+type FMP4Segmenter struct {
+	// TargetDuration is in the timescale.
+	TargetDuration uint64
+	// DefaultSampleDuration is the duration of the last sample on Flush when
+	// no previous sample tells it. It is in the timescale.
+	DefaultSampleDuration uint32
+
+	timescale      uint32
+	sampleEntry    MP4AVCSampleEntry
+	sequenceNumber uint32
+	samples        []MP4Sample
+	lastDuration   uint32
+}
+
+func NewFMP4Segmenter(record AVCDecoderConfigurationRecord, timescale uint32, targetDuration uint64) (*FMP4Segmenter, error) {
+	if timescale == 0 {
+		return nil, errors.New("timescale must be positive")
+	}
+	sampleEntry, err := NewMP4AVCSampleEntry(record)
+	if err != nil {
+		return nil, err
+	}
+	frameRate := DefaultMP4FrameRate
+	if len(record.SequenceParameterSetNALUnits) > 0 {
+		nal := NALUnit{}
+		sps := SequenceParameterSet{}
+		if nal.UnmarshalBinary(record.SequenceParameterSetNALUnits[0]) == nil && sps.UnmarshalBinary(nal.RBSPByte) == nil {
+			if r := mp4FrameRateFromVUI(sps); r != nil {
+				frameRate = *r
+			}
+		}
+	}
+	return &FMP4Segmenter{
+		TargetDuration:        targetDuration,
+		DefaultSampleDuration: uint32(uint64(timescale) * uint64(frameRate.Den) / uint64(frameRate.Num)),
+		timescale:             timescale,
+		sampleEntry:           sampleEntry,
+	}, nil
+}
+
+// InitSegment returns ftyp and moov.
+func (s *FMP4Segmenter) InitSegment() ([]byte, error) {
+	b := appendMP4FileType(nil, "iso6", 0, "iso6", "cmfc", "avc1", "mp41")
+
+	var sampleTable []byte
+	sampleTable = appendMP4FullBox(sampleTable, "stts", 0, 0, make([]byte, 4))
+	sampleTable = appendMP4FullBox(sampleTable, "stsc", 0, 0, make([]byte, 4))
+	sampleTable = appendMP4FullBox(sampleTable, "stsz", 0, 0, make([]byte, 8))
+	sampleTable = appendMP4FullBox(sampleTable, "stco", 0, 0, make([]byte, 4))
+
+	trex := make([]byte, 20)
+	binary.BigEndian.PutUint32(trex[0:4], fmp4TrackID)
+	// default_sample_description_index
+	binary.BigEndian.PutUint32(trex[4:8], 1)
+	mvex := appendMP4Box(nil, "mvex", appendMP4FullBox(nil, "trex", 0, 0, trex))
+
+	return mp4VideoTrack{
+		trackID:     fmp4TrackID,
+		timescale:   s.timescale,
+		sampleEntry: s.sampleEntry,
+		sampleTable: sampleTable,
+	}.appendMoov(b, mvex)
+}
+
+// WriteSample adds sample and returns a media segment when sample starts a
+// new one. Samples before the first IDR access unit are discarded. SPS and
+// PPS NAL units in sample are kept, and must be those of the record since
+// the avc1 sample entry does not allow updating them.
+func (s *FMP4Segmenter) WriteSample(sample MP4Sample) ([]byte, error) {
+	if err := s.sampleEntry.AVCConfig.checkParameterSets(sample.NALUnits); err != nil {
+		return nil, err
+	}
+	isSync := AccessUnit{NALUnits: sample.NALUnits}.IsIDR()
+	if len(s.samples) == 0 {
+		if isSync {
+			s.samples = append(s.samples, sample)
+		}
+		return nil, nil
+	}
+	if sample.DTS <= s.samples[len(s.samples)-1].DTS {
+		return nil, errors.Errorf("non-monotonic DTS: dts=%d", sample.DTS)
+	}
+
+	var segment []byte
+	if isSync && sample.DTS-s.samples[0].DTS >= s.TargetDuration {
+		var err error
+		segment, err = s.mediaSegment(sample.DTS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.samples = append(s.samples, sample)
+	return segment, nil
+}
+
+// Flush returns the media segment of the remaining samples, or nil when no
+// sample remains. The duration of the last sample is that of the previous
+// one, or DefaultSampleDuration without previous samples.
+func (s *FMP4Segmenter) Flush() ([]byte, error) {
+	n := len(s.samples)
+	if n == 0 {
+		return nil, nil
+	}
+	duration := uint64(s.DefaultSampleDuration)
+	switch {
+	case n >= 2:
+		duration = s.samples[n-1].DTS - s.samples[n-2].DTS
+	case s.lastDuration > 0:
+		duration = uint64(s.lastDuration)
+	}
+	return s.mediaSegment(s.samples[n-1].DTS + duration)
+}
+
+// mediaSegment returns moof and mdat of the buffered samples, where nextDTS
+// is DTS of the following sample.
+func (s *FMP4Segmenter) mediaSegment(nextDTS uint64) ([]byte, error) {
+	samples := s.samples
+	s.samples = nil
+	s.sequenceNumber++
+
+	var mdat []byte
+	trun := binary.BigEndian.AppendUint32(nil, uint32(len(samples)))
+	// data_offset is set after the size of moof is known
+	trun = binary.BigEndian.AppendUint32(trun, 0)
+	for i, sample := range samples {
+		data, err := mp4SampleData(sample.NALUnits)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal sample: dts=%d", sample.DTS)
+		}
+		mdat = append(mdat, data...)
+
+		next := nextDTS
+		if i+1 < len(samples) {
+			next = samples[i+1].DTS
+		}
+		duration := uint32(next - sample.DTS)
+		s.lastDuration = duration
+		flags := uint32(mp4SampleFlagsNonSync)
+		if (AccessUnit{NALUnits: sample.NALUnits}).IsIDR() {
+			flags = mp4SampleFlagsSync
+		}
+
+		trun = binary.BigEndian.AppendUint32(trun, duration)
+		trun = binary.BigEndian.AppendUint32(trun, uint32(len(data)))
+		trun = binary.BigEndian.AppendUint32(trun, flags)
+		trun = binary.BigEndian.AppendUint32(trun, uint32(int32(int64(sample.PTS)-int64(sample.DTS))))
+	}
+
+	mfhd := appendMP4FullBox(nil, "mfhd", 0, 0, binary.BigEndian.AppendUint32(nil, s.sequenceNumber))
+	// default-base-is-moof
+	tfhd := appendMP4FullBox(nil, "tfhd", 0, 0x020000, binary.BigEndian.AppendUint32(nil, fmp4TrackID))
+	tfdt := appendMP4FullBox(nil, "tfdt", 1, 0, binary.BigEndian.AppendUint64(nil, samples[0].DTS))
+	moof := func() []byte {
+		// data-offset, sample-duration, sample-size, sample-flags and
+		// sample-composition-time-offsets with signed offsets of version 1
+		traf := appendMP4Box(nil, "traf", tfhd, tfdt, appendMP4FullBox(nil, "trun", 1, 0x000f01, trun))
+		return appendMP4Box(nil, "moof", mfhd, traf)
+	}
+	binary.BigEndian.PutUint32(trun[4:8], uint32(len(moof())+8))
+
+	return appendMP4Box(moof(), "mdat", mdat), nil
+}
@@ -0,0 +1,178 @@
+package h264
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fmp4TestSamples() []MP4Sample {
+	idr := []NALUnit{
+		{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0x10}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: []byte{0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xce, 0x38, 0x80}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84, 0x21}},
+	}
+	p := []NALUnit{
+		{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a, 0x21}},
+	}
+	return []MP4Sample{
+		// dropped since it is before the first IDR access unit
+		{DTS: 0, PTS: 0, NALUnits: p},
+		{DTS: 3000, PTS: 6000, NALUnits: idr},
+		{DTS: 6000, PTS: 12000, NALUnits: p},
+		{DTS: 9000, PTS: 9000, NALUnits: p},
+		{DTS: 12000, PTS: 12000, NALUnits: idr},
+		{DTS: 15000, PTS: 15000, NALUnits: p},
+	}
+}
+
+type fmp4TestSampleEntry struct {
+	Duration          uint32
+	Size              uint32
+	Flags             uint32
+	CompositionOffset int32
+}
+
+// parseFMP4TestSegment returns sequence_number, baseMediaDecodeTime, trun
+// entries and sample data of a media segment.
+func parseFMP4TestSegment(t *testing.T, segment []byte) (uint32, uint64, []fmp4TestSampleEntry, []byte) {
+	assert.Equal(t, []string{"moof", "mdat"}, mp4BoxTypes(t, segment))
+	moof := mustFindMP4Box(t, segment, "moof")
+	mdat := mustFindMP4Box(t, segment, "mdat")
+
+	mfhd := mustFindMP4Box(t, moof, "mfhd")
+	tfhd := mustFindMP4Box(t, moof, "traf", "tfhd")
+	assert.Equal(t, []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, tfhd)
+	tfdt := mustFindMP4Box(t, moof, "traf", "tfdt")
+	require.Equal(t, uint8(1), tfdt[0])
+	trun := mustFindMP4Box(t, moof, "traf", "trun")
+	assert.Equal(t, []byte{0x01, 0x00, 0x0f, 0x01}, trun[0:4])
+
+	count := int(binary.BigEndian.Uint32(trun[4:8]))
+	dataOffset := int(binary.BigEndian.Uint32(trun[8:12]))
+	// mdat payload follows moof and the mdat header
+	assert.Equal(t, len(segment)-len(mdat), dataOffset)
+	var entries []fmp4TestSampleEntry
+	for i := 0; i < count; i++ {
+		e := trun[12+16*i:]
+		entries = append(entries, fmp4TestSampleEntry{
+			Duration:          binary.BigEndian.Uint32(e[0:4]),
+			Size:              binary.BigEndian.Uint32(e[4:8]),
+			Flags:             binary.BigEndian.Uint32(e[8:12]),
+			CompositionOffset: int32(binary.BigEndian.Uint32(e[12:16])),
+		})
+	}
+	return binary.BigEndian.Uint32(mfhd[4:8]), binary.BigEndian.Uint64(tfdt[4:12]), entries, mdat
+}
+
+func TestFMP4Segmenter_InitSegment(t *testing.T) {
+	s, err := NewFMP4Segmenter(mp4AVCSampleEntryTestConfig, 90000, 6000)
+	require.NoError(t, err)
+	b, err := s.InitSegment()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"ftyp", "moov"}, mp4BoxTypes(t, b))
+	assert.Equal(t, []byte("iso6\x00\x00\x00\x00iso6cmfcavc1mp41"), mustFindMP4Box(t, b, "ftyp"))
+	assert.Equal(t, []string{"mvhd", "trak", "mvex"}, mp4BoxTypes(t, mustFindMP4Box(t, b, "moov")))
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}, mustFindMP4Box(t, b, "moov", "mvex", "trex"))
+	stbl := mustFindMP4Box(t, b, "moov", "trak", "mdia", "minf", "stbl")
+	assert.Equal(t, []string{"stsd", "stts", "stsc", "stsz", "stco"}, mp4BoxTypes(t, stbl))
+
+	stsd := mustFindMP4Box(t, stbl, "stsd")
+	entry := MP4AVCSampleEntry{}
+	require.NoError(t, entry.UnmarshalBinary(stsd[8:]))
+	assert.Equal(t, mp4AVCSampleEntryTestConfig, entry.AVCConfig)
+	assert.Equal(t, uint16(640), entry.Width)
+}
+
+func TestFMP4Segmenter_WriteSample(t *testing.T) {
+	s, err := NewFMP4Segmenter(mp4AVCSampleEntryTestConfig, 90000, 9000)
+	require.NoError(t, err)
+
+	var segments [][]byte
+	for _, sample := range fmp4TestSamples() {
+		segment, err := s.WriteSample(sample)
+		require.NoError(t, err)
+		if segment != nil {
+			segments = append(segments, segment)
+		}
+	}
+	segment, err := s.Flush()
+	require.NoError(t, err)
+	segments = append(segments, segment)
+	require.Len(t, segments, 2)
+
+	idrData := []byte{
+		0x00, 0x00, 0x00, 0x09, 0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40,
+		0x00, 0x00, 0x00, 0x04, 0x68, 0xce, 0x38, 0x80,
+		0x00, 0x00, 0x00, 0x04, 0x65, 0x88, 0x84, 0x21,
+	}
+	pData := []byte{0x00, 0x00, 0x00, 0x03, 0x41, 0x9a, 0x21}
+
+	seq, baseMediaDecodeTime, entries, mdat := parseFMP4TestSegment(t, segments[0])
+	assert.Equal(t, uint32(1), seq)
+	assert.Equal(t, uint64(3000), baseMediaDecodeTime)
+	assert.Equal(t, []fmp4TestSampleEntry{
+		{Duration: 3000, Size: 29, Flags: mp4SampleFlagsSync, CompositionOffset: 3000},
+		{Duration: 3000, Size: 7, Flags: mp4SampleFlagsNonSync, CompositionOffset: 6000},
+		{Duration: 3000, Size: 7, Flags: mp4SampleFlagsNonSync, CompositionOffset: 0},
+	}, entries)
+	assert.Equal(t, append(append(append([]byte{}, idrData...), pData...), pData...), mdat)
+
+	seq, baseMediaDecodeTime, entries, mdat = parseFMP4TestSegment(t, segments[1])
+	assert.Equal(t, uint32(2), seq)
+	assert.Equal(t, uint64(12000), baseMediaDecodeTime)
+	assert.Equal(t, []fmp4TestSampleEntry{
+		{Duration: 3000, Size: 29, Flags: mp4SampleFlagsSync, CompositionOffset: 0},
+		{Duration: 3000, Size: 7, Flags: mp4SampleFlagsNonSync, CompositionOffset: 0},
+	}, entries)
+	assert.Equal(t, append(append([]byte{}, idrData...), pData...), mdat)
+
+	t.Run("non-monotonic DTS", func(t *testing.T) {
+		s, err := NewFMP4Segmenter(mp4AVCSampleEntryTestConfig, 90000, 9000)
+		require.NoError(t, err)
+		samples := fmp4TestSamples()
+		_, err = s.WriteSample(samples[1])
+		require.NoError(t, err)
+		_, err = s.WriteSample(samples[1])
+		assert.Error(t, err)
+	})
+
+	t.Run("single sample", func(t *testing.T) {
+		s, err := NewFMP4Segmenter(mp4AVCSampleEntryTestConfig, 90000, 9000)
+		require.NoError(t, err)
+		_, err = s.WriteSample(fmp4TestSamples()[1])
+		require.NoError(t, err)
+		segment, err := s.Flush()
+		require.NoError(t, err)
+		_, _, entries, _ := parseFMP4TestSegment(t, segment)
+		assert.Equal(t, []fmp4TestSampleEntry{
+			{Duration: 3000, Size: 29, Flags: mp4SampleFlagsSync, CompositionOffset: 3000},
+		}, entries)
+	})
+
+	t.Run("updated parameter set", func(t *testing.T) {
+		s, err := NewFMP4Segmenter(mp4AVCSampleEntryTestConfig, 90000, 9000)
+		require.NoError(t, err)
+		sample := fmp4TestSamples()[1]
+		sample.NALUnits = append([]NALUnit{}, sample.NALUnits...)
+		sample.NALUnits[2] = NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xcf, 0x38, 0x80}}
+		_, err = s.WriteSample(sample)
+		assert.Error(t, err)
+	})
+
+	t.Run("no samples", func(t *testing.T) {
+		s, err := NewFMP4Segmenter(mp4AVCSampleEntryTestConfig, 90000, 9000)
+		require.NoError(t, err)
+		segment, err := s.Flush()
+		require.NoError(t, err)
+		assert.Nil(t, segment)
+	})
+}
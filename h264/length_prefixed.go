@@ -0,0 +1,173 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// LengthSize returns the byte length of the NALUnitLength field of the
+// samples described by m.
+func (m AVCDecoderConfigurationRecord) LengthSize() int {
+	return int(m.LengthSizeMinusOne) + 1
+}
+
+// NewLengthPrefixedReader returns a reader of sample whose NAL units are
+// prefixed by their length in m.LengthSize() bytes.
+func (m AVCDecoderConfigurationRecord) NewLengthPrefixedReader(sample []byte) (*LengthPrefixedReader, error) {
+	return NewLengthPrefixedReader(sample, m.LengthSize())
+}
+
+// NewLengthPrefixedWriter returns a writer of samples whose NAL units are
+// prefixed by their length in m.LengthSize() bytes.
+func (m AVCDecoderConfigurationRecord) NewLengthPrefixedWriter(w io.Writer) (*LengthPrefixedWriter, error) {
+	return NewLengthPrefixedWriter(w, m.LengthSize())
+}
+
+func validateLengthSize(lengthSize int) error {
+	switch lengthSize {
+	case 1, 2, 4:
+		return nil
+	}
+	return errors.Errorf("invalid length size: %d", lengthSize)
+}
+
+// LengthPrefixedReader reads NAL units from a sample in which each NAL unit
+// is prefixed by its length, as stored in MP4 and FLV.
+type LengthPrefixedReader struct {
+	lengthSize int
+	b          []byte
+	ind        int
+}
+
+func NewLengthPrefixedReader(sample []byte, lengthSize int) (*LengthPrefixedReader, error) {
+	if err := validateLengthSize(lengthSize); err != nil {
+		return nil, err
+	}
+	return &LengthPrefixedReader{
+		lengthSize: lengthSize,
+		b:          sample,
+	}, nil
+}
+
+// ReadRaw returns the bytes of the next NAL unit. It returns io.EOF at the
+// end of the sample. Zero length NAL units are skipped. The returned bytes
+// share the sample.
+func (r *LengthPrefixedReader) ReadRaw() ([]byte, error) {
+	for {
+		if r.ind == len(r.b) {
+			return nil, io.EOF
+		}
+		if len(r.b)-r.ind < r.lengthSize {
+			return nil, errors.Errorf("truncated NAL unit length: offset=%d, lengthSize=%d, remaining=%d", r.ind, r.lengthSize, len(r.b)-r.ind)
+		}
+		var l uint64
+		for _, b := range r.b[r.ind : r.ind+r.lengthSize] {
+			l = l<<8 | uint64(b)
+		}
+		r.ind += r.lengthSize
+		if l > uint64(len(r.b)-r.ind) {
+			return nil, errors.Errorf("NAL unit length exceeds sample: offset=%d, length=%d, remaining=%d", r.ind-r.lengthSize, l, len(r.b)-r.ind)
+		}
+		if l == 0 {
+			continue
+		}
+		b := r.b[r.ind : r.ind+int(l)]
+		r.ind += int(l)
+		return b, nil
+	}
+}
+
+// ReadNALUnit returns the next NAL unit. It returns io.EOF at the end of the
+// sample.
+func (r *LengthPrefixedReader) ReadNALUnit() (NALUnit, error) {
+	b, err := r.ReadRaw()
+	if err != nil {
+		return NALUnit{}, err
+	}
+	nal := NALUnit{}
+	if err := nal.UnmarshalBinary(b); err != nil {
+		return NALUnit{}, err
+	}
+	return nal, nil
+}
+
+// LengthPrefixedWriter writes NAL units each prefixed by its length.
+type LengthPrefixedWriter struct {
+	lengthSize int
+	w          io.Writer
+}
+
+func NewLengthPrefixedWriter(w io.Writer, lengthSize int) (*LengthPrefixedWriter, error) {
+	if err := validateLengthSize(lengthSize); err != nil {
+		return nil, err
+	}
+	return &LengthPrefixedWriter{
+		lengthSize: lengthSize,
+		w:          w,
+	}, nil
+}
+
+// WriteRaw writes b, the bytes of a NAL unit including the NAL unit header
+// and emulation prevention bytes, with its length.
+func (w *LengthPrefixedWriter) WriteRaw(b []byte) error {
+	if uint64(len(b)) > uint64(1)<<(8*uint(w.lengthSize))-1 {
+		return errors.Errorf("NAL unit is too large for length size: len=%d, lengthSize=%d", len(b), w.lengthSize)
+	}
+	l := make([]byte, w.lengthSize)
+	for i := range l {
+		l[i] = byte(len(b) >> (8 * uint(w.lengthSize-1-i)))
+	}
+	if _, err := w.w.Write(l); err != nil {
+		return err
+	}
+	_, err := w.w.Write(b)
+	return err
+}
+
+func (w *LengthPrefixedWriter) WriteNALUnit(nal NALUnit) error {
+	b, err := nal.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return w.WriteRaw(b)
+}
+
+// SplitLengthPrefixed returns the NAL units of sample.
+func SplitLengthPrefixed(sample []byte, lengthSize int) ([][]byte, error) {
+	r, err := NewLengthPrefixedReader(sample, lengthSize)
+	if err != nil {
+		return nil, err
+	}
+	var nals [][]byte
+	for {
+		b, err := r.ReadRaw()
+		if err == io.EOF {
+			return nals, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		nals = append(nals, b)
+	}
+}
+
+// JoinLengthPrefixed returns a sample of nals.
+func JoinLengthPrefixed(nals [][]byte, lengthSize int) ([]byte, error) {
+	l := 0
+	for i := range nals {
+		l += lengthSize + len(nals[i])
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, l))
+	w, err := NewLengthPrefixedWriter(buf, lengthSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range nals {
+		if err := w.WriteRaw(nals[i]); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
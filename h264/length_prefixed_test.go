@@ -0,0 +1,147 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var LengthPrefixedTestData = []struct {
+	Name       string
+	LengthSize int
+	NALUnits   [][]byte
+	Binary     []byte
+}{
+	{
+		Name:       "empty sample",
+		LengthSize: 4,
+		NALUnits:   nil,
+		Binary:     []byte{},
+	},
+	{
+		Name:       "length size = 1",
+		LengthSize: 1,
+		NALUnits: [][]byte{
+			{0x09, 0xf0},
+			{0x65, 0x88, 0x84},
+		},
+		Binary: []byte{
+			0x02, 0x09, 0xf0,
+			0x03, 0x65, 0x88, 0x84,
+		},
+	},
+	{
+		Name:       "length size = 2",
+		LengthSize: 2,
+		NALUnits: [][]byte{
+			{0x09, 0xf0},
+			{0x65, 0x88, 0x84},
+		},
+		Binary: []byte{
+			0x00, 0x02, 0x09, 0xf0,
+			0x00, 0x03, 0x65, 0x88, 0x84,
+		},
+	},
+	{
+		Name:       "length size = 4",
+		LengthSize: 4,
+		NALUnits: [][]byte{
+			{0x09, 0xf0},
+			{0x65, 0x88, 0x84},
+		},
+		Binary: []byte{
+			0x00, 0x00, 0x00, 0x02, 0x09, 0xf0,
+			0x00, 0x00, 0x00, 0x03, 0x65, 0x88, 0x84,
+		},
+	},
+}
+
+func TestJoinLengthPrefixed(t *testing.T) {
+	for _, tt := range LengthPrefixedTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := JoinLengthPrefixed(tt.NALUnits, tt.LengthSize)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+
+	t.Run("invalid length size", func(t *testing.T) {
+		_, err := JoinLengthPrefixed([][]byte{{0x09, 0xf0}}, 3)
+		assert.Error(t, err)
+	})
+
+	t.Run("NAL unit is too large", func(t *testing.T) {
+		_, err := JoinLengthPrefixed([][]byte{bytes.Repeat([]byte{0x65}, 0x100)}, 1)
+		assert.Error(t, err)
+	})
+}
+
+func TestSplitLengthPrefixed(t *testing.T) {
+	for _, tt := range LengthPrefixedTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			nals, err := SplitLengthPrefixed(tt.Binary, tt.LengthSize)
+			require.NoError(t, err)
+			assert.Equal(t, tt.NALUnits, nals)
+		})
+	}
+
+	t.Run("zero length NAL unit is skipped", func(t *testing.T) {
+		nals, err := SplitLengthPrefixed([]byte{0x00, 0x00, 0x00, 0x02, 0x09, 0xf0}, 2)
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{{0x09, 0xf0}}, nals)
+	})
+
+	t.Run("truncated length", func(t *testing.T) {
+		_, err := SplitLengthPrefixed([]byte{0x00, 0x00, 0x00, 0x02, 0x09, 0xf0, 0x00}, 4)
+		assert.Error(t, err)
+	})
+
+	t.Run("length exceeds sample", func(t *testing.T) {
+		_, err := SplitLengthPrefixed([]byte{0x00, 0x03, 0x09, 0xf0}, 2)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid length size", func(t *testing.T) {
+		_, err := SplitLengthPrefixed([]byte{0x00, 0x00, 0x02, 0x09, 0xf0}, 3)
+		assert.Error(t, err)
+	})
+}
+
+func TestAVCDecoderConfigurationRecord_NewLengthPrefixedReader(t *testing.T) {
+	record := AVCDecoderConfigurationRecord{LengthSizeMinusOne: 1}
+	r, err := record.NewLengthPrefixedReader([]byte{
+		0x00, 0x02, 0x09, 0xf0,
+		0x00, 0x03, 0x65, 0x88, 0x84,
+	})
+	require.NoError(t, err)
+
+	nal, err := r.ReadNALUnit()
+	require.NoError(t, err)
+	assert.Equal(t, NALUnit{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0xf0}}, nal)
+
+	nal, err = r.ReadNALUnit()
+	require.NoError(t, err)
+	assert.Equal(t, NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}}, nal)
+
+	_, err = r.ReadNALUnit()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestAVCDecoderConfigurationRecord_NewLengthPrefixedWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := AVCDecoderConfigurationRecord{LengthSizeMinusOne: 3}.NewLengthPrefixedWriter(buf)
+	require.NoError(t, err)
+
+	require.NoError(t, w.WriteNALUnit(NALUnit{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0xf0}}))
+	require.NoError(t, w.WriteNALUnit(NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}}))
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x02, 0x09, 0xf0,
+		0x00, 0x00, 0x00, 0x03, 0x65, 0x88, 0x84,
+	}, buf.Bytes())
+
+	_, err = AVCDecoderConfigurationRecord{LengthSizeMinusOne: 2}.NewLengthPrefixedWriter(buf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,435 @@
+package h264
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	MatroskaCodecIDAVC = "V_MPEG4/ISO/AVC"
+
+	// DefaultMatroskaTimestampScale is TimestampScale of milliseconds.
+	DefaultMatroskaTimestampScale = 1000000
+
+	matroskaTrackTypeVideo = 1
+)
+
+const (
+	matroskaIDSegment         = 0x18538067
+	matroskaIDInfo            = 0x1549a966
+	matroskaIDTimestampScale  = 0x2ad7b1
+	matroskaIDMuxingApp       = 0x4d80
+	matroskaIDWritingApp      = 0x5741
+	matroskaIDTracks          = 0x1654ae6b
+	matroskaIDTrackEntry      = 0xae
+	matroskaIDTrackNumber     = 0xd7
+	matroskaIDTrackUID        = 0x73c5
+	matroskaIDTrackType       = 0x83
+	matroskaIDCodecID         = 0x86
+	matroskaIDCodecPrivate    = 0x63a2
+	matroskaIDDefaultDuration = 0x23e383
+	matroskaIDVideo           = 0xe0
+	matroskaIDPixelWidth      = 0xb0
+	matroskaIDPixelHeight     = 0xba
+	matroskaIDCluster         = 0x1f43b675
+	matroskaIDTimestamp       = 0xe7
+	matroskaIDSimpleBlock     = 0xa3
+	matroskaIDBlockGroup      = 0xa0
+	matroskaIDBlock           = 0xa1
+	matroskaIDReferenceBlock  = 0xfb
+)
+
+const (
+	matroskaBlockFlagKeyframe = 0x80
+	matroskaBlockFlagsLacing  = 0x06
+)
+
+// MatroskaTrack is a TrackEntry of Tracks.
+type MatroskaTrack struct {
+	TrackNumber  uint64
+	TrackType    uint64
+	CodecID      string
+	CodecPrivate []byte
+	// DefaultDuration is the duration of frames in nanoseconds, or 0.
+	DefaultDuration uint64
+	PixelWidth      uint64
+	PixelHeight     uint64
+}
+
+// MatroskaFrame is a frame of a block.
+type MatroskaFrame struct {
+	// Timestamp is the presentation time in TimestampScale nanoseconds.
+	// Laced frames are DefaultDuration apart.
+	Timestamp int64
+	Keyframe  bool
+	NALUnits  []NALUnit
+}
+
+// MatroskaDemuxer reads frames of the first V_MPEG4/ISO/AVC track of a
+// Matroska or WebM file in the stored order. Segment and Cluster of unknown
+// sizes are supported, while seeking is not needed.
+type MatroskaDemuxer struct {
+	TimestampScale uint64
+	Track          MatroskaTrack
+	AVCConfig      AVCDecoderConfigurationRecord
+
+	r                *bufio.Reader
+	clusterTimestamp int64
+	frames           []MatroskaFrame
+}
+
+// NewMatroskaDemuxer reads r until Tracks and returns the demuxer of its
+// first AVC track.
+func NewMatroskaDemuxer(r io.Reader) (*MatroskaDemuxer, error) {
+	d := &MatroskaDemuxer{
+		TimestampScale: DefaultMatroskaTimestampScale,
+		r:              bufio.NewReader(r),
+	}
+
+	id, size, err := readEBMLElementHeader(d.r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read EBML header")
+	}
+	if id != ebmlIDHeader {
+		return nil, errors.Errorf("not an EBML file: id=%#x", id)
+	}
+	header, err := readEBMLElementData(d.r, id, size)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := splitEBMLElements(header)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elements {
+		if e.ID == ebmlIDDocType && string(e.Data) != "matroska" && string(e.Data) != "webm" {
+			return nil, errors.Errorf("unsupported DocType: %s", e.Data)
+		}
+	}
+
+	for {
+		id, size, err := readEBMLElementHeader(d.r)
+		if err == io.EOF {
+			return nil, errors.New("Tracks is not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case matroskaIDSegment:
+			// descend into the children
+		case matroskaIDInfo:
+			if err := d.readInfo(id, size); err != nil {
+				return nil, err
+			}
+		case matroskaIDTracks:
+			data, err := readEBMLElementData(d.r, id, size)
+			if err != nil {
+				return nil, err
+			}
+			if err := d.parseTracks(data); err != nil {
+				return nil, err
+			}
+			return d, nil
+		case matroskaIDCluster:
+			return nil, errors.New("Cluster is found before Tracks")
+		default:
+			if err := d.skip(id, size); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// ReadFrame returns the next frame of the track. It returns io.EOF at the
+// end of the file.
+func (d *MatroskaDemuxer) ReadFrame() (MatroskaFrame, error) {
+	for len(d.frames) == 0 {
+		id, size, err := readEBMLElementHeader(d.r)
+		if err != nil {
+			return MatroskaFrame{}, err
+		}
+		switch id {
+		case matroskaIDSegment, matroskaIDCluster:
+			// descend into the children
+		case matroskaIDInfo:
+			if err := d.readInfo(id, size); err != nil {
+				return MatroskaFrame{}, err
+			}
+		case matroskaIDTimestamp:
+			data, err := readEBMLElementData(d.r, id, size)
+			if err != nil {
+				return MatroskaFrame{}, err
+			}
+			v, err := ebmlUint(data)
+			if err != nil {
+				return MatroskaFrame{}, err
+			}
+			d.clusterTimestamp = int64(v)
+		case matroskaIDSimpleBlock:
+			data, err := readEBMLElementData(d.r, id, size)
+			if err != nil {
+				return MatroskaFrame{}, err
+			}
+			if err := d.appendBlockFrames(data, true, false); err != nil {
+				return MatroskaFrame{}, err
+			}
+		case matroskaIDBlockGroup:
+			data, err := readEBMLElementData(d.r, id, size)
+			if err != nil {
+				return MatroskaFrame{}, err
+			}
+			if err := d.appendBlockGroupFrames(data); err != nil {
+				return MatroskaFrame{}, err
+			}
+		default:
+			if err := d.skip(id, size); err != nil {
+				return MatroskaFrame{}, err
+			}
+		}
+	}
+	frame := d.frames[0]
+	d.frames = d.frames[1:]
+	return frame, nil
+}
+
+func (d *MatroskaDemuxer) skip(id uint32, size uint64) error {
+	if size == ebmlUnknownSize {
+		return errors.Errorf("unknown-sized element is not supported: id=%#x", id)
+	}
+	n, err := io.CopyN(io.Discard, d.r, int64(size))
+	if err == io.EOF {
+		return errors.Errorf("truncated EBML element: id=%#x, size=%d, len=%d", id, size, n)
+	}
+	return err
+}
+
+func (d *MatroskaDemuxer) readInfo(id uint32, size uint64) error {
+	data, err := readEBMLElementData(d.r, id, size)
+	if err != nil {
+		return err
+	}
+	elements, err := splitEBMLElements(data)
+	if err != nil {
+		return err
+	}
+	for _, e := range elements {
+		if e.ID != matroskaIDTimestampScale {
+			continue
+		}
+		v, err := ebmlUint(e.Data)
+		if err != nil {
+			return err
+		}
+		if v == 0 {
+			return errors.New("TimestampScale must be positive")
+		}
+		d.TimestampScale = v
+	}
+	return nil
+}
+
+func (d *MatroskaDemuxer) parseTracks(data []byte) error {
+	entries, err := splitEBMLElements(data)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.ID != matroskaIDTrackEntry {
+			continue
+		}
+		track, err := parseMatroskaTrackEntry(entry.Data)
+		if err != nil {
+			return err
+		}
+		if track.CodecID != MatroskaCodecIDAVC {
+			continue
+		}
+		if err := d.AVCConfig.UnmarshalBinary(track.CodecPrivate); err != nil {
+			return errors.Wrap(err, "failed to unmarshal CodecPrivate")
+		}
+		d.Track = track
+		return nil
+	}
+	return errors.Errorf("%s track is not found", MatroskaCodecIDAVC)
+}
+
+func parseMatroskaTrackEntry(data []byte) (MatroskaTrack, error) {
+	elements, err := splitEBMLElements(data)
+	if err != nil {
+		return MatroskaTrack{}, err
+	}
+	track := MatroskaTrack{}
+	for _, e := range elements {
+		var err error
+		switch e.ID {
+		case matroskaIDTrackNumber:
+			track.TrackNumber, err = ebmlUint(e.Data)
+		case matroskaIDTrackType:
+			track.TrackType, err = ebmlUint(e.Data)
+		case matroskaIDCodecID:
+			track.CodecID = string(e.Data)
+		case matroskaIDCodecPrivate:
+			track.CodecPrivate = e.Data
+		case matroskaIDDefaultDuration:
+			track.DefaultDuration, err = ebmlUint(e.Data)
+		case matroskaIDVideo:
+			var video []ebmlElement
+			video, err = splitEBMLElements(e.Data)
+			for _, v := range video {
+				switch v.ID {
+				case matroskaIDPixelWidth:
+					track.PixelWidth, err = ebmlUint(v.Data)
+				case matroskaIDPixelHeight:
+					track.PixelHeight, err = ebmlUint(v.Data)
+				}
+				if err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return MatroskaTrack{}, err
+		}
+	}
+	return track, nil
+}
+
+// appendBlockGroupFrames appends the frames of the Block of a BlockGroup,
+// which is a keyframe unless it has ReferenceBlock.
+func (d *MatroskaDemuxer) appendBlockGroupFrames(data []byte) error {
+	elements, err := splitEBMLElements(data)
+	if err != nil {
+		return err
+	}
+	var block []byte
+	keyframe := true
+	for _, e := range elements {
+		switch e.ID {
+		case matroskaIDBlock:
+			block = e.Data
+		case matroskaIDReferenceBlock:
+			keyframe = false
+		}
+	}
+	if block == nil {
+		return errors.New("Block is not found in BlockGroup")
+	}
+	return d.appendBlockFrames(block, false, keyframe)
+}
+
+// appendBlockFrames appends the frames of a SimpleBlock or a Block of the
+// track. keyframe is used for a Block, which does not have the flag.
+func (d *MatroskaDemuxer) appendBlockFrames(block []byte, simple bool, keyframe bool) error {
+	trackNumber, n, err := decodeEBMLVint(block, 8, false)
+	if err != nil {
+		return errors.Wrap(err, "failed to read block track number")
+	}
+	if trackNumber != d.Track.TrackNumber {
+		return nil
+	}
+	block = block[n:]
+	if len(block) < 3 {
+		return errors.Errorf("invalid block header length: len=%d", len(block))
+	}
+	timestamp := d.clusterTimestamp + int64(int16(uint16(block[0])<<8|uint16(block[1])))
+	flags := block[2]
+	if simple {
+		keyframe = flags&matroskaBlockFlagKeyframe != 0
+	}
+	frames, err := splitMatroskaLacing(block[3:], flags&matroskaBlockFlagsLacing)
+	if err != nil {
+		return err
+	}
+	if len(frames) > 1 && d.Track.DefaultDuration == 0 {
+		return errors.New("laced frames without DefaultDuration")
+	}
+
+	for i, frame := range frames {
+		raws, err := SplitLengthPrefixed(frame, d.AVCConfig.LengthSize())
+		if err != nil {
+			return err
+		}
+		nals := make([]NALUnit, len(raws))
+		for j, raw := range raws {
+			if err := nals[j].UnmarshalBinary(raw); err != nil {
+				return err
+			}
+		}
+		d.frames = append(d.frames, MatroskaFrame{
+			// the following laced frames are DefaultDuration apart
+			Timestamp: timestamp + int64(uint64(i)*d.Track.DefaultDuration/d.TimestampScale),
+			Keyframe:  keyframe && i == 0,
+			NALUnits:  nals,
+		})
+	}
+	return nil
+}
+
+// splitMatroskaLacing splits the data of a block by the lacing bits of its
+// flags.
+func splitMatroskaLacing(data []byte, lacing uint8) ([][]byte, error) {
+	if lacing == 0 {
+		return [][]byte{data}, nil
+	}
+	if len(data) < 1 {
+		return nil, errors.New("lace count is not found")
+	}
+	count := int(data[0]) + 1
+	data = data[1:]
+
+	sizes := make([]uint64, 0, count)
+	switch lacing {
+	case 0x02: // Xiph lacing
+		for i := 0; i < count-1; i++ {
+			size := uint64(0)
+			for {
+				if len(data) == 0 {
+					return nil, errors.New("truncated Xiph lace size")
+				}
+				c := data[0]
+				data = data[1:]
+				size += uint64(c)
+				if c != 0xff {
+					break
+				}
+			}
+			sizes = append(sizes, size)
+		}
+	case 0x04: // fixed-size lacing
+		if len(data)%count != 0 {
+			return nil, errors.Errorf("invalid fixed-size lacing: count=%d, len=%d", count, len(data))
+		}
+		for i := 0; i < count-1; i++ {
+			sizes = append(sizes, uint64(len(data)/count))
+		}
+	case 0x06: // EBML lacing
+		size := uint64(0)
+		for i := 0; i < count-1; i++ {
+			raw, n, err := decodeEBMLVint(data, 8, false)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read EBML lace size")
+			}
+			data = data[n:]
+			if i == 0 {
+				size = raw
+			} else {
+				// differences are signed by subtracting the half of the range
+				size = uint64(int64(size) + int64(raw) - (1<<(7*n-1) - 1))
+			}
+			sizes = append(sizes, size)
+		}
+	}
+
+	frames := make([][]byte, 0, count)
+	for _, size := range sizes {
+		if size > uint64(len(data)) {
+			return nil, errors.Errorf("invalid lace size: size=%d, len=%d", size, len(data))
+		}
+		frames = append(frames, data[:size])
+		data = data[size:]
+	}
+	return append(frames, data), nil
+}
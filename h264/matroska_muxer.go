@@ -0,0 +1,159 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const matroskaMuxerTrackNumber = 1
+
+// MatroskaMuxer writes a Matroska file of a single V_MPEG4/ISO/AVC track.
+// Segment is written with an unknown size so that the output does not need
+// seeking, and each keyframe starts a Cluster.
+type MatroskaMuxer struct {
+	// TimestampScale is in nanoseconds.
+	TimestampScale uint64
+
+	w                io.Writer
+	record           AVCDecoderConfigurationRecord
+	sps              SequenceParameterSet
+	started          bool
+	cluster          []byte
+	clusterTimestamp int64
+}
+
+func NewMatroskaMuxer(w io.Writer, record AVCDecoderConfigurationRecord) (*MatroskaMuxer, error) {
+	if len(record.SequenceParameterSetNALUnits) == 0 {
+		return nil, errors.New("sequence parameter set is not found")
+	}
+	nal := NALUnit{}
+	if err := nal.UnmarshalBinary(record.SequenceParameterSetNALUnits[0]); err != nil {
+		return nil, err
+	}
+	sps := SequenceParameterSet{}
+	if err := sps.UnmarshalBinary(nal.RBSPByte); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal sequence parameter set")
+	}
+	return &MatroskaMuxer{
+		TimestampScale: DefaultMatroskaTimestampScale,
+		w:              w,
+		record:         record,
+		sps:            sps,
+	}, nil
+}
+
+// WriteFrame writes the access unit of nals as a SimpleBlock at timestamp
+// in TimestampScale nanoseconds. Access unit delimiters are removed. SPS and
+// PPS NAL units are kept, and must be those of CodecPrivate since it cannot
+// be updated.
+func (m *MatroskaMuxer) WriteFrame(timestamp int64, nals []NALUnit) error {
+	if timestamp < 0 {
+		return errors.Errorf("negative timestamp: %d", timestamp)
+	}
+	if err := m.record.checkParameterSets(nals); err != nil {
+		return err
+	}
+	if !m.started {
+		if err := m.writeHeader(); err != nil {
+			return err
+		}
+		m.started = true
+	}
+
+	keyframe := AccessUnit{NALUnits: nals}.IsIDR()
+	relative := timestamp - m.clusterTimestamp
+	if m.cluster == nil || keyframe || relative < math.MinInt16 || relative > math.MaxInt16 {
+		if err := m.flushCluster(); err != nil {
+			return err
+		}
+		m.cluster = appendEBMLUint([]byte{}, matroskaIDTimestamp, uint64(timestamp))
+		m.clusterTimestamp = timestamp
+		relative = 0
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := m.record.NewLengthPrefixedWriter(buf)
+	if err != nil {
+		return err
+	}
+	for _, nal := range nals {
+		if nal.NALUnitType == NALUnitTypeAccessUnitDelimiter {
+			continue
+		}
+		if err := w.WriteNALUnit(nal); err != nil {
+			return err
+		}
+	}
+
+	flags := uint8(0)
+	if keyframe {
+		flags |= matroskaBlockFlagKeyframe
+	}
+	block := appendEBMLSize(nil, matroskaMuxerTrackNumber)
+	block = append(block, byte(uint16(relative)>>8), byte(relative), flags)
+	m.cluster = appendEBMLElement(m.cluster, matroskaIDSimpleBlock, block, buf.Bytes())
+	return nil
+}
+
+// Close writes the last Cluster. The underlying writer is not closed.
+func (m *MatroskaMuxer) Close() error {
+	return m.flushCluster()
+}
+
+func (m *MatroskaMuxer) flushCluster() error {
+	if m.cluster == nil {
+		return nil
+	}
+	cluster := m.cluster
+	m.cluster = nil
+	_, err := m.w.Write(appendEBMLElement(nil, matroskaIDCluster, cluster))
+	return err
+}
+
+// writeHeader writes the EBML header, the beginning of Segment, Info and
+// Tracks.
+func (m *MatroskaMuxer) writeHeader() error {
+	if m.TimestampScale == 0 {
+		return errors.New("TimestampScale must be positive")
+	}
+	var header []byte
+	header = appendEBMLUint(header, ebmlIDVersion, 1)
+	header = appendEBMLUint(header, ebmlIDReadVersion, 1)
+	header = appendEBMLUint(header, ebmlIDMaxIDLength, 4)
+	header = appendEBMLUint(header, ebmlIDMaxSizeLength, 8)
+	header = appendEBMLElement(header, ebmlIDDocType, []byte("matroska"))
+	header = appendEBMLUint(header, ebmlIDDocTypeVersion, 4)
+	header = appendEBMLUint(header, ebmlIDDocTypeReadVersion, 2)
+	b := appendEBMLElement(nil, ebmlIDHeader, header)
+
+	b = appendEBMLID(b, matroskaIDSegment)
+	b = appendEBMLSize(b, ebmlUnknownSize)
+
+	var info []byte
+	info = appendEBMLUint(info, matroskaIDTimestampScale, m.TimestampScale)
+	info = appendEBMLElement(info, matroskaIDMuxingApp, []byte("go-h264"))
+	info = appendEBMLElement(info, matroskaIDWritingApp, []byte("go-h264"))
+	b = appendEBMLElement(b, matroskaIDInfo, info)
+
+	codecPrivate, err := m.record.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var video []byte
+	video = appendEBMLUint(video, matroskaIDPixelWidth, m.sps.Width())
+	video = appendEBMLUint(video, matroskaIDPixelHeight, m.sps.Height())
+	var entry []byte
+	entry = appendEBMLUint(entry, matroskaIDTrackNumber, matroskaMuxerTrackNumber)
+	entry = appendEBMLUint(entry, matroskaIDTrackUID, matroskaMuxerTrackNumber)
+	entry = appendEBMLUint(entry, matroskaIDTrackType, matroskaTrackTypeVideo)
+	entry = appendEBMLElement(entry, matroskaIDCodecID, []byte(MatroskaCodecIDAVC))
+	entry = appendEBMLElement(entry, matroskaIDCodecPrivate, codecPrivate)
+	entry = appendEBMLElement(entry, matroskaIDVideo, video)
+	b = appendEBMLElement(b, matroskaIDTracks, appendEBMLElement(nil, matroskaIDTrackEntry, entry))
+
+	_, err = m.w.Write(b)
+	return err
+}
@@ -0,0 +1,91 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatroskaMuxer(t *testing.T) {
+	aud := NALUnit{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0x10}}
+	sps := NALUnit{}
+	require.NoError(t, sps.UnmarshalBinary(mp4AVCSampleEntryTestConfig.SequenceParameterSetNALUnits[0]))
+	idr := NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}}
+	p := NALUnit{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a, 0x02}}
+
+	buf := &bytes.Buffer{}
+	m, err := NewMatroskaMuxer(buf, mp4AVCSampleEntryTestConfig)
+	require.NoError(t, err)
+	require.NoError(t, m.WriteFrame(0, []NALUnit{aud, sps, idr}))
+	require.NoError(t, m.WriteFrame(33, []NALUnit{aud, p}))
+	// beyond the relative timestamp of int16
+	require.NoError(t, m.WriteFrame(33+math.MaxInt16+1, []NALUnit{p}))
+	require.NoError(t, m.WriteFrame(40000, []NALUnit{idr}))
+	require.NoError(t, m.Close())
+
+	clusters := 0
+	for i := 0; i+4 <= buf.Len(); i++ {
+		if bytes.Equal(buf.Bytes()[i:i+4], []byte{0x1f, 0x43, 0xb6, 0x75}) {
+			clusters++
+		}
+	}
+	assert.Equal(t, 3, clusters)
+
+	d, err := NewMatroskaDemuxer(buf)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(DefaultMatroskaTimestampScale), d.TimestampScale)
+	assert.Equal(t, MatroskaTrack{
+		TrackNumber:  1,
+		TrackType:    matroskaTrackTypeVideo,
+		CodecID:      MatroskaCodecIDAVC,
+		CodecPrivate: d.Track.CodecPrivate,
+		PixelWidth:   640,
+		PixelHeight:  480,
+	}, d.Track)
+	assert.Equal(t, mp4AVCSampleEntryTestConfig, d.AVCConfig)
+
+	for _, want := range []MatroskaFrame{
+		{Timestamp: 0, Keyframe: true, NALUnits: []NALUnit{sps, idr}},
+		{Timestamp: 33, Keyframe: false, NALUnits: []NALUnit{p}},
+		{Timestamp: 33 + math.MaxInt16 + 1, Keyframe: false, NALUnits: []NALUnit{p}},
+		{Timestamp: 40000, Keyframe: true, NALUnits: []NALUnit{idr}},
+	} {
+		frame, err := d.ReadFrame()
+		require.NoError(t, err)
+		assert.Equal(t, want, frame)
+	}
+	_, err = d.ReadFrame()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMatroskaMuxer_Error(t *testing.T) {
+	t.Run("no sequence parameter set", func(t *testing.T) {
+		_, err := NewMatroskaMuxer(&bytes.Buffer{}, AVCDecoderConfigurationRecord{})
+		assert.Error(t, err)
+	})
+
+	t.Run("negative timestamp", func(t *testing.T) {
+		m, err := NewMatroskaMuxer(&bytes.Buffer{}, mp4AVCSampleEntryTestConfig)
+		require.NoError(t, err)
+		assert.Error(t, m.WriteFrame(-1, nil))
+	})
+
+	t.Run("updated parameter set", func(t *testing.T) {
+		m, err := NewMatroskaMuxer(&bytes.Buffer{}, mp4AVCSampleEntryTestConfig)
+		require.NoError(t, err)
+		pps := NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xcf, 0x38, 0x80}}
+		idr := NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}}
+		assert.Error(t, m.WriteFrame(0, []NALUnit{pps, idr}))
+	})
+
+	t.Run("zero TimestampScale", func(t *testing.T) {
+		m, err := NewMatroskaMuxer(&bytes.Buffer{}, mp4AVCSampleEntryTestConfig)
+		require.NoError(t, err)
+		m.TimestampScale = 0
+		assert.Error(t, m.WriteFrame(0, nil))
+	})
+}
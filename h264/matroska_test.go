@@ -0,0 +1,177 @@
+package h264
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// matroskaTestFile returns a WebM file of an audio track 1 and an AVC track
+// 2 with the unknown-sized Segment followed by clusters.
+func matroskaTestFile(t *testing.T, clusters ...[]byte) []byte {
+	t.Helper()
+	codecPrivate, err := mp4AVCSampleEntryTestConfig.MarshalBinary()
+	require.NoError(t, err)
+
+	var b []byte
+	b = appendEBMLElement(b, ebmlIDHeader, appendEBMLElement(nil, ebmlIDDocType, []byte("webm")))
+	b = appendEBMLID(b, matroskaIDSegment)
+	b = appendEBMLSize(b, ebmlUnknownSize)
+	// Void
+	b = appendEBMLElement(b, 0xec, []byte{0x00, 0x00})
+	b = appendEBMLElement(b, matroskaIDInfo, appendEBMLUint(nil, matroskaIDTimestampScale, 1000))
+
+	var audio, video []byte
+	audio = appendEBMLUint(audio, matroskaIDTrackNumber, 1)
+	audio = appendEBMLUint(audio, matroskaIDTrackType, 2)
+	audio = appendEBMLElement(audio, matroskaIDCodecID, []byte("A_OPUS"))
+	video = appendEBMLUint(video, matroskaIDTrackNumber, 2)
+	video = appendEBMLUint(video, matroskaIDTrackType, matroskaTrackTypeVideo)
+	video = appendEBMLElement(video, matroskaIDCodecID, []byte(MatroskaCodecIDAVC))
+	video = appendEBMLElement(video, matroskaIDCodecPrivate, codecPrivate)
+	video = appendEBMLUint(video, matroskaIDDefaultDuration, 40000)
+	video = appendEBMLElement(video, matroskaIDVideo,
+		appendEBMLUint(appendEBMLUint(nil, matroskaIDPixelWidth, 640), matroskaIDPixelHeight, 480))
+	b = appendEBMLElement(b, matroskaIDTracks,
+		appendEBMLElement(nil, matroskaIDTrackEntry, audio),
+		appendEBMLElement(nil, matroskaIDTrackEntry, video),
+	)
+	for _, cluster := range clusters {
+		b = append(b, cluster...)
+	}
+	return b
+}
+
+func TestMatroskaDemuxer_ReadFrame(t *testing.T) {
+	idr := []byte{0x00, 0x00, 0x00, 0x03, 0x65, 0x88, 0x84}
+	p := []byte{0x00, 0x00, 0x00, 0x03, 0x41, 0x9a, 0x02}
+
+	var cluster []byte
+	cluster = appendEBMLUint(cluster, matroskaIDTimestamp, 1000)
+	// audio
+	cluster = appendEBMLElement(cluster, matroskaIDSimpleBlock, []byte{0x81, 0x00, 0x00, 0x80, 0xfc})
+	cluster = appendEBMLElement(cluster, matroskaIDSimpleBlock, []byte{0x82, 0x00, 0x00, 0x80}, idr)
+	// BlockGroup with ReferenceBlock and a negative relative timestamp
+	cluster = appendEBMLElement(cluster, matroskaIDBlockGroup,
+		appendEBMLElement(nil, matroskaIDBlock, []byte{0x82, 0xff, 0xf6, 0x00}, p),
+		appendEBMLElement(nil, matroskaIDReferenceBlock, []byte{0xf6}),
+	)
+	// fixed-size lacing of 2 frames
+	cluster = appendEBMLElement(cluster, matroskaIDSimpleBlock, []byte{0x82, 0x00, 0x50, 0x04, 0x01}, p, p)
+	// unknown-sized Cluster
+	b := append(appendEBMLID(nil, matroskaIDCluster), appendEBMLSize(nil, ebmlUnknownSize)...)
+	b = append(b, cluster...)
+	b = appendEBMLElement(b, matroskaIDBlockGroup,
+		appendEBMLElement(nil, matroskaIDBlock, []byte{0x82, 0x00, 0x78, 0x00}, idr),
+	)
+
+	d, err := NewMatroskaDemuxer(bytes.NewReader(matroskaTestFile(t, b)))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000), d.TimestampScale)
+	assert.Equal(t, uint64(2), d.Track.TrackNumber)
+	assert.Equal(t, uint64(40000), d.Track.DefaultDuration)
+	assert.Equal(t, uint64(640), d.Track.PixelWidth)
+	assert.Equal(t, uint64(480), d.Track.PixelHeight)
+	assert.Equal(t, mp4AVCSampleEntryTestConfig, d.AVCConfig)
+
+	idrNALUnits := []NALUnit{{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}}}
+	pNALUnits := []NALUnit{{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a, 0x02}}}
+	for _, want := range []MatroskaFrame{
+		{Timestamp: 1000, Keyframe: true, NALUnits: idrNALUnits},
+		{Timestamp: 990, Keyframe: false, NALUnits: pNALUnits},
+		{Timestamp: 1080, Keyframe: false, NALUnits: pNALUnits},
+		{Timestamp: 1120, Keyframe: false, NALUnits: pNALUnits},
+		{Timestamp: 1120, Keyframe: true, NALUnits: idrNALUnits},
+	} {
+		frame, err := d.ReadFrame()
+		require.NoError(t, err)
+		assert.Equal(t, want, frame)
+	}
+	_, err = d.ReadFrame()
+	assert.Equal(t, io.EOF, err)
+
+	t.Run("laced frames without DefaultDuration", func(t *testing.T) {
+		var cluster []byte
+		cluster = appendEBMLUint(cluster, matroskaIDTimestamp, 1000)
+		cluster = appendEBMLElement(cluster, matroskaIDSimpleBlock, []byte{0x82, 0x00, 0x00, 0x84, 0x01}, idr, p)
+		b := matroskaTestFile(t, appendEBMLElement(nil, matroskaIDCluster, cluster))
+		b = bytes.Replace(b, appendEBMLUint(nil, matroskaIDDefaultDuration, 40000), []byte{0x23, 0xe3, 0x83, 0x82, 0x00, 0x00}, 1)
+
+		d, err := NewMatroskaDemuxer(bytes.NewReader(b))
+		require.NoError(t, err)
+		require.Zero(t, d.Track.DefaultDuration)
+		_, err = d.ReadFrame()
+		assert.Error(t, err)
+	})
+}
+
+func TestNewMatroskaDemuxer_Error(t *testing.T) {
+	t.Run("not EBML", func(t *testing.T) {
+		_, err := NewMatroskaDemuxer(bytes.NewReader([]byte{0x00, 0x00, 0x00, 0x18, 'f', 't', 'y', 'p'}))
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported DocType", func(t *testing.T) {
+		b := appendEBMLElement(nil, ebmlIDHeader, appendEBMLElement(nil, ebmlIDDocType, []byte("mka")))
+		_, err := NewMatroskaDemuxer(bytes.NewReader(b))
+		assert.Error(t, err)
+	})
+
+	t.Run("AVC track is not found", func(t *testing.T) {
+		var b []byte
+		b = appendEBMLElement(b, ebmlIDHeader, appendEBMLElement(nil, ebmlIDDocType, []byte("matroska")))
+		b = appendEBMLElement(b, matroskaIDSegment, appendEBMLElement(nil, matroskaIDTracks,
+			appendEBMLElement(nil, matroskaIDTrackEntry, appendEBMLElement(nil, matroskaIDCodecID, []byte("V_VP9"))),
+		))
+		_, err := NewMatroskaDemuxer(bytes.NewReader(b))
+		assert.Error(t, err)
+	})
+
+	t.Run("Tracks is not found", func(t *testing.T) {
+		var b []byte
+		b = appendEBMLElement(b, ebmlIDHeader, appendEBMLElement(nil, ebmlIDDocType, []byte("matroska")))
+		b = appendEBMLElement(b, matroskaIDSegment, appendEBMLUint(nil, 0xec, 0))
+		_, err := NewMatroskaDemuxer(bytes.NewReader(b))
+		assert.Error(t, err)
+	})
+}
+
+func TestSplitMatroskaLacing(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Lacing uint8
+		Binary []byte
+		Frames [][]byte
+	}{
+		{"no lacing", 0x00, []byte{0x01, 0x02}, [][]byte{{0x01, 0x02}}},
+		{"Xiph", 0x02, append([]byte{0x02, 0xff, 0x00, 0x01}, make([]byte, 255+1+2)...), [][]byte{make([]byte, 255), {0x00}, {0x00, 0x00}}},
+		{"fixed-size", 0x04, []byte{0x01, 0x01, 0x02, 0x03, 0x04}, [][]byte{{0x01, 0x02}, {0x03, 0x04}}},
+		// sizes 2, 2+1=3 and the rest
+		{"EBML", 0x06, []byte{0x02, 0x82, 0xc0, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}, [][]byte{{0x01, 0x02}, {0x03, 0x04, 0x05}, {0x06}}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			frames, err := splitMatroskaLacing(tt.Binary, tt.Lacing)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Frames, frames)
+		})
+	}
+
+	for _, tt := range []struct {
+		Name   string
+		Lacing uint8
+		Binary []byte
+	}{
+		{"no count", 0x02, []byte{}},
+		{"truncated Xiph", 0x02, []byte{0x01, 0xff}},
+		{"invalid fixed-size", 0x04, []byte{0x01, 0x01, 0x02, 0x03}},
+		{"too large EBML", 0x06, []byte{0x01, 0x85, 0x01}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := splitMatroskaLacing(tt.Binary, tt.Lacing)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package h264
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	MP4SampleEntryTypeAVC1 = "avc1"
+	MP4SampleEntryTypeAVC3 = "avc3"
+
+	// MP4ColourTypeNCLX is colour_type of the colour information with
+	// colour_primaries, transfer_characteristics and matrix_coefficients.
+	MP4ColourTypeNCLX = "nclx"
+
+	mp4DefaultResolution = 0x00480000
+	mp4DefaultDepth      = 0x0018
+)
+
+// MP4AVCSampleEntry is the avc1 or avc3 VisualSampleEntry (ISO/IEC 14496-15)
+// with avcC and the optional btrt, pasp and colr boxes.
+type MP4AVCSampleEntry struct {
+	// Type is avc1, or avc3 where parameter sets may be in samples.
+	Type               string
+	DataReferenceIndex uint16
+	Width              uint16
+	Height             uint16
+	HorizResolution    uint32
+	VertResolution     uint32
+	FrameCount         uint16
+	CompressorName     string
+	Depth              uint16
+	AVCConfig          AVCDecoderConfigurationRecord
+	BitRate            *MP4BitRateBox
+	PixelAspectRatio   *MP4PixelAspectRatioBox
+	ColourInformation  *MP4ColourInformationBox
+	// OtherBoxes are the other child boxes.
+	OtherBoxes []MP4Box
+}
+
+// MP4BitRateBox is btrt.
+type MP4BitRateBox struct {
+	BufferSizeDB uint32
+	MaxBitrate   uint32
+	AvgBitrate   uint32
+}
+
+// MP4PixelAspectRatioBox is pasp.
+type MP4PixelAspectRatioBox struct {
+	HSpacing uint32
+	VSpacing uint32
+}
+
+// MP4ColourInformationBox is colr. The colour description is used when
+// ColourType is nclx, otherwise ICCProfile holds the rest of the box.
+type MP4ColourInformationBox struct {
+	ColourType              string
+	ColourPrimaries         uint16
+	TransferCharacteristics uint16
+	MatrixCoefficients      uint16
+	FullRangeFlag           bool
+	ICCProfile              []byte
+}
+
+// NewMP4AVCSampleEntry returns an avc1 sample entry of record. The width and
+// height are derived from the first SPS, and pasp and colr from its VUI.
+func NewMP4AVCSampleEntry(record AVCDecoderConfigurationRecord) (MP4AVCSampleEntry, error) {
+	if len(record.SequenceParameterSetNALUnits) == 0 {
+		return MP4AVCSampleEntry{}, errors.New("sequence parameter set is not found")
+	}
+	nal := NALUnit{}
+	if err := nal.UnmarshalBinary(record.SequenceParameterSetNALUnits[0]); err != nil {
+		return MP4AVCSampleEntry{}, err
+	}
+	sps := SequenceParameterSet{}
+	if err := sps.UnmarshalBinary(nal.RBSPByte); err != nil {
+		return MP4AVCSampleEntry{}, errors.Wrap(err, "failed to unmarshal sequence parameter set")
+	}
+	// width and height of the sample entry are 16 bits
+	if sps.Width() > 0xffff || sps.Height() > 0xffff {
+		return MP4AVCSampleEntry{}, errors.Errorf("too large picture size: width=%d, height=%d", sps.Width(), sps.Height())
+	}
+
+	m := MP4AVCSampleEntry{
+		Type:               MP4SampleEntryTypeAVC1,
+		DataReferenceIndex: 1,
+		Width:              uint16(sps.Width()),
+		Height:             uint16(sps.Height()),
+		HorizResolution:    mp4DefaultResolution,
+		VertResolution:     mp4DefaultResolution,
+		FrameCount:         1,
+		Depth:              mp4DefaultDepth,
+		AVCConfig:          record,
+	}
+	if vui, ok := sps.VUI(); ok {
+		if w, h, ok := vui.SampleAspectRatio(); ok {
+			m.PixelAspectRatio = &MP4PixelAspectRatioBox{HSpacing: uint32(w), VSpacing: uint32(h)}
+		}
+		if vui.VideoSignalTypePresentFlag && vui.ColourDescriptionPresentFlag {
+			m.ColourInformation = &MP4ColourInformationBox{
+				ColourType:              MP4ColourTypeNCLX,
+				ColourPrimaries:         uint16(vui.ColourPrimaries),
+				TransferCharacteristics: uint16(vui.TransferCharacteristics),
+				MatrixCoefficients:      uint16(vui.MatrixCoefficients),
+				FullRangeFlag:           vui.VideoFullRangeFlag,
+			}
+		}
+	}
+	return m, nil
+}
+
+// MarshalBinary returns the whole box including the box header.
+func (m MP4AVCSampleEntry) MarshalBinary() ([]byte, error) {
+	if len(m.Type) != 4 {
+		return nil, errors.Errorf("invalid sample entry type: %q", m.Type)
+	}
+	if len(m.CompressorName) > 31 {
+		return nil, errors.Errorf("too long compressorname: %q", m.CompressorName)
+	}
+
+	b := make([]byte, 78)
+	binary.BigEndian.PutUint16(b[6:8], m.DataReferenceIndex)
+	binary.BigEndian.PutUint16(b[24:26], m.Width)
+	binary.BigEndian.PutUint16(b[26:28], m.Height)
+	binary.BigEndian.PutUint32(b[28:32], m.HorizResolution)
+	binary.BigEndian.PutUint32(b[32:36], m.VertResolution)
+	binary.BigEndian.PutUint16(b[40:42], m.FrameCount)
+	b[42] = uint8(len(m.CompressorName))
+	copy(b[43:74], m.CompressorName)
+	binary.BigEndian.PutUint16(b[74:76], m.Depth)
+	// pre_defined = -1
+	binary.BigEndian.PutUint16(b[76:78], 0xffff)
+
+	avcC, err := m.AVCConfig.MarshalBinary()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal avcC")
+	}
+	b = appendMP4Box(b, "avcC", avcC)
+	if m.BitRate != nil {
+		btrt := make([]byte, 12)
+		binary.BigEndian.PutUint32(btrt[0:4], m.BitRate.BufferSizeDB)
+		binary.BigEndian.PutUint32(btrt[4:8], m.BitRate.MaxBitrate)
+		binary.BigEndian.PutUint32(btrt[8:12], m.BitRate.AvgBitrate)
+		b = appendMP4Box(b, "btrt", btrt)
+	}
+	if m.PixelAspectRatio != nil {
+		pasp := make([]byte, 8)
+		binary.BigEndian.PutUint32(pasp[0:4], m.PixelAspectRatio.HSpacing)
+		binary.BigEndian.PutUint32(pasp[4:8], m.PixelAspectRatio.VSpacing)
+		b = appendMP4Box(b, "pasp", pasp)
+	}
+	if c := m.ColourInformation; c != nil {
+		if len(c.ColourType) != 4 {
+			return nil, errors.Errorf("invalid colour_type: %q", c.ColourType)
+		}
+		colr := []byte(c.ColourType)
+		if c.ColourType == MP4ColourTypeNCLX {
+			colr = binary.BigEndian.AppendUint16(colr, c.ColourPrimaries)
+			colr = binary.BigEndian.AppendUint16(colr, c.TransferCharacteristics)
+			colr = binary.BigEndian.AppendUint16(colr, c.MatrixCoefficients)
+			if c.FullRangeFlag {
+				colr = append(colr, 0x80)
+			} else {
+				colr = append(colr, 0x00)
+			}
+		} else {
+			colr = append(colr, c.ICCProfile...)
+		}
+		b = appendMP4Box(b, "colr", colr)
+	}
+	for _, box := range m.OtherBoxes {
+		b = appendMP4Box(b, box.Type, box.Payload)
+	}
+
+	return appendMP4Box(nil, m.Type, b), nil
+}
+
+// UnmarshalBinary parses the whole box including the box header.
+func (m *MP4AVCSampleEntry) UnmarshalBinary(b []byte) error {
+	h, n, err := readMP4BoxHeader(b)
+	if err != nil {
+		return err
+	}
+	if h.Type != MP4SampleEntryTypeAVC1 && h.Type != MP4SampleEntryTypeAVC3 {
+		return errors.Errorf("not an AVC sample entry: type=%s", h.Type)
+	}
+	b = b[n:h.size]
+	if len(b) < 78 {
+		return errors.Errorf("invalid visual sample entry length: len=%d", len(b))
+	}
+
+	*m = MP4AVCSampleEntry{
+		Type:               h.Type,
+		DataReferenceIndex: binary.BigEndian.Uint16(b[6:8]),
+		Width:              binary.BigEndian.Uint16(b[24:26]),
+		Height:             binary.BigEndian.Uint16(b[26:28]),
+		HorizResolution:    binary.BigEndian.Uint32(b[28:32]),
+		VertResolution:     binary.BigEndian.Uint32(b[32:36]),
+		FrameCount:         binary.BigEndian.Uint16(b[40:42]),
+		Depth:              binary.BigEndian.Uint16(b[74:76]),
+	}
+	if l := int(b[42]); l <= 31 {
+		m.CompressorName = string(b[43 : 43+l])
+	}
+
+	boxes, err := splitMP4Boxes(b[78:])
+	if err != nil {
+		return err
+	}
+	hasAVCConfig := false
+	for _, box := range boxes {
+		p := box.Payload
+		switch box.Type {
+		case "avcC":
+			if err := m.AVCConfig.UnmarshalBinary(p); err != nil {
+				return errors.Wrap(err, "failed to unmarshal avcC")
+			}
+			hasAVCConfig = true
+		case "btrt":
+			if len(p) < 12 {
+				return errors.Errorf("invalid btrt length: len=%d", len(p))
+			}
+			m.BitRate = &MP4BitRateBox{
+				BufferSizeDB: binary.BigEndian.Uint32(p[0:4]),
+				MaxBitrate:   binary.BigEndian.Uint32(p[4:8]),
+				AvgBitrate:   binary.BigEndian.Uint32(p[8:12]),
+			}
+		case "pasp":
+			if len(p) < 8 {
+				return errors.Errorf("invalid pasp length: len=%d", len(p))
+			}
+			m.PixelAspectRatio = &MP4PixelAspectRatioBox{
+				HSpacing: binary.BigEndian.Uint32(p[0:4]),
+				VSpacing: binary.BigEndian.Uint32(p[4:8]),
+			}
+		case "colr":
+			if len(p) < 4 {
+				return errors.Errorf("invalid colr length: len=%d", len(p))
+			}
+			c := &MP4ColourInformationBox{ColourType: string(p[0:4])}
+			if c.ColourType == MP4ColourTypeNCLX {
+				if len(p) < 11 {
+					return errors.Errorf("invalid nclx colr length: len=%d", len(p))
+				}
+				c.ColourPrimaries = binary.BigEndian.Uint16(p[4:6])
+				c.TransferCharacteristics = binary.BigEndian.Uint16(p[6:8])
+				c.MatrixCoefficients = binary.BigEndian.Uint16(p[8:10])
+				c.FullRangeFlag = p[10]&0x80 != 0
+			} else {
+				c.ICCProfile = p[4:]
+			}
+			m.ColourInformation = c
+		default:
+			m.OtherBoxes = append(m.OtherBoxes, box)
+		}
+	}
+	if !hasAVCConfig {
+		return errors.New("avcC is not found")
+	}
+	return nil
+}
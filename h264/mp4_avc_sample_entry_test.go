@@ -0,0 +1,214 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mp4AVCSampleEntryTestConfig = AVCDecoderConfigurationRecord{
+	ConfigurationVersion:         1,
+	AVCProfileIndication:         66,
+	ProfileCompatibility:         0xc0,
+	AVCLevelIndication:           30,
+	LengthSizeMinusOne:           3,
+	SequenceParameterSetNALUnits: [][]byte{{0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40}},
+	PictureParameterSetNALUnits:  [][]byte{{0x68, 0xce, 0x38, 0x80}},
+}
+
+var mp4AVCSampleEntryTestHeader = []byte{
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+	0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x02, 0x80, 0x01, 0xe0,
+	0x00, 0x48, 0x00, 0x00, 0x00, 0x48, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00,
+	0x00, 0x01,
+	0x04, 'h', '2', '6', '4',
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x18, 0xff, 0xff,
+}
+
+var mp4AVCSampleEntryTestAVCC = []byte{
+	0x00, 0x00, 0x00, 0x20, 'a', 'v', 'c', 'C',
+	0x01, 0x42, 0xc0, 0x1e, 0xff,
+	0xe1, 0x00, 0x09, 0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40,
+	0x01, 0x00, 0x04, 0x68, 0xce, 0x38, 0x80,
+}
+
+var MP4AVCSampleEntryTestData = []struct {
+	Name   string
+	Struct MP4AVCSampleEntry
+	Binary []byte
+}{
+	{
+		Name: "avc1",
+		Struct: MP4AVCSampleEntry{
+			Type:               MP4SampleEntryTypeAVC1,
+			DataReferenceIndex: 1,
+			Width:              640,
+			Height:             480,
+			HorizResolution:    mp4DefaultResolution,
+			VertResolution:     mp4DefaultResolution,
+			FrameCount:         1,
+			CompressorName:     "h264",
+			Depth:              mp4DefaultDepth,
+			AVCConfig:          mp4AVCSampleEntryTestConfig,
+		},
+		Binary: append(append([]byte{
+			0x00, 0x00, 0x00, 0x76, 'a', 'v', 'c', '1',
+		}, mp4AVCSampleEntryTestHeader...), mp4AVCSampleEntryTestAVCC...),
+	},
+	{
+		Name: "avc3 with btrt, pasp, colr and other box",
+		Struct: MP4AVCSampleEntry{
+			Type:               MP4SampleEntryTypeAVC3,
+			DataReferenceIndex: 1,
+			Width:              640,
+			Height:             480,
+			HorizResolution:    mp4DefaultResolution,
+			VertResolution:     mp4DefaultResolution,
+			FrameCount:         1,
+			CompressorName:     "h264",
+			Depth:              mp4DefaultDepth,
+			AVCConfig:          mp4AVCSampleEntryTestConfig,
+			BitRate:            &MP4BitRateBox{BufferSizeDB: 1, MaxBitrate: 2, AvgBitrate: 3},
+			PixelAspectRatio:   &MP4PixelAspectRatioBox{HSpacing: 4, VSpacing: 3},
+			ColourInformation: &MP4ColourInformationBox{
+				ColourType:              MP4ColourTypeNCLX,
+				ColourPrimaries:         1,
+				TransferCharacteristics: 1,
+				MatrixCoefficients:      1,
+				FullRangeFlag:           true,
+			},
+			OtherBoxes: []MP4Box{{Type: "fiel", Payload: []byte{0x01, 0x00}}},
+		},
+		Binary: append(append(append([]byte{
+			0x00, 0x00, 0x00, 0xb7, 'a', 'v', 'c', '3',
+		}, mp4AVCSampleEntryTestHeader...), mp4AVCSampleEntryTestAVCC...),
+			0x00, 0x00, 0x00, 0x14, 'b', 't', 'r', 't',
+			0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03,
+			0x00, 0x00, 0x00, 0x10, 'p', 'a', 's', 'p',
+			0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x03,
+			0x00, 0x00, 0x00, 0x13, 'c', 'o', 'l', 'r',
+			'n', 'c', 'l', 'x', 0x00, 0x01, 0x00, 0x01, 0x00, 0x01, 0x80,
+			0x00, 0x00, 0x00, 0x0a, 'f', 'i', 'e', 'l', 0x01, 0x00,
+		),
+	},
+}
+
+func TestMP4AVCSampleEntry_MarshalBinary(t *testing.T) {
+	for _, tt := range MP4AVCSampleEntryTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := tt.Struct.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+}
+
+func TestMP4AVCSampleEntry_UnmarshalBinary(t *testing.T) {
+	for _, tt := range MP4AVCSampleEntryTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := MP4AVCSampleEntry{}
+			err := s.UnmarshalBinary(tt.Binary)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, b := range [][]byte{
+			// not an AVC sample entry
+			append([]byte{0x00, 0x00, 0x00, 0x56, 'h', 'v', 'c', '1'}, mp4AVCSampleEntryTestHeader...),
+			// without avcC
+			append([]byte{0x00, 0x00, 0x00, 0x56, 'a', 'v', 'c', '1'}, mp4AVCSampleEntryTestHeader...),
+			// truncated
+			append([]byte{0x00, 0x00, 0x00, 0x55, 'a', 'v', 'c', '1'}, mp4AVCSampleEntryTestHeader[:77]...),
+		} {
+			s := MP4AVCSampleEntry{}
+			assert.Error(t, s.UnmarshalBinary(b))
+		}
+	})
+}
+
+func TestNewMP4AVCSampleEntry(t *testing.T) {
+	t.Run("without VUI", func(t *testing.T) {
+		s, err := NewMP4AVCSampleEntry(mp4AVCSampleEntryTestConfig)
+		require.NoError(t, err)
+		expected := MP4AVCSampleEntryTestData[0].Struct
+		expected.CompressorName = ""
+		assert.Equal(t, expected, s)
+	})
+
+	t.Run("with VUI", func(t *testing.T) {
+		sps := SequenceParameterSet{
+			ProfileIDC:                100,
+			LevelIDC:                  40,
+			ChromaFormatIDC:           1,
+			Log2MaxFrameNumMinus4:     4,
+			PicOrderCntType:           2,
+			MaxNumRefFrames:           1,
+			PicWidthInMbsMinus1:       119,
+			PicHeightInMapUnitsMinus1: 67,
+			FrameMbsOnlyFlag:          true,
+			Direct8x8InterenceFlag:    true,
+			FrameCroppingFlag:         true,
+			FrameCropBottomOffset:     4,
+			VUIParametersPresentFlag:  true,
+			VUIs: []VideoUsabilityInformation{
+				{
+					AspectRatioInfoPresentFlag:   true,
+					AspectRatioIdc:               14,
+					VideoSignalTypePresentFlag:   true,
+					VideoFormat:                  5,
+					ColourDescriptionPresentFlag: true,
+					ColourPrimaries:              9,
+					TransferCharacteristics:      16,
+					MatrixCoefficients:           9,
+				},
+			},
+		}
+		record, err := NewAVCDecoderConfigurationRecord(
+			[][]byte{mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, sps)},
+			[][]byte{{0x68, 0xce, 0x38, 0x80}},
+		)
+		require.NoError(t, err)
+
+		s, err := NewMP4AVCSampleEntry(record)
+		require.NoError(t, err)
+		assert.Equal(t, uint16(1920), s.Width)
+		assert.Equal(t, uint16(1080), s.Height)
+		assert.Equal(t, &MP4PixelAspectRatioBox{HSpacing: 4, VSpacing: 3}, s.PixelAspectRatio)
+		assert.Equal(t, &MP4ColourInformationBox{
+			ColourType:              MP4ColourTypeNCLX,
+			ColourPrimaries:         9,
+			TransferCharacteristics: 16,
+			MatrixCoefficients:      9,
+		}, s.ColourInformation)
+		assert.Equal(t, record, s.AVCConfig)
+	})
+
+	t.Run("without SPS", func(t *testing.T) {
+		_, err := NewMP4AVCSampleEntry(AVCDecoderConfigurationRecord{})
+		assert.Error(t, err)
+	})
+
+	t.Run("too large picture size", func(t *testing.T) {
+		for _, sps := range []SequenceParameterSet{
+			{ProfileIDC: 66, PicWidthInMbsMinus1: 4096, FrameMbsOnlyFlag: true},
+			{ProfileIDC: 66, PicHeightInMapUnitsMinus1: 4096, FrameMbsOnlyFlag: true},
+		} {
+			record, err := NewAVCDecoderConfigurationRecord(
+				[][]byte{mustMarshalParameterSetNALUnit(t, NALUnitTypeSequenceParameterSet, sps)},
+				[][]byte{{0x68, 0xce, 0x38, 0x80}},
+			)
+			require.NoError(t, err)
+
+			_, err = NewMP4AVCSampleEntry(record)
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package h264
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// MP4Box is a box of ISO base media file format (ISO/IEC 14496-12) with the
+// payload left unparsed.
+type MP4Box struct {
+	Type    string
+	Payload []byte
+}
+
+func (m MP4Box) MarshalBinary() ([]byte, error) {
+	return appendMP4Box(nil, m.Type, m.Payload), nil
+}
+
+// appendMP4Box appends a box of typ containing payloads to b.
+func appendMP4Box(b []byte, typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	if uint64(size) > math.MaxUint32 {
+		b = binary.BigEndian.AppendUint32(b, 1)
+		b = append(b, typ...)
+		b = binary.BigEndian.AppendUint64(b, uint64(size+8))
+	} else {
+		b = binary.BigEndian.AppendUint32(b, uint32(size))
+		b = append(b, typ...)
+	}
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// appendMP4FullBox appends a full box with version and flags.
+func appendMP4FullBox(b []byte, typ string, version uint8, flags uint32, payloads ...[]byte) []byte {
+	header := []byte{version, uint8(flags >> 16), uint8(flags >> 8), uint8(flags)}
+	return appendMP4Box(b, typ, append([][]byte{header}, payloads...)...)
+}
+
+// splitMP4Boxes splits b into boxes. The payloads refer to b.
+func splitMP4Boxes(b []byte) ([]MP4Box, error) {
+	var boxes []MP4Box
+	for len(b) > 0 {
+		box, n, err := readMP4BoxHeader(b)
+		if err != nil {
+			return nil, err
+		}
+		box.Payload = b[n:box.size]
+		boxes = append(boxes, box.MP4Box)
+		b = b[box.size:]
+	}
+	return boxes, nil
+}
+
+// findMP4Box returns the payload of the first box at path in b. Full boxes
+// in the path other than the last one are not supported.
+func findMP4Box(b []byte, path ...string) ([]byte, bool) {
+	for _, typ := range path {
+		boxes, err := splitMP4Boxes(b)
+		if err != nil {
+			return nil, false
+		}
+		found := false
+		for _, box := range boxes {
+			if box.Type == typ {
+				b = box.Payload
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return b, true
+}
+
+type mp4BoxHeader struct {
+	MP4Box
+	// size is the size of the whole box.
+	size uint64
+}
+
+// readMP4BoxHeader reads the box header at the beginning of b and returns it
+// with the header length. size 0 means the box extends to the end of b.
+func readMP4BoxHeader(b []byte) (mp4BoxHeader, int, error) {
+	if len(b) < 8 {
+		return mp4BoxHeader{}, 0, errors.Errorf("invalid box header length: len=%d", len(b))
+	}
+	h := mp4BoxHeader{
+		MP4Box: MP4Box{Type: string(b[4:8])},
+		size:   uint64(binary.BigEndian.Uint32(b[0:4])),
+	}
+	n := 8
+	switch h.size {
+	case 0:
+		h.size = uint64(len(b))
+	case 1:
+		if len(b) < 16 {
+			return mp4BoxHeader{}, 0, errors.Errorf("invalid largesize box header length: type=%s, len=%d", h.Type, len(b))
+		}
+		h.size = binary.BigEndian.Uint64(b[8:16])
+		n = 16
+	}
+	if h.size < uint64(n) || h.size > uint64(len(b)) {
+		return mp4BoxHeader{}, 0, errors.Errorf("invalid box size: type=%s, size=%d, len=%d", h.Type, h.size, len(b))
+	}
+	return h, n, nil
+}
@@ -0,0 +1,45 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMP4Box_MarshalBinary(t *testing.T) {
+	b, err := MP4Box{Type: "free", Payload: []byte{0x01, 0x02}}.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x0a, 'f', 'r', 'e', 'e', 0x01, 0x02}, b)
+}
+
+func TestSplitMP4Boxes(t *testing.T) {
+	t.Run("boxes", func(t *testing.T) {
+		boxes, err := splitMP4Boxes([]byte{
+			0x00, 0x00, 0x00, 0x09, 'f', 'r', 'e', 'e', 0x01,
+			// largesize
+			0x00, 0x00, 0x00, 0x01, 's', 'k', 'i', 'p',
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x11, 0x02,
+			// extends to the end
+			0x00, 0x00, 0x00, 0x00, 'm', 'd', 'a', 't', 0x03, 0x04,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []MP4Box{
+			{Type: "free", Payload: []byte{0x01}},
+			{Type: "skip", Payload: []byte{0x02}},
+			{Type: "mdat", Payload: []byte{0x03, 0x04}},
+		}, boxes)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, b := range [][]byte{
+			{0x00, 0x00, 0x00, 0x09, 'f', 'r', 'e'},
+			{0x00, 0x00, 0x00, 0x0a, 'f', 'r', 'e', 'e', 0x01},
+			{0x00, 0x00, 0x00, 0x07, 'f', 'r', 'e', 'e', 0x01},
+			{0x00, 0x00, 0x00, 0x01, 's', 'k', 'i', 'p', 0x00},
+		} {
+			_, err := splitMP4Boxes(b)
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,678 @@
+package h264
+
+import (
+	"encoding/binary"
+	"io"
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// mp4SampleIsNonSyncSample is sample_is_non_sync_sample of sample flags.
+	mp4SampleIsNonSyncSample = 0x00010000
+)
+
+// MP4DemuxerSample is a sample read by MP4Demuxer.
+type MP4DemuxerSample struct {
+	MP4Sample
+	// Sync is true for sync samples, which can be decoded first.
+	Sync bool
+}
+
+// MP4Demuxer reads samples of the first avc1 or avc3 track of a progressive
+// or fragmented MP4 file in decoding order. Only the first sample entry of
+// the track is used. PTS is on the presentation timeline of the edit list,
+// where only the leading empty edits and the first non-empty edit are taken
+// into account.
+type MP4Demuxer struct {
+	TrackID     uint32
+	Timescale   uint32
+	SampleEntry MP4AVCSampleEntry
+
+	r io.ReadSeeker
+	// size is the size of r.
+	size int64
+	// editOffset is subtracted from composition times by the edit list.
+	editOffset int64
+	samples    []mp4SampleLocation
+	// nextBox is the position of the next top-level box to look for moof.
+	nextBox int64
+	// trexs holds the defaults of trex by track_ID.
+	trexs map[uint32]mp4TrackExtends
+	// nextDTS is the decoding time following the samples read so far.
+	nextDTS uint64
+}
+
+type mp4SampleLocation struct {
+	offset            int64
+	size              uint32
+	dts               uint64
+	compositionOffset int64
+	sync              bool
+}
+
+// mp4TrackExtends holds the defaults of trex.
+type mp4TrackExtends struct {
+	defaultSampleDuration uint32
+	defaultSampleSize     uint32
+	defaultSampleFlags    uint32
+}
+
+// NewMP4Demuxer reads the top-level boxes of r until moov and returns the
+// demuxer of its first AVC track.
+func NewMP4Demuxer(r io.ReadSeeker) (*MP4Demuxer, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	d := &MP4Demuxer{r: r, size: size, trexs: make(map[uint32]mp4TrackExtends)}
+	for {
+		h, n, err := d.readBoxHeader(d.nextBox)
+		if err == io.EOF {
+			return nil, errors.New("moov is not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset := d.nextBox
+		d.nextBox += int64(h.size)
+		if h.Type != "moov" {
+			continue
+		}
+		moov, err := d.readBoxPayload(offset, h, n)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.parseMoov(moov); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+}
+
+// ReadSample returns the next sample. It returns io.EOF after the last
+// sample.
+func (d *MP4Demuxer) ReadSample() (MP4DemuxerSample, error) {
+	for len(d.samples) == 0 {
+		if err := d.readMoof(); err != nil {
+			return MP4DemuxerSample{}, err
+		}
+	}
+	loc := d.samples[0]
+	d.samples = d.samples[1:]
+	if loc.offset < 0 || loc.offset+int64(loc.size) > d.size {
+		return MP4DemuxerSample{}, errors.Errorf("sample is out of the file: offset=%d, size=%d", loc.offset, loc.size)
+	}
+
+	if _, err := d.r.Seek(loc.offset, io.SeekStart); err != nil {
+		return MP4DemuxerSample{}, err
+	}
+	b := make([]byte, loc.size)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return MP4DemuxerSample{}, errors.Wrapf(err, "failed to read sample: offset=%d, size=%d", loc.offset, loc.size)
+	}
+	raws, err := SplitLengthPrefixed(b, d.SampleEntry.AVCConfig.LengthSize())
+	if err != nil {
+		return MP4DemuxerSample{}, errors.Wrapf(err, "failed to split sample: offset=%d", loc.offset)
+	}
+	nals := make([]NALUnit, len(raws))
+	for i, raw := range raws {
+		if err := nals[i].UnmarshalBinary(raw); err != nil {
+			return MP4DemuxerSample{}, err
+		}
+	}
+
+	pts := int64(loc.dts) + loc.compositionOffset - d.editOffset
+	if pts < 0 {
+		pts = 0
+	}
+	return MP4DemuxerSample{
+		MP4Sample: MP4Sample{
+			DTS:      loc.dts,
+			PTS:      uint64(pts),
+			NALUnits: nals,
+		},
+		Sync: loc.sync,
+	}, nil
+}
+
+// readMoof appends the samples of the next moof of the track. It returns
+// io.EOF when no moof remains.
+func (d *MP4Demuxer) readMoof() error {
+	for {
+		h, n, err := d.readBoxHeader(d.nextBox)
+		if err != nil {
+			return err
+		}
+		offset := d.nextBox
+		d.nextBox += int64(h.size)
+		if h.Type != "moof" {
+			continue
+		}
+		moof, err := d.readBoxPayload(offset, h, n)
+		if err != nil {
+			return err
+		}
+		return d.parseMoof(offset, moof)
+	}
+}
+
+func (d *MP4Demuxer) parseMoov(moov []byte) error {
+	boxes, err := splitMP4Boxes(moov)
+	if err != nil {
+		return err
+	}
+	mvhd, ok := findMP4Box(moov, "mvhd")
+	if !ok || len(mvhd) < 24 {
+		return errors.New("invalid mvhd")
+	}
+	movieTimescale := binary.BigEndian.Uint32(mvhd[12:16])
+	if mvhd[0] == 1 {
+		movieTimescale = binary.BigEndian.Uint32(mvhd[20:24])
+	}
+
+	var stbl []byte
+	for _, box := range boxes {
+		if box.Type != "trak" {
+			continue
+		}
+		found, err := d.parseTrak(box.Payload, movieTimescale)
+		if err != nil {
+			return err
+		}
+		if found {
+			stbl, _ = findMP4Box(box.Payload, "mdia", "minf", "stbl")
+			break
+		}
+	}
+	if stbl == nil {
+		return errors.New("AVC track is not found")
+	}
+
+	samples, nextDTS, err := mp4SampleTableSamples(stbl, d.size)
+	if err != nil {
+		return err
+	}
+	d.samples = samples
+	d.nextDTS = nextDTS
+
+	if mvex, ok := findMP4Box(moov, "mvex"); ok {
+		boxes, err := splitMP4Boxes(mvex)
+		if err != nil {
+			return err
+		}
+		for _, box := range boxes {
+			p := box.Payload
+			if box.Type != "trex" || len(p) < 24 {
+				continue
+			}
+			d.trexs[binary.BigEndian.Uint32(p[4:8])] = mp4TrackExtends{
+				defaultSampleDuration: binary.BigEndian.Uint32(p[12:16]),
+				defaultSampleSize:     binary.BigEndian.Uint32(p[16:20]),
+				defaultSampleFlags:    binary.BigEndian.Uint32(p[20:24]),
+			}
+		}
+	}
+	return nil
+}
+
+// parseTrak sets the track fields when trak is an AVC track.
+func (d *MP4Demuxer) parseTrak(trak []byte, movieTimescale uint32) (bool, error) {
+	stsd, ok := findMP4Box(trak, "mdia", "minf", "stbl", "stsd")
+	if !ok || len(stsd) < 16 {
+		return false, nil
+	}
+	// the first entry after version, flags and entry_count
+	entry := stsd[8:]
+	if typ := string(entry[4:8]); typ != MP4SampleEntryTypeAVC1 && typ != MP4SampleEntryTypeAVC3 {
+		return false, nil
+	}
+	if err := d.SampleEntry.UnmarshalBinary(entry); err != nil {
+		return false, err
+	}
+
+	tkhd, ok := findMP4Box(trak, "tkhd")
+	if !ok || len(tkhd) < 24 {
+		return false, errors.New("invalid tkhd")
+	}
+	mdhd, ok := findMP4Box(trak, "mdia", "mdhd")
+	if !ok || len(mdhd) < 24 {
+		return false, errors.New("invalid mdhd")
+	}
+	if tkhd[0] == 1 {
+		d.TrackID = binary.BigEndian.Uint32(tkhd[20:24])
+	} else {
+		d.TrackID = binary.BigEndian.Uint32(tkhd[12:16])
+	}
+	if mdhd[0] == 1 {
+		d.Timescale = binary.BigEndian.Uint32(mdhd[20:24])
+	} else {
+		d.Timescale = binary.BigEndian.Uint32(mdhd[12:16])
+	}
+	if elst, ok := findMP4Box(trak, "edts", "elst"); ok {
+		offset, err := mp4EditListOffset(elst, movieTimescale, d.Timescale)
+		if err != nil {
+			return false, err
+		}
+		d.editOffset = offset
+	}
+	return true, nil
+}
+
+// mp4EditListOffset returns the time in the media timescale which elst
+// subtracts from composition times: media_time of the first non-empty edit
+// less the durations of the preceding empty edits.
+func mp4EditListOffset(elst []byte, movieTimescale, mediaTimescale uint32) (int64, error) {
+	if len(elst) < 1 {
+		return 0, errors.New("invalid elst")
+	}
+	entrySize := 12
+	if elst[0] == 1 {
+		entrySize = 20
+	}
+	version, entries, err := mp4FullBoxEntries("elst", elst, entrySize)
+	if err != nil {
+		return 0, err
+	}
+	offset := int64(0)
+	for ; len(entries) > 0; entries = entries[entrySize:] {
+		var segmentDuration uint64
+		var mediaTime int64
+		if version == 1 {
+			segmentDuration = binary.BigEndian.Uint64(entries[0:8])
+			mediaTime = int64(binary.BigEndian.Uint64(entries[8:16]))
+		} else {
+			segmentDuration = uint64(binary.BigEndian.Uint32(entries[0:4]))
+			mediaTime = int64(int32(binary.BigEndian.Uint32(entries[4:8])))
+		}
+		if mediaTime >= 0 {
+			return offset + mediaTime, nil
+		}
+		// an empty edit delays the presentation by segment_duration in the
+		// movie timescale
+		hi, lo := bits.Mul64(segmentDuration, uint64(mediaTimescale))
+		if movieTimescale == 0 || hi >= uint64(movieTimescale) {
+			return 0, errors.Errorf("invalid elst segment_duration: %d", segmentDuration)
+		}
+		delay, _ := bits.Div64(hi, lo, uint64(movieTimescale))
+		if delay > 1<<62 {
+			return 0, errors.Errorf("invalid elst segment_duration: %d", segmentDuration)
+		}
+		offset -= int64(delay)
+	}
+	return offset, nil
+}
+
+// parseMoof appends the samples of the track fragments of the track in moof
+// at moofOffset.
+func (d *MP4Demuxer) parseMoof(moofOffset int64, moof []byte) error {
+	boxes, err := splitMP4Boxes(moof)
+	if err != nil {
+		return err
+	}
+	// base data offset of a track fragment without explicit one
+	dataEnd := moofOffset
+	for _, box := range boxes {
+		if box.Type != "traf" {
+			continue
+		}
+		trafBoxes, err := splitMP4Boxes(box.Payload)
+		if err != nil {
+			return err
+		}
+		tfhd, ok := findMP4Box(box.Payload, "tfhd")
+		if !ok || len(tfhd) < 8 {
+			return errors.New("invalid tfhd")
+		}
+		flags := binary.BigEndian.Uint32(tfhd[0:4]) & 0xffffff
+		trackID := binary.BigEndian.Uint32(tfhd[4:8])
+		// samples of other tracks are not read, but their data moves dataEnd
+		own := trackID == d.TrackID
+
+		defaults := d.trexs[trackID]
+		baseDataOffset := dataEnd
+		p := tfhd[8:]
+		for _, f := range []struct {
+			flag uint32
+			size int
+			set  func(b []byte)
+		}{
+			{0x000001, 8, func(b []byte) { baseDataOffset = int64(binary.BigEndian.Uint64(b)) }},
+			{0x000002, 4, func(b []byte) {}},
+			{0x000008, 4, func(b []byte) { defaults.defaultSampleDuration = binary.BigEndian.Uint32(b) }},
+			{0x000010, 4, func(b []byte) { defaults.defaultSampleSize = binary.BigEndian.Uint32(b) }},
+			{0x000020, 4, func(b []byte) { defaults.defaultSampleFlags = binary.BigEndian.Uint32(b) }},
+		} {
+			if flags&f.flag == 0 {
+				continue
+			}
+			if len(p) < f.size {
+				return errors.Errorf("invalid tfhd length: flags=%#x", flags)
+			}
+			f.set(p[:f.size])
+			p = p[f.size:]
+		}
+		if flags&0x000001 == 0 && flags&0x020000 != 0 {
+			// default-base-is-moof
+			baseDataOffset = moofOffset
+		}
+
+		if tfdt, ok := findMP4Box(box.Payload, "tfdt"); ok && own {
+			switch {
+			case len(tfdt) >= 12 && tfdt[0] == 1:
+				d.nextDTS = binary.BigEndian.Uint64(tfdt[4:12])
+			case len(tfdt) >= 8:
+				d.nextDTS = uint64(binary.BigEndian.Uint32(tfdt[4:8]))
+			default:
+				return errors.New("invalid tfdt")
+			}
+		}
+
+		dataEnd = baseDataOffset
+		for _, trun := range trafBoxes {
+			if trun.Type != "trun" {
+				continue
+			}
+			end, err := d.parseTrun(trun.Payload, baseDataOffset, dataEnd, defaults, own)
+			if err != nil {
+				return err
+			}
+			dataEnd = end
+		}
+	}
+	return nil
+}
+
+// parseTrun appends the samples of trun when own and returns the end of
+// their data. dataEnd is the end of the data of the previous trun.
+func (d *MP4Demuxer) parseTrun(trun []byte, baseDataOffset, dataEnd int64, defaults mp4TrackExtends, own bool) (int64, error) {
+	if len(trun) < 8 {
+		return 0, errors.Errorf("invalid trun length: len=%d", len(trun))
+	}
+	version := trun[0]
+	flags := binary.BigEndian.Uint32(trun[0:4]) & 0xffffff
+	count := binary.BigEndian.Uint32(trun[4:8])
+	p := trun[8:]
+
+	offset := dataEnd
+	if flags&0x000001 != 0 {
+		if len(p) < 4 {
+			return 0, errors.New("invalid trun data_offset")
+		}
+		offset = baseDataOffset + int64(int32(binary.BigEndian.Uint32(p[0:4])))
+		p = p[4:]
+	}
+	firstSampleFlags, hasFirstSampleFlags := uint32(0), flags&0x000004 != 0
+	if hasFirstSampleFlags {
+		if len(p) < 4 {
+			return 0, errors.New("invalid trun first_sample_flags")
+		}
+		firstSampleFlags = binary.BigEndian.Uint32(p[0:4])
+		p = p[4:]
+	}
+
+	entrySize := 0
+	for _, f := range []uint32{0x000100, 0x000200, 0x000400, 0x000800} {
+		if flags&f != 0 {
+			entrySize += 4
+		}
+	}
+	if uint64(len(p)) < uint64(count)*uint64(entrySize) {
+		return 0, errors.Errorf("invalid trun length: sample_count=%d, len=%d", count, len(p))
+	}
+	// samples without entries are limited by the size of the stream
+	if entrySize == 0 && count > 0 && (defaults.defaultSampleSize == 0 || uint64(count)*uint64(defaults.defaultSampleSize) > uint64(d.size)) {
+		return 0, errors.Errorf("invalid trun sample_count: %d", count)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		loc := mp4SampleLocation{
+			offset: offset,
+			size:   defaults.defaultSampleSize,
+			dts:    d.nextDTS,
+		}
+		duration := defaults.defaultSampleDuration
+		sampleFlags := defaults.defaultSampleFlags
+		if i == 0 && hasFirstSampleFlags {
+			sampleFlags = firstSampleFlags
+		}
+		if flags&0x000100 != 0 {
+			duration = binary.BigEndian.Uint32(p[0:4])
+			p = p[4:]
+		}
+		if flags&0x000200 != 0 {
+			loc.size = binary.BigEndian.Uint32(p[0:4])
+			p = p[4:]
+		}
+		if flags&0x000400 != 0 {
+			sampleFlags = binary.BigEndian.Uint32(p[0:4])
+			p = p[4:]
+		}
+		if flags&0x000800 != 0 {
+			if version == 0 {
+				loc.compositionOffset = int64(binary.BigEndian.Uint32(p[0:4]))
+			} else {
+				loc.compositionOffset = int64(int32(binary.BigEndian.Uint32(p[0:4])))
+			}
+			p = p[4:]
+		}
+		loc.sync = sampleFlags&mp4SampleIsNonSyncSample == 0
+
+		if own {
+			d.samples = append(d.samples, loc)
+			d.nextDTS += uint64(duration)
+		}
+		offset += int64(loc.size)
+	}
+	return offset, nil
+}
+
+// mp4SampleTableSamples returns the samples described by stbl and the
+// decoding time following them. size is the size of the stream, which limits
+// the number of samples of a constant size.
+func mp4SampleTableSamples(stbl []byte, size int64) ([]mp4SampleLocation, uint64, error) {
+	stsz, ok := findMP4Box(stbl, "stsz")
+	if !ok || len(stsz) < 12 {
+		return nil, 0, errors.New("invalid stsz")
+	}
+	sampleSize := binary.BigEndian.Uint32(stsz[4:8])
+	sampleCount := binary.BigEndian.Uint32(stsz[8:12])
+	if sampleSize == 0 && uint64(len(stsz)-12) < uint64(sampleCount)*4 {
+		return nil, 0, errors.Errorf("invalid stsz length: sample_count=%d, len=%d", sampleCount, len(stsz))
+	}
+	if sampleSize != 0 && uint64(sampleCount)*uint64(sampleSize) > uint64(size) {
+		return nil, 0, errors.Errorf("invalid stsz sample_count: %d", sampleCount)
+	}
+	samples := make([]mp4SampleLocation, 0, sampleCount)
+	for i := uint32(0); i < sampleCount; i++ {
+		size := sampleSize
+		if size == 0 {
+			size = binary.BigEndian.Uint32(stsz[12+4*i:])
+		}
+		samples = append(samples, mp4SampleLocation{size: size})
+	}
+	if sampleCount == 0 {
+		return nil, 0, nil
+	}
+
+	// chunk offsets
+	var chunkOffsets []int64
+	if stco, ok := findMP4Box(stbl, "stco"); ok {
+		_, entries, err := mp4FullBoxEntries("stco", stco, 4)
+		if err != nil {
+			return nil, 0, err
+		}
+		for ; len(entries) > 0; entries = entries[4:] {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(entries)))
+		}
+	} else if co64, ok := findMP4Box(stbl, "co64"); ok {
+		_, entries, err := mp4FullBoxEntries("co64", co64, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+		for ; len(entries) > 0; entries = entries[8:] {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(entries)))
+		}
+	} else {
+		return nil, 0, errors.New("stco is not found")
+	}
+
+	// sample offsets from stsc
+	stsc, ok := findMP4Box(stbl, "stsc")
+	if !ok {
+		return nil, 0, errors.New("stsc is not found")
+	}
+	_, entries, err := mp4FullBoxEntries("stsc", stsc, 12)
+	if err != nil {
+		return nil, 0, err
+	}
+	sample := 0
+	for ; len(entries) > 0 && sample < len(samples); entries = entries[12:] {
+		firstChunk := binary.BigEndian.Uint32(entries[0:4])
+		samplesPerChunk := binary.BigEndian.Uint32(entries[4:8])
+		lastChunk := uint32(len(chunkOffsets))
+		if len(entries) > 12 {
+			lastChunk = binary.BigEndian.Uint32(entries[12:16]) - 1
+		}
+		if firstChunk == 0 || lastChunk > uint32(len(chunkOffsets)) {
+			return nil, 0, errors.Errorf("invalid stsc chunk: first_chunk=%d", firstChunk)
+		}
+		for chunk := firstChunk; chunk <= lastChunk && sample < len(samples); chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for i := uint32(0); i < samplesPerChunk && sample < len(samples); i++ {
+				samples[sample].offset = offset
+				offset += int64(samples[sample].size)
+				sample++
+			}
+		}
+	}
+	if sample < len(samples) {
+		return nil, 0, errors.Errorf("samples are not in chunks: sample_count=%d, chunked=%d", len(samples), sample)
+	}
+
+	// decoding times from stts
+	stts, ok := findMP4Box(stbl, "stts")
+	if !ok {
+		return nil, 0, errors.New("stts is not found")
+	}
+	_, entries, err = mp4FullBoxEntries("stts", stts, 8)
+	if err != nil {
+		return nil, 0, err
+	}
+	sample = 0
+	dts := uint64(0)
+	for ; len(entries) > 0; entries = entries[8:] {
+		count := binary.BigEndian.Uint32(entries[0:4])
+		delta := binary.BigEndian.Uint32(entries[4:8])
+		for i := uint32(0); i < count && sample < len(samples); i++ {
+			samples[sample].dts = dts
+			dts += uint64(delta)
+			sample++
+		}
+	}
+
+	// composition offsets from ctts
+	if ctts, ok := findMP4Box(stbl, "ctts"); ok {
+		version, entries, err := mp4FullBoxEntries("ctts", ctts, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+		sample = 0
+		for ; len(entries) > 0; entries = entries[8:] {
+			count := binary.BigEndian.Uint32(entries[0:4])
+			offset := int64(binary.BigEndian.Uint32(entries[4:8]))
+			if version == 1 {
+				offset = int64(int32(binary.BigEndian.Uint32(entries[4:8])))
+			}
+			for i := uint32(0); i < count && sample < len(samples); i++ {
+				samples[sample].compositionOffset = offset
+				sample++
+			}
+		}
+	}
+
+	// every sample is a sync sample without stss
+	stss, ok := findMP4Box(stbl, "stss")
+	if !ok {
+		for i := range samples {
+			samples[i].sync = true
+		}
+		return samples, dts, nil
+	}
+	_, entries, err = mp4FullBoxEntries("stss", stss, 4)
+	if err != nil {
+		return nil, 0, err
+	}
+	for ; len(entries) > 0; entries = entries[4:] {
+		n := binary.BigEndian.Uint32(entries)
+		if n == 0 || n > uint32(len(samples)) {
+			return nil, 0, errors.Errorf("invalid stss sample_number: %d", n)
+		}
+		samples[n-1].sync = true
+	}
+	return samples, dts, nil
+}
+
+// mp4FullBoxEntries returns the version and the entries of a full box of
+// typ whose payload is an entry_count followed by entries of entrySize.
+func mp4FullBoxEntries(typ string, p []byte, entrySize int) (uint8, []byte, error) {
+	if len(p) < 8 {
+		return 0, nil, errors.Errorf("invalid %s length: len=%d", typ, len(p))
+	}
+	count := binary.BigEndian.Uint32(p[4:8])
+	if uint64(len(p)-8) < uint64(count)*uint64(entrySize) {
+		return 0, nil, errors.Errorf("invalid %s length: entry_count=%d, len=%d", typ, count, len(p))
+	}
+	return p[0], p[8 : 8+int(count)*entrySize], nil
+}
+
+// readBoxHeader reads the header of the box at offset. It returns io.EOF
+// when offset is the end of the file. size 0 means the box extends to the
+// end of the file.
+func (d *MP4Demuxer) readBoxHeader(offset int64) (mp4BoxHeader, int, error) {
+	if _, err := d.r.Seek(offset, io.SeekStart); err != nil {
+		return mp4BoxHeader{}, 0, err
+	}
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(d.r, b[:8]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return mp4BoxHeader{}, 0, errors.Errorf("invalid box header length: offset=%d", offset)
+		}
+		return mp4BoxHeader{}, 0, err
+	}
+	h := mp4BoxHeader{
+		MP4Box: MP4Box{Type: string(b[4:8])},
+		size:   uint64(binary.BigEndian.Uint32(b[0:4])),
+	}
+	n := 8
+	switch h.size {
+	case 0:
+		h.size = uint64(d.size - offset)
+	case 1:
+		if _, err := io.ReadFull(d.r, b[8:16]); err != nil {
+			return mp4BoxHeader{}, 0, errors.Errorf("invalid largesize box header length: type=%s, offset=%d", h.Type, offset)
+		}
+		h.size = binary.BigEndian.Uint64(b[8:16])
+		n = 16
+	}
+	if h.size < uint64(n) {
+		return mp4BoxHeader{}, 0, errors.Errorf("invalid box size: type=%s, size=%d", h.Type, h.size)
+	}
+	if h.size > uint64(d.size-offset) {
+		return mp4BoxHeader{}, 0, errors.Errorf("box is out of the file: type=%s, offset=%d, size=%d", h.Type, offset, h.size)
+	}
+	return h, n, nil
+}
+
+// readBoxPayload reads the payload of the box of h at offset.
+func (d *MP4Demuxer) readBoxPayload(offset int64, h mp4BoxHeader, headerLen int) ([]byte, error) {
+	if _, err := d.r.Seek(offset+int64(headerLen), io.SeekStart); err != nil {
+		return nil, err
+	}
+	b := make([]byte, h.size-uint64(headerLen))
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", h.Type)
+	}
+	return b, nil
+}
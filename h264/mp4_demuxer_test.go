@@ -0,0 +1,264 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mp4DemuxerTestNALUnits returns NAL units of a sample, which do not
+// include access unit delimiters.
+func mp4DemuxerTestNALUnits(t *testing.T, nals []NALUnit) []NALUnit {
+	b, err := mp4SampleData(nals)
+	require.NoError(t, err)
+	raws, err := SplitLengthPrefixed(b, 4)
+	require.NoError(t, err)
+	return mustUnmarshalNALUnits(t, raws)
+}
+
+func readAllMP4DemuxerSamples(t *testing.T, d *MP4Demuxer) []MP4DemuxerSample {
+	var samples []MP4DemuxerSample
+	for {
+		sample, err := d.ReadSample()
+		if err == io.EOF {
+			return samples
+		}
+		require.NoError(t, err)
+		samples = append(samples, sample)
+	}
+}
+
+func TestMP4Demuxer_Progressive(t *testing.T) {
+	stream, aus := mp4MuxerTestStream(t)
+	f := &mp4MuxerTestFile{}
+	require.NoError(t, AnnexBToMP4(bytes.NewReader(stream), f, nil))
+
+	d, err := NewMP4Demuxer(bytes.NewReader(f.b))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), d.TrackID)
+	assert.Equal(t, uint32(60), d.Timescale)
+	assert.Equal(t, MP4SampleEntryTypeAVC1, d.SampleEntry.Type)
+	assert.Len(t, d.SampleEntry.AVCConfig.SequenceParameterSetNALUnits, 1)
+
+	var expected []MP4DemuxerSample
+	// the composition offsets are shifted back by the edit list
+	for i, pts := range []uint64{0, 4, 2, 8, 6} {
+		expected = append(expected, MP4DemuxerSample{
+			MP4Sample: MP4Sample{
+				DTS:      uint64(2 * i),
+				PTS:      pts,
+				NALUnits: mp4DemuxerTestNALUnits(t, aus[i]),
+			},
+			Sync: i == 0,
+		})
+	}
+	assert.Equal(t, expected, readAllMP4DemuxerSamples(t, d))
+}
+
+func TestMP4Demuxer_Fragmented(t *testing.T) {
+	s, err := NewFMP4Segmenter(mp4AVCSampleEntryTestConfig, 90000, 9000)
+	require.NoError(t, err)
+	b, err := s.InitSegment()
+	require.NoError(t, err)
+	samples := fmp4TestSamples()
+	for _, sample := range samples {
+		segment, err := s.WriteSample(sample)
+		require.NoError(t, err)
+		b = append(b, segment...)
+	}
+	segment, err := s.Flush()
+	require.NoError(t, err)
+	b = append(b, segment...)
+
+	d, err := NewMP4Demuxer(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(fmp4TrackID), d.TrackID)
+	assert.Equal(t, uint32(90000), d.Timescale)
+	assert.Equal(t, mp4AVCSampleEntryTestConfig, d.SampleEntry.AVCConfig)
+
+	var expected []MP4DemuxerSample
+	// the first sample is dropped by the segmenter
+	for _, sample := range samples[1:] {
+		expected = append(expected, MP4DemuxerSample{
+			MP4Sample: MP4Sample{
+				DTS:      sample.DTS,
+				PTS:      sample.PTS,
+				NALUnits: mp4DemuxerTestNALUnits(t, sample.NALUnits),
+			},
+			Sync: AccessUnit{NALUnits: sample.NALUnits}.IsIDR(),
+		})
+	}
+	assert.Equal(t, expected, readAllMP4DemuxerSamples(t, d))
+}
+
+func TestMP4Demuxer_Error(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Binary []byte
+	}{
+		{"without moov", appendMP4FileType(nil, "isom", 0, "isom")},
+		{"without AVC track", appendMP4Box(appendMP4FileType(nil, "isom", 0, "isom"), "moov", appendMP4FullBox(nil, "mvhd", 0, 0, make([]byte, 96)))},
+		{"truncated box", appendMP4Box(nil, "moov", make([]byte, 16))[:20]},
+		{"largesize over the file", []byte{
+			0x00, 0x00, 0x00, 0x01, 'f', 'r', 'e', 'e', 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10,
+			0x00, 0x00, 0x00, 0x01, 'f', 'r', 'e', 'e', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xf0,
+		}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := NewMP4Demuxer(bytes.NewReader(tt.Binary))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMP4SampleTableSamples(t *testing.T) {
+	u32 := func(values ...uint32) []byte {
+		var b []byte
+		for _, v := range values {
+			b = binary.BigEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	var stbl []byte
+	stbl = appendMP4FullBox(stbl, "stts", 0, 0, u32(2, 2, 100, 1, 50))
+	// signed offsets of version 1
+	stbl = appendMP4FullBox(stbl, "ctts", 1, 0, u32(2, 1, 100, 2, 0xffffff9c))
+	stbl = appendMP4FullBox(stbl, "stss", 0, 0, u32(1, 1))
+	// two samples in the first chunk and one in the second one
+	stbl = appendMP4FullBox(stbl, "stsc", 0, 0, u32(2, 1, 2, 1, 2, 1, 1))
+	stbl = appendMP4FullBox(stbl, "stsz", 0, 0, u32(10, 3))
+	stbl = appendMP4FullBox(stbl, "co64", 0, 0, u32(2), binary.BigEndian.AppendUint64(nil, 1000), binary.BigEndian.AppendUint64(nil, 1<<32))
+
+	samples, nextDTS, err := mp4SampleTableSamples(stbl, 1<<33)
+	require.NoError(t, err)
+	assert.Equal(t, []mp4SampleLocation{
+		{offset: 1000, size: 10, dts: 0, compositionOffset: 100, sync: true},
+		{offset: 1010, size: 10, dts: 100, compositionOffset: -100},
+		{offset: 1 << 32, size: 10, dts: 200, compositionOffset: -100},
+	}, samples)
+	assert.Equal(t, uint64(250), nextDTS)
+
+	t.Run("samples out of chunks", func(t *testing.T) {
+		var stbl []byte
+		stbl = appendMP4FullBox(stbl, "stts", 0, 0, u32(1, 3, 100))
+		stbl = appendMP4FullBox(stbl, "stsc", 0, 0, u32(1, 1, 1, 1))
+		stbl = appendMP4FullBox(stbl, "stsz", 0, 0, u32(10, 3))
+		stbl = appendMP4FullBox(stbl, "stco", 0, 0, u32(1, 1000))
+		_, _, err := mp4SampleTableSamples(stbl, 1<<33)
+		assert.Error(t, err)
+	})
+
+	t.Run("samples over the stream", func(t *testing.T) {
+		var stbl []byte
+		stbl = appendMP4FullBox(stbl, "stts", 0, 0, u32(1, 0xffffffff, 100))
+		stbl = appendMP4FullBox(stbl, "stsc", 0, 0, u32(1, 1, 0xffffffff, 1))
+		stbl = appendMP4FullBox(stbl, "stsz", 0, 0, u32(10, 0xffffffff))
+		stbl = appendMP4FullBox(stbl, "stco", 0, 0, u32(1, 1000))
+		_, _, err := mp4SampleTableSamples(stbl, 1<<20)
+		assert.Error(t, err)
+	})
+}
+
+func TestMP4Demuxer_parseTrun(t *testing.T) {
+	u32 := func(values ...uint32) []byte {
+		var b []byte
+		for _, v := range values {
+			b = binary.BigEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	d := &MP4Demuxer{size: 1000}
+	defaults := mp4TrackExtends{defaultSampleDuration: 100, defaultSampleSize: 10}
+
+	end, err := d.parseTrun(u32(0, 3), 0, 200, defaults, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(230), end)
+	assert.Equal(t, []mp4SampleLocation{
+		{offset: 200, size: 10, dts: 0, sync: true},
+		{offset: 210, size: 10, dts: 100, sync: true},
+		{offset: 220, size: 10, dts: 200, sync: true},
+	}, d.samples)
+
+	for _, tt := range []struct {
+		Name     string
+		Trun     []byte
+		Defaults mp4TrackExtends
+	}{
+		{"samples over the stream", u32(0, 0xffffffff), defaults},
+		{"samples without size", u32(0, 0xffffffff), mp4TrackExtends{}},
+		{"truncated entries", u32(0x000200, 2, 10), defaults},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			d := &MP4Demuxer{size: 1000}
+			_, err := d.parseTrun(tt.Trun, 0, 0, tt.Defaults, true)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMP4Demuxer_parseMoof(t *testing.T) {
+	u32 := func(values ...uint32) []byte {
+		var b []byte
+		for _, v := range values {
+			b = binary.BigEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+	d := &MP4Demuxer{
+		TrackID: 1,
+		size:    1000,
+		trexs: map[uint32]mp4TrackExtends{
+			1: {defaultSampleDuration: 100, defaultSampleSize: 20},
+			2: {defaultSampleSize: 10},
+		},
+	}
+	// the data of track 2 at base_data_offset 500 precedes that of track 1
+	moof := appendMP4Box(nil, "traf",
+		appendMP4FullBox(nil, "tfhd", 0, 0x000001, u32(2, 0, 500)),
+		appendMP4FullBox(nil, "trun", 0, 0, u32(3)),
+	)
+	moof = appendMP4Box(moof, "traf",
+		appendMP4FullBox(nil, "tfhd", 0, 0, u32(1)),
+		appendMP4FullBox(nil, "trun", 0, 0, u32(2)),
+	)
+	require.NoError(t, d.parseMoof(100, moof))
+	assert.Equal(t, []mp4SampleLocation{
+		{offset: 530, size: 20, dts: 0, sync: true},
+		{offset: 550, size: 20, dts: 100, sync: true},
+	}, d.samples)
+	assert.Equal(t, uint64(200), d.nextDTS)
+}
+
+func TestMP4EditListOffset(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Elst   []byte
+		Offset int64
+	}{
+		{"media_time", appendMP4EditList(nil, 1000, 300)[8:], 300},
+		{
+			"empty edit",
+			[]byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x02,
+				0x00, 0x00, 0x03, 0xe8, 0xff, 0xff, 0xff, 0xff, 0x00, 0x01, 0x00, 0x00,
+				0x00, 0x00, 0x03, 0xe8, 0x00, 0x00, 0x01, 0x2c, 0x00, 0x01, 0x00, 0x00,
+			},
+			300 - 90000,
+		},
+		{"version 1", appendMP4EditList(nil, 1<<32, 300)[8:], 300},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			offset, err := mp4EditListOffset(tt.Elst, 1000, 90000)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Offset, offset)
+		})
+	}
+
+	_, err := mp4EditListOffset([]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}, 1000, 90000)
+	assert.Error(t, err)
+}
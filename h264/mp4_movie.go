@@ -0,0 +1,127 @@
+package h264
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// MP4Sample is an access unit with its timestamps in the timescale of the
+// track.
+type MP4Sample struct {
+	DTS      uint64
+	PTS      uint64
+	NALUnits []NALUnit
+}
+
+// mp4Matrix is the unity matrix of mvhd and tkhd.
+var mp4Matrix = []byte{
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00,
+}
+
+// mp4VideoTrack is the single video track of a movie.
+type mp4VideoTrack struct {
+	trackID     uint32
+	timescale   uint32
+	duration    uint64
+	sampleEntry MP4AVCSampleEntry
+	// editList is edts of the track, or nil.
+	editList []byte
+	// sampleTable is the boxes following stsd in stbl.
+	sampleTable []byte
+}
+
+// appendMP4FileType appends ftyp.
+func appendMP4FileType(b []byte, majorBrand string, minorVersion uint32, compatibleBrands ...string) []byte {
+	p := []byte(majorBrand)
+	p = binary.BigEndian.AppendUint32(p, minorVersion)
+	for _, brand := range compatibleBrands {
+		p = append(p, brand...)
+	}
+	return appendMP4Box(b, "ftyp", p)
+}
+
+// appendMP4TimeFields appends creation_time, modification_time and the
+// fields between them and duration, choosing the version by duration.
+func appendMP4TimeFields(p []byte, duration uint64, middle []byte) (uint8, []byte) {
+	if duration > math.MaxUint32 {
+		p = append(p, make([]byte, 16)...)
+		p = append(p, middle...)
+		return 1, binary.BigEndian.AppendUint64(p, duration)
+	}
+	p = append(p, make([]byte, 8)...)
+	p = append(p, middle...)
+	return 0, binary.BigEndian.AppendUint32(p, uint32(duration))
+}
+
+// appendMoov appends moov of the track. mvex is appended for fragmented
+// movies when it is not nil.
+func (t mp4VideoTrack) appendMoov(b []byte, mvex []byte) ([]byte, error) {
+	stsd, err := t.sampleEntry.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	// mvhd
+	version, p := appendMP4TimeFields(nil, t.duration, binary.BigEndian.AppendUint32(nil, t.timescale))
+	p = binary.BigEndian.AppendUint32(p, 0x00010000) // rate
+	p = binary.BigEndian.AppendUint16(p, 0x0100)     // volume
+	p = append(p, make([]byte, 10)...)
+	p = append(p, mp4Matrix...)
+	p = append(p, make([]byte, 24)...)
+	p = binary.BigEndian.AppendUint32(p, t.trackID+1) // next_track_ID
+	mvhd := appendMP4FullBox(nil, "mvhd", version, 0, p)
+
+	// tkhd with track_enabled and track_in_movie. track_ID and reserved are
+	// between modification_time and duration.
+	version, p = appendMP4TimeFields(nil, t.duration, binary.BigEndian.AppendUint64(nil, uint64(t.trackID)<<32))
+	p = append(p, make([]byte, 8)...)
+	p = append(p, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00) // layer, alternate_group, volume, reserved
+	p = append(p, mp4Matrix...)
+	p = binary.BigEndian.AppendUint32(p, uint32(t.sampleEntry.Width)<<16)
+	p = binary.BigEndian.AppendUint32(p, uint32(t.sampleEntry.Height)<<16)
+	tkhd := appendMP4FullBox(nil, "tkhd", version, 0x000003, p)
+
+	// mdhd with language und
+	version, p = appendMP4TimeFields(nil, t.duration, binary.BigEndian.AppendUint32(nil, t.timescale))
+	p = append(p, 0x55, 0xc4, 0x00, 0x00)
+	mdhd := appendMP4FullBox(nil, "mdhd", version, 0, p)
+
+	hdlr := appendMP4FullBox(nil, "hdlr", 0, 0,
+		make([]byte, 4), []byte("vide"), make([]byte, 12), []byte("VideoHandler\x00"))
+
+	vmhd := appendMP4FullBox(nil, "vmhd", 0, 0x000001, make([]byte, 8))
+	// self-contained data reference
+	dref := appendMP4FullBox(nil, "dref", 0, 0,
+		[]byte{0x00, 0x00, 0x00, 0x01}, appendMP4FullBox(nil, "url ", 0, 0x000001))
+	dinf := appendMP4Box(nil, "dinf", dref)
+	stbl := appendMP4Box(nil, "stbl",
+		appendMP4FullBox(nil, "stsd", 0, 0, []byte{0x00, 0x00, 0x00, 0x01}, stsd),
+		t.sampleTable,
+	)
+	minf := appendMP4Box(nil, "minf", vmhd, dinf, stbl)
+	mdia := appendMP4Box(nil, "mdia", mdhd, hdlr, minf)
+	trak := appendMP4Box(nil, "trak", tkhd, t.editList, mdia)
+
+	return appendMP4Box(b, "moov", mvhd, trak, mvex), nil
+}
+
+// mp4SampleData returns the length prefixed NAL units of a sample. Access
+// unit delimiters are removed. Parameter sets are kept in the sample even
+// though the sample entry carries them.
+func mp4SampleData(nals []NALUnit) ([]byte, error) {
+	var b []byte
+	for _, nal := range nals {
+		if nal.NALUnitType == NALUnitTypeAccessUnitDelimiter {
+			continue
+		}
+		raw, err := nal.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(len(raw)))
+		b = append(b, raw...)
+	}
+	return b, nil
+}
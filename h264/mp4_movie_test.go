@@ -0,0 +1,108 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mustFindMP4Box returns the payload of the box at path. Full boxes in the
+// path other than the last one are not supported.
+func mustFindMP4Box(t *testing.T, b []byte, path ...string) []byte {
+	for _, typ := range path {
+		boxes, err := splitMP4Boxes(b)
+		require.NoError(t, err)
+		found := false
+		for _, box := range boxes {
+			if box.Type == typ {
+				b = box.Payload
+				found = true
+				break
+			}
+		}
+		require.True(t, found, "%s is not found in %v", typ, path)
+	}
+	return b
+}
+
+func mp4BoxTypes(t *testing.T, b []byte) []string {
+	boxes, err := splitMP4Boxes(b)
+	require.NoError(t, err)
+	var types []string
+	for _, box := range boxes {
+		types = append(types, box.Type)
+	}
+	return types
+}
+
+func TestMP4VideoTrack_appendMoov(t *testing.T) {
+	sampleEntry, err := NewMP4AVCSampleEntry(mp4AVCSampleEntryTestConfig)
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		Name     string
+		Duration uint64
+		Version  uint8
+	}{
+		{"version 0", 90000, 0},
+		{"version 1", 1 << 32, 1},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := mp4VideoTrack{
+				trackID:     1,
+				timescale:   90000,
+				duration:    tt.Duration,
+				sampleEntry: sampleEntry,
+			}.appendMoov(nil, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"moov"}, mp4BoxTypes(t, b))
+			moov := mustFindMP4Box(t, b, "moov")
+			assert.Equal(t, []string{"mvhd", "trak"}, mp4BoxTypes(t, moov))
+			assert.Equal(t, []string{"tkhd", "mdia"}, mp4BoxTypes(t, mustFindMP4Box(t, moov, "trak")))
+			assert.Equal(t, []string{"mdhd", "hdlr", "minf"}, mp4BoxTypes(t, mustFindMP4Box(t, moov, "trak", "mdia")))
+			assert.Equal(t, []string{"vmhd", "dinf", "stbl"}, mp4BoxTypes(t, mustFindMP4Box(t, moov, "trak", "mdia", "minf")))
+
+			mvhd := mustFindMP4Box(t, moov, "mvhd")
+			assert.Equal(t, tt.Version, mvhd[0])
+			tkhd := mustFindMP4Box(t, moov, "trak", "tkhd")
+			assert.Equal(t, tt.Version, tkhd[0])
+			// width and height
+			assert.Equal(t, []byte{0x02, 0x80, 0x00, 0x00, 0x01, 0xe0, 0x00, 0x00}, tkhd[len(tkhd)-8:])
+			mdhd := mustFindMP4Box(t, moov, "trak", "mdia", "mdhd")
+			assert.Equal(t, tt.Version, mdhd[0])
+			if tt.Version == 0 {
+				assert.Len(t, mvhd, 100)
+				assert.Len(t, tkhd, 84)
+				assert.Len(t, mdhd, 24)
+			} else {
+				assert.Len(t, mvhd, 112)
+				assert.Len(t, tkhd, 96)
+				assert.Len(t, mdhd, 36)
+			}
+
+			stsd := mustFindMP4Box(t, moov, "trak", "mdia", "minf", "stbl", "stsd")
+			s := MP4AVCSampleEntry{}
+			require.NoError(t, s.UnmarshalBinary(stsd[8:]))
+			assert.Equal(t, sampleEntry, s)
+		})
+	}
+}
+
+func TestMP4SampleData(t *testing.T) {
+	b, err := mp4SampleData([]NALUnit{
+		{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0xf0}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: []byte{0x42, 0xc0, 0x1e}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xce}},
+		{NALUnitType: NALUnitTypeSEI, RBSPByte: []byte{0x05, 0x01, 0x00, 0x80}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x84}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x04, 0x67, 0x42, 0xc0, 0x1e,
+		0x00, 0x00, 0x00, 0x02, 0x68, 0xce,
+		0x00, 0x00, 0x00, 0x05, 0x06, 0x05, 0x01, 0x00, 0x80,
+		0x00, 0x00, 0x00, 0x03, 0x65, 0x88, 0x84,
+	}, b)
+}
@@ -0,0 +1,440 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const mp4MuxerTrackID = 1
+
+// MP4FrameRate is Num/Den frames per second.
+type MP4FrameRate struct {
+	Num uint32
+	Den uint32
+}
+
+// DefaultMP4FrameRate is used when neither MP4Muxer.FrameRate nor VUI timing
+// info is available.
+var DefaultMP4FrameRate = MP4FrameRate{Num: 30, Den: 1}
+
+// MP4Muxer writes access units into a progressive MP4 file of ftyp, mdat and
+// moov. moov is written on Close, and the size of mdat is set by seeking
+// back.
+type MP4Muxer struct {
+	// FrameRate overrides the frame rate derived from VUI timing info when it
+	// is not nil.
+	FrameRate *MP4FrameRate
+
+	w             io.WriteSeeker
+	parameterSets ParameterSets
+	pocDecoder    *PicOrderCntDecoder
+	// spsNALUnits and ppsNALUnits hold the latest NAL unit of each parameter
+	// set ID.
+	spsNALUnits map[uint64][]byte
+	ppsNALUnits map[uint64][]byte
+	// updated is true when a parameter set ID is redefined with a different
+	// NAL unit, which makes the sample entry avc3.
+	updated      bool
+	vuiFrameRate *MP4FrameRate
+	// mdatOffset is the position of the mdat header, or -1 before the first
+	// sample.
+	mdatOffset int64
+	mdatSize   uint64
+	samples    []mp4MuxerSample
+}
+
+type mp4MuxerSample struct {
+	size uint32
+	sync bool
+	poc  int64
+	// reset is true when the picture resets the picture order count.
+	reset bool
+
+	// field is true while the sample holds a single field, which the
+	// following field may be paired with.
+	field    bool
+	bottom   bool
+	frameNum uint64
+	ref      bool
+}
+
+func NewMP4Muxer(w io.WriteSeeker) *MP4Muxer {
+	return &MP4Muxer{
+		w:           w,
+		pocDecoder:  NewPicOrderCntDecoder(),
+		spsNALUnits: make(map[uint64][]byte),
+		ppsNALUnits: make(map[uint64][]byte),
+		mdatOffset:  -1,
+	}
+}
+
+// AnnexBToMP4 converts an Annex B byte stream into a progressive MP4 file.
+// The frame rate is taken from VUI timing info unless frameRate is not nil.
+func AnnexBToMP4(r io.Reader, w io.WriteSeeker, frameRate *MP4FrameRate) error {
+	m := NewMP4Muxer(w)
+	m.FrameRate = frameRate
+
+	ar := NewAnnexBReader(r)
+	assembler := NewAccessUnitAssembler()
+	for {
+		nal, _, err := ar.ReadNALUnit()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		au, ok, err := assembler.Push(nal)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := m.WriteAccessUnit(au); err != nil {
+				return err
+			}
+		}
+	}
+	if au, ok := assembler.Flush(); ok {
+		if err := m.WriteAccessUnit(au); err != nil {
+			return err
+		}
+	}
+	return m.Close()
+}
+
+// WriteAccessUnit writes the sample of au in decoding order. Access units
+// before the first IDR access unit and those without slices are discarded.
+// The latest SPS and PPS NAL units of each ID are copied into avcC, while
+// samples keep them too. The sample entry is avc3 instead of avc1 when a
+// parameter set is updated in the stream. The second field of a complementary field pair is
+// written into the sample of the first field.
+func (m *MP4Muxer) WriteAccessUnit(au AccessUnit) error {
+	var slice *NALUnit
+	for i, nal := range au.NALUnits {
+		if err := m.parameterSets.Update(nal); err != nil {
+			return err
+		}
+		switch nal.NALUnitType {
+		case NALUnitTypeSequenceParameterSet, NALUnitTypePictureParameterSet:
+			b, err := nal.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			id, err := mp4ParameterSetID(nal)
+			if err != nil {
+				return err
+			}
+			nals := m.ppsNALUnits
+			if nal.NALUnitType == NALUnitTypeSequenceParameterSet {
+				nals = m.spsNALUnits
+			}
+			if prev, ok := nals[id]; ok && !bytes.Equal(prev, b) {
+				m.updated = true
+			}
+			nals[id] = b
+		case NALUnitTypeNonIDRSlice, NALUnitTypeSliceDataPartitionA, NALUnitTypeIDRSlice:
+			if slice == nil {
+				slice = &au.NALUnits[i]
+			}
+		}
+	}
+	if slice == nil || len(m.samples) == 0 && !au.IsIDR() {
+		return nil
+	}
+
+	header := SliceHeader{}
+	if err := header.UnmarshalNALUnit(*slice, m.parameterSets.SequenceParameterSet, m.parameterSets.PictureParameterSet); err != nil {
+		return errors.Wrap(err, "failed to unmarshal slice header")
+	}
+	pps, _ := m.parameterSets.PictureParameterSet(header.PictureParameterSetID)
+	sps, _ := m.parameterSets.SequenceParameterSet(pps.SequenceParameterSetID)
+	poc, reset, err := m.pocDecoder.Decode(sps, slice.NALRefIDC, IDRPicFlag(*slice), header)
+	if err != nil {
+		return err
+	}
+
+	if m.vuiFrameRate == nil {
+		m.vuiFrameRate = mp4FrameRateFromVUI(sps)
+	}
+
+	if m.mdatOffset < 0 {
+		if err := m.writeHeader(); err != nil {
+			return err
+		}
+	}
+	data, err := mp4SampleData(au.NALUnits)
+	if err != nil {
+		return err
+	}
+	if _, err := m.w.Write(data); err != nil {
+		return err
+	}
+	m.mdatSize += uint64(len(data))
+
+	ref := slice.NALRefIDC != 0
+	if n := len(m.samples); n > 0 && header.FieldPicFlag && !IDRPicFlag(*slice) {
+		prev := &m.samples[n-1]
+		if prev.field && prev.bottom != header.BottomFieldFlag && prev.frameNum == header.FrameNum && prev.ref == ref {
+			prev.size += uint32(len(data))
+			prev.field = false
+			// PicOrderCnt of a frame is the smaller of its fields
+			if poc < prev.poc {
+				prev.poc = poc
+			}
+			return nil
+		}
+	}
+	m.samples = append(m.samples, mp4MuxerSample{
+		size:     uint32(len(data)),
+		sync:     au.IsIDR(),
+		poc:      poc,
+		reset:    reset,
+		field:    header.FieldPicFlag,
+		bottom:   header.BottomFieldFlag,
+		frameNum: header.FrameNum,
+		ref:      ref,
+	})
+	return nil
+}
+
+// writeHeader writes ftyp and the header of mdat with largesize.
+func (m *MP4Muxer) writeHeader() error {
+	if _, err := m.w.Write(appendMP4FileType(nil, "isom", 0x200, "isom", "iso2", "avc1", "mp41")); err != nil {
+		return err
+	}
+	offset, err := m.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	m.mdatOffset = offset
+	// largesize is set on Close
+	_, err = m.w.Write([]byte{0x00, 0x00, 0x00, 0x01, 'm', 'd', 'a', 't', 0, 0, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// mp4FrameRateFromVUI returns the frame rate of VUI timing info, or nil when
+// it is absent.
+func mp4FrameRateFromVUI(sps SequenceParameterSet) *MP4FrameRate {
+	vui, ok := sps.VUI()
+	if !ok || !vui.TimingInfoPresentFlag || vui.NumUnitsInTick == 0 || vui.TimeScale == 0 {
+		return nil
+	}
+	// a frame is two field ticks
+	if vui.NumUnitsInTick > math.MaxUint32/2 {
+		return nil
+	}
+	return &MP4FrameRate{Num: vui.TimeScale, Den: 2 * vui.NumUnitsInTick}
+}
+
+// Close writes moov and sets the size of mdat. The underlying writer is not
+// closed.
+func (m *MP4Muxer) Close() error {
+	if len(m.samples) == 0 {
+		return errors.New("no IDR access unit")
+	}
+	record, err := NewAVCDecoderConfigurationRecord(sortedMP4ParameterSets(m.spsNALUnits), sortedMP4ParameterSets(m.ppsNALUnits))
+	if err != nil {
+		return err
+	}
+	sampleEntry, err := NewMP4AVCSampleEntry(record)
+	if err != nil {
+		return err
+	}
+	if m.updated {
+		sampleEntry.Type = MP4SampleEntryTypeAVC3
+	}
+
+	frameRate := DefaultMP4FrameRate
+	switch {
+	case m.FrameRate != nil:
+		frameRate = *m.FrameRate
+	case m.vuiFrameRate != nil:
+		frameRate = *m.vuiFrameRate
+	}
+	if frameRate.Num == 0 || frameRate.Den == 0 {
+		return errors.Errorf("invalid frame rate: %d/%d", frameRate.Num, frameRate.Den)
+	}
+
+	sampleDuration := frameRate.Den
+	duration := uint64(len(m.samples)) * uint64(sampleDuration)
+	compositionOffsets, delay := mp4CompositionOffsets(m.samples)
+
+	var sampleTable []byte
+	// stts
+	p := binary.BigEndian.AppendUint32(nil, 1)
+	p = binary.BigEndian.AppendUint32(p, uint32(len(m.samples)))
+	p = binary.BigEndian.AppendUint32(p, sampleDuration)
+	sampleTable = appendMP4FullBox(sampleTable, "stts", 0, 0, p)
+	// ctts
+	if delay > 0 {
+		var entries []byte
+		count := uint32(0)
+		for i := 0; i < len(compositionOffsets); {
+			j := i
+			for j < len(compositionOffsets) && compositionOffsets[j] == compositionOffsets[i] {
+				j++
+			}
+			entries = binary.BigEndian.AppendUint32(entries, uint32(j-i))
+			entries = binary.BigEndian.AppendUint32(entries, compositionOffsets[i]*sampleDuration)
+			count++
+			i = j
+		}
+		sampleTable = appendMP4FullBox(sampleTable, "ctts", 0, 0, binary.BigEndian.AppendUint32(nil, count), entries)
+	}
+	// stss
+	var syncSamples []byte
+	count := uint32(0)
+	for i, s := range m.samples {
+		if s.sync {
+			syncSamples = binary.BigEndian.AppendUint32(syncSamples, uint32(i+1))
+			count++
+		}
+	}
+	sampleTable = appendMP4FullBox(sampleTable, "stss", 0, 0, binary.BigEndian.AppendUint32(nil, count), syncSamples)
+	// stsc with all samples in a single chunk
+	p = binary.BigEndian.AppendUint32(nil, 1)
+	p = binary.BigEndian.AppendUint32(p, 1)
+	p = binary.BigEndian.AppendUint32(p, uint32(len(m.samples)))
+	p = binary.BigEndian.AppendUint32(p, 1)
+	sampleTable = appendMP4FullBox(sampleTable, "stsc", 0, 0, p)
+	// stsz
+	p = binary.BigEndian.AppendUint32(nil, 0)
+	p = binary.BigEndian.AppendUint32(p, uint32(len(m.samples)))
+	for _, s := range m.samples {
+		p = binary.BigEndian.AppendUint32(p, s.size)
+	}
+	sampleTable = appendMP4FullBox(sampleTable, "stsz", 0, 0, p)
+	// stco or co64
+	chunkOffset := uint64(m.mdatOffset) + 16
+	p = binary.BigEndian.AppendUint32(nil, 1)
+	if chunkOffset > math.MaxUint32 {
+		sampleTable = appendMP4FullBox(sampleTable, "co64", 0, 0, binary.BigEndian.AppendUint64(p, chunkOffset))
+	} else {
+		sampleTable = appendMP4FullBox(sampleTable, "stco", 0, 0, binary.BigEndian.AppendUint32(p, uint32(chunkOffset)))
+	}
+
+	var editList []byte
+	if delay > 0 {
+		editList = appendMP4Box(nil, "edts", appendMP4EditList(nil, duration, uint64(delay)*uint64(sampleDuration)))
+	}
+
+	moov, err := mp4VideoTrack{
+		trackID:     mp4MuxerTrackID,
+		timescale:   frameRate.Num,
+		duration:    duration,
+		sampleEntry: sampleEntry,
+		editList:    editList,
+		sampleTable: sampleTable,
+	}.appendMoov(nil, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := m.w.Write(moov); err != nil {
+		return err
+	}
+
+	end, err := m.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := m.w.Seek(m.mdatOffset+8, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := m.w.Write(binary.BigEndian.AppendUint64(nil, m.mdatSize+16)); err != nil {
+		return err
+	}
+	_, err = m.w.Seek(end, io.SeekStart)
+	return err
+}
+
+// mp4ParameterSetID returns seq_parameter_set_id of an SPS NAL unit or
+// pic_parameter_set_id of a PPS NAL unit.
+func mp4ParameterSetID(nal NALUnit) (uint64, error) {
+	r := newBitReader(nal.RBSPByte)
+	if nal.NALUnitType == NALUnitTypeSequenceParameterSet {
+		// profile_idc, constraint_set flags and level_idc
+		if _, err := r.ReadBits(24); err != nil {
+			return 0, err
+		}
+	}
+	g, err := readExponentialGolombCoding(r)
+	if err != nil {
+		return 0, err
+	}
+	return GolombCodeNumToUint64(g), nil
+}
+
+// sortedMP4ParameterSets returns the NAL units of parameter sets in the order
+// of their IDs.
+func sortedMP4ParameterSets(nals map[uint64][]byte) [][]byte {
+	ids := make([]uint64, 0, len(nals))
+	for id := range nals {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	b := make([][]byte, len(ids))
+	for i, id := range ids {
+		b[i] = nals[id]
+	}
+	return b
+}
+
+// appendMP4EditList appends elst of a single edit which starts the
+// presentation at mediaTime.
+func appendMP4EditList(b []byte, segmentDuration uint64, mediaTime uint64) []byte {
+	p := binary.BigEndian.AppendUint32(nil, 1)
+	version := uint8(0)
+	if segmentDuration > math.MaxUint32 || mediaTime > math.MaxInt32 {
+		version = 1
+		p = binary.BigEndian.AppendUint64(p, segmentDuration)
+		p = binary.BigEndian.AppendUint64(p, mediaTime)
+	} else {
+		p = binary.BigEndian.AppendUint32(p, uint32(segmentDuration))
+		p = binary.BigEndian.AppendUint32(p, uint32(mediaTime))
+	}
+	// media_rate_integer and media_rate_fraction
+	p = binary.BigEndian.AppendUint32(p, 0x00010000)
+	return appendMP4FullBox(b, "elst", version, 0, p)
+}
+
+// mp4CompositionOffsets returns the composition offsets of samples in
+// frames and the number of frames they are shifted by to be non-negative.
+// The output order is that of picture order count between pictures which
+// reset it.
+func mp4CompositionOffsets(samples []mp4MuxerSample) ([]uint32, uint32) {
+	outputIndices := make([]int, len(samples))
+	for start := 0; start < len(samples); {
+		end := start + 1
+		for end < len(samples) && !samples[end].reset {
+			end++
+		}
+		order := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			order = append(order, i)
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return samples[order[i]].poc < samples[order[j]].poc
+		})
+		for rank, i := range order {
+			outputIndices[i] = start + rank
+		}
+		start = end
+	}
+
+	delay := 0
+	for i, o := range outputIndices {
+		if i-o > delay {
+			delay = i - o
+		}
+	}
+	offsets := make([]uint32, len(samples))
+	for i, o := range outputIndices {
+		offsets[i] = uint32(o - i + delay)
+	}
+	return offsets, uint32(delay)
+}
@@ -0,0 +1,369 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mp4MuxerTestFile is an in-memory io.WriteSeeker.
+type mp4MuxerTestFile struct {
+	b   []byte
+	pos int64
+}
+
+func (f *mp4MuxerTestFile) Write(p []byte) (int, error) {
+	if end := f.pos + int64(len(p)); end > int64(len(f.b)) {
+		f.b = append(f.b, make([]byte, end-int64(len(f.b)))...)
+	}
+	n := copy(f.b[f.pos:], p)
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *mp4MuxerTestFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		f.pos = offset
+	case io.SeekCurrent:
+		f.pos += offset
+	case io.SeekEnd:
+		f.pos = int64(len(f.b)) + offset
+	}
+	return f.pos, nil
+}
+
+// mp4MuxerTestSPS has pic_order_cnt_type 0 with MaxPicOrderCntLsb 16 and
+// VUI timing info of 30 frames per second. modify changes the SPS when it is
+// not nil.
+func mp4MuxerTestSPS(t *testing.T, modify func(sps *SequenceParameterSet)) NALUnit {
+	sps := SequenceParameterSet{
+		ProfileIDC:                66,
+		ConstraintSet0Flag:        true,
+		ConstraintSet1Flag:        true,
+		LevelIDC:                  30,
+		PicOrderCntType:           0,
+		MaxNumRefFrames:           1,
+		PicWidthInMbsMinus1:       39,
+		PicHeightInMapUnitsMinus1: 29,
+		FrameMbsOnlyFlag:          true,
+		Direct8x8InterenceFlag:    true,
+		VUIParametersPresentFlag:  true,
+		VUIs: []VideoUsabilityInformation{
+			{TimingInfoPresentFlag: true, NumUnitsInTick: 1, TimeScale: 60, FixedFrameRateFlag: true},
+		},
+	}
+	if modify != nil {
+		modify(&sps)
+	}
+	b, err := sps.MarshalBinary()
+	require.NoError(t, err)
+	return NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: b}
+}
+
+// mp4MuxerTestSlice returns an I slice of mp4MuxerTestSPS without slice
+// data.
+func mp4MuxerTestSlice(t *testing.T, nalRefIDC uint8, idr bool, frameNum, picOrderCntLsb uint64) NALUnit {
+	w := newBitWriter()
+	write := func(v uint64, n int) {
+		_, err := w.WriteBits(v, n)
+		require.NoError(t, err)
+	}
+	write(1, 1)         // first_mb_in_slice
+	write(0b0001000, 7) // slice_type 7
+	write(1, 1)         // pic_parameter_set_id
+	write(frameNum, 4)
+	if idr {
+		write(1, 1) // idr_pic_id
+	}
+	write(picOrderCntLsb, 4)
+	// dec_ref_pic_marking without operations
+	switch {
+	case idr:
+		write(0, 2)
+	case nalRefIDC != 0:
+		write(0, 1)
+	}
+	// slice_qp_delta and rbsp_stop_one_bit
+	write(0b11, 2)
+
+	nalUnitType := uint8(NALUnitTypeNonIDRSlice)
+	if idr {
+		nalUnitType = NALUnitTypeIDRSlice
+	}
+	return NALUnit{NALRefIDC: nalRefIDC, NALUnitType: nalUnitType, RBSPByte: w.Bytes()}
+}
+
+// mp4MuxerTestFieldSlice returns an I slice of a field of mp4MuxerTestSPS
+// with frame_mbs_only_flag equal to 0.
+func mp4MuxerTestFieldSlice(t *testing.T, nalRefIDC uint8, idr bool, frameNum uint64, bottom bool, picOrderCntLsb uint64) NALUnit {
+	w := newBitWriter()
+	write := func(v uint64, n int) {
+		_, err := w.WriteBits(v, n)
+		require.NoError(t, err)
+	}
+	write(1, 1)         // first_mb_in_slice
+	write(0b0001000, 7) // slice_type 7
+	write(1, 1)         // pic_parameter_set_id
+	write(frameNum, 4)
+	write(1, 1) // field_pic_flag
+	if bottom {
+		write(1, 1)
+	} else {
+		write(0, 1)
+	}
+	if idr {
+		write(1, 1) // idr_pic_id
+	}
+	write(picOrderCntLsb, 4)
+	switch {
+	case idr:
+		write(0, 2)
+	case nalRefIDC != 0:
+		write(0, 1)
+	}
+	write(0b11, 2)
+
+	nalUnitType := uint8(NALUnitTypeNonIDRSlice)
+	if idr {
+		nalUnitType = NALUnitTypeIDRSlice
+	}
+	return NALUnit{NALRefIDC: nalRefIDC, NALUnitType: nalUnitType, RBSPByte: w.Bytes()}
+}
+
+func mp4MuxerTestAnnexB(t *testing.T, aus [][]NALUnit) []byte {
+	buf := &bytes.Buffer{}
+	w := NewAnnexBWriter(buf)
+	for _, au := range aus {
+		require.NoError(t, w.WriteAccessUnit(au))
+	}
+	return buf.Bytes()
+}
+
+// mp4MuxerTestStream returns an Annex B byte stream of access units in
+// decoding order, whose output order is I0 B2 P1 B4 P3 after a leading
+// non-IDR access unit.
+func mp4MuxerTestStream(t *testing.T) ([]byte, [][]NALUnit) {
+	pps := NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xce, 0x38, 0x80}}
+	aus := [][]NALUnit{
+		{mp4MuxerTestSlice(t, 2, false, 3, 2)},
+		{mp4MuxerTestSPS(t, nil), pps, mp4MuxerTestSlice(t, 3, true, 0, 0)},
+		{mp4MuxerTestSlice(t, 2, false, 1, 4)},
+		{mp4MuxerTestSlice(t, 0, false, 2, 2)},
+		{mp4MuxerTestSlice(t, 2, false, 2, 8)},
+		{mp4MuxerTestSlice(t, 0, false, 3, 6)},
+	}
+	return mp4MuxerTestAnnexB(t, aus), aus[1:]
+}
+
+func TestAnnexBToMP4(t *testing.T) {
+	stream, aus := mp4MuxerTestStream(t)
+	var mdat []byte
+	var sizes []byte
+	for _, au := range aus {
+		data, err := mp4SampleData(au)
+		require.NoError(t, err)
+		mdat = append(mdat, data...)
+		sizes = binary.BigEndian.AppendUint32(sizes, uint32(len(data)))
+	}
+
+	for _, tt := range []struct {
+		Name      string
+		FrameRate *MP4FrameRate
+		Timescale uint32
+		Duration  uint32
+	}{
+		{"frame rate of VUI", nil, 60, 2},
+		{"overridden frame rate", &MP4FrameRate{Num: 25, Den: 1}, 25, 1},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			f := &mp4MuxerTestFile{}
+			require.NoError(t, AnnexBToMP4(bytes.NewReader(stream), f, tt.FrameRate))
+			b := f.b
+
+			assert.Equal(t, []string{"ftyp", "mdat", "moov"}, mp4BoxTypes(t, b))
+			assert.Equal(t, mdat, mustFindMP4Box(t, b, "mdat"))
+			// largesize
+			assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x01, 'm', 'd', 'a', 't'}, b[32:40])
+
+			mdhd := mustFindMP4Box(t, b, "moov", "trak", "mdia", "mdhd")
+			assert.Equal(t, tt.Timescale, binary.BigEndian.Uint32(mdhd[12:16]))
+			assert.Equal(t, 5*tt.Duration, binary.BigEndian.Uint32(mdhd[16:20]))
+
+			d := tt.Duration
+			assert.Equal(t, []byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, byte(5 * d), 0x00, 0x00, 0x00, byte(d), 0x00, 0x01, 0x00, 0x00,
+			}, mustFindMP4Box(t, b, "moov", "trak", "edts", "elst"))
+
+			stbl := mustFindMP4Box(t, b, "moov", "trak", "mdia", "minf", "stbl")
+			assert.Equal(t, []string{"stsd", "stts", "ctts", "stss", "stsc", "stsz", "stco"}, mp4BoxTypes(t, stbl))
+			assert.Equal(t, []byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, byte(d),
+			}, mustFindMP4Box(t, stbl, "stts"))
+			assert.Equal(t, []byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x05,
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, byte(d),
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, byte(2 * d),
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, byte(2 * d),
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+			}, mustFindMP4Box(t, stbl, "ctts"))
+			assert.Equal(t, []byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x01,
+			}, mustFindMP4Box(t, stbl, "stss"))
+			assert.Equal(t, []byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x01,
+			}, mustFindMP4Box(t, stbl, "stsc"))
+			assert.Equal(t, append([]byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x05,
+			}, sizes...), mustFindMP4Box(t, stbl, "stsz"))
+			// ftyp and the header of mdat
+			assert.Equal(t, []byte{
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x01,
+				0x00, 0x00, 0x00, 48,
+			}, mustFindMP4Box(t, stbl, "stco"))
+
+			stsd := mustFindMP4Box(t, stbl, "stsd")
+			entry := MP4AVCSampleEntry{}
+			require.NoError(t, entry.UnmarshalBinary(stsd[8:]))
+			assert.Equal(t, uint16(640), entry.Width)
+			assert.Len(t, entry.AVCConfig.SequenceParameterSetNALUnits, 1)
+			assert.Len(t, entry.AVCConfig.PictureParameterSetNALUnits, 1)
+		})
+	}
+
+	t.Run("without reordering", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w := NewAnnexBWriter(buf)
+		for _, au := range aus[:2] {
+			require.NoError(t, w.WriteAccessUnit(au))
+		}
+		f := &mp4MuxerTestFile{}
+		require.NoError(t, AnnexBToMP4(buf, f, nil))
+
+		assert.Equal(t, []string{"tkhd", "mdia"}, mp4BoxTypes(t, mustFindMP4Box(t, f.b, "moov", "trak")))
+		stbl := mustFindMP4Box(t, f.b, "moov", "trak", "mdia", "minf", "stbl")
+		assert.Equal(t, []string{"stsd", "stts", "stss", "stsc", "stsz", "stco"}, mp4BoxTypes(t, stbl))
+	})
+
+	t.Run("frame rate without timing info", func(t *testing.T) {
+		pps := aus[0][1]
+		sps := mp4MuxerTestSPS(t, func(sps *SequenceParameterSet) {
+			sps.VUIParametersPresentFlag = false
+			sps.VUIs = nil
+		})
+		f := &mp4MuxerTestFile{}
+		require.NoError(t, AnnexBToMP4(bytes.NewReader(mp4MuxerTestAnnexB(t, [][]NALUnit{
+			{sps, pps, aus[0][2]},
+			aus[1],
+		})), f, nil))
+
+		mdhd := mustFindMP4Box(t, f.b, "moov", "trak", "mdia", "mdhd")
+		assert.Equal(t, DefaultMP4FrameRate.Num, binary.BigEndian.Uint32(mdhd[12:16]))
+		assert.Equal(t, 2*DefaultMP4FrameRate.Den, binary.BigEndian.Uint32(mdhd[16:20]))
+	})
+
+	t.Run("parameter sets of the same ID", func(t *testing.T) {
+		pps := aus[0][1]
+		sps := mp4MuxerTestSPS(t, func(sps *SequenceParameterSet) {
+			sps.LevelIDC = 31
+		})
+		f := &mp4MuxerTestFile{}
+		require.NoError(t, AnnexBToMP4(bytes.NewReader(mp4MuxerTestAnnexB(t, [][]NALUnit{
+			aus[0],
+			{sps, pps, mp4MuxerTestSlice(t, 3, true, 0, 0)},
+		})), f, nil))
+
+		stsd := mustFindMP4Box(t, f.b, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+		entry := MP4AVCSampleEntry{}
+		require.NoError(t, entry.UnmarshalBinary(stsd[8:]))
+		b, err := sps.MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{b}, entry.AVCConfig.SequenceParameterSetNALUnits)
+		assert.Len(t, entry.AVCConfig.PictureParameterSetNALUnits, 1)
+		// the updated SPS is also in the sample
+		assert.Equal(t, MP4SampleEntryTypeAVC3, entry.Type)
+
+		f = &mp4MuxerTestFile{}
+		require.NoError(t, AnnexBToMP4(bytes.NewReader(mp4MuxerTestAnnexB(t, [][]NALUnit{
+			aus[0],
+			{aus[0][0], pps, mp4MuxerTestSlice(t, 3, true, 0, 0)},
+		})), f, nil))
+		stsd = mustFindMP4Box(t, f.b, "moov", "trak", "mdia", "minf", "stbl", "stsd")
+		require.NoError(t, entry.UnmarshalBinary(stsd[8:]))
+		assert.Equal(t, MP4SampleEntryTypeAVC1, entry.Type)
+	})
+
+	t.Run("field pairs", func(t *testing.T) {
+		pps := aus[0][1]
+		sps := mp4MuxerTestSPS(t, func(sps *SequenceParameterSet) {
+			sps.FrameMbsOnlyFlag = false
+		})
+		fieldAUs := [][]NALUnit{
+			{sps, pps, mp4MuxerTestFieldSlice(t, 3, true, 0, false, 0)},
+			{mp4MuxerTestFieldSlice(t, 3, false, 0, true, 1)},
+			{mp4MuxerTestFieldSlice(t, 2, false, 1, false, 4)},
+			{mp4MuxerTestFieldSlice(t, 2, false, 1, true, 5)},
+			// an unpaired field
+			{mp4MuxerTestFieldSlice(t, 2, false, 2, false, 8)},
+		}
+		var sizes []byte
+		for _, pair := range [][][]NALUnit{fieldAUs[0:2], fieldAUs[2:4], fieldAUs[4:5]} {
+			size := 0
+			for _, au := range pair {
+				data, err := mp4SampleData(au)
+				require.NoError(t, err)
+				size += len(data)
+			}
+			sizes = binary.BigEndian.AppendUint32(sizes, uint32(size))
+		}
+
+		f := &mp4MuxerTestFile{}
+		require.NoError(t, AnnexBToMP4(bytes.NewReader(mp4MuxerTestAnnexB(t, fieldAUs)), f, nil))
+
+		stbl := mustFindMP4Box(t, f.b, "moov", "trak", "mdia", "minf", "stbl")
+		assert.Equal(t, []string{"stsd", "stts", "stss", "stsc", "stsz", "stco"}, mp4BoxTypes(t, stbl))
+		assert.Equal(t, append([]byte{
+			0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x03,
+		}, sizes...), mustFindMP4Box(t, stbl, "stsz"))
+	})
+
+	t.Run("without IDR access units", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, NewAnnexBWriter(buf).WriteAccessUnit(aus[1]))
+		assert.Error(t, AnnexBToMP4(buf, &mp4MuxerTestFile{}, nil))
+	})
+}
+
+func TestMP4CompositionOffsets(t *testing.T) {
+	offsets, delay := mp4CompositionOffsets([]mp4MuxerSample{
+		{poc: 0, reset: true},
+		{poc: 4},
+		{poc: 2},
+		// the second IDR picture is output after all the preceding ones
+		{poc: 0, reset: true},
+		{poc: 8},
+		{poc: 4},
+		{poc: 2},
+	})
+	assert.Equal(t, []uint32{2, 3, 1, 2, 4, 2, 0}, offsets)
+	assert.Equal(t, uint32(2), delay)
+}
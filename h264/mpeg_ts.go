@@ -0,0 +1,72 @@
+package h264
+
+import "github.com/pkg/errors"
+
+const (
+	MPEGTSPacketSize = 188
+	MPEGTSSyncByte   = 0x47
+
+	MPEGTSPIDPAT  = 0x0000
+	MPEGTSPIDNull = 0x1fff
+
+	// MPEGTSStreamTypeH264 is stream_type of AVC video streams in PMT.
+	MPEGTSStreamTypeH264 = 0x1b
+
+	mpegTSTableIDPAT = 0x00
+	mpegTSTableIDPMT = 0x02
+
+	// mpegTSStreamIDVideo is the first stream_id of video streams in PES.
+	mpegTSStreamIDVideo = 0xe0
+
+	// MPEGTSClockRate is the frequency of PTS and DTS.
+	MPEGTSClockRate = 90000
+)
+
+var mpegTSCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// mpegTSCRC32 is CRC_32 of PSI sections (ITU-T H.222.0 Annex A).
+func mpegTSCRC32(b []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, v := range b {
+		crc = crc<<8 ^ mpegTSCRCTable[byte(crc>>24)^v]
+	}
+	return crc
+}
+
+// readMPEGTSTimestamp reads 33 bits of PTS or DTS in PES header.
+func readMPEGTSTimestamp(b []byte) (uint64, error) {
+	if len(b) < 5 {
+		return 0, errors.Errorf("invalid timestamp length: len=%d", len(b))
+	}
+	if b[0]&0x01 == 0 || b[2]&0x01 == 0 || b[4]&0x01 == 0 {
+		return 0, errors.New("invalid timestamp marker_bit")
+	}
+	return uint64(b[0]>>1&0x07)<<30 |
+		uint64(b[1])<<22 |
+		uint64(b[2]>>1)<<15 |
+		uint64(b[3])<<7 |
+		uint64(b[4]>>1), nil
+}
+
+// putMPEGTSTimestamp writes 33 bits of ts with the 4 bits prefix.
+func putMPEGTSTimestamp(b []byte, prefix uint8, ts uint64) {
+	b[0] = prefix<<4 | uint8(ts>>29)&0x0e | 0x01
+	b[1] = uint8(ts >> 22)
+	b[2] = uint8(ts>>14)&0xfe | 0x01
+	b[3] = uint8(ts >> 7)
+	b[4] = uint8(ts<<1) | 0x01
+}
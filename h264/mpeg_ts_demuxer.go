@@ -0,0 +1,359 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// MPEGTSAccessUnit is an access unit demuxed from a transport stream. PTS
+// and DTS are in 90 kHz and taken from the PES packet where the access unit
+// begins.
+type MPEGTSAccessUnit struct {
+	PTS uint64
+	DTS uint64
+	// NoPTS is true when the PES packet where the access unit begins has no
+	// PTS, or another access unit begins earlier in it (2.4.3.7). PTS and DTS
+	// are 0 then.
+	NoPTS    bool
+	NALUnits []NALUnit
+	// RandomAccess is random_access_indicator of the transport stream packet
+	// where the access unit begins.
+	RandomAccess bool
+	// ContinuityError is true when transport stream packets are lost while
+	// the access unit is assembled. The lost PES packet is discarded.
+	ContinuityError bool
+	// Corrupt is true when a corrupt PES packet or NAL unit is discarded
+	// while the access unit is assembled.
+	Corrupt bool
+}
+
+// MPEGTSDemuxer reads access units of the first H.264 stream
+// (stream_type 0x1B) found in PMT. It resynchronizes on the next sync_byte
+// after a broken packet. Malformed packets and PSI sections are dropped and
+// counted.
+type MPEGTSDemuxer struct {
+	// MalformedPackets is the number of transport stream packets dropped for
+	// an invalid adaptation field.
+	MalformedPackets int
+	// MalformedSections is the number of PSI sections dropped for invalid
+	// lengths or CRC errors.
+	MalformedSections int
+
+	r   io.Reader
+	buf []byte
+
+	sections map[uint16][]byte
+	pmtPIDs  map[uint16]bool
+	hasPID   bool
+	pid      uint16
+	lastCC   int
+
+	// pes is the PES packet being received.
+	pes             []byte
+	pesRandomAccess bool
+
+	assembler *AccessUnitAssembler
+	// current holds the fields of the access unit being assembled.
+	current    MPEGTSAccessUnit
+	hasCurrent bool
+
+	pending []MPEGTSAccessUnit
+	eof     bool
+}
+
+func NewMPEGTSDemuxer(r io.Reader) *MPEGTSDemuxer {
+	return &MPEGTSDemuxer{
+		r:         r,
+		buf:       make([]byte, MPEGTSPacketSize),
+		sections:  make(map[uint16][]byte),
+		pmtPIDs:   make(map[uint16]bool),
+		lastCC:    -1,
+		assembler: NewAccessUnitAssembler(),
+	}
+}
+
+// ReadAccessUnit returns the next access unit. It returns io.EOF at the end
+// of the stream.
+func (d *MPEGTSDemuxer) ReadAccessUnit() (MPEGTSAccessUnit, error) {
+	for len(d.pending) == 0 {
+		if d.eof {
+			return MPEGTSAccessUnit{}, io.EOF
+		}
+		if err := d.readPacket(); err != nil {
+			if err != io.EOF {
+				return MPEGTSAccessUnit{}, err
+			}
+			d.eof = true
+			d.flushPES()
+			if au, ok := d.assembler.Flush(); ok {
+				d.complete(au)
+			}
+		}
+	}
+
+	au := d.pending[0]
+	d.pending = d.pending[1:]
+	return au, nil
+}
+
+func (d *MPEGTSDemuxer) readPacket() error {
+	if _, err := io.ReadFull(d.r, d.buf); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+		return errors.Wrap(err, "failed to read transport stream packet")
+	}
+	b := d.buf
+	for b[0] != MPEGTSSyncByte {
+		if err := d.resync(); err != nil {
+			return err
+		}
+	}
+	if b[1]&0x80 != 0 {
+		// transport_error_indicator
+		return nil
+	}
+	pusi := b[1]&0x40 != 0
+	pid := binary.BigEndian.Uint16(b[1:3]) & 0x1fff
+	adaptationFieldControl := b[3] >> 4 & 0x03
+	cc := int(b[3] & 0x0f)
+
+	payload := b[4:]
+	randomAccess := false
+	discontinuity := false
+	if adaptationFieldControl&0x02 != 0 {
+		n := int(payload[0])
+		if n > len(payload)-1 {
+			// invalid adaptation_field_length
+			d.MalformedPackets++
+			if d.hasPID && pid == d.pid && d.pes != nil {
+				d.pes = nil
+				d.current.Corrupt = true
+			}
+			return nil
+		}
+		if n > 0 {
+			discontinuity = payload[1]&0x80 != 0
+			randomAccess = payload[1]&0x40 != 0
+		}
+		payload = payload[1+n:]
+	}
+	if adaptationFieldControl&0x01 == 0 {
+		payload = nil
+	}
+
+	switch {
+	case pid == MPEGTSPIDPAT || d.pmtPIDs[pid]:
+		if err := d.processSection(pid, pusi, payload); err != nil {
+			d.MalformedSections++
+		}
+		return nil
+	case d.hasPID && pid == d.pid:
+		return d.processPES(pusi, cc, adaptationFieldControl&0x01 != 0, discontinuity, randomAccess, payload)
+	}
+	return nil
+}
+
+// processSection reassembles PSI sections of PAT and PMT. It returns an
+// error for a malformed section, which is dropped.
+func (d *MPEGTSDemuxer) processSection(pid uint16, pusi bool, payload []byte) error {
+	if pusi {
+		if len(payload) < 1 || int(payload[0]) > len(payload)-1 {
+			return errors.Errorf("invalid pointer_field: pid=%d", pid)
+		}
+		payload = payload[1+int(payload[0]):]
+		d.sections[pid] = append([]byte{}, payload...)
+	} else if d.sections[pid] != nil {
+		d.sections[pid] = append(d.sections[pid], payload...)
+	}
+
+	section := d.sections[pid]
+	if len(section) < 3 || section[0] == 0xff {
+		return nil
+	}
+	sectionLength := int(binary.BigEndian.Uint16(section[1:3]) & 0x0fff)
+	if len(section) < 3+sectionLength {
+		return nil
+	}
+	section = section[:3+sectionLength]
+	delete(d.sections, pid)
+	if sectionLength < 9 {
+		return errors.Errorf("invalid section_length: pid=%d, length=%d", pid, sectionLength)
+	}
+	if mpegTSCRC32(section) != 0 {
+		return errors.Errorf("CRC error: pid=%d", pid)
+	}
+	// skip to the loop, and exclude CRC_32
+	body := section[8 : len(section)-4]
+
+	switch {
+	case pid == MPEGTSPIDPAT && section[0] == mpegTSTableIDPAT:
+		for ; len(body) >= 4; body = body[4:] {
+			if programNumber := binary.BigEndian.Uint16(body[0:2]); programNumber != 0 {
+				d.pmtPIDs[binary.BigEndian.Uint16(body[2:4])&0x1fff] = true
+			}
+		}
+	case d.pmtPIDs[pid] && section[0] == mpegTSTableIDPMT:
+		if len(body) < 4 {
+			return errors.Errorf("invalid PMT length: pid=%d", pid)
+		}
+		programInfoLength := int(binary.BigEndian.Uint16(body[2:4]) & 0x0fff)
+		if len(body) < 4+programInfoLength {
+			return errors.Errorf("invalid program_info_length: pid=%d", pid)
+		}
+		for body = body[4+programInfoLength:]; len(body) >= 5; {
+			streamType := body[0]
+			esPID := binary.BigEndian.Uint16(body[1:3]) & 0x1fff
+			esInfoLength := int(binary.BigEndian.Uint16(body[3:5]) & 0x0fff)
+			if len(body) < 5+esInfoLength {
+				return errors.Errorf("invalid ES_info_length: pid=%d", pid)
+			}
+			if streamType == MPEGTSStreamTypeH264 && !d.hasPID {
+				d.hasPID = true
+				d.pid = esPID
+			}
+			body = body[5+esInfoLength:]
+		}
+	}
+	return nil
+}
+
+func (d *MPEGTSDemuxer) processPES(pusi bool, cc int, hasPayload, discontinuity, randomAccess bool, payload []byte) error {
+	// continuity_counter is incremented only by packets with payload
+	if hasPayload {
+		expected := (d.lastCC + 1) & 0x0f
+		switch {
+		case d.lastCC < 0 || discontinuity || cc == expected:
+		case cc == d.lastCC:
+			// duplicate packet
+			return nil
+		default:
+			d.lose()
+		}
+		d.lastCC = cc
+	}
+
+	if pusi {
+		d.flushPES()
+		d.pes = append([]byte{}, payload...)
+		d.pesRandomAccess = randomAccess
+		return nil
+	}
+	if d.pes == nil {
+		return nil
+	}
+	d.pes = append(d.pes, payload...)
+	return nil
+}
+
+// lose discards the PES packet being received.
+func (d *MPEGTSDemuxer) lose() {
+	d.pes = nil
+	d.current.ContinuityError = true
+}
+
+// resync moves the next sync_byte in buf to the beginning, and fills buf.
+func (d *MPEGTSDemuxer) resync() error {
+	i := bytes.IndexByte(d.buf[1:], MPEGTSSyncByte) + 1
+	if i == 0 {
+		i = len(d.buf)
+	}
+	n := copy(d.buf, d.buf[i:])
+	if _, err := io.ReadFull(d.r, d.buf[n:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		return errors.Wrap(err, "failed to read transport stream packet")
+	}
+	return nil
+}
+
+// flushPES splits the received PES packet into NAL units and passes them to
+// the assembler. A corrupt PES packet is discarded.
+func (d *MPEGTSDemuxer) flushPES() {
+	pes := d.pes
+	d.pes = nil
+	if pes == nil {
+		return
+	}
+	if err := d.pushPES(pes); err != nil {
+		d.current.Corrupt = true
+	}
+}
+
+func (d *MPEGTSDemuxer) pushPES(pes []byte) error {
+	if len(pes) < 9 || pes[0] != 0x00 || pes[1] != 0x00 || pes[2] != 0x01 {
+		return errors.New("invalid PES packet start code")
+	}
+	if pes[3]&0xf0 != mpegTSStreamIDVideo {
+		return errors.Errorf("unexpected stream_id: %#x", pes[3])
+	}
+	if n := int(binary.BigEndian.Uint16(pes[4:6])); n != 0 && 6+n <= len(pes) {
+		pes = pes[:6+n]
+	}
+	ptsDTSFlags := pes[7] >> 6
+	headerDataLength := int(pes[8])
+	if len(pes) < 9+headerDataLength {
+		return errors.Errorf("invalid PES_header_data_length: %d", headerDataLength)
+	}
+	header := pes[9 : 9+headerDataLength]
+
+	var pts, dts uint64
+	var err error
+	hasPTS := ptsDTSFlags&0x02 != 0
+	if hasPTS {
+		if pts, err = readMPEGTSTimestamp(header); err != nil {
+			return errors.Wrap(err, "failed to read PTS")
+		}
+		dts = pts
+	}
+	if ptsDTSFlags == 0x03 {
+		if len(header) < 10 {
+			return errors.New("invalid PES header length for DTS")
+		}
+		if dts, err = readMPEGTSTimestamp(header[5:10]); err != nil {
+			return errors.Wrap(err, "failed to read DTS")
+		}
+	}
+
+	r := NewAnnexBReader(bytes.NewReader(pes[9+headerDataLength:]))
+	first := true
+	for {
+		nal, _, err := r.ReadNALUnit()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			d.current.Corrupt = true
+			continue
+		}
+		au, completed, err := d.assembler.Push(nal)
+		if err != nil {
+			d.current.Corrupt = true
+			continue
+		}
+		if completed {
+			d.complete(au)
+		}
+		if !d.hasCurrent {
+			d.hasCurrent = true
+			d.current.PTS = pts
+			d.current.DTS = dts
+			d.current.NoPTS = !hasPTS
+			d.current.RandomAccess = first && d.pesRandomAccess
+			// the timestamps are only for the first access unit
+			pts, dts, hasPTS = 0, 0, false
+		}
+		first = false
+	}
+}
+
+func (d *MPEGTSDemuxer) complete(au AccessUnit) {
+	d.current.NALUnits = au.NALUnits
+	d.pending = append(d.pending, d.current)
+	d.current = MPEGTSAccessUnit{}
+	d.hasCurrent = false
+}
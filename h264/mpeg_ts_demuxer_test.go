@@ -0,0 +1,275 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mpegTSTestPackets splits payload into transport stream packets. The first
+// packet has payload_unit_start_indicator and random_access_indicator when
+// randomAccess.
+func mpegTSTestPackets(pid uint16, cc *uint8, randomAccess bool, payload []byte) [][]byte {
+	var packets [][]byte
+	for first := true; first || len(payload) > 0; first = false {
+		p := make([]byte, 4, MPEGTSPacketSize)
+		p[0] = MPEGTSSyncByte
+		binary.BigEndian.PutUint16(p[1:3], pid)
+		if first {
+			p[1] |= 0x40
+		}
+		p[3] = 0x10 | *cc
+		*cc = (*cc + 1) & 0x0f
+
+		var af []byte
+		if first && randomAccess {
+			af = []byte{0x40}
+		}
+		n := len(payload)
+		if n > MPEGTSPacketSize-4-len(af) {
+			n = MPEGTSPacketSize - 4 - len(af)
+			if af != nil {
+				n--
+			}
+		}
+		if af != nil || n < MPEGTSPacketSize-4 {
+			p[3] |= 0x20
+			stuffing := MPEGTSPacketSize - 4 - 1 - len(af) - n
+			if af == nil && stuffing > 0 {
+				af = []byte{0x00}
+				stuffing--
+			}
+			p = append(p, uint8(len(af)+stuffing))
+			p = append(p, af...)
+			p = append(p, bytes.Repeat([]byte{0xff}, stuffing)...)
+		}
+		p = append(p, payload[:n]...)
+		payload = payload[n:]
+		packets = append(packets, p)
+	}
+	return packets
+}
+
+func mpegTSTestSection(tableID uint8, body []byte) []byte {
+	b := []byte{0x00, tableID, 0xb0, 0x00, 0x00, 0x01, 0xc1, 0x00, 0x00}
+	binary.BigEndian.PutUint16(b[2:4], 0xb000|uint16(5+len(body)+4))
+	b = append(b, body...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, mpegTSCRC32(b[1:]))
+	return append(b, crc...)
+}
+
+func mpegTSTestPES(pts, dts uint64, nals [][]byte) []byte {
+	b := []byte{0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0xc0, 0x0a}
+	ts := make([]byte, 10)
+	putMPEGTSTimestamp(ts[0:5], 0x03, pts)
+	putMPEGTSTimestamp(ts[5:10], 0x01, dts)
+	b = append(b, ts...)
+	for _, nal := range nals {
+		b = append(b, 0x00, 0x00, 0x00, 0x01)
+		b = append(b, nal...)
+	}
+	return b
+}
+
+func mustUnmarshalNALUnits(t *testing.T, nals [][]byte) []NALUnit {
+	var units []NALUnit
+	for _, b := range nals {
+		nal := NALUnit{}
+		require.NoError(t, nal.UnmarshalBinary(b))
+		units = append(units, nal)
+	}
+	return units
+}
+
+var mpegTSTestAccessUnits = [][][]byte{
+	{
+		{0x09, 0x10},
+		{0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40},
+		{0x68, 0xce, 0x38, 0x80},
+		append([]byte{0x65, 0x88, 0x84}, bytes.Repeat([]byte{0x5a}, 400)...),
+	},
+	{
+		{0x09, 0x30},
+		{0x41, 0x9a, 0x21, 0x6c},
+	},
+}
+
+// mpegTSTestStream returns packets of PAT, PMT with an audio stream at PID
+// 0x101 and H.264 at 0x100, and mpegTSTestAccessUnits.
+func mpegTSTestStream() [][]byte {
+	return mpegTSTestStreamWithPES(mpegTSTestPES(9000, 6000, mpegTSTestAccessUnits[1]))
+}
+
+// mpegTSTestStreamWithPES returns mpegTSTestStream whose second video PES
+// packet is replaced with pes.
+func mpegTSTestStreamWithPES(pes []byte) [][]byte {
+	var patCC, pmtCC, videoCC, audioCC uint8
+	var packets [][]byte
+	packets = append(packets, mpegTSTestPackets(MPEGTSPIDPAT, &patCC, false, mpegTSTestSection(mpegTSTableIDPAT, []byte{
+		0x00, 0x01, 0xf0, 0x00,
+	}))...)
+	packets = append(packets, mpegTSTestPackets(0x1000, &pmtCC, false, mpegTSTestSection(mpegTSTableIDPMT, []byte{
+		0xe1, 0x00, 0xf0, 0x00,
+		0x0f, 0xe1, 0x01, 0xf0, 0x00,
+		MPEGTSStreamTypeH264, 0xe1, 0x00, 0xf0, 0x00,
+	}))...)
+	packets = append(packets, mpegTSTestPackets(0x100, &videoCC, true, mpegTSTestPES(6000, 3000, mpegTSTestAccessUnits[0]))...)
+	packets = append(packets, mpegTSTestPackets(0x101, &audioCC, true, []byte{0x00, 0x00, 0x01, 0xc0, 0x00, 0x00})...)
+	packets = append(packets, mpegTSTestPackets(0x100, &videoCC, false, pes)...)
+	return packets
+}
+
+func readMPEGTSAccessUnits(t *testing.T, packets [][]byte) []MPEGTSAccessUnit {
+	return readMPEGTSAccessUnitsFrom(t, NewMPEGTSDemuxer(bytes.NewReader(bytes.Join(packets, nil))))
+}
+
+func readMPEGTSAccessUnitsFrom(t *testing.T, d *MPEGTSDemuxer) []MPEGTSAccessUnit {
+	var aus []MPEGTSAccessUnit
+	for {
+		au, err := d.ReadAccessUnit()
+		if err == io.EOF {
+			return aus
+		}
+		require.NoError(t, err)
+		aus = append(aus, au)
+	}
+}
+
+func TestMPEGTSDemuxer_ReadAccessUnit(t *testing.T) {
+	expected := []MPEGTSAccessUnit{
+		{
+			PTS:          6000,
+			DTS:          3000,
+			NALUnits:     mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[0]),
+			RandomAccess: true,
+		},
+		{
+			PTS:      9000,
+			DTS:      6000,
+			NALUnits: mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[1]),
+		},
+	}
+
+	t.Run("demux", func(t *testing.T) {
+		packets := mpegTSTestStream()
+		for _, p := range packets {
+			require.Len(t, p, MPEGTSPacketSize)
+		}
+		assert.Equal(t, expected, readMPEGTSAccessUnits(t, packets))
+	})
+
+	t.Run("duplicate packet", func(t *testing.T) {
+		packets := mpegTSTestStream()
+		packets = append(packets[:4], packets[3:]...)
+		assert.Equal(t, expected, readMPEGTSAccessUnits(t, packets))
+	})
+
+	t.Run("continuity counter error", func(t *testing.T) {
+		packets := mpegTSTestStream()
+		packets = append(packets[:3], packets[4:]...)
+		assert.Equal(t, []MPEGTSAccessUnit{
+			{
+				PTS:             9000,
+				DTS:             6000,
+				NALUnits:        mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[1]),
+				ContinuityError: true,
+			},
+		}, readMPEGTSAccessUnits(t, packets))
+	})
+
+	t.Run("PSI CRC error", func(t *testing.T) {
+		packets := mpegTSTestStream()
+		broken := append([]byte{}, packets[1]...)
+		broken[len(broken)-1] ^= 0xff
+		// the PMT is repeated after the broken one
+		packets = append(packets[:1], append([][]byte{broken}, packets[1:]...)...)
+		d := NewMPEGTSDemuxer(bytes.NewReader(bytes.Join(packets, nil)))
+		assert.Equal(t, expected, readMPEGTSAccessUnitsFrom(t, d))
+		assert.Equal(t, 1, d.MalformedSections)
+		assert.Zero(t, d.MalformedPackets)
+	})
+
+	t.Run("invalid adaptation_field_length", func(t *testing.T) {
+		packets := mpegTSTestStream()
+		packets[2] = append([]byte{}, packets[2]...)
+		packets[2][4] = MPEGTSPacketSize - 4
+		d := NewMPEGTSDemuxer(bytes.NewReader(bytes.Join(packets, nil)))
+		assert.Equal(t, expected[1:], readMPEGTSAccessUnitsFrom(t, d))
+		assert.Equal(t, 1, d.MalformedPackets)
+		assert.Zero(t, d.MalformedSections)
+	})
+
+	t.Run("invalid sync_byte", func(t *testing.T) {
+		packets := mpegTSTestStream()
+		broken := append([]byte{}, packets[3]...)
+		broken[0] = 0x00
+		packets = append(packets[:3], append([][]byte{broken[:100]}, packets[3:]...)...)
+		assert.Equal(t, expected, readMPEGTSAccessUnits(t, packets))
+
+		_, err := NewMPEGTSDemuxer(bytes.NewReader(make([]byte, MPEGTSPacketSize))).ReadAccessUnit()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("PES packet without PTS", func(t *testing.T) {
+		pes := []byte{0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0x00, 0x00}
+		for _, nal := range mpegTSTestAccessUnits[1] {
+			pes = append(append(pes, 0x00, 0x00, 0x00, 0x01), nal...)
+		}
+		assert.Equal(t, []MPEGTSAccessUnit{
+			expected[0],
+			{
+				NoPTS:    true,
+				NALUnits: mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[1]),
+			},
+		}, readMPEGTSAccessUnits(t, mpegTSTestStreamWithPES(pes)))
+	})
+
+	t.Run("access units in a PES packet", func(t *testing.T) {
+		pes := mpegTSTestPES(9000, 6000, mpegTSTestAccessUnits[1])
+		for _, nal := range mpegTSTestAccessUnits[1] {
+			pes = append(append(pes, 0x00, 0x00, 0x00, 0x01), nal...)
+		}
+		assert.Equal(t, []MPEGTSAccessUnit{
+			expected[0],
+			expected[1],
+			{
+				NoPTS:    true,
+				NALUnits: mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[1]),
+			},
+		}, readMPEGTSAccessUnits(t, mpegTSTestStreamWithPES(pes)))
+	})
+
+	t.Run("corrupt PES header", func(t *testing.T) {
+		pes := mpegTSTestPES(9000, 6000, mpegTSTestAccessUnits[1])
+		pes[8] = 0xff // PES_header_data_length
+		actual := readMPEGTSAccessUnits(t, mpegTSTestStreamWithPES(pes))
+		assert.Equal(t, []MPEGTSAccessUnit{
+			{
+				PTS:          6000,
+				DTS:          3000,
+				NALUnits:     mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[0]),
+				RandomAccess: true,
+				Corrupt:      true,
+			},
+		}, actual)
+	})
+
+	t.Run("corrupt NAL unit", func(t *testing.T) {
+		// prefix NAL unit without the header extension
+		nals := [][]byte{mpegTSTestAccessUnits[1][0], {0x6e}, mpegTSTestAccessUnits[1][1]}
+		assert.Equal(t, []MPEGTSAccessUnit{
+			expected[0],
+			{
+				PTS:      9000,
+				DTS:      6000,
+				NALUnits: mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[1]),
+				Corrupt:  true,
+			},
+		}, readMPEGTSAccessUnits(t, mpegTSTestStreamWithPES(mpegTSTestPES(9000, 6000, nals))))
+	})
+}
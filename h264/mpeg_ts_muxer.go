@@ -0,0 +1,221 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMPEGTSPMTPID   = 0x1000
+	DefaultMPEGTSVideoPID = 0x100
+	// DefaultMPEGTSPCRDelay is 700 ms in 90 kHz, the maximum delay of data
+	// through the T-STD buffers except for still picture video (2.4.2.6).
+	DefaultMPEGTSPCRDelay = 63000
+)
+
+// MPEGTSMuxer writes H.264 access units as transport stream packets of a
+// single program. PAT and PMT are written before the first access unit and
+// every random access point. PCR is carried in the video PID with the value
+// of DTS, and PTS and DTS are written with PCRDelay added so that the access
+// units arrive before they are decoded.
+type MPEGTSMuxer struct {
+	PMTPID   uint16
+	VideoPID uint16
+	// PCRDelay is in 90 kHz.
+	PCRDelay uint64
+
+	w       io.Writer
+	started bool
+	patCC   uint8
+	pmtCC   uint8
+	videoCC uint8
+}
+
+func NewMPEGTSMuxer(w io.Writer) *MPEGTSMuxer {
+	return &MPEGTSMuxer{
+		PMTPID:   DefaultMPEGTSPMTPID,
+		VideoPID: DefaultMPEGTSVideoPID,
+		PCRDelay: DefaultMPEGTSPCRDelay,
+		w:        w,
+	}
+}
+
+// WriteAccessUnit writes au as a PES packet. An access unit delimiter is
+// inserted when au does not begin with it. random_access_indicator is set
+// when au is an IDR access unit or au.RandomAccess is true. Neither PTS nor
+// PCR is written when au.NoPTS is true.
+func (m *MPEGTSMuxer) WriteAccessUnit(au MPEGTSAccessUnit) error {
+	randomAccess := au.RandomAccess || AccessUnit{NALUnits: au.NALUnits}.IsIDR()
+	if !m.started || randomAccess {
+		if err := m.writePSI(); err != nil {
+			return err
+		}
+		m.started = true
+	}
+
+	nals := au.NALUnits
+	if len(nals) == 0 || nals[0].NALUnitType != NALUnitTypeAccessUnitDelimiter {
+		// primary_pic_type 7, which allows any slice type
+		aud := NALUnit{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0xf0}}
+		nals = append([]NALUnit{aud}, nals...)
+	}
+	buf := &bytes.Buffer{}
+	if err := NewAnnexBWriter(buf).WriteAccessUnit(nals); err != nil {
+		return err
+	}
+
+	pes := m.pesHeader(au.PTS+m.PCRDelay, au.DTS+m.PCRDelay, !au.NoPTS, buf.Len())
+	pes = append(pes, buf.Bytes()...)
+	return m.writePackets(m.VideoPID, &m.videoCC, pes, &mpegTSAdaptation{
+		pcr:          au.DTS,
+		hasPCR:       !au.NoPTS,
+		randomAccess: randomAccess,
+	})
+}
+
+func (m *MPEGTSMuxer) pesHeader(pts, dts uint64, hasPTS bool, payloadLen int) []byte {
+	headerDataLength := 0
+	ptsDTSFlags := uint8(0x00)
+	switch {
+	case !hasPTS:
+	case dts != pts:
+		headerDataLength = 10
+		ptsDTSFlags = 0x03
+	default:
+		headerDataLength = 5
+		ptsDTSFlags = 0x02
+	}
+	b := make([]byte, 9+headerDataLength)
+	b[0], b[1], b[2] = 0x00, 0x00, 0x01
+	b[3] = mpegTSStreamIDVideo
+	// PES_packet_length 0 is allowed for video in transport streams
+	if n := 3 + headerDataLength + payloadLen; n <= 0xffff {
+		binary.BigEndian.PutUint16(b[4:6], uint16(n))
+	}
+	// marker bits and data_alignment_indicator
+	b[6] = 0x84
+	b[7] = ptsDTSFlags << 6
+	b[8] = uint8(headerDataLength)
+	if ptsDTSFlags&0x02 != 0 {
+		putMPEGTSTimestamp(b[9:14], ptsDTSFlags, pts)
+	}
+	if ptsDTSFlags == 0x03 {
+		putMPEGTSTimestamp(b[14:19], 0x01, dts)
+	}
+	return b
+}
+
+func (m *MPEGTSMuxer) writePSI() error {
+	pat := mpegTSSection(mpegTSTableIDPAT, 1, []byte{
+		0x00, 0x01,
+		0xe0 | uint8(m.PMTPID>>8), uint8(m.PMTPID),
+	})
+	if err := m.writePackets(MPEGTSPIDPAT, &m.patCC, pat, nil); err != nil {
+		return err
+	}
+	pmt := mpegTSSection(mpegTSTableIDPMT, 1, []byte{
+		// PCR_PID
+		0xe0 | uint8(m.VideoPID>>8), uint8(m.VideoPID),
+		// program_info_length
+		0xf0, 0x00,
+		MPEGTSStreamTypeH264,
+		0xe0 | uint8(m.VideoPID>>8), uint8(m.VideoPID),
+		// ES_info_length
+		0xf0, 0x00,
+	})
+	return m.writePackets(m.PMTPID, &m.pmtCC, pmt, nil)
+}
+
+// mpegTSSection returns a PSI section with pointer_field.
+func mpegTSSection(tableID uint8, tableIDExtension uint16, body []byte) []byte {
+	b := make([]byte, 9, 9+len(body)+4)
+	b[1] = tableID
+	// section_syntax_indicator and section_length
+	binary.BigEndian.PutUint16(b[2:4], 0xb000|uint16(5+len(body)+4))
+	binary.BigEndian.PutUint16(b[4:6], tableIDExtension)
+	// version_number 0 and current_next_indicator
+	b[6] = 0xc1
+	b = append(b, body...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, mpegTSCRC32(b[1:]))
+	return append(b, crc...)
+}
+
+// mpegTSAdaptation is the adaptation field of the first packet of a payload.
+type mpegTSAdaptation struct {
+	pcr          uint64
+	hasPCR       bool
+	randomAccess bool
+}
+
+func (a *mpegTSAdaptation) marshal() []byte {
+	if a == nil {
+		return nil
+	}
+	var flags uint8
+	if a.randomAccess {
+		flags |= 0x40
+	}
+	b := []byte{flags}
+	if a.hasPCR {
+		b[0] |= 0x10
+		// program_clock_reference_base with 0 of the extension
+		b = append(b,
+			uint8(a.pcr>>25), uint8(a.pcr>>17), uint8(a.pcr>>9), uint8(a.pcr>>1),
+			uint8(a.pcr<<7)|0x7e, 0x00,
+		)
+	}
+	return b
+}
+
+// writePackets splits payload into packets. The last packet is filled with
+// stuffing bytes in its adaptation field.
+func (m *MPEGTSMuxer) writePackets(pid uint16, cc *uint8, payload []byte, adaptation *mpegTSAdaptation) error {
+	af := adaptation.marshal()
+	for first := true; first || len(payload) > 0; first = false {
+		p := make([]byte, 4, MPEGTSPacketSize)
+		p[0] = MPEGTSSyncByte
+		binary.BigEndian.PutUint16(p[1:3], pid&0x1fff)
+		if first {
+			p[1] |= 0x40
+		} else {
+			af = nil
+		}
+		p[3] = 0x10 | *cc
+		*cc = (*cc + 1) & 0x0f
+
+		space := MPEGTSPacketSize - 4
+		if af != nil {
+			space -= 1 + len(af)
+		}
+		n := len(payload)
+		if n > space {
+			n = space
+		}
+		if af != nil || n < space {
+			stuffing := space - n
+			if af == nil {
+				// adaptation_field_length
+				stuffing--
+				if stuffing > 0 {
+					af = []byte{0x00}
+					stuffing--
+				}
+			}
+			p[3] |= 0x20
+			p = append(p, uint8(len(af)+stuffing))
+			p = append(p, af...)
+			p = append(p, bytes.Repeat([]byte{0xff}, stuffing)...)
+		}
+		p = append(p, payload[:n]...)
+		payload = payload[n:]
+
+		if _, err := m.w.Write(p); err != nil {
+			return errors.Wrap(err, "failed to write transport stream packet")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMPEGTSMuxer_WriteAccessUnit(t *testing.T) {
+	idr := mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[0])[1:]
+	nonIDR := mustUnmarshalNALUnits(t, mpegTSTestAccessUnits[1])
+	aus := []MPEGTSAccessUnit{
+		{PTS: 6000, DTS: 3000, NALUnits: idr},
+		{PTS: 9000, DTS: 6000, NALUnits: nonIDR},
+		{PTS: 12000, DTS: 12000, NALUnits: nonIDR[1:]},
+		{NoPTS: true, NALUnits: nonIDR},
+	}
+
+	buf := &bytes.Buffer{}
+	m := NewMPEGTSMuxer(buf)
+	for _, au := range aus {
+		require.NoError(t, m.WriteAccessUnit(au))
+	}
+	b := buf.Bytes()
+	require.Equal(t, 0, len(b)%MPEGTSPacketSize)
+
+	t.Run("packets", func(t *testing.T) {
+		var pids []uint16
+		var ccs []uint8
+		for i := 0; i < len(b); i += MPEGTSPacketSize {
+			p := b[i : i+MPEGTSPacketSize]
+			require.Equal(t, uint8(MPEGTSSyncByte), p[0])
+			pid := binary.BigEndian.Uint16(p[1:3]) & 0x1fff
+			pids = append(pids, pid)
+			if pid == DefaultMPEGTSVideoPID {
+				ccs = append(ccs, p[3]&0x0f)
+			}
+		}
+		assert.Equal(t, []uint16{
+			MPEGTSPIDPAT, DefaultMPEGTSPMTPID,
+			DefaultMPEGTSVideoPID, DefaultMPEGTSVideoPID, DefaultMPEGTSVideoPID,
+			DefaultMPEGTSVideoPID,
+			DefaultMPEGTSVideoPID,
+			DefaultMPEGTSVideoPID,
+		}, pids)
+		assert.Equal(t, []uint8{0, 1, 2, 3, 4, 5}, ccs)
+
+		// adaptation field with random_access_indicator, PCR_flag and
+		// PCR of 3000
+		first := b[2*MPEGTSPacketSize:]
+		assert.Equal(t, uint8(0x30), first[3]&0xf0)
+		assert.Equal(t, []byte{0x07, 0x50, 0x00, 0x00, 0x05, 0xdc, 0x7e, 0x00}, first[4:12])
+		// no random_access_indicator on non-IDR
+		second := b[5*MPEGTSPacketSize:]
+		assert.Equal(t, uint8(0x10), second[5])
+		// PTS of 6000+63000 after PCR
+		pes := first[12:]
+		assert.Equal(t, []byte{0x00, 0x00, 0x01, mpegTSStreamIDVideo}, pes[0:4])
+		assert.Equal(t, []byte{0x31, 0x00, 0x05, 0x1b, 0x11}, pes[9:14])
+		// neither PCR nor PTS without PTS
+		last := b[7*MPEGTSPacketSize:]
+		assert.Equal(t, uint8(0x00), last[5]&0x10)
+		pes = last[5+last[4]:]
+		assert.Equal(t, []byte{0x00, 0x00, 0x01, mpegTSStreamIDVideo}, pes[0:4])
+		assert.Equal(t, []byte{0x00, 0x00}, pes[7:9])
+	})
+
+	t.Run("demux", func(t *testing.T) {
+		aud := NALUnit{NALUnitType: NALUnitTypeAccessUnitDelimiter, RBSPByte: []byte{0xf0}}
+		d := NewMPEGTSDemuxer(bytes.NewReader(b))
+		for i, au := range []MPEGTSAccessUnit{
+			{PTS: 69000, DTS: 66000, NALUnits: append([]NALUnit{aud}, idr...), RandomAccess: true},
+			{PTS: 72000, DTS: 69000, NALUnits: nonIDR},
+			{PTS: 75000, DTS: 75000, NALUnits: append([]NALUnit{aud}, nonIDR[1:]...)},
+			{NoPTS: true, NALUnits: nonIDR},
+		} {
+			actual, err := d.ReadAccessUnit()
+			require.NoError(t, err, i)
+			assert.Equal(t, au, actual, i)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMPEGTSCRC32(t *testing.T) {
+	// PAT of program_number 1 at PID 0x1000
+	section := []byte{0x00, 0xb0, 0x0d, 0x00, 0x01, 0xc1, 0x00, 0x00, 0x00, 0x01, 0xf0, 0x00}
+	assert.Equal(t, uint32(0x2ab104b2), mpegTSCRC32(section))
+	assert.Equal(t, uint32(0), mpegTSCRC32(append(section, 0x2a, 0xb1, 0x04, 0xb2)))
+}
+
+func TestMPEGTSTimestamp(t *testing.T) {
+	for _, ts := range []uint64{0, 90000, 1<<33 - 1} {
+		b := make([]byte, 5)
+		putMPEGTSTimestamp(b, 0x02, ts)
+		assert.Equal(t, uint8(0x21), b[0]&0xf1)
+		actual, err := readMPEGTSTimestamp(b)
+		require.NoError(t, err)
+		assert.Equal(t, ts, actual)
+	}
+
+	_, err := readMPEGTSTimestamp([]byte{0x20, 0x00, 0x01, 0x00, 0x01})
+	assert.Error(t, err)
+}
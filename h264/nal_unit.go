@@ -15,12 +15,34 @@ type NALUnit struct {
 	RBSPByte       []byte
 }
 
+const (
+	NALUnitTypeNonIDRSlice                   = 1
+	NALUnitTypeSliceDataPartitionA           = 2
+	NALUnitTypeSliceDataPartitionB           = 3
+	NALUnitTypeSliceDataPartitionC           = 4
+	NALUnitTypeIDRSlice                      = 5
+	NALUnitTypeSEI                           = 6
+	NALUnitTypeSequenceParameterSet          = 7
+	NALUnitTypePictureParameterSet           = 8
+	NALUnitTypeAccessUnitDelimiter           = 9
+	NALUnitTypeEndOfSequence                 = 10
+	NALUnitTypeEndOfStream                   = 11
+	NALUnitTypeFillerData                    = 12
+	NALUnitTypeSequenceParameterSetExtension = 13
+	NALUnitTypePrefix                        = 14
+	NALUnitTypeSubsetSequenceParameterSet    = 15
+	NALUnitTypeDepthParameterSet             = 16
+	NALUnitTypeAuxiliarySlice                = 19
+	NALUnitTypeSliceExtension                = 20
+	NALUnitTypeSliceExtensionForDepthView    = 21
+)
+
 func (m NALUnit) MarshalBinary() ([]byte, error) {
 
 	w := newBitWriter()
 
 	if err := w.WriteByte(
-		0x80 | m.NALRefIDC<<5 | m.NALUnitType,
+		m.NALRefIDC<<5 | m.NALUnitType,
 	); err != nil {
 		return nil, err
 	}
@@ -81,6 +103,9 @@ func (m NALUnit) MarshalBinary() ([]byte, error) {
 }
 
 func (m *NALUnit) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return errors.New("empty NAL unit")
+	}
 
 	ind := 0
 
@@ -92,6 +117,9 @@ func (m *NALUnit) UnmarshalBinary(b []byte) error {
 	case 14, 20, 21:
 		var headerBytes []byte
 		var svcExtensionFlag, avc3dExtensionFlag bool
+		if len(b)-ind < 2 || (len(b)-ind < 3 && (m.NALUnitType != 21 || b[ind]>>7 != 1)) {
+			return errors.Errorf("invalid NAL unit header extension length: nal_unit_type=%d, len=%d", m.NALUnitType, len(b)-ind)
+		}
 		if m.NALUnitType != 21 {
 			headerBytes = b[ind : ind+3]
 			svcExtensionFlag = headerBytes[0]>>7 == 1
@@ -15,7 +15,7 @@ var NALUnitTestData = []struct {
 	{
 		Name:   "empty struct",
 		Struct: NALUnit{},
-		Binary: []byte{0x80 /* 0b10000000 */},
+		Binary: []byte{0x00 /* 0b00000000 */},
 	},
 	{
 		Name: "unit type = 14 && with SVCExtension",
@@ -26,7 +26,7 @@ var NALUnitTestData = []struct {
 			RBSPByte:     []byte{0x01, 0x02},
 		},
 		Binary: []byte{
-			0xae,             /* 0b1 000000 | 0b0 01 00000 | 14 (0b00001110) */
+			0x2e,             /* 0b0 000000 | 0b0 01 00000 | 14 (0b00001110) */
 			0x80, 0x00, 0x03, // empty SVCExtension
 			0x01, 0x02, // RBSPByte
 		},
@@ -40,7 +40,7 @@ var NALUnitTestData = []struct {
 			RBSPByte:     []byte{0x01, 0x02},
 		},
 		Binary: []byte{
-			0xae,             /* 0b1 000000 | 0b0 01 00000 | 14 (0b00001110) */
+			0x2e,             /* 0b0 000000 | 0b0 01 00000 | 14 (0b00001110) */
 			0x00, 0x00, 0x00, // empty MVCExtension
 			0x01, 0x02, // RBSPByte
 		},
@@ -54,7 +54,7 @@ var NALUnitTestData = []struct {
 			RBSPByte:     []byte{0x01, 0x02},
 		},
 		Binary: []byte{
-			0xb4,             /* 0b1 000000 | 0b0 01 00000 | 20 (0b00010100) */
+			0x34,             /* 0b0 000000 | 0b0 01 00000 | 20 (0b00010100) */
 			0x80, 0x00, 0x03, // empty SVCExtension
 			0x01, 0x02, // RBSPByte
 		},
@@ -68,7 +68,7 @@ var NALUnitTestData = []struct {
 			RBSPByte:     []byte{0x01, 0x02},
 		},
 		Binary: []byte{
-			0xb4,             /* 0b1 000000 | 0b0 01 00000 | 20 (0b00010100) */
+			0x34,             /* 0b0 000000 | 0b0 01 00000 | 20 (0b00010100) */
 			0x00, 0x00, 0x00, // empty MVCExtension
 			0x01, 0x02, // RBSPByte
 		},
@@ -82,7 +82,7 @@ var NALUnitTestData = []struct {
 			RBSPByte:       []byte{0x01, 0x02},
 		},
 		Binary: []byte{
-			0xb5,       /* 0b1 000000 | 0b0 01 00000 | 21 (0b00010101) */
+			0x35,       /* 0b0 000000 | 0b0 01 00000 | 21 (0b00010101) */
 			0x80, 0x00, // empty AVC3dExtension
 			0x01, 0x02, // RBSPByte
 		},
@@ -96,7 +96,7 @@ var NALUnitTestData = []struct {
 			RBSPByte:     []byte{0x01, 0x02},
 		},
 		Binary: []byte{
-			0xb5,             /* 0b1 000000 | 0b0 01 00000 | 21 (0b00010101) */
+			0x35,             /* 0b0 000000 | 0b0 01 00000 | 21 (0b00010101) */
 			0x00, 0x00, 0x00, // empty MVCExtension
 			0x01, 0x02, // RBSPByte
 		},
@@ -117,7 +117,7 @@ var NALUnitTestData = []struct {
 			},
 		},
 		Binary: []byte{
-			0x80,
+			0x00,
 			0xff, // dummy
 			0x00, 0x00, 0x03, 0x03,
 			0xff, // dummy
@@ -140,7 +140,7 @@ var NALUnitTestData = []struct {
 			},
 		},
 		Binary: []byte{
-			0x80,
+			0x00,
 			0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
 			0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
 			0x03, 0x03, 0x03, 0x03,
@@ -155,7 +155,7 @@ var NALUnitTestData = []struct {
 			},
 		},
 		Binary: []byte{
-			0x80,
+			0x00,
 			0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00, 0x00,
 		},
 	},
@@ -167,7 +167,7 @@ var NALUnitTestData = []struct {
 			},
 		},
 		Binary: []byte{
-			0x80,
+			0x00,
 			0x00, 0x00, 0x03, 0x03, 0x00, 0x00, 0x03, 0x00, 0x00,
 		},
 	},
@@ -194,6 +194,24 @@ func TestNALUnit_UnmarshalBinary(t *testing.T) {
 	}
 }
 
+func TestNALUnit_UnmarshalBinary_Error(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Binary []byte
+	}{
+		{"empty", []byte{}},
+		{"unit type = 14 without extension", []byte{0x2e}},
+		{"unit type = 20 with truncated extension", []byte{0x34, 0x80, 0x00}},
+		{"unit type = 21 with truncated AVC3dExtension", []byte{0x35, 0x80}},
+		{"unit type = 21 with truncated MVCExtension", []byte{0x35, 0x00, 0x00}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := NALUnit{}
+			assert.Error(t, s.UnmarshalBinary(tt.Binary))
+		})
+	}
+}
+
 var NALUnitHeaderSVCExtensionTestData = []struct {
 	Name   string
 	Struct NALUnitHeaderSVCExtension
@@ -0,0 +1,49 @@
+package h264
+
+import "github.com/pkg/errors"
+
+type PictureParameterSetLookup func(id uint64) (PictureParameterSet, bool)
+
+// ParameterSets keeps the latest SPS and PPS for each parameter set ID.
+// Its SequenceParameterSet and PictureParameterSet methods can be used as
+// SequenceParameterSetLookup and PictureParameterSetLookup.
+type ParameterSets struct {
+	SequenceParameterSets map[uint64]SequenceParameterSet
+	PictureParameterSets  map[uint64]PictureParameterSet
+}
+
+func (m *ParameterSets) SequenceParameterSet(id uint64) (SequenceParameterSet, bool) {
+	sps, ok := m.SequenceParameterSets[id]
+	return sps, ok
+}
+
+func (m *ParameterSets) PictureParameterSet(id uint64) (PictureParameterSet, bool) {
+	pps, ok := m.PictureParameterSets[id]
+	return pps, ok
+}
+
+// Update stores the parameter set carried by nal. NAL units other than SPS
+// and PPS are ignored.
+func (m *ParameterSets) Update(nal NALUnit) error {
+	switch nal.NALUnitType {
+	case NALUnitTypeSequenceParameterSet:
+		sps := SequenceParameterSet{}
+		if err := sps.UnmarshalBinary(nal.RBSPByte); err != nil {
+			return errors.Wrap(err, "failed to unmarshal sequence parameter set")
+		}
+		if m.SequenceParameterSets == nil {
+			m.SequenceParameterSets = make(map[uint64]SequenceParameterSet)
+		}
+		m.SequenceParameterSets[sps.SequenceParamterSetID] = sps
+	case NALUnitTypePictureParameterSet:
+		pps := PictureParameterSet{}
+		if err := pps.UnmarshalBinaryWithSPS(nal.RBSPByte, m.SequenceParameterSet); err != nil {
+			return errors.Wrap(err, "failed to unmarshal picture parameter set")
+		}
+		if m.PictureParameterSets == nil {
+			m.PictureParameterSets = make(map[uint64]PictureParameterSet)
+		}
+		m.PictureParameterSets[pps.PictureParameterSetID] = pps
+	}
+	return nil
+}
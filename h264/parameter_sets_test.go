@@ -0,0 +1,58 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameterSets_Update(t *testing.T) {
+	sps := SequenceParameterSet{
+		ProfileIDC:            100,
+		SequenceParamterSetID: 1,
+		ChromaFormatIDC:       3,
+		FrameMbsOnlyFlag:      true,
+	}
+	spsb, err := sps.MarshalBinary()
+	require.NoError(t, err)
+
+	pps := PictureParameterSet{
+		PictureParameterSetID:       2,
+		SequenceParameterSetID:      1,
+		MoreRBSPData:                true,
+		Transform8x8ModeFlag:        true,
+		PicScalingMatrixPresentFlag: true,
+		PicScalingListPresentFlag:   make([]bool, 12),
+		ScalingListDeltaScales:      make([][]int64, 12),
+	}
+	ppsb, err := pps.MarshalBinary()
+	require.NoError(t, err)
+
+	s := ParameterSets{}
+
+	_, ok := s.SequenceParameterSet(1)
+	assert.False(t, ok)
+
+	require.NoError(t, s.Update(NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: spsb}))
+	require.NoError(t, s.Update(NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: ppsb}))
+	require.NoError(t, s.Update(NALUnit{NALUnitType: NALUnitTypeSEI, RBSPByte: []byte{0xff}}))
+
+	gotSPS, ok := s.SequenceParameterSet(1)
+	require.True(t, ok)
+	assert.Equal(t, sps, gotSPS)
+
+	gotPPS, ok := s.PictureParameterSet(2)
+	require.True(t, ok)
+	assert.Equal(t, pps, gotPPS)
+
+	err = s.Update(NALUnit{
+		NALUnitType: NALUnitTypePictureParameterSet,
+		RBSPByte: mustBitToBytes(
+			l,             // PictureParameterSetID
+			o, o, l, o, o, // SequenceParameterSetID
+			l, o, // trailing bits
+		),
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,406 @@
+package h264
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Link types of captured packets.
+const (
+	PcapLinkTypeNull      = 0
+	PcapLinkTypeEthernet  = 1
+	PcapLinkTypeRaw       = 101
+	PcapLinkTypeLinuxSLL  = 113
+	PcapLinkTypeIPv4      = 228
+	PcapLinkTypeIPv6      = 229
+	PcapLinkTypeLinuxSLL2 = 276
+)
+
+const (
+	pcapMagicMicroseconds = 0xa1b2c3d4
+	pcapMagicNanoseconds  = 0xa1b23c4d
+	pcapngByteOrderMagic  = 0x1a2b3c4d
+
+	pcapngBlockTypeSectionHeader       = 0x0a0d0d0a
+	pcapngBlockTypeInterfaceDescriptor = 1
+	pcapngBlockTypeSimplePacket        = 3
+	pcapngBlockTypeEnhancedPacket      = 6
+
+	pcapngOptionIfTSResol = 9
+
+	// pcapMaxBlockSize limits the allocation for a packet or a block.
+	pcapMaxBlockSize = 16 << 20
+)
+
+// PcapPacket is a packet in a capture file.
+type PcapPacket struct {
+	Timestamp time.Time
+	LinkType  uint32
+	Data      []byte
+}
+
+// PcapReader reads packets from a capture file of the classic pcap format or
+// the pcapng format.
+type PcapReader struct {
+	r         io.Reader
+	ng        bool
+	byteOrder binary.ByteOrder
+
+	// classic pcap
+	linkType    uint32
+	nanoseconds bool
+
+	// pcapng
+	interfaces []pcapngInterface
+}
+
+type pcapngInterface struct {
+	linkType uint32
+	// units is the number of timestamp units per second.
+	units uint64
+}
+
+// NewPcapReader reads the file header and detects the format.
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, errors.Wrap(err, "failed to read magic number")
+	}
+	pr := &PcapReader{r: r}
+	if binary.BigEndian.Uint32(magic) == pcapngBlockTypeSectionHeader {
+		pr.ng = true
+		if err := pr.readSectionHeader(); err != nil {
+			return nil, err
+		}
+		return pr, nil
+	}
+
+	switch {
+	case binary.BigEndian.Uint32(magic) == pcapMagicMicroseconds:
+		pr.byteOrder = binary.BigEndian
+	case binary.LittleEndian.Uint32(magic) == pcapMagicMicroseconds:
+		pr.byteOrder = binary.LittleEndian
+	case binary.BigEndian.Uint32(magic) == pcapMagicNanoseconds:
+		pr.byteOrder = binary.BigEndian
+		pr.nanoseconds = true
+	case binary.LittleEndian.Uint32(magic) == pcapMagicNanoseconds:
+		pr.byteOrder = binary.LittleEndian
+		pr.nanoseconds = true
+	default:
+		return nil, errors.Errorf("unknown capture file format: magic=%x", magic)
+	}
+
+	header := make([]byte, 20)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "failed to read file header")
+	}
+	pr.linkType = pr.byteOrder.Uint32(header[16:20]) & 0xffff
+	return pr, nil
+}
+
+// ReadPacket returns the next packet. It returns io.EOF at the end of the
+// file.
+func (r *PcapReader) ReadPacket() (PcapPacket, error) {
+	if r.ng {
+		return r.readPcapngPacket()
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r.r, header); err != nil {
+		if err == io.EOF {
+			return PcapPacket{}, io.EOF
+		}
+		return PcapPacket{}, errors.Wrap(err, "failed to read packet header")
+	}
+	sec := r.byteOrder.Uint32(header[0:4])
+	frac := r.byteOrder.Uint32(header[4:8])
+	capLen := r.byteOrder.Uint32(header[8:12])
+	if capLen > pcapMaxBlockSize {
+		return PcapPacket{}, errors.Errorf("too large packet: len=%d", capLen)
+	}
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return PcapPacket{}, errors.Wrap(err, "failed to read packet data")
+	}
+
+	nsec := int64(frac) * 1000
+	if r.nanoseconds {
+		nsec = int64(frac)
+	}
+	return PcapPacket{
+		Timestamp: time.Unix(int64(sec), nsec),
+		LinkType:  r.linkType,
+		Data:      data,
+	}, nil
+}
+
+func (r *PcapReader) readPcapngPacket() (PcapPacket, error) {
+	for {
+		typeBytes := make([]byte, 4)
+		if _, err := io.ReadFull(r.r, typeBytes); err != nil {
+			if err == io.EOF {
+				return PcapPacket{}, io.EOF
+			}
+			return PcapPacket{}, errors.Wrap(err, "failed to read block type")
+		}
+		if binary.BigEndian.Uint32(typeBytes) == pcapngBlockTypeSectionHeader {
+			if err := r.readSectionHeader(); err != nil {
+				return PcapPacket{}, err
+			}
+			continue
+		}
+
+		blockType := r.byteOrder.Uint32(typeBytes)
+		body, err := r.readBlockBody()
+		if err != nil {
+			return PcapPacket{}, err
+		}
+
+		switch blockType {
+		case pcapngBlockTypeInterfaceDescriptor:
+			if err := r.addInterface(body); err != nil {
+				return PcapPacket{}, err
+			}
+		case pcapngBlockTypeEnhancedPacket:
+			if len(body) < 20 {
+				return PcapPacket{}, errors.Errorf("invalid enhanced packet block length: len=%d", len(body))
+			}
+			id := r.byteOrder.Uint32(body[0:4])
+			if int(id) >= len(r.interfaces) {
+				return PcapPacket{}, errors.Errorf("unknown interface: id=%d", id)
+			}
+			ts := uint64(r.byteOrder.Uint32(body[4:8]))<<32 | uint64(r.byteOrder.Uint32(body[8:12]))
+			capLen := r.byteOrder.Uint32(body[12:16])
+			if uint64(capLen) > uint64(len(body)-20) {
+				return PcapPacket{}, errors.Errorf("invalid captured packet length: len=%d", capLen)
+			}
+			return PcapPacket{
+				Timestamp: r.interfaces[id].time(ts),
+				LinkType:  r.interfaces[id].linkType,
+				Data:      body[20 : 20+capLen],
+			}, nil
+		case pcapngBlockTypeSimplePacket:
+			if len(body) < 4 {
+				return PcapPacket{}, errors.Errorf("invalid simple packet block length: len=%d", len(body))
+			}
+			if len(r.interfaces) == 0 {
+				return PcapPacket{}, errors.New("simple packet block without interface")
+			}
+			data := body[4:]
+			if origLen := r.byteOrder.Uint32(body[0:4]); uint64(origLen) < uint64(len(data)) {
+				data = data[:origLen]
+			}
+			return PcapPacket{
+				LinkType: r.interfaces[0].linkType,
+				Data:     data,
+			}, nil
+		}
+	}
+}
+
+// readSectionHeader reads a section header block after its block type.
+func (r *PcapReader) readSectionHeader() error {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return errors.Wrap(err, "failed to read section header block")
+	}
+	switch {
+	case binary.BigEndian.Uint32(b[4:8]) == pcapngByteOrderMagic:
+		r.byteOrder = binary.BigEndian
+	case binary.LittleEndian.Uint32(b[4:8]) == pcapngByteOrderMagic:
+		r.byteOrder = binary.LittleEndian
+	default:
+		return errors.Errorf("invalid byte-order magic: %x", b[4:8])
+	}
+	length := r.byteOrder.Uint32(b[0:4])
+	if length < 28 || length%4 != 0 || length > pcapMaxBlockSize {
+		return errors.Errorf("invalid section header block length: len=%d", length)
+	}
+	if _, err := io.CopyN(io.Discard, r.r, int64(length)-12); err != nil {
+		return errors.Wrap(err, "failed to read section header block")
+	}
+	r.interfaces = nil
+	return nil
+}
+
+// readBlockBody reads a block after its block type and returns the body
+// without the trailing block total length.
+func (r *PcapReader) readBlockBody() ([]byte, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, errors.Wrap(err, "failed to read block total length")
+	}
+	length := r.byteOrder.Uint32(b)
+	if length < 12 || length%4 != 0 || length > pcapMaxBlockSize {
+		return nil, errors.Errorf("invalid block total length: len=%d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return nil, errors.Wrap(err, "failed to read block")
+	}
+	return body[:len(body)-4], nil
+}
+
+func (r *PcapReader) addInterface(body []byte) error {
+	if len(body) < 8 {
+		return errors.Errorf("invalid interface description block length: len=%d", len(body))
+	}
+	iface := pcapngInterface{
+		linkType: uint32(r.byteOrder.Uint16(body[0:2])),
+		units:    1000000,
+	}
+	options := body[8:]
+	for len(options) >= 4 {
+		code := r.byteOrder.Uint16(options[0:2])
+		n := int(r.byteOrder.Uint16(options[2:4]))
+		if len(options) < 4+n {
+			return errors.Errorf("invalid option length: len=%d", n)
+		}
+		if code == pcapngOptionIfTSResol && n >= 1 {
+			v := options[4]
+			// the units must fit in uint64
+			if v&0x80 == 0 && v > 19 || v&0x80 != 0 && v&0x7f > 63 {
+				return errors.Errorf("invalid if_tsresol: %d", v)
+			}
+			if v&0x80 == 0 {
+				iface.units = uint64(math.Pow10(int(v)))
+			} else {
+				iface.units = 1 << (v & 0x7f)
+			}
+		}
+		options = options[4+(n+3)/4*4:]
+	}
+	r.interfaces = append(r.interfaces, iface)
+	return nil
+}
+
+func (i pcapngInterface) time(ts uint64) time.Time {
+	sec := ts / i.units
+	// the fraction is multiplied in 128 bits not to overflow with fine
+	// resolutions
+	hi, lo := bits.Mul64(ts%i.units, 1000000000)
+	nsec, _ := bits.Div64(hi, lo, i.units)
+	return time.Unix(int64(sec), int64(nsec))
+}
+
+// PcapUDPDatagram is a UDP datagram in a captured packet.
+type PcapUDPDatagram struct {
+	SrcIP   net.IP
+	DstIP   net.IP
+	SrcPort uint16
+	DstPort uint16
+	Payload []byte
+}
+
+// UDPDatagram returns the UDP datagram in p. It returns false when p is not
+// a UDP datagram over IPv4 or IPv6, or is a fragment of it.
+func (p PcapPacket) UDPDatagram() (PcapUDPDatagram, bool) {
+	b := p.Data
+	switch p.LinkType {
+	case PcapLinkTypeNull, PcapLinkTypeRaw, PcapLinkTypeIPv4, PcapLinkTypeIPv6:
+		if p.LinkType == PcapLinkTypeNull {
+			if len(b) < 4 {
+				return PcapUDPDatagram{}, false
+			}
+			b = b[4:]
+		}
+		return parsePcapIP(b)
+	case PcapLinkTypeEthernet:
+		if len(b) < 14 {
+			return PcapUDPDatagram{}, false
+		}
+		etherType := binary.BigEndian.Uint16(b[12:14])
+		b = b[14:]
+		// VLAN tags
+		for etherType == 0x8100 || etherType == 0x88a8 {
+			if len(b) < 4 {
+				return PcapUDPDatagram{}, false
+			}
+			etherType = binary.BigEndian.Uint16(b[2:4])
+			b = b[4:]
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return PcapUDPDatagram{}, false
+		}
+		return parsePcapIP(b)
+	case PcapLinkTypeLinuxSLL:
+		if len(b) < 16 {
+			return PcapUDPDatagram{}, false
+		}
+		return parsePcapIP(b[16:])
+	case PcapLinkTypeLinuxSLL2:
+		if len(b) < 20 {
+			return PcapUDPDatagram{}, false
+		}
+		return parsePcapIP(b[20:])
+	}
+	return PcapUDPDatagram{}, false
+}
+
+func parsePcapIP(b []byte) (PcapUDPDatagram, bool) {
+	if len(b) < 1 {
+		return PcapUDPDatagram{}, false
+	}
+	d := PcapUDPDatagram{}
+	switch b[0] >> 4 {
+	case 4:
+		if len(b) < 20 {
+			return PcapUDPDatagram{}, false
+		}
+		headerLen := int(b[0]&0x0f) * 4
+		totalLen := int(binary.BigEndian.Uint16(b[2:4]))
+		if headerLen < 20 || totalLen < headerLen || len(b) < totalLen {
+			return PcapUDPDatagram{}, false
+		}
+		// more fragments flag or fragment offset
+		if binary.BigEndian.Uint16(b[6:8])&0x3fff != 0 || b[9] != 17 {
+			return PcapUDPDatagram{}, false
+		}
+		d.SrcIP = net.IP(b[12:16])
+		d.DstIP = net.IP(b[16:20])
+		b = b[headerLen:totalLen]
+	case 6:
+		if len(b) < 40 {
+			return PcapUDPDatagram{}, false
+		}
+		payloadLen := int(binary.BigEndian.Uint16(b[4:6]))
+		if len(b) < 40+payloadLen {
+			return PcapUDPDatagram{}, false
+		}
+		nextHeader := b[6]
+		d.SrcIP = net.IP(b[8:24])
+		d.DstIP = net.IP(b[24:40])
+		b = b[40 : 40+payloadLen]
+		// hop-by-hop options, routing and destination options headers
+		for nextHeader == 0 || nextHeader == 43 || nextHeader == 60 {
+			if len(b) < 8 || len(b) < (int(b[1])+1)*8 {
+				return PcapUDPDatagram{}, false
+			}
+			nextHeader = b[0]
+			b = b[(int(b[1])+1)*8:]
+		}
+		if nextHeader != 17 {
+			return PcapUDPDatagram{}, false
+		}
+	default:
+		return PcapUDPDatagram{}, false
+	}
+
+	if len(b) < 8 {
+		return PcapUDPDatagram{}, false
+	}
+	length := int(binary.BigEndian.Uint16(b[4:6]))
+	if length < 8 || len(b) < length {
+		return PcapUDPDatagram{}, false
+	}
+	d.SrcPort = binary.BigEndian.Uint16(b[0:2])
+	d.DstPort = binary.BigEndian.Uint16(b[2:4])
+	d.Payload = b[8:length]
+	return d, true
+}
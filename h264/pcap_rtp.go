@@ -0,0 +1,139 @@
+package h264
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// PcapRTPFilter selects RTP packets in a capture. The zero value selects all
+// UDP datagrams.
+type PcapRTPFilter struct {
+	// Port matches either the source or the destination port when it is not
+	// 0.
+	Port uint16
+	// SSRC matches the SSRC when it is not nil.
+	SSRC *uint32
+}
+
+// PcapRTPReader reads H.264 access units of an RTP stream in a capture file.
+// When Filter has no SSRC, the SSRC of the first selected packet is used so
+// that streams are not mixed. Gaps of sequence numbers are reported as
+// LostPackets of the access units. Malformed packets are dropped and counted
+// in MalformedPackets.
+type PcapRTPReader struct {
+	Filter       PcapRTPFilter
+	Depacketizer *RTPDepacketizer
+	// MalformedPackets is the number of packets dropped since they are not
+	// valid RTP packets or their payloads could not be depacketized. Invalid
+	// RTP packets are counted only when Filter has a port, since other UDP
+	// traffic is not RTP.
+	MalformedPackets int
+
+	r       *PcapReader
+	hasSSRC bool
+	ssrc    uint32
+	pending []RTPAccessUnit
+	eof     bool
+}
+
+func NewPcapRTPReader(r io.Reader, filter PcapRTPFilter) (*PcapRTPReader, error) {
+	pr, err := NewPcapReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &PcapRTPReader{
+		Filter:       filter,
+		Depacketizer: NewRTPDepacketizer(),
+		r:            pr,
+	}, nil
+}
+
+// ReadRTPPacket returns the next selected RTP packet. It returns io.EOF at
+// the end of the file.
+func (r *PcapRTPReader) ReadRTPPacket() (RTPPacket, error) {
+	for {
+		p, err := r.r.ReadPacket()
+		if err != nil {
+			return RTPPacket{}, err
+		}
+		d, ok := p.UDPDatagram()
+		if !ok {
+			continue
+		}
+		if r.Filter.Port != 0 && d.SrcPort != r.Filter.Port && d.DstPort != r.Filter.Port {
+			continue
+		}
+		// RTCP multiplexed on the port (RFC 5761)
+		if len(d.Payload) >= 2 && d.Payload[1] >= 192 && d.Payload[1] <= 223 {
+			continue
+		}
+		pkt := RTPPacket{}
+		if err := pkt.UnmarshalBinary(d.Payload); err != nil || pkt.Version != 2 || len(pkt.Payload) == 0 {
+			if r.Filter.Port != 0 {
+				r.MalformedPackets++
+			}
+			continue
+		}
+		if r.Filter.SSRC != nil && pkt.SSRC != *r.Filter.SSRC {
+			continue
+		}
+		if !r.hasSSRC {
+			r.hasSSRC = true
+			r.ssrc = pkt.SSRC
+		}
+		if pkt.SSRC != r.ssrc {
+			continue
+		}
+		return pkt, nil
+	}
+}
+
+// ReadAccessUnit returns the next access unit. It returns io.EOF at the end
+// of the file.
+func (r *PcapRTPReader) ReadAccessUnit() (RTPAccessUnit, error) {
+	for len(r.pending) == 0 {
+		if r.eof {
+			return RTPAccessUnit{}, io.EOF
+		}
+		pkt, err := r.ReadRTPPacket()
+		if err == io.EOF {
+			r.eof = true
+			r.pending = r.Depacketizer.Flush()
+			continue
+		}
+		if err != nil {
+			return RTPAccessUnit{}, err
+		}
+		r.pending = r.Depacketizer.Push(pkt)
+	}
+
+	au := r.pending[0]
+	r.pending = r.pending[1:]
+	r.MalformedPackets += au.MalformedPackets
+	return au, nil
+}
+
+// WriteAnnexB writes all the access units as an Annex B byte stream and
+// returns the number of lost packets. Malformed packets do not stop it and
+// are counted in MalformedPackets.
+func (r *PcapRTPReader) WriteAnnexB(w io.Writer) (int, error) {
+	aw := NewAnnexBWriter(w)
+	lostPackets := 0
+	for {
+		au, err := r.ReadAccessUnit()
+		if err == io.EOF {
+			return lostPackets, nil
+		}
+		if err != nil {
+			return lostPackets, err
+		}
+		lostPackets += au.LostPackets
+		if len(au.NALUnits) == 0 {
+			continue
+		}
+		if err := aw.WriteAccessUnit(au.NALUnits); err != nil {
+			return lostPackets, errors.Wrapf(err, "failed to write access unit: timestamp=%d", au.Timestamp)
+		}
+	}
+}
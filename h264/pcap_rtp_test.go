@@ -0,0 +1,135 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pcapRTPTestPackets returns UDP packets of rtpDepacketizerTestAccessUnits
+// sent to port 5004 with SSRC 1, mixed with RTCP, another SSRC and another
+// port.
+func pcapRTPTestPackets(t *testing.T, skip int) [][]byte {
+	marshal := func(pkt RTPPacket) []byte {
+		b, err := pkt.MarshalBinary()
+		require.NoError(t, err)
+		return b
+	}
+
+	var packets [][]byte
+	for i, pkt := range mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100) {
+		if i == skip {
+			continue
+		}
+		pkt.SSRC = 1
+		packets = append(packets, pcapTestUDPPacket(40000, 5004, marshal(pkt)))
+
+		other := pkt
+		other.SSRC = 2
+		packets = append(packets, pcapTestUDPPacket(40000, 5004, marshal(other)))
+		packets = append(packets, pcapTestUDPPacket(40002, 6004, marshal(pkt)))
+	}
+	// RTCP receiver report
+	packets = append(packets, pcapTestUDPPacket(40000, 5004, []byte{0x80, 0xc9, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01}))
+	return packets
+}
+
+func TestPcapRTPReader_ReadAccessUnit(t *testing.T) {
+	ssrc := uint32(1)
+
+	for _, tt := range []struct {
+		Name   string
+		File   []byte
+		Filter PcapRTPFilter
+	}{
+		{"pcap with port", pcapTestClassicFile(binary.LittleEndian, PcapLinkTypeEthernet, pcapRTPTestPackets(t, -1)), PcapRTPFilter{Port: 5004}},
+		{"pcapng with SSRC", pcapTestPcapngFile(PcapLinkTypeEthernet, pcapRTPTestPackets(t, -1)), PcapRTPFilter{SSRC: &ssrc}},
+		{"first SSRC", pcapTestPcapngFile(PcapLinkTypeEthernet, pcapRTPTestPackets(t, -1)), PcapRTPFilter{}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			r, err := NewPcapRTPReader(bytes.NewReader(tt.File), tt.Filter)
+			require.NoError(t, err)
+			var aus []RTPAccessUnit
+			for {
+				au, err := r.ReadAccessUnit()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				aus = append(aus, au)
+			}
+			assert.Equal(t, rtpDepacketizerTestAccessUnits, aus)
+		})
+	}
+
+	t.Run("sequence gap", func(t *testing.T) {
+		file := pcapTestClassicFile(binary.LittleEndian, PcapLinkTypeEthernet, pcapRTPTestPackets(t, 4))
+		r, err := NewPcapRTPReader(bytes.NewReader(file), PcapRTPFilter{Port: 5004})
+		require.NoError(t, err)
+		var aus []RTPAccessUnit
+		for {
+			au, err := r.ReadAccessUnit()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			aus = append(aus, au)
+		}
+		require.Len(t, aus, 2)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits[0], aus[0])
+		assert.Equal(t, 1, aus[1].LostPackets)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits[2].NALUnits, aus[1].NALUnits)
+	})
+}
+
+func TestPcapRTPReader_WriteAnnexB(t *testing.T) {
+	file := pcapTestClassicFile(binary.LittleEndian, PcapLinkTypeEthernet, pcapRTPTestPackets(t, 4))
+	r, err := NewPcapRTPReader(bytes.NewReader(file), PcapRTPFilter{Port: 5004})
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	lostPackets, err := r.WriteAnnexB(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 1, lostPackets)
+
+	expected := &bytes.Buffer{}
+	w := NewAnnexBWriter(expected)
+	require.NoError(t, w.WriteAccessUnit(rtpDepacketizerTestAccessUnits[0].NALUnits))
+	require.NoError(t, w.WriteAccessUnit(rtpDepacketizerTestAccessUnits[2].NALUnits))
+	assert.Equal(t, expected.Bytes(), buf.Bytes())
+}
+
+func TestPcapRTPReader_WriteAnnexB_MalformedPackets(t *testing.T) {
+	var packets [][]byte
+	for i, pkt := range mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100) {
+		pkt.SSRC = 1
+		if i == 4 {
+			// STAP-A truncated in the first NAL unit
+			pkt.Payload = []byte{0x18, 0x00, 0x05, 0x67}
+		}
+		b, err := pkt.MarshalBinary()
+		require.NoError(t, err)
+		packets = append(packets, pcapTestUDPPacket(40000, 5004, b))
+		if i == 2 {
+			// truncated RTP header
+			packets = append(packets, pcapTestUDPPacket(40000, 5004, []byte{0x80, 0x60, 0x00}))
+		}
+	}
+	file := pcapTestClassicFile(binary.LittleEndian, PcapLinkTypeEthernet, packets)
+	r, err := NewPcapRTPReader(bytes.NewReader(file), PcapRTPFilter{Port: 5004})
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	lostPackets, err := r.WriteAnnexB(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 0, lostPackets)
+	assert.Equal(t, 2, r.MalformedPackets)
+
+	expected := &bytes.Buffer{}
+	w := NewAnnexBWriter(expected)
+	require.NoError(t, w.WriteAccessUnit(rtpDepacketizerTestAccessUnits[0].NALUnits))
+	require.NoError(t, w.WriteAccessUnit(rtpDepacketizerTestAccessUnits[2].NALUnits))
+	assert.Equal(t, expected.Bytes(), buf.Bytes())
+}
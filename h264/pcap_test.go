@@ -0,0 +1,230 @@
+package h264
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pcapTestUDP(srcPort, dstPort uint16, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(b[0:2], srcPort)
+	binary.BigEndian.PutUint16(b[2:4], dstPort)
+	binary.BigEndian.PutUint16(b[4:6], uint16(8+len(payload)))
+	return append(b, payload...)
+}
+
+func pcapTestIPv4(protocol uint8, payload []byte) []byte {
+	b := make([]byte, 20, 20+len(payload))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:4], uint16(20+len(payload)))
+	b[8] = 64
+	b[9] = protocol
+	copy(b[12:16], net.IPv4(192, 168, 0, 1).To4())
+	copy(b[16:20], net.IPv4(192, 168, 0, 2).To4())
+	return append(b, payload...)
+}
+
+func pcapTestEthernet(etherType uint16, payload []byte) []byte {
+	b := make([]byte, 14, 14+len(payload))
+	binary.BigEndian.PutUint16(b[12:14], etherType)
+	return append(b, payload...)
+}
+
+// pcapTestUDPPacket returns an Ethernet frame of a UDP datagram over IPv4.
+func pcapTestUDPPacket(srcPort, dstPort uint16, payload []byte) []byte {
+	return pcapTestEthernet(0x0800, pcapTestIPv4(17, pcapTestUDP(srcPort, dstPort, payload)))
+}
+
+func pcapTestClassicFile(byteOrder binary.ByteOrder, linkType uint32, packets [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	for _, v := range []interface{}{
+		uint32(pcapMagicMicroseconds), uint16(2), uint16(4), int32(0), uint32(0), uint32(65535), linkType,
+	} {
+		binary.Write(buf, byteOrder, v)
+	}
+	for i, p := range packets {
+		for _, v := range []uint32{1500000000 + uint32(i), 250000, uint32(len(p)), uint32(len(p))} {
+			binary.Write(buf, byteOrder, v)
+		}
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func pcapTestPcapngBlock(blockType uint32, body []byte) []byte {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	b := make([]byte, 8, 12+len(body))
+	binary.LittleEndian.PutUint32(b[0:4], blockType)
+	binary.LittleEndian.PutUint32(b[4:8], uint32(12+len(body)))
+	b = append(b, body...)
+	return append(b, b[4:8]...)
+}
+
+// pcapTestPcapngFile returns a little endian pcapng file with an interface of
+// nanosecond timestamps.
+func pcapTestPcapngFile(linkType uint16, packets [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write(pcapTestPcapngBlock(pcapngBlockTypeSectionHeader, []byte{
+		0x4d, 0x3c, 0x2b, 0x1a, 0x01, 0x00, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	}))
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:2], linkType)
+	idb = append(idb,
+		// if_tsresol
+		0x09, 0x00, 0x01, 0x00, 0x09, 0x00, 0x00, 0x00,
+		// opt_endofopt
+		0x00, 0x00, 0x00, 0x00,
+	)
+	buf.Write(pcapTestPcapngBlock(pcapngBlockTypeInterfaceDescriptor, idb))
+	for i, p := range packets {
+		ts := uint64(1500000000+i)*1000000000 + 250000000
+		epb := make([]byte, 20, 20+len(p))
+		binary.LittleEndian.PutUint32(epb[4:8], uint32(ts>>32))
+		binary.LittleEndian.PutUint32(epb[8:12], uint32(ts))
+		binary.LittleEndian.PutUint32(epb[12:16], uint32(len(p)))
+		binary.LittleEndian.PutUint32(epb[16:20], uint32(len(p)))
+		buf.Write(pcapTestPcapngBlock(pcapngBlockTypeEnhancedPacket, append(epb, p...)))
+	}
+	// a custom block is skipped
+	buf.Write(pcapTestPcapngBlock(0x00000bad, []byte{0x01, 0x02, 0x03, 0x04}))
+	return buf.Bytes()
+}
+
+func readPcapTestPackets(t *testing.T, b []byte) []PcapPacket {
+	r, err := NewPcapReader(bytes.NewReader(b))
+	require.NoError(t, err)
+	var packets []PcapPacket
+	for {
+		p, err := r.ReadPacket()
+		if err == io.EOF {
+			return packets
+		}
+		require.NoError(t, err)
+		packets = append(packets, p)
+	}
+}
+
+func TestPcapReader_ReadPacket(t *testing.T) {
+	packets := [][]byte{
+		pcapTestUDPPacket(5004, 5006, []byte{0x01, 0x02}),
+		pcapTestEthernet(0x0806, make([]byte, 28)),
+	}
+	expected := []PcapPacket{
+		{Timestamp: time.Unix(1500000000, 250000000), LinkType: PcapLinkTypeEthernet, Data: packets[0]},
+		{Timestamp: time.Unix(1500000001, 250000000), LinkType: PcapLinkTypeEthernet, Data: packets[1]},
+	}
+
+	t.Run("pcap little endian", func(t *testing.T) {
+		actual := readPcapTestPackets(t, pcapTestClassicFile(binary.LittleEndian, PcapLinkTypeEthernet, packets))
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("pcap big endian", func(t *testing.T) {
+		actual := readPcapTestPackets(t, pcapTestClassicFile(binary.BigEndian, PcapLinkTypeEthernet, packets))
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("pcapng", func(t *testing.T) {
+		actual := readPcapTestPackets(t, pcapTestPcapngFile(PcapLinkTypeEthernet, packets))
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := NewPcapReader(bytes.NewReader([]byte{0x00, 0x00, 0x00, 0x01, 0x67}))
+		assert.Error(t, err)
+	})
+
+	t.Run("too fine if_tsresol", func(t *testing.T) {
+		for _, v := range []byte{20, 0x80 | 64} {
+			b := pcapTestPcapngFile(PcapLinkTypeEthernet, packets)
+			i := bytes.Index(b, []byte{0x09, 0x00, 0x01, 0x00, 0x09})
+			require.True(t, i >= 0)
+			b[i+4] = v
+			r, err := NewPcapReader(bytes.NewReader(b))
+			if err == nil {
+				_, err = r.ReadPacket()
+			}
+			assert.Error(t, err, "if_tsresol=%d", v)
+		}
+	})
+
+	t.Run("if_tsresol of 19", func(t *testing.T) {
+		assert.Equal(t, time.Unix(1, 500000000), pcapngInterface{units: 10000000000000000000}.time(15000000000000000000))
+	})
+
+	t.Run("truncated packet", func(t *testing.T) {
+		b := pcapTestClassicFile(binary.LittleEndian, PcapLinkTypeEthernet, packets)
+		r, err := NewPcapReader(bytes.NewReader(b[:len(b)-1]))
+		require.NoError(t, err)
+		_, err = r.ReadPacket()
+		require.NoError(t, err)
+		_, err = r.ReadPacket()
+		assert.Error(t, err)
+	})
+}
+
+func TestPcapPacket_UDPDatagram(t *testing.T) {
+	payload := []byte{0x80, 0x60, 0x00, 0x01}
+	udp := pcapTestUDP(5004, 5006, payload)
+
+	ipv6 := make([]byte, 40)
+	ipv6[0] = 0x60
+	binary.BigEndian.PutUint16(ipv6[4:6], uint16(8+len(udp)))
+	// hop-by-hop options header followed by UDP
+	ipv6[6] = 0
+	ipv6[39] = 0x01
+	ipv6 = append(ipv6, 17, 0, 0, 0, 0, 0, 0, 0)
+	ipv6 = append(ipv6, udp...)
+
+	vlan := pcapTestEthernet(0x8100, append([]byte{0x00, 0x01, 0x08, 0x00}, pcapTestIPv4(17, udp)...))
+	null := append([]byte{0x02, 0x00, 0x00, 0x00}, pcapTestIPv4(17, udp)...)
+	sll := append(make([]byte, 16), pcapTestIPv4(17, udp)...)
+	padded := append(pcapTestUDPPacket(5004, 5006, payload), 0x00, 0x00)
+
+	for _, tt := range []struct {
+		Name   string
+		Packet PcapPacket
+		SrcIP  net.IP
+	}{
+		{"Ethernet", PcapPacket{LinkType: PcapLinkTypeEthernet, Data: pcapTestUDPPacket(5004, 5006, payload)}, net.IPv4(192, 168, 0, 1).To4()},
+		{"Ethernet with padding", PcapPacket{LinkType: PcapLinkTypeEthernet, Data: padded}, net.IPv4(192, 168, 0, 1).To4()},
+		{"VLAN", PcapPacket{LinkType: PcapLinkTypeEthernet, Data: vlan}, net.IPv4(192, 168, 0, 1).To4()},
+		{"null", PcapPacket{LinkType: PcapLinkTypeNull, Data: null}, net.IPv4(192, 168, 0, 1).To4()},
+		{"Linux cooked", PcapPacket{LinkType: PcapLinkTypeLinuxSLL, Data: sll}, net.IPv4(192, 168, 0, 1).To4()},
+		{"raw IPv6", PcapPacket{LinkType: PcapLinkTypeRaw, Data: ipv6}, net.IP(ipv6[8:24])},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			d, ok := tt.Packet.UDPDatagram()
+			require.True(t, ok)
+			assert.Equal(t, tt.SrcIP, d.SrcIP)
+			assert.Equal(t, uint16(5004), d.SrcPort)
+			assert.Equal(t, uint16(5006), d.DstPort)
+			assert.Equal(t, payload, d.Payload)
+		})
+	}
+
+	t.Run("not UDP", func(t *testing.T) {
+		fragment := pcapTestUDPPacket(5004, 5006, payload)
+		fragment[14+6] = 0x20
+		for _, p := range []PcapPacket{
+			{LinkType: PcapLinkTypeEthernet, Data: pcapTestEthernet(0x0800, pcapTestIPv4(6, udp))},
+			{LinkType: PcapLinkTypeEthernet, Data: pcapTestEthernet(0x0806, make([]byte, 28))},
+			{LinkType: PcapLinkTypeEthernet, Data: fragment},
+			{LinkType: PcapLinkTypeEthernet, Data: pcapTestUDPPacket(5004, 5006, payload)[:40]},
+			{LinkType: 105, Data: udp},
+		} {
+			_, ok := p.UDPDatagram()
+			assert.False(t, ok)
+		}
+	})
+}
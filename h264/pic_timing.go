@@ -0,0 +1,336 @@
+package h264
+
+import "github.com/pkg/errors"
+
+// PicTiming is pic_timing(), the SEI payload whose payloadType is 1.
+type PicTiming struct {
+	CPBRemovalDelay uint64
+	DPBOutputDelay  uint64
+	PicStruct       uint8
+	// ClockTimestamps has NumClockTS entries derived from PicStruct.
+	ClockTimestamps []ClockTimestamp
+}
+
+type ClockTimestamp struct {
+	ClockTimestampFlag bool
+	CTType             uint8
+	NuitFieldBasedFlag bool
+	CountingType       uint8
+	FullTimestampFlag  bool
+	DiscontinuityFlag  bool
+	CntDroppedFlag     bool
+	NFrames            uint8
+	SecondsFlag        bool
+	SecondsValue       uint8
+	MinutesFlag        bool
+	MinutesValue       uint8
+	HoursFlag          bool
+	HoursValue         uint8
+	TimeOffset         int64
+}
+
+// NumClockTS returns NumClockTS of Table D-1.
+func NumClockTS(picStruct uint8) (int, error) {
+	switch picStruct {
+	case 0, 1, 2:
+		return 1, nil
+	case 3, 4, 7:
+		return 2, nil
+	case 5, 6, 8:
+		return 3, nil
+	}
+	return 0, errors.Errorf("reserved pic_struct: %d", picStruct)
+}
+
+// NewPicTimingDecoder returns the decoder of pic_timing() with the SPS of
+// activeSPSID resolved through lookup at each decoding, since pic_timing()
+// does not refer to its SPS by itself.
+func NewPicTimingDecoder(lookup SequenceParameterSetLookup, activeSPSID func() uint64) SEIPayloadDecoder {
+	return func(payload []byte) (interface{}, error) {
+		id := activeSPSID()
+		sps, ok := lookup(id)
+		if !ok {
+			return nil, errors.Errorf("sequence parameter set is not found: id=%d", id)
+		}
+		m := PicTiming{}
+		if err := m.UnmarshalBinaryWithSPS(payload, sps); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+// picTimingHRD returns the HRD parameters which give the field lengths of
+// pic_timing(). NAL HRD parameters are preferred since both must agree.
+// Without them, time_offset_length is inferred to be 24 (E.2.2).
+func picTimingHRD(vui VideoUsabilityInformation) (HypotheticalReferenceDecoder, bool, error) {
+	switch {
+	case vui.NalHrdParametersPresentFlag:
+		if vui.HrdNal == nil {
+			return HypotheticalReferenceDecoder{}, false, errors.New("NAL HRD parameters are not found")
+		}
+		return *vui.HrdNal, true, nil
+	case vui.VclHrdParametersPresentFlag:
+		if vui.HrdVcl == nil {
+			return HypotheticalReferenceDecoder{}, false, errors.New("VCL HRD parameters are not found")
+		}
+		return *vui.HrdVcl, true, nil
+	}
+	return HypotheticalReferenceDecoder{TimeOffsetLength: 24}, false, nil
+}
+
+func (m PicTiming) MarshalBinaryWithSPS(sps SequenceParameterSet) ([]byte, error) {
+	vui, _ := sps.VUI()
+	hrd, cpbDpbDelaysPresentFlag, err := picTimingHRD(vui)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newBitWriter()
+
+	if cpbDpbDelaysPresentFlag {
+		if _, err := w.WriteBits(m.CPBRemovalDelay, int(hrd.CPBRemovalDelayLengthMinus1)+1); err != nil {
+			return nil, err
+		}
+		if _, err := w.WriteBits(m.DPBOutputDelay, int(hrd.DPBOutputDelayLengthMinus1)+1); err != nil {
+			return nil, err
+		}
+	}
+	if vui.PicStructPresentFlag {
+		numClockTS, err := NumClockTS(m.PicStruct)
+		if err != nil {
+			return nil, err
+		}
+		if len(m.ClockTimestamps) != numClockTS {
+			return nil, errors.Errorf("invalid clock timestamp count: pic_struct=%d, len=%d", m.PicStruct, len(m.ClockTimestamps))
+		}
+		if _, err := w.WriteBits(uint64(m.PicStruct), 4); err != nil {
+			return nil, err
+		}
+		for i := range m.ClockTimestamps {
+			if err := writeClockTimestamp(w, m.ClockTimestamps[i], int(hrd.TimeOffsetLength)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := writeSEIPayloadAlignment(w); err != nil {
+		return nil, err
+	}
+
+	return w.Bytes(), nil
+}
+
+func (m *PicTiming) UnmarshalBinaryWithSPS(b []byte, sps SequenceParameterSet) error {
+	var err error
+	var g uint64
+	r := newBitReader(b)
+
+	vui, _ := sps.VUI()
+	hrd, cpbDpbDelaysPresentFlag, err := picTimingHRD(vui)
+	if err != nil {
+		return err
+	}
+
+	if cpbDpbDelaysPresentFlag {
+		m.CPBRemovalDelay, err = r.ReadBits(int(hrd.CPBRemovalDelayLengthMinus1) + 1)
+		if err != nil {
+			return err
+		}
+		m.DPBOutputDelay, err = r.ReadBits(int(hrd.DPBOutputDelayLengthMinus1) + 1)
+		if err != nil {
+			return err
+		}
+	}
+	if vui.PicStructPresentFlag {
+		g, err = r.ReadBits(4)
+		if err != nil {
+			return err
+		}
+		m.PicStruct = uint8(g)
+		numClockTS, err := NumClockTS(m.PicStruct)
+		if err != nil {
+			return err
+		}
+		m.ClockTimestamps = make([]ClockTimestamp, numClockTS)
+		for i := range m.ClockTimestamps {
+			m.ClockTimestamps[i], err = readClockTimestamp(r, int(hrd.TimeOffsetLength))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeClockTimestamp(w *bitWriter, m ClockTimestamp, timeOffsetLength int) error {
+	if _, err := w.WriteBit(m.ClockTimestampFlag); err != nil {
+		return err
+	}
+	if !m.ClockTimestampFlag {
+		return nil
+	}
+	if _, err := w.WriteBits(uint64(m.CTType), 2); err != nil {
+		return err
+	}
+	if _, err := w.WriteBit(m.NuitFieldBasedFlag); err != nil {
+		return err
+	}
+	if _, err := w.WriteBits(uint64(m.CountingType), 5); err != nil {
+		return err
+	}
+	if _, err := w.WriteBit(
+		m.FullTimestampFlag,
+		m.DiscontinuityFlag,
+		m.CntDroppedFlag,
+	); err != nil {
+		return err
+	}
+	if err := w.WriteByte(m.NFrames); err != nil {
+		return err
+	}
+	if m.FullTimestampFlag {
+		if _, err := w.WriteBits(uint64(m.SecondsValue), 6); err != nil {
+			return err
+		}
+		if _, err := w.WriteBits(uint64(m.MinutesValue), 6); err != nil {
+			return err
+		}
+		if _, err := w.WriteBits(uint64(m.HoursValue), 5); err != nil {
+			return err
+		}
+	} else {
+		if _, err := w.WriteBit(m.SecondsFlag); err != nil {
+			return err
+		}
+		if m.SecondsFlag {
+			if _, err := w.WriteBits(uint64(m.SecondsValue), 6); err != nil {
+				return err
+			}
+			if _, err := w.WriteBit(m.MinutesFlag); err != nil {
+				return err
+			}
+			if m.MinutesFlag {
+				if _, err := w.WriteBits(uint64(m.MinutesValue), 6); err != nil {
+					return err
+				}
+				if _, err := w.WriteBit(m.HoursFlag); err != nil {
+					return err
+				}
+				if m.HoursFlag {
+					if _, err := w.WriteBits(uint64(m.HoursValue), 5); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	if timeOffsetLength > 0 {
+		if _, err := w.WriteBits(uint64(m.TimeOffset), timeOffsetLength); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readClockTimestamp(r *bitReader, timeOffsetLength int) (m ClockTimestamp, err error) {
+	var g uint64
+
+	m.ClockTimestampFlag, err = r.ReadBit()
+	if err != nil {
+		return m, err
+	}
+	if !m.ClockTimestampFlag {
+		return m, nil
+	}
+	g, err = r.ReadBits(2)
+	if err != nil {
+		return m, err
+	}
+	m.CTType = uint8(g)
+	m.NuitFieldBasedFlag, err = r.ReadBit()
+	if err != nil {
+		return m, err
+	}
+	g, err = r.ReadBits(5)
+	if err != nil {
+		return m, err
+	}
+	m.CountingType = uint8(g)
+	m.FullTimestampFlag, err = r.ReadBit()
+	if err != nil {
+		return m, err
+	}
+	m.DiscontinuityFlag, err = r.ReadBit()
+	if err != nil {
+		return m, err
+	}
+	m.CntDroppedFlag, err = r.ReadBit()
+	if err != nil {
+		return m, err
+	}
+	m.NFrames, err = r.ReadByte()
+	if err != nil {
+		return m, err
+	}
+	if m.FullTimestampFlag {
+		g, err = r.ReadBits(6)
+		if err != nil {
+			return m, err
+		}
+		m.SecondsValue = uint8(g)
+		g, err = r.ReadBits(6)
+		if err != nil {
+			return m, err
+		}
+		m.MinutesValue = uint8(g)
+		g, err = r.ReadBits(5)
+		if err != nil {
+			return m, err
+		}
+		m.HoursValue = uint8(g)
+	} else {
+		m.SecondsFlag, err = r.ReadBit()
+		if err != nil {
+			return m, err
+		}
+		if m.SecondsFlag {
+			g, err = r.ReadBits(6)
+			if err != nil {
+				return m, err
+			}
+			m.SecondsValue = uint8(g)
+			m.MinutesFlag, err = r.ReadBit()
+			if err != nil {
+				return m, err
+			}
+			if m.MinutesFlag {
+				g, err = r.ReadBits(6)
+				if err != nil {
+					return m, err
+				}
+				m.MinutesValue = uint8(g)
+				m.HoursFlag, err = r.ReadBit()
+				if err != nil {
+					return m, err
+				}
+				if m.HoursFlag {
+					g, err = r.ReadBits(5)
+					if err != nil {
+						return m, err
+					}
+					m.HoursValue = uint8(g)
+				}
+			}
+		}
+	}
+	if timeOffsetLength > 0 {
+		g, err = r.ReadBits(timeOffsetLength)
+		if err != nil {
+			return m, err
+		}
+		// i(v): two's complement
+		m.TimeOffset = int64(g<<uint(64-timeOffsetLength)) >> uint(64-timeOffsetLength)
+	}
+	return m, nil
+}
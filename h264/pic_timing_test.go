@@ -0,0 +1,223 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var picTimingTestSPS = SequenceParameterSet{
+	VUIParametersPresentFlag: true,
+	VUIs: []VideoUsabilityInformation{
+		{
+			NalHrdParametersPresentFlag: true,
+			HrdNal: &HypotheticalReferenceDecoder{
+				CPBRemovalDelayLengthMinus1: 7,
+				DPBOutputDelayLengthMinus1:  3,
+				TimeOffsetLength:            5,
+			},
+			PicStructPresentFlag: true,
+		},
+	},
+}
+
+var PicTimingTestData = []struct {
+	Name   string
+	SPS    SequenceParameterSet
+	Struct PicTiming
+	Binary []byte
+}{
+	{
+		Name:   "without VUI",
+		SPS:    SequenceParameterSet{},
+		Struct: PicTiming{},
+		Binary: []byte{},
+	},
+	{
+		Name: "frame without clock timestamp",
+		SPS:  picTimingTestSPS,
+		Struct: PicTiming{
+			CPBRemovalDelay: 0xa5,
+			DPBOutputDelay:  0x3,
+			PicStruct:       0,
+			ClockTimestamps: []ClockTimestamp{
+				{},
+			},
+		},
+		Binary: mustBitToBytes(
+			l, o, l, o, o, l, o, l, // CPBRemovalDelay
+			o, o, l, l, // DPBOutputDelay
+			o, o, o, o, // PicStruct
+			o,                   // ClockTimestampFlag[0]
+			l, o, o, o, o, o, o, // alignment
+		),
+	},
+	{
+		Name: "top bottom with full and partial timestamps",
+		SPS:  picTimingTestSPS,
+		Struct: PicTiming{
+			PicStruct: 3,
+			ClockTimestamps: []ClockTimestamp{
+				{
+					ClockTimestampFlag: true,
+					CTType:             2,
+					NuitFieldBasedFlag: true,
+					CountingType:       4,
+					FullTimestampFlag:  true,
+					CntDroppedFlag:     true,
+					NFrames:            0x12,
+					SecondsValue:       30,
+					MinutesValue:       15,
+					HoursValue:         1,
+					TimeOffset:         -3,
+				},
+				{
+					ClockTimestampFlag: true,
+					SecondsFlag:        true,
+					SecondsValue:       1,
+					MinutesFlag:        true,
+					MinutesValue:       2,
+					TimeOffset:         3,
+				},
+			},
+		},
+		Binary: mustBitToBytes(
+			o, o, o, o, o, o, o, o, // CPBRemovalDelay
+			o, o, o, o, // DPBOutputDelay
+			o, o, l, l, // PicStruct
+
+			l,    // ClockTimestampFlag[0]
+			l, o, // CTType
+			l,             // NuitFieldBasedFlag
+			o, o, l, o, o, // CountingType
+			l,                      // FullTimestampFlag
+			o,                      // DiscontinuityFlag
+			l,                      // CntDroppedFlag
+			o, o, o, l, o, o, l, o, // NFrames
+			o, l, l, l, l, o, // SecondsValue
+			o, o, l, l, l, l, // MinutesValue
+			o, o, o, o, l, // HoursValue
+			l, l, l, o, l, // TimeOffset
+
+			l,    // ClockTimestampFlag[1]
+			o, o, // CTType
+			o,             // NuitFieldBasedFlag
+			o, o, o, o, o, // CountingType
+			o,                      // FullTimestampFlag
+			o,                      // DiscontinuityFlag
+			o,                      // CntDroppedFlag
+			o, o, o, o, o, o, o, o, // NFrames
+			l,                // SecondsFlag
+			o, o, o, o, o, l, // SecondsValue
+			l,                // MinutesFlag
+			o, o, o, o, l, o, // MinutesValue
+			o,             // HoursFlag
+			o, o, o, l, l, // TimeOffset
+			l, o, o, o, o, o, // alignment
+		),
+	},
+}
+
+func TestPicTiming_MarshalBinaryWithSPS(t *testing.T) {
+	for _, tt := range PicTimingTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := tt.Struct.MarshalBinaryWithSPS(tt.SPS)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+
+	t.Run("reserved pic_struct", func(t *testing.T) {
+		_, err := PicTiming{PicStruct: 9}.MarshalBinaryWithSPS(picTimingTestSPS)
+		assert.Error(t, err)
+	})
+}
+
+func TestPicTiming_UnmarshalBinaryWithSPS(t *testing.T) {
+	for _, tt := range PicTimingTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := PicTiming{}
+			err := s.UnmarshalBinaryWithSPS(tt.Binary, tt.SPS)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+}
+
+func TestNewPicTimingDecoder(t *testing.T) {
+	r := SEIPayloadRegistry{}
+	spsID := uint64(0)
+	r.Register(SEIPayloadTypePicTiming, NewPicTimingDecoder(func(id uint64) (SequenceParameterSet, bool) {
+		return picTimingTestSPS, id == 0
+	}, func() uint64 {
+		return spsID
+	}))
+
+	v, err := r.Decode(SEIMessage{
+		PayloadType: SEIPayloadTypePicTiming,
+		PayloadByte: PicTimingTestData[2].Binary,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PicTimingTestData[2].Struct, v)
+
+	spsID = 1
+	_, err = r.Decode(SEIMessage{
+		PayloadType: SEIPayloadTypePicTiming,
+		PayloadByte: PicTimingTestData[2].Binary,
+	})
+	assert.Error(t, err)
+}
+
+func TestPicTiming_withoutHRDParameters(t *testing.T) {
+	sps := SequenceParameterSet{
+		VUIParametersPresentFlag: true,
+		VUIs: []VideoUsabilityInformation{
+			{PicStructPresentFlag: true},
+		},
+	}
+	want := PicTiming{
+		ClockTimestamps: []ClockTimestamp{
+			{ClockTimestampFlag: true, NFrames: 1, TimeOffset: -1},
+		},
+	}
+	// time_offset_length is inferred to be 24
+	binary := mustBitToBytes(
+		o, o, o, o, // PicStruct
+		l,    // ClockTimestampFlag
+		o, o, // CTType
+		o,             // NuitFieldBasedFlag
+		o, o, o, o, o, // CountingType
+		o, o, o, // FullTimestampFlag, DiscontinuityFlag, CntDroppedFlag
+		o, o, o, o, o, o, o, l, // NFrames
+		o,                      // SecondsFlag
+		l, l, l, l, l, l, l, l, // TimeOffset
+		l, l, l, l, l, l, l, l,
+		l, l, l, l, l, l, l, l,
+		l, o, o, o, o, o, o, // alignment
+	)
+
+	b, err := want.MarshalBinaryWithSPS(sps)
+	require.NoError(t, err)
+	assert.Equal(t, binary, b)
+
+	s := PicTiming{}
+	require.NoError(t, s.UnmarshalBinaryWithSPS(binary, sps))
+	assert.Equal(t, want, s)
+}
+
+func TestPicTiming_withoutHRDPointer(t *testing.T) {
+	for _, vui := range []VideoUsabilityInformation{
+		{NalHrdParametersPresentFlag: true},
+		{VclHrdParametersPresentFlag: true},
+	} {
+		sps := SequenceParameterSet{
+			VUIParametersPresentFlag: true,
+			VUIs:                     []VideoUsabilityInformation{vui},
+		}
+		_, err := PicTiming{}.MarshalBinaryWithSPS(sps)
+		assert.Error(t, err)
+		s := PicTiming{}
+		assert.Error(t, s.UnmarshalBinaryWithSPS([]byte{0xff, 0xff}, sps))
+	}
+}
@@ -0,0 +1,158 @@
+package h264
+
+import "github.com/pkg/errors"
+
+// PicOrderCntDecoder derives PicOrderCnt of primary coded pictures passed in
+// decoding order (8.2.1).
+type PicOrderCntDecoder struct {
+	started bool
+
+	// of the previous reference picture for pic_order_cnt_type 0
+	prevPicOrderCntMsb int64
+	prevPicOrderCntLsb int64
+
+	// of the previous picture for pic_order_cnt_type 1 and 2
+	prevFrameNumOffset int64
+	prevFrameNum       uint64
+}
+
+func NewPicOrderCntDecoder() *PicOrderCntDecoder {
+	return &PicOrderCntDecoder{}
+}
+
+// Decode returns PicOrderCnt of the picture of a slice header. reset is true
+// when the picture is an IDR picture or has memory_management_control_operation
+// equal to 5, where the following pictures are output after the preceding
+// ones. PicOrderCnt of such a picture with memory_management_control_operation
+// equal to 5 is the value after the operation.
+func (d *PicOrderCntDecoder) Decode(sps SequenceParameterSet, nalRefIDC uint8, idrPicFlag bool, header SliceHeader) (poc int64, reset bool, err error) {
+	mmco5 := hasMMCO5(header)
+	var top, bottom int64
+
+	switch sps.PicOrderCntType {
+	case 0:
+		if idrPicFlag || !d.started {
+			d.prevPicOrderCntMsb = 0
+			d.prevPicOrderCntLsb = 0
+		}
+		maxPicOrderCntLsb := int64(1) << (sps.Log2MaxPicOrderCntLsbMinus4 + 4)
+		lsb := int64(header.PicOrderCntLsb)
+		msb := d.prevPicOrderCntMsb
+		switch {
+		case lsb < d.prevPicOrderCntLsb && d.prevPicOrderCntLsb-lsb >= maxPicOrderCntLsb/2:
+			msb += maxPicOrderCntLsb
+		case lsb > d.prevPicOrderCntLsb && lsb-d.prevPicOrderCntLsb > maxPicOrderCntLsb/2:
+			msb -= maxPicOrderCntLsb
+		}
+		top = msb + lsb
+		bottom = top + header.DeltaPicOrderCntBottom
+		if header.FieldPicFlag {
+			bottom = msb + lsb
+		}
+		if nalRefIDC != 0 {
+			d.prevPicOrderCntMsb = msb
+			d.prevPicOrderCntLsb = lsb
+		}
+
+	case 1, 2:
+		maxFrameNum := int64(1) << (sps.Log2MaxFrameNumMinus4 + 4)
+		frameNumOffset := d.prevFrameNumOffset
+		switch {
+		case idrPicFlag || !d.started:
+			frameNumOffset = 0
+		case d.prevFrameNum > header.FrameNum:
+			frameNumOffset += maxFrameNum
+		}
+		d.prevFrameNumOffset = frameNumOffset
+		d.prevFrameNum = header.FrameNum
+
+		if sps.PicOrderCntType == 1 {
+			top, bottom = picOrderCntType1(sps, nalRefIDC, frameNumOffset, header)
+			break
+		}
+		temp := 2 * (frameNumOffset + int64(header.FrameNum))
+		switch {
+		case idrPicFlag:
+			temp = 0
+		case nalRefIDC == 0:
+			temp--
+		}
+		top, bottom = temp, temp
+
+	default:
+		return 0, false, errors.Errorf("invalid pic_order_cnt_type: %d", sps.PicOrderCntType)
+	}
+	d.started = true
+
+	poc = top
+	switch {
+	case header.FieldPicFlag && header.BottomFieldFlag:
+		poc = bottom
+	case !header.FieldPicFlag && bottom < top:
+		poc = bottom
+	}
+
+	if mmco5 {
+		// tempPicOrderCnt is subtracted from the field order counts
+		d.prevPicOrderCntMsb = 0
+		d.prevPicOrderCntLsb = 0
+		if !(header.FieldPicFlag && header.BottomFieldFlag) {
+			d.prevPicOrderCntLsb = top - poc
+		}
+		d.prevFrameNumOffset = 0
+		d.prevFrameNum = 0
+		poc = 0
+	}
+	return poc, idrPicFlag || mmco5, nil
+}
+
+// picOrderCntType1 returns TopFieldOrderCnt and BottomFieldOrderCnt of
+// pic_order_cnt_type 1 (8.2.1.2).
+func picOrderCntType1(sps SequenceParameterSet, nalRefIDC uint8, frameNumOffset int64, header SliceHeader) (int64, int64) {
+	n := int64(len(sps.OffsetForRefFrame))
+	absFrameNum := int64(0)
+	if n != 0 {
+		absFrameNum = frameNumOffset + int64(header.FrameNum)
+	}
+	if nalRefIDC == 0 && absFrameNum > 0 {
+		absFrameNum--
+	}
+
+	expectedPicOrderCnt := int64(0)
+	if absFrameNum > 0 {
+		picOrderCntCycleCnt := (absFrameNum - 1) / n
+		frameNumInPicOrderCntCycle := (absFrameNum - 1) % n
+		expectedDeltaPerPicOrderCntCycle := int64(0)
+		for _, offset := range sps.OffsetForRefFrame {
+			expectedDeltaPerPicOrderCntCycle += offset
+		}
+		expectedPicOrderCnt = picOrderCntCycleCnt * expectedDeltaPerPicOrderCntCycle
+		for i := int64(0); i <= frameNumInPicOrderCntCycle; i++ {
+			expectedPicOrderCnt += sps.OffsetForRefFrame[i]
+		}
+	}
+	if nalRefIDC == 0 {
+		expectedPicOrderCnt += sps.OffsetForNonRefPic
+	}
+
+	if header.FieldPicFlag {
+		if header.BottomFieldFlag {
+			return 0, expectedPicOrderCnt + sps.OffsetForTopToBottomField + header.DeltaPicOrderCnt[0]
+		}
+		return expectedPicOrderCnt + header.DeltaPicOrderCnt[0], 0
+	}
+	top := expectedPicOrderCnt + header.DeltaPicOrderCnt[0]
+	return top, top + sps.OffsetForTopToBottomField + header.DeltaPicOrderCnt[1]
+}
+
+func hasMMCO5(header SliceHeader) bool {
+	if header.DecRefPicMarking == nil {
+		return false
+	}
+	for _, o := range header.DecRefPicMarking.MemoryManagementControlOperations {
+		if o.MemoryManagementControlOperation == 5 {
+			return true
+		}
+	}
+	return false
+}
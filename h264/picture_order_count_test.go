@@ -0,0 +1,116 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type picOrderCntTestPicture struct {
+	NALRefIDC   uint8
+	IDRPicFlag  bool
+	Header      SliceHeader
+	PicOrderCnt int64
+	Reset       bool
+}
+
+func TestPicOrderCntDecoder_Decode(t *testing.T) {
+	mmco5 := &DecRefPicMarking{
+		AdaptiveRefPicMarkingModeFlag: true,
+		MemoryManagementControlOperations: []MemoryManagementControlOperation{
+			{MemoryManagementControlOperation: 5},
+		},
+	}
+
+	for _, tt := range []struct {
+		Name     string
+		SPS      SequenceParameterSet
+		Pictures []picOrderCntTestPicture
+	}{
+		{
+			Name: "type 0 with wrapping pic_order_cnt_lsb",
+			SPS:  SequenceParameterSet{PicOrderCntType: 0, Log2MaxPicOrderCntLsbMinus4: 0},
+			Pictures: []picOrderCntTestPicture{
+				{NALRefIDC: 3, IDRPicFlag: true, Header: SliceHeader{PicOrderCntLsb: 0}, PicOrderCnt: 0, Reset: true},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 8}, PicOrderCnt: 8},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 14}, PicOrderCnt: 14},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 4}, PicOrderCnt: 20},
+				// non-reference pictures do not update prevPicOrderCntMsb
+				{NALRefIDC: 0, Header: SliceHeader{PicOrderCntLsb: 2}, PicOrderCnt: 18},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 12}, PicOrderCnt: 28},
+				{NALRefIDC: 3, IDRPicFlag: true, Header: SliceHeader{PicOrderCntLsb: 0}, PicOrderCnt: 0, Reset: true},
+			},
+		},
+		{
+			Name: "type 0 with delta_pic_order_cnt_bottom",
+			SPS:  SequenceParameterSet{PicOrderCntType: 0, Log2MaxPicOrderCntLsbMinus4: 2},
+			Pictures: []picOrderCntTestPicture{
+				{NALRefIDC: 3, IDRPicFlag: true, Header: SliceHeader{PicOrderCntLsb: 0, DeltaPicOrderCntBottom: 1}, PicOrderCnt: 0, Reset: true},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 4, DeltaPicOrderCntBottom: -1}, PicOrderCnt: 3},
+			},
+		},
+		{
+			Name: "type 0 with memory_management_control_operation 5",
+			SPS:  SequenceParameterSet{PicOrderCntType: 0, Log2MaxPicOrderCntLsbMinus4: 0},
+			Pictures: []picOrderCntTestPicture{
+				{NALRefIDC: 3, IDRPicFlag: true, Header: SliceHeader{PicOrderCntLsb: 0}, PicOrderCnt: 0, Reset: true},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 6}, PicOrderCnt: 6},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 10, DecRefPicMarking: mmco5}, PicOrderCnt: 0, Reset: true},
+				{NALRefIDC: 2, Header: SliceHeader{PicOrderCntLsb: 2}, PicOrderCnt: 2},
+			},
+		},
+		{
+			Name: "type 1",
+			SPS: SequenceParameterSet{
+				PicOrderCntType:                1,
+				Log2MaxFrameNumMinus4:          0,
+				OffsetForNonRefPic:             -2,
+				OffsetForTopToBottomField:      1,
+				NumRefFramesInPicOrderCntCycle: 2,
+				OffsetForRefFrame:              []int64{4, 2},
+			},
+			Pictures: []picOrderCntTestPicture{
+				{NALRefIDC: 3, IDRPicFlag: true, Header: SliceHeader{FrameNum: 0}, PicOrderCnt: 0, Reset: true},
+				{NALRefIDC: 2, Header: SliceHeader{FrameNum: 1}, PicOrderCnt: 4},
+				{NALRefIDC: 0, Header: SliceHeader{FrameNum: 2}, PicOrderCnt: 2},
+				{NALRefIDC: 2, Header: SliceHeader{FrameNum: 2}, PicOrderCnt: 6},
+				{NALRefIDC: 2, Header: SliceHeader{FrameNum: 3, DeltaPicOrderCnt: [2]int64{1, -3}}, PicOrderCnt: 9},
+			},
+		},
+		{
+			Name: "type 2 with wrapping frame_num",
+			SPS:  SequenceParameterSet{PicOrderCntType: 2, Log2MaxFrameNumMinus4: 0},
+			Pictures: []picOrderCntTestPicture{
+				{NALRefIDC: 3, IDRPicFlag: true, Header: SliceHeader{FrameNum: 0}, PicOrderCnt: 0, Reset: true},
+				{NALRefIDC: 2, Header: SliceHeader{FrameNum: 15}, PicOrderCnt: 30},
+				{NALRefIDC: 0, Header: SliceHeader{FrameNum: 0}, PicOrderCnt: 31},
+				{NALRefIDC: 2, Header: SliceHeader{FrameNum: 0}, PicOrderCnt: 32},
+			},
+		},
+		{
+			Name: "type 2 with fields",
+			SPS:  SequenceParameterSet{PicOrderCntType: 2, Log2MaxFrameNumMinus4: 0},
+			Pictures: []picOrderCntTestPicture{
+				{NALRefIDC: 3, IDRPicFlag: true, Header: SliceHeader{FieldPicFlag: true}, PicOrderCnt: 0, Reset: true},
+				{NALRefIDC: 3, Header: SliceHeader{FieldPicFlag: true, BottomFieldFlag: true}, PicOrderCnt: 0},
+				{NALRefIDC: 2, Header: SliceHeader{FrameNum: 1, FieldPicFlag: true}, PicOrderCnt: 2},
+			},
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			d := NewPicOrderCntDecoder()
+			for i, p := range tt.Pictures {
+				poc, reset, err := d.Decode(tt.SPS, p.NALRefIDC, p.IDRPicFlag, p.Header)
+				require.NoError(t, err)
+				assert.Equal(t, p.PicOrderCnt, poc, "picture %d", i)
+				assert.Equal(t, p.Reset, reset, "picture %d", i)
+			}
+		})
+	}
+
+	t.Run("invalid pic_order_cnt_type", func(t *testing.T) {
+		_, _, err := NewPicOrderCntDecoder().Decode(SequenceParameterSet{PicOrderCntType: 3}, 3, true, SliceHeader{})
+		assert.Error(t, err)
+	})
+}
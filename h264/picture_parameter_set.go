@@ -0,0 +1,397 @@
+package h264
+
+import (
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+type PictureParameterSet struct {
+	PictureParameterSetID                 uint64
+	SequenceParameterSetID                uint64
+	EntropyCodingModeFlag                 bool
+	BottomFieldPicOrderInFramePresentFlag bool
+	NumSliceGroupsMinus1                  uint64
+	SliceGroupMapType                     uint64
+	RunLengthMinus1                       []uint64
+	TopLeft                               []uint64
+	BottomRight                           []uint64
+	SliceGroupChangeDirectionFlag         bool
+	SliceGroupChangeRateMinus1            uint64
+	PicSizeInMapUnitsMinus1               uint64
+	SliceGroupID                          []uint64
+	NumRefIdxL0DefaultActiveMinus1        uint64
+	NumRefIdxL1DefaultActiveMinus1        uint64
+	WeightedPredFlag                      bool
+	WeightedBipredIDC                     uint8
+	PicInitQPMinus26                      int64
+	PicInitQSMinus26                      int64
+	ChromaQPIndexOffset                   int64
+	DeblockingFilterControlPresentFlag    bool
+	ConstrainedIntraPredFlag              bool
+	RedundantPicCntPresentFlag            bool
+	// MoreRBSPData is true when transform_8x8_mode_flag and the following
+	// syntax elements are present.
+	MoreRBSPData                bool
+	Transform8x8ModeFlag        bool
+	PicScalingMatrixPresentFlag bool
+	PicScalingListPresentFlag   []bool
+	ScalingListDeltaScales      [][]int64
+	SecondChromaQPIndexOffset   int64
+}
+
+type SequenceParameterSetLookup func(id uint64) (SequenceParameterSet, bool)
+
+func (m PictureParameterSet) MarshalBinary() ([]byte, error) {
+
+	w := newBitWriter()
+
+	if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.PictureParameterSetID)); err != nil {
+		return nil, err
+	}
+	if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.SequenceParameterSetID)); err != nil {
+		return nil, err
+	}
+	if _, err := w.WriteBit(
+		m.EntropyCodingModeFlag,
+		m.BottomFieldPicOrderInFramePresentFlag,
+	); err != nil {
+		return nil, err
+	}
+	if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.NumSliceGroupsMinus1)); err != nil {
+		return nil, err
+	}
+	if m.NumSliceGroupsMinus1 > 0 {
+		if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.SliceGroupMapType)); err != nil {
+			return nil, err
+		}
+		switch m.SliceGroupMapType {
+		case 0:
+			if uint64(len(m.RunLengthMinus1)) != m.NumSliceGroupsMinus1+1 {
+				return nil, errors.Errorf("invalid run_length_minus1 length: len=%d, num_slice_groups_minus1=%d", len(m.RunLengthMinus1), m.NumSliceGroupsMinus1)
+			}
+			for i := 0; i <= int(m.NumSliceGroupsMinus1); i++ {
+				if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.RunLengthMinus1[i])); err != nil {
+					return nil, err
+				}
+			}
+		case 2:
+			if uint64(len(m.TopLeft)) != m.NumSliceGroupsMinus1 || uint64(len(m.BottomRight)) != m.NumSliceGroupsMinus1 {
+				return nil, errors.Errorf("invalid top_left or bottom_right length: len=%d/%d, num_slice_groups_minus1=%d", len(m.TopLeft), len(m.BottomRight), m.NumSliceGroupsMinus1)
+			}
+			for i := 0; i < int(m.NumSliceGroupsMinus1); i++ {
+				if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.TopLeft[i])); err != nil {
+					return nil, err
+				}
+				if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.BottomRight[i])); err != nil {
+					return nil, err
+				}
+			}
+		case 3, 4, 5:
+			if _, err := w.WriteBit(m.SliceGroupChangeDirectionFlag); err != nil {
+				return nil, err
+			}
+			if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.SliceGroupChangeRateMinus1)); err != nil {
+				return nil, err
+			}
+		case 6:
+			if uint64(len(m.SliceGroupID)) != m.PicSizeInMapUnitsMinus1+1 {
+				return nil, errors.Errorf("invalid slice_group_id length: len=%d, pic_size_in_map_units_minus1=%d", len(m.SliceGroupID), m.PicSizeInMapUnitsMinus1)
+			}
+			if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.PicSizeInMapUnitsMinus1)); err != nil {
+				return nil, err
+			}
+			v := sliceGroupIDBitLength(m.NumSliceGroupsMinus1)
+			for i := 0; i <= int(m.PicSizeInMapUnitsMinus1); i++ {
+				if _, err := w.WriteBits(m.SliceGroupID[i], v); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.NumRefIdxL0DefaultActiveMinus1)); err != nil {
+		return nil, err
+	}
+	if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.NumRefIdxL1DefaultActiveMinus1)); err != nil {
+		return nil, err
+	}
+	if _, err := w.WriteBit(
+		m.WeightedPredFlag,
+		m.WeightedBipredIDC&(1<<1) > 0,
+		m.WeightedBipredIDC&1 > 0,
+	); err != nil {
+		return nil, err
+	}
+	if _, err := writeExponentialGolombCoding(w, Int64ToGolombCodeNum(m.PicInitQPMinus26)); err != nil {
+		return nil, err
+	}
+	if _, err := writeExponentialGolombCoding(w, Int64ToGolombCodeNum(m.PicInitQSMinus26)); err != nil {
+		return nil, err
+	}
+	if _, err := writeExponentialGolombCoding(w, Int64ToGolombCodeNum(m.ChromaQPIndexOffset)); err != nil {
+		return nil, err
+	}
+	if _, err := w.WriteBit(
+		m.DeblockingFilterControlPresentFlag,
+		m.ConstrainedIntraPredFlag,
+		m.RedundantPicCntPresentFlag,
+	); err != nil {
+		return nil, err
+	}
+	if m.MoreRBSPData {
+		if _, err := w.WriteBit(
+			m.Transform8x8ModeFlag,
+			m.PicScalingMatrixPresentFlag,
+		); err != nil {
+			return nil, err
+		}
+		if m.PicScalingMatrixPresentFlag {
+			if len(m.ScalingListDeltaScales) < len(m.PicScalingListPresentFlag) {
+				return nil, errors.Errorf("invalid delta_scale length: len=%d, want=%d", len(m.ScalingListDeltaScales), len(m.PicScalingListPresentFlag))
+			}
+			for i := range m.PicScalingListPresentFlag {
+				if _, err := w.WriteBit(m.PicScalingListPresentFlag[i]); err != nil {
+					return nil, err
+				}
+				if m.PicScalingListPresentFlag[i] {
+					if err := writeScalingList(w, m.ScalingListDeltaScales[i]); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+		if _, err := writeExponentialGolombCoding(w, Int64ToGolombCodeNum(m.SecondChromaQPIndexOffset)); err != nil {
+			return nil, err
+		}
+	}
+
+	// trailing bits
+	if _, err := w.WriteBit(BitOne); err != nil {
+		return nil, err
+	}
+
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a pic_parameter_set_rbsp whose SPS is not known,
+// assuming chroma_format_idc is not 3.
+func (m *PictureParameterSet) UnmarshalBinary(b []byte) error {
+	return m.unmarshalBinary(b, nil)
+}
+
+// UnmarshalBinaryWithSPS decodes a pic_parameter_set_rbsp, resolving the SPS
+// referred by seq_parameter_set_id through lookup.
+func (m *PictureParameterSet) UnmarshalBinaryWithSPS(b []byte, lookup SequenceParameterSetLookup) error {
+	return m.unmarshalBinary(b, lookup)
+}
+
+// unmarshalBinary decodes b with the SPS of lookup, or with an unknown SPS
+// when lookup is nil.
+func (m *PictureParameterSet) unmarshalBinary(b []byte, lookup SequenceParameterSetLookup) error {
+	var err error
+	var g uint64
+	r := newBitReader(b)
+
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.PictureParameterSetID = GolombCodeNumToUint64(g)
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.SequenceParameterSetID = GolombCodeNumToUint64(g)
+	sps := SequenceParameterSet{}
+	if lookup != nil {
+		var ok bool
+		sps, ok = lookup(m.SequenceParameterSetID)
+		if !ok {
+			return errors.Errorf("sequence parameter set is not found: id=%d", m.SequenceParameterSetID)
+		}
+	}
+	m.EntropyCodingModeFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+	m.BottomFieldPicOrderInFramePresentFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.NumSliceGroupsMinus1 = GolombCodeNumToUint64(g)
+	if m.NumSliceGroupsMinus1 > 7 {
+		return errors.Errorf("invalid num_slice_groups_minus1: %d", m.NumSliceGroupsMinus1)
+	}
+	if m.NumSliceGroupsMinus1 > 0 {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return err
+		}
+		m.SliceGroupMapType = GolombCodeNumToUint64(g)
+		if m.SliceGroupMapType > 6 {
+			return errors.Errorf("invalid slice_group_map_type: %d", m.SliceGroupMapType)
+		}
+		switch m.SliceGroupMapType {
+		case 0:
+			m.RunLengthMinus1 = make([]uint64, m.NumSliceGroupsMinus1+1)
+			for i := range m.RunLengthMinus1 {
+				g, err = readExponentialGolombCoding(r)
+				if err != nil {
+					return err
+				}
+				m.RunLengthMinus1[i] = GolombCodeNumToUint64(g)
+			}
+		case 2:
+			m.TopLeft = make([]uint64, m.NumSliceGroupsMinus1)
+			m.BottomRight = make([]uint64, m.NumSliceGroupsMinus1)
+			for i := range m.TopLeft {
+				g, err = readExponentialGolombCoding(r)
+				if err != nil {
+					return err
+				}
+				m.TopLeft[i] = GolombCodeNumToUint64(g)
+				g, err = readExponentialGolombCoding(r)
+				if err != nil {
+					return err
+				}
+				m.BottomRight[i] = GolombCodeNumToUint64(g)
+			}
+		case 3, 4, 5:
+			m.SliceGroupChangeDirectionFlag, err = r.ReadBit()
+			if err != nil {
+				return err
+			}
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return err
+			}
+			m.SliceGroupChangeRateMinus1 = GolombCodeNumToUint64(g)
+			// slice_group_change_rate_minus1 is in the range of 0 to PicSizeInMapUnits - 1
+			if m.SliceGroupChangeRateMinus1 >= 1<<32 || lookup != nil && m.SliceGroupChangeRateMinus1 >= (sps.PicWidthInMbsMinus1+1)*(sps.PicHeightInMapUnitsMinus1+1) {
+				return errors.Errorf("invalid slice_group_change_rate_minus1: %d", m.SliceGroupChangeRateMinus1)
+			}
+		case 6:
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return err
+			}
+			m.PicSizeInMapUnitsMinus1 = GolombCodeNumToUint64(g)
+			if lookup != nil && m.PicSizeInMapUnitsMinus1 != (sps.PicWidthInMbsMinus1+1)*(sps.PicHeightInMapUnitsMinus1+1)-1 {
+				return errors.Errorf("pic_size_in_map_units_minus1 does not match the SPS: %d", m.PicSizeInMapUnitsMinus1)
+			}
+			v := sliceGroupIDBitLength(m.NumSliceGroupsMinus1)
+			// slice_group_id of each map unit must remain in b
+			if m.PicSizeInMapUnitsMinus1 >= uint64((len(b)*8-r.BitOffset())/v) {
+				return errors.Errorf("invalid pic_size_in_map_units_minus1: %d", m.PicSizeInMapUnitsMinus1)
+			}
+			m.SliceGroupID = make([]uint64, m.PicSizeInMapUnitsMinus1+1)
+			for i := range m.SliceGroupID {
+				m.SliceGroupID[i], err = r.ReadBits(v)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.NumRefIdxL0DefaultActiveMinus1 = GolombCodeNumToUint64(g)
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.NumRefIdxL1DefaultActiveMinus1 = GolombCodeNumToUint64(g)
+	m.WeightedPredFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+	g, err = r.ReadBits(2)
+	if err != nil {
+		return err
+	}
+	m.WeightedBipredIDC = uint8(g)
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.PicInitQPMinus26 = GolombCodeNumToInt64(g)
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.PicInitQSMinus26 = GolombCodeNumToInt64(g)
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.ChromaQPIndexOffset = GolombCodeNumToInt64(g)
+	m.DeblockingFilterControlPresentFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+	m.ConstrainedIntraPredFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+	m.RedundantPicCntPresentFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+
+	m.MoreRBSPData = r.MoreRBSPData()
+	if !m.MoreRBSPData {
+		m.SecondChromaQPIndexOffset = m.ChromaQPIndexOffset
+		return nil
+	}
+
+	m.Transform8x8ModeFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+	m.PicScalingMatrixPresentFlag, err = r.ReadBit()
+	if err != nil {
+		return err
+	}
+	if m.PicScalingMatrixPresentFlag {
+		xx := 6
+		if m.Transform8x8ModeFlag {
+			if sps.ChromaFormatIDC == 3 {
+				xx += 6
+			} else {
+				xx += 2
+			}
+		}
+		m.PicScalingListPresentFlag = make([]bool, xx)
+		m.ScalingListDeltaScales = make([][]int64, xx)
+		for i := 0; i < xx; i++ {
+			m.PicScalingListPresentFlag[i], err = r.ReadBit()
+			if err != nil {
+				return err
+			}
+			if m.PicScalingListPresentFlag[i] {
+				m.ScalingListDeltaScales[i], err = readScalingList(r, sizeOfScalingList(i))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.SecondChromaQPIndexOffset = GolombCodeNumToInt64(g)
+
+	return nil
+}
+
+// sliceGroupIDBitLength returns Ceil(Log2(num_slice_groups_minus1 + 1)).
+func sliceGroupIDBitLength(numSliceGroupsMinus1 uint64) int {
+	return bits.Len64(numSliceGroupsMinus1)
+}
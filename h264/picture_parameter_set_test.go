@@ -0,0 +1,517 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var PictureParameterSetTestData = []struct {
+	Name   string
+	Struct PictureParameterSet
+	Binary []byte
+}{
+	{
+		Name:   "empty struct",
+		Struct: PictureParameterSet{},
+		Binary: mustBitToBytes(
+			l,    // PictureParameterSetID
+			l,    // SequenceParameterSetID
+			o,    // EntropyCodingModeFlag
+			o,    // BottomFieldPicOrderInFramePresentFlag
+			l,    // NumSliceGroupsMinus1
+			l,    // NumRefIdxL0DefaultActiveMinus1
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+
+			l,                      // PicInitQPMinus26
+			l,                      // PicInitQSMinus26
+			l,                      // ChromaQPIndexOffset
+			o,                      // DeblockingFilterControlPresentFlag
+			o,                      // ConstrainedIntraPredFlag
+			o,                      // RedundantPicCntPresentFlag
+			l, o, o, o, o, o, o, o, // trailing bits
+		),
+	},
+	{
+		Name: "IDs and entropy flags",
+		Struct: PictureParameterSet{
+			PictureParameterSetID:                 1,
+			SequenceParameterSetID:                2,
+			EntropyCodingModeFlag:                 true,
+			BottomFieldPicOrderInFramePresentFlag: true,
+		},
+		Binary: mustBitToBytes(
+			o, l, o, // PictureParameterSetID
+			o, l, l, // SequenceParameterSetID
+			l, // EntropyCodingModeFlag
+			l, // BottomFieldPicOrderInFramePresentFlag
+
+			l,    // NumSliceGroupsMinus1
+			l,    // NumRefIdxL0DefaultActiveMinus1
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+			l, // PicInitQPMinus26
+			l, // PicInitQSMinus26
+
+			l,          // ChromaQPIndexOffset
+			o,          // DeblockingFilterControlPresentFlag
+			o,          // ConstrainedIntraPredFlag
+			o,          // RedundantPicCntPresentFlag
+			l, o, o, o, // trailing bits
+		),
+	},
+	{
+		Name: "SliceGroupMapType is 0",
+		Struct: PictureParameterSet{
+			NumSliceGroupsMinus1: 1,
+			SliceGroupMapType:    0,
+			RunLengthMinus1:      []uint64{0, 1},
+		},
+		Binary: mustBitToBytes(
+			l,       // PictureParameterSetID
+			l,       // SequenceParameterSetID
+			o,       // EntropyCodingModeFlag
+			o,       // BottomFieldPicOrderInFramePresentFlag
+			o, l, o, // NumSliceGroupsMinus1
+			l,       // SliceGroupMapType
+			l,       // RunLengthMinus1[0]
+			o, l, o, // RunLengthMinus1[1]
+
+			l,    // NumRefIdxL0DefaultActiveMinus1
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+			l, // PicInitQPMinus26
+			l, // PicInitQSMinus26
+			l, // ChromaQPIndexOffset
+
+			o, // DeblockingFilterControlPresentFlag
+			o, // ConstrainedIntraPredFlag
+			o, // RedundantPicCntPresentFlag
+			l, // trailing bits
+		),
+	},
+	{
+		Name: "SliceGroupMapType is 2",
+		Struct: PictureParameterSet{
+			NumSliceGroupsMinus1: 1,
+			SliceGroupMapType:    2,
+			TopLeft:              []uint64{0},
+			BottomRight:          []uint64{2},
+		},
+		Binary: mustBitToBytes(
+			l,       // PictureParameterSetID
+			l,       // SequenceParameterSetID
+			o,       // EntropyCodingModeFlag
+			o,       // BottomFieldPicOrderInFramePresentFlag
+			o, l, o, // NumSliceGroupsMinus1
+			o, l, l, // SliceGroupMapType
+
+			l,       // TopLeft[0]
+			o, l, l, // BottomRight[0]
+			l,    // NumRefIdxL0DefaultActiveMinus1
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+
+			l,    // PicInitQPMinus26
+			l,    // PicInitQSMinus26
+			l,    // ChromaQPIndexOffset
+			o,    // DeblockingFilterControlPresentFlag
+			o,    // ConstrainedIntraPredFlag
+			o,    // RedundantPicCntPresentFlag
+			l, o, // trailing bits
+		),
+	},
+	{
+		Name: "SliceGroupMapType is 4",
+		Struct: PictureParameterSet{
+			NumSliceGroupsMinus1:          1,
+			SliceGroupMapType:             4,
+			SliceGroupChangeDirectionFlag: true,
+			SliceGroupChangeRateMinus1:    1,
+		},
+		Binary: mustBitToBytes(
+			l,       // PictureParameterSetID
+			l,       // SequenceParameterSetID
+			o,       // EntropyCodingModeFlag
+			o,       // BottomFieldPicOrderInFramePresentFlag
+			o, l, o, // NumSliceGroupsMinus1
+			o, o, l, o, l, // SliceGroupMapType
+
+			l,       // SliceGroupChangeDirectionFlag
+			o, l, o, // SliceGroupChangeRateMinus1
+			l,    // NumRefIdxL0DefaultActiveMinus1
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+
+			l,    // PicInitQPMinus26
+			l,    // PicInitQSMinus26
+			l,    // ChromaQPIndexOffset
+			o,    // DeblockingFilterControlPresentFlag
+			o,    // ConstrainedIntraPredFlag
+			o,    // RedundantPicCntPresentFlag
+			l, o, // trailing bits
+		),
+	},
+	{
+		Name: "SliceGroupMapType is 6",
+		Struct: PictureParameterSet{
+			NumSliceGroupsMinus1:    2,
+			SliceGroupMapType:       6,
+			PicSizeInMapUnitsMinus1: 2,
+			SliceGroupID:            []uint64{0, 1, 2},
+		},
+		Binary: mustBitToBytes(
+			l,       // PictureParameterSetID
+			l,       // SequenceParameterSetID
+			o,       // EntropyCodingModeFlag
+			o,       // BottomFieldPicOrderInFramePresentFlag
+			o, l, l, // NumSliceGroupsMinus1
+			o, o, l, l, l, // SliceGroupMapType
+
+			o, l, l, // PicSizeInMapUnitsMinus1
+			o, o, // SliceGroupID[0]
+			o, l, // SliceGroupID[1]
+			l, o, // SliceGroupID[2]
+			l, // NumRefIdxL0DefaultActiveMinus1
+
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+			l, // PicInitQPMinus26
+			l, // PicInitQSMinus26
+			l, // ChromaQPIndexOffset
+			o, // DeblockingFilterControlPresentFlag
+
+			o,                // ConstrainedIntraPredFlag
+			o,                // RedundantPicCntPresentFlag
+			l, o, o, o, o, o, // trailing bits
+		),
+	},
+	{
+		Name: "reference indices, weighted prediction and QP",
+		Struct: PictureParameterSet{
+			NumRefIdxL0DefaultActiveMinus1:     1,
+			NumRefIdxL1DefaultActiveMinus1:     2,
+			WeightedPredFlag:                   true,
+			WeightedBipredIDC:                  2,
+			PicInitQPMinus26:                   -26,
+			PicInitQSMinus26:                   1,
+			ChromaQPIndexOffset:                -1,
+			DeblockingFilterControlPresentFlag: true,
+			ConstrainedIntraPredFlag:           true,
+			RedundantPicCntPresentFlag:         true,
+			SecondChromaQPIndexOffset:          -1,
+		},
+		Binary: mustBitToBytes(
+			l,       // PictureParameterSetID
+			l,       // SequenceParameterSetID
+			o,       // EntropyCodingModeFlag
+			o,       // BottomFieldPicOrderInFramePresentFlag
+			l,       // NumSliceGroupsMinus1
+			o, l, o, // NumRefIdxL0DefaultActiveMinus1
+
+			o, l, l, // NumRefIdxL1DefaultActiveMinus1
+			l,    // WeightedPredFlag
+			l, o, // WeightedBipredIDC
+			o, o, o, o, o, l, l, o, l, o, l, // PicInitQPMinus26
+			o, l, o, // PicInitQSMinus26
+			o, l, l, // ChromaQPIndexOffset
+			l, // DeblockingFilterControlPresentFlag
+			l, // ConstrainedIntraPredFlag
+			l, // RedundantPicCntPresentFlag
+			l, // trailing bits
+		),
+	},
+	{
+		Name: "MoreRBSPData: Transform8x8ModeFlag is true",
+		Struct: PictureParameterSet{
+			MoreRBSPData:              true,
+			Transform8x8ModeFlag:      true,
+			SecondChromaQPIndexOffset: 2,
+		},
+		Binary: mustBitToBytes(
+			l,    // PictureParameterSetID
+			l,    // SequenceParameterSetID
+			o,    // EntropyCodingModeFlag
+			o,    // BottomFieldPicOrderInFramePresentFlag
+			l,    // NumSliceGroupsMinus1
+			l,    // NumRefIdxL0DefaultActiveMinus1
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+
+			l, // PicInitQPMinus26
+			l, // PicInitQSMinus26
+			l, // ChromaQPIndexOffset
+			o, // DeblockingFilterControlPresentFlag
+			o, // ConstrainedIntraPredFlag
+			o, // RedundantPicCntPresentFlag
+			l, // Transform8x8ModeFlag
+			o, // PicScalingMatrixPresentFlag
+
+			o, o, l, o, o, // SecondChromaQPIndexOffset
+			l, // trailing bits
+		),
+	},
+	{
+		Name: "MoreRBSPData: PicScalingMatrix: ChromaFormatIDC is not 3",
+		Struct: PictureParameterSet{
+			MoreRBSPData:                true,
+			Transform8x8ModeFlag:        true,
+			PicScalingMatrixPresentFlag: true,
+			PicScalingListPresentFlag: []bool{
+				true, false, false, false, false, false,
+				true, false,
+			},
+			ScalingListDeltaScales: [][]int64{
+				{-8}, nil, nil, nil, nil, nil,
+				{-8}, nil,
+			},
+		},
+		Binary: mustBitToBytes(
+			l,    // PictureParameterSetID
+			l,    // SequenceParameterSetID
+			o,    // EntropyCodingModeFlag
+			o,    // BottomFieldPicOrderInFramePresentFlag
+			l,    // NumSliceGroupsMinus1
+			l,    // NumRefIdxL0DefaultActiveMinus1
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+
+			l, // PicInitQPMinus26
+			l, // PicInitQSMinus26
+			l, // ChromaQPIndexOffset
+			o, // DeblockingFilterControlPresentFlag
+			o, // ConstrainedIntraPredFlag
+			o, // RedundantPicCntPresentFlag
+			l, // Transform8x8ModeFlag
+			l, // PicScalingMatrixPresentFlag
+
+			// PicScalingList 0
+			l,
+			o, o, o, o, l, o, o, o, l,
+			// PicScalingList 1-5
+			o, o, o, o, o,
+			// PicScalingList 6
+			l,
+			o, o, o, o, l, o, o, o, l,
+			// PicScalingList 7
+			o,
+
+			l,       // SecondChromaQPIndexOffset
+			l, o, o, // trailing bits
+		),
+	},
+}
+
+func TestPictureParameterSet_MarshalBinary(t *testing.T) {
+	for _, tt := range PictureParameterSetTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := tt.Struct.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+}
+
+func TestPictureParameterSet_UnmarshalBinary(t *testing.T) {
+	for _, tt := range PictureParameterSetTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := PictureParameterSet{}
+			err := s.UnmarshalBinary(tt.Binary)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+}
+
+func TestPictureParameterSet_UnmarshalBinaryWithSPS(t *testing.T) {
+	spss := map[uint64]SequenceParameterSet{
+		1: {
+			ProfileIDC:            244,
+			SequenceParamterSetID: 1,
+			ChromaFormatIDC:       3,
+		},
+	}
+	lookup := func(id uint64) (SequenceParameterSet, bool) {
+		sps, ok := spss[id]
+		return sps, ok
+	}
+
+	t.Run("ChromaFormatIDC is 3", func(t *testing.T) {
+		want := PictureParameterSet{
+			SequenceParameterSetID:      1,
+			MoreRBSPData:                true,
+			Transform8x8ModeFlag:        true,
+			PicScalingMatrixPresentFlag: true,
+			PicScalingListPresentFlag:   make([]bool, 12),
+			ScalingListDeltaScales:      make([][]int64, 12),
+		}
+		want.PicScalingListPresentFlag[11] = true
+		want.ScalingListDeltaScales[11] = []int64{-8}
+
+		b, err := want.MarshalBinary()
+		require.NoError(t, err)
+		assert.Equal(t, mustBitToBytes(
+			l,       // PictureParameterSetID
+			o, l, o, // SequenceParameterSetID
+			o, // EntropyCodingModeFlag
+			o, // BottomFieldPicOrderInFramePresentFlag
+			l, // NumSliceGroupsMinus1
+			l, // NumRefIdxL0DefaultActiveMinus1
+
+			l,    // NumRefIdxL1DefaultActiveMinus1
+			o,    // WeightedPredFlag
+			o, o, // WeightedBipredIDC
+			l, // PicInitQPMinus26
+			l, // PicInitQSMinus26
+			l, // ChromaQPIndexOffset
+			o, // DeblockingFilterControlPresentFlag
+
+			o, // ConstrainedIntraPredFlag
+			o, // RedundantPicCntPresentFlag
+			l, // Transform8x8ModeFlag
+			l, // PicScalingMatrixPresentFlag
+			// PicScalingList 0-10
+			o, o, o, o, o, o, o, o, o, o, o,
+			// PicScalingList 11
+			l,
+			o, o, o, o, l, o, o, o, l,
+			l, // SecondChromaQPIndexOffset
+			l, // trailing bits
+		), b)
+
+		s := PictureParameterSet{}
+		require.NoError(t, s.UnmarshalBinaryWithSPS(b, lookup))
+		assert.Equal(t, want, s)
+	})
+
+	t.Run("pic_size_in_map_units_minus1", func(t *testing.T) {
+		spss[2] = SequenceParameterSet{
+			SequenceParamterSetID:     2,
+			PicWidthInMbsMinus1:       1,
+			PicHeightInMapUnitsMinus1: 1,
+		}
+		want := PictureParameterSet{
+			SequenceParameterSetID:    2,
+			NumSliceGroupsMinus1:      1,
+			SliceGroupMapType:         6,
+			PicSizeInMapUnitsMinus1:   3,
+			SliceGroupID:              []uint64{0, 1, 1, 0},
+			SecondChromaQPIndexOffset: 0,
+		}
+		b, err := want.MarshalBinary()
+		require.NoError(t, err)
+
+		s := PictureParameterSet{}
+		require.NoError(t, s.UnmarshalBinaryWithSPS(b, lookup))
+		assert.Equal(t, want, s)
+
+		spss[2] = SequenceParameterSet{SequenceParamterSetID: 2}
+		assert.Error(t, s.UnmarshalBinaryWithSPS(b, lookup))
+	})
+
+	t.Run("SPS is not found", func(t *testing.T) {
+		s := PictureParameterSet{}
+		err := s.UnmarshalBinaryWithSPS(mustBitToBytes(
+			l,             // PictureParameterSetID
+			o, o, l, o, o, // SequenceParameterSetID
+			l, o, // trailing bits
+		), lookup)
+		assert.Error(t, err)
+	})
+}
+
+func TestPictureParameterSet_UnmarshalBinary_Error(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Binary []byte
+	}{
+		{"too large pic_size_in_map_units_minus1", []byte("1\x00\x00\x00\x00\x17\x17\x17,oF0")},
+		{"too large num_slice_groups_minus1", mustBitToBytes(
+			l,                   // PictureParameterSetID
+			l,                   // SequenceParameterSetID
+			o,                   // EntropyCodingModeFlag
+			o,                   // BottomFieldPicOrderInFramePresentFlag
+			o, o, o, l, o, o, o, // NumSliceGroupsMinus1 = 8
+			l, // SliceGroupMapType
+			l, // trailing bits
+		)},
+		{"too large slice_group_map_type", mustBitToBytes(
+			l,       // PictureParameterSetID
+			l,       // SequenceParameterSetID
+			o,       // EntropyCodingModeFlag
+			o,       // BottomFieldPicOrderInFramePresentFlag
+			o, l, o, // NumSliceGroupsMinus1 = 1
+			o, o, o, l, o, o, o, // SliceGroupMapType = 7
+			l, // trailing bits
+		)},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := PictureParameterSet{}
+			assert.Error(t, s.UnmarshalBinary(tt.Binary))
+		})
+	}
+
+	t.Run("too large slice_group_change_rate_minus1", func(t *testing.T) {
+		b, err := PictureParameterSet{
+			NumSliceGroupsMinus1:       1,
+			SliceGroupMapType:          3,
+			SliceGroupChangeRateMinus1: 1 << 32,
+		}.MarshalBinary()
+		require.NoError(t, err)
+
+		s := PictureParameterSet{}
+		assert.Error(t, s.UnmarshalBinary(b))
+	})
+
+	t.Run("slice_group_change_rate_minus1 out of the SPS", func(t *testing.T) {
+		spss := map[uint64]SequenceParameterSet{0: {PicWidthInMbsMinus1: 1, PicHeightInMapUnitsMinus1: 1}}
+		lookup := func(id uint64) (SequenceParameterSet, bool) {
+			sps, ok := spss[id]
+			return sps, ok
+		}
+		b, err := PictureParameterSet{
+			NumSliceGroupsMinus1:       1,
+			SliceGroupMapType:          3,
+			SliceGroupChangeRateMinus1: 3,
+		}.MarshalBinary()
+		require.NoError(t, err)
+
+		s := PictureParameterSet{}
+		require.NoError(t, s.UnmarshalBinaryWithSPS(b, lookup))
+		b, err = PictureParameterSet{
+			NumSliceGroupsMinus1:       1,
+			SliceGroupMapType:          3,
+			SliceGroupChangeRateMinus1: 4,
+		}.MarshalBinary()
+		require.NoError(t, err)
+		assert.Error(t, s.UnmarshalBinaryWithSPS(b, lookup))
+	})
+}
+
+func TestPictureParameterSet_MarshalBinary_Error(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Struct PictureParameterSet
+	}{
+		{"RunLengthMinus1", PictureParameterSet{NumSliceGroupsMinus1: 1, SliceGroupMapType: 0, RunLengthMinus1: []uint64{0}}},
+		{"TopLeft", PictureParameterSet{NumSliceGroupsMinus1: 2, SliceGroupMapType: 2, TopLeft: []uint64{0}, BottomRight: []uint64{0, 0}}},
+		{"BottomRight", PictureParameterSet{NumSliceGroupsMinus1: 1, SliceGroupMapType: 2, TopLeft: []uint64{0}}},
+		{"SliceGroupID", PictureParameterSet{NumSliceGroupsMinus1: 1, SliceGroupMapType: 6, PicSizeInMapUnitsMinus1: 3, SliceGroupID: []uint64{0}}},
+		{"ScalingListDeltaScales", PictureParameterSet{MoreRBSPData: true, PicScalingMatrixPresentFlag: true, PicScalingListPresentFlag: make([]bool, 6)}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			_, err := tt.Struct.MarshalBinary()
+			assert.Error(t, err)
+		})
+	}
+}
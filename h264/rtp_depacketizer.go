@@ -0,0 +1,305 @@
+package h264
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const DefaultRTPReorderWindow = 16
+
+// DefaultRTPMaxNALUnitSize is the default limit of the size of a NAL unit
+// reassembled from fragments.
+const DefaultRTPMaxNALUnitSize = 16 << 20
+
+const (
+	// rtpMaxDropout and rtpMaxMisorder are MAX_DROPOUT and MAX_MISORDER of
+	// RFC 3550 A.1, which tell a restarted sequence from late packets.
+	rtpMaxDropout  = 3000
+	rtpMaxMisorder = 100
+)
+
+// RTPAccessUnit is an access unit reassembled from RTP packets which share
+// an RTP timestamp.
+type RTPAccessUnit struct {
+	Timestamp uint32
+	NALUnits  []NALUnit
+	// LostPackets is the number of packets found lost while this access unit
+	// was assembled.
+	LostPackets int
+	// DroppedNALUnits is the number of fragmented NAL units dropped since some
+	// of their fragments were lost.
+	DroppedNALUnits int
+	// MalformedPackets is the number of packets dropped since their payloads
+	// could not be depacketized.
+	MalformedPackets int
+}
+
+// RTPDepacketizer reassembles NAL units from RTP packets of the
+// non-interleaved mode of RFC 6184: single NAL unit packets, STAP-A and FU-A.
+// Packets are reordered by sequence number within ReorderWindow packets.
+// Malformed packets are dropped and counted in the access units, as are
+// fragments which make a NAL unit larger than MaxNALUnitSize.
+type RTPDepacketizer struct {
+	ReorderWindow  int
+	MaxNALUnitSize int
+
+	started bool
+	nextSeq uint16
+	// jumped is true after a packet far from nextSeq, which is kept in
+	// jumpPacket until the next packet confirms a new sequence.
+	jumped     bool
+	jumpPacket RTPPacket
+	// buffered is sorted by sequence number
+	buffered []RTPPacket
+
+	hasCurrent bool
+	current    RTPAccessUnit
+
+	fragment []byte
+	// dropping is true while fragments of a dropped NAL unit arrive.
+	dropping bool
+
+	completed []RTPAccessUnit
+}
+
+func NewRTPDepacketizer() *RTPDepacketizer {
+	return &RTPDepacketizer{
+		ReorderWindow:  DefaultRTPReorderWindow,
+		MaxNALUnitSize: DefaultRTPMaxNALUnitSize,
+	}
+}
+
+// Push adds pkt and returns the access units completed by it. Packets older
+// than the already processed ones are discarded. When two consecutive packets
+// jump far from the expected sequence number, as a restarted sender does, the
+// buffered packets are processed and the sequence starts again from them.
+func (d *RTPDepacketizer) Push(pkt RTPPacket) []RTPAccessUnit {
+	if !d.started {
+		d.started = true
+		d.nextSeq = pkt.SequenceNumber
+	}
+	switch delta := pkt.SequenceNumber - d.nextSeq; {
+	case delta < rtpMaxDropout:
+		d.jumped = false
+	case delta >= 1<<16-rtpMaxMisorder:
+		// a late or duplicate packet
+		return d.takeCompleted()
+	case !d.jumped || pkt.SequenceNumber != d.jumpPacket.SequenceNumber+1:
+		d.jumped = true
+		d.jumpPacket = pkt
+		return d.takeCompleted()
+	default:
+		d.jumped = false
+		d.drain()
+		d.dropFragment()
+		d.complete()
+		d.nextSeq = d.jumpPacket.SequenceNumber
+		d.insert(d.jumpPacket)
+	}
+	if !d.insert(pkt) {
+		return d.takeCompleted()
+	}
+
+	for len(d.buffered) > 0 {
+		pkt := d.buffered[0]
+		if pkt.SequenceNumber != d.nextSeq {
+			if len(d.buffered) <= d.ReorderWindow {
+				break
+			}
+			d.lose(int(pkt.SequenceNumber - d.nextSeq))
+		}
+		d.buffered = d.buffered[1:]
+		d.nextSeq = pkt.SequenceNumber + 1
+		d.process(pkt)
+	}
+
+	return d.takeCompleted()
+}
+
+// Flush processes all buffered packets and returns the remaining access
+// units.
+func (d *RTPDepacketizer) Flush() []RTPAccessUnit {
+	d.drain()
+	d.dropFragment()
+	d.complete()
+	return d.takeCompleted()
+}
+
+// drain processes all buffered packets regardless of the losses.
+func (d *RTPDepacketizer) drain() {
+	for len(d.buffered) > 0 {
+		pkt := d.buffered[0]
+		if pkt.SequenceNumber != d.nextSeq {
+			d.lose(int(pkt.SequenceNumber - d.nextSeq))
+		}
+		d.buffered = d.buffered[1:]
+		d.nextSeq = pkt.SequenceNumber + 1
+		d.process(pkt)
+	}
+}
+
+// insert adds pkt to buffered in sequence number order. It returns false for
+// a duplicate.
+func (d *RTPDepacketizer) insert(pkt RTPPacket) bool {
+	offset := pkt.SequenceNumber - d.nextSeq
+	i := len(d.buffered)
+	for i > 0 {
+		o := d.buffered[i-1].SequenceNumber - d.nextSeq
+		if o == offset {
+			return false
+		}
+		if o < offset {
+			break
+		}
+		i--
+	}
+	d.buffered = append(d.buffered, RTPPacket{})
+	copy(d.buffered[i+1:], d.buffered[i:])
+	d.buffered[i] = pkt
+	return true
+}
+
+func (d *RTPDepacketizer) lose(n int) {
+	d.current.LostPackets += n
+	if d.fragment != nil {
+		d.dropFragment()
+		// the following fragments of the NAL unit may arrive
+		d.dropping = true
+	}
+}
+
+func (d *RTPDepacketizer) dropFragment() {
+	if d.fragment != nil {
+		d.current.DroppedNALUnits++
+		d.fragment = nil
+	}
+}
+
+func (d *RTPDepacketizer) process(pkt RTPPacket) {
+	if d.hasCurrent && pkt.Timestamp != d.current.Timestamp {
+		d.dropFragment()
+		d.complete()
+	}
+	if !d.hasCurrent {
+		d.hasCurrent = true
+		d.current.Timestamp = pkt.Timestamp
+	}
+
+	if err := d.processPayload(pkt.Payload); err != nil {
+		d.current.MalformedPackets++
+		if d.fragment != nil {
+			// the fragmented NAL unit is broken as if the packet were lost
+			d.dropFragment()
+			d.dropping = true
+		}
+	}
+
+	if pkt.Marker {
+		d.dropFragment()
+		d.complete()
+	}
+}
+
+func (d *RTPDepacketizer) processPayload(payload []byte) error {
+	if len(payload) == 0 {
+		return errors.New("empty payload")
+	}
+
+	switch t := payload[0] & 0x1f; t {
+	case RTPPacketTypeSTAPA:
+		raws, err := splitSTAP(payload[1:])
+		if err != nil {
+			return err
+		}
+		// all NAL units are checked first so that a malformed packet adds
+		// none of them
+		nals := make([]NALUnit, len(raws))
+		for i, raw := range raws {
+			if err := nals[i].UnmarshalBinary(raw); err != nil {
+				return err
+			}
+		}
+		d.current.NALUnits = append(d.current.NALUnits, nals...)
+		d.dropping = false
+	case RTPPacketTypeFUA:
+		if len(payload) < 2 {
+			return errors.Errorf("invalid FU-A length: len=%d", len(payload))
+		}
+		start := payload[1]&0x80 != 0
+		end := payload[1]&0x40 != 0
+		if start {
+			d.dropFragment()
+			d.dropping = false
+			d.fragment = append([]byte{payload[0]&0xe0 | payload[1]&0x1f}, payload[2:]...)
+		} else if d.fragment != nil {
+			if len(d.fragment)+len(payload)-2 > d.MaxNALUnitSize {
+				return errors.Errorf("too large fragmented NAL unit: len=%d", len(d.fragment)+len(payload)-2)
+			}
+			d.fragment = append(d.fragment, payload[2:]...)
+		} else {
+			// the start fragment is lost
+			if !d.dropping {
+				d.current.DroppedNALUnits++
+				d.dropping = true
+			}
+			return nil
+		}
+		if end {
+			nal := d.fragment
+			d.fragment = nil
+			return d.appendNALUnit(nal)
+		}
+	case 0, 30, 31:
+		return errors.Errorf("undefined NAL unit type: %d", t)
+	case RTPPacketTypeSTAPB, RTPPacketTypeMTAP16, RTPPacketTypeMTAP24, RTPPacketTypeFUB:
+		return errors.Errorf("unsupported packet type in non-interleaved mode: %d", t)
+	default:
+		d.dropping = false
+		return d.appendNALUnit(payload)
+	}
+	return nil
+}
+
+func (d *RTPDepacketizer) appendNALUnit(b []byte) error {
+	nal := NALUnit{}
+	if err := nal.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	d.current.NALUnits = append(d.current.NALUnits, nal)
+	return nil
+}
+
+func (d *RTPDepacketizer) complete() {
+	if d.hasCurrent && (len(d.current.NALUnits) > 0 || d.current.LostPackets > 0 || d.current.DroppedNALUnits > 0 || d.current.MalformedPackets > 0) {
+		d.completed = append(d.completed, d.current)
+	}
+	d.hasCurrent = false
+	d.current = RTPAccessUnit{}
+	d.dropping = false
+}
+
+func (d *RTPDepacketizer) takeCompleted() []RTPAccessUnit {
+	aus := d.completed
+	d.completed = nil
+	return aus
+}
+
+// splitSTAP returns the NAL units of the aggregation units of STAP-A, which
+// follow the STAP NAL unit header.
+func splitSTAP(b []byte) ([][]byte, error) {
+	var nals [][]byte
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.Errorf("invalid aggregation unit length: len=%d", len(b))
+		}
+		l := int(binary.BigEndian.Uint16(b[0:2]))
+		b = b[2:]
+		if l == 0 || l > len(b) {
+			return nil, errors.Errorf("invalid NAL unit size: size=%d, remaining=%d", l, len(b))
+		}
+		nals = append(nals, b[:l])
+		b = b[l:]
+	}
+	return nals, nil
+}
@@ -0,0 +1,214 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var rtpDepacketizerTestAccessUnits = []RTPAccessUnit{
+	{
+		Timestamp: 0,
+		NALUnits: []NALUnit{
+			{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: []byte{0x42, 0xc0, 0x1e}},
+			{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xce}},
+			{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{
+				0x88, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09,
+				0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13,
+				0x14, 0x15, 0x16, 0x17, 0x18,
+			}},
+		},
+	},
+	{
+		Timestamp: 3000,
+		NALUnits: []NALUnit{
+			{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a, 0x01}},
+		},
+	},
+	{
+		Timestamp: 6000,
+		NALUnits: []NALUnit{
+			{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a, 0x02}},
+		},
+	},
+}
+
+// mustPacketizeRTPAccessUnits returns packets of aus: the STAP-A of SPS and
+// PPS, 3 FU-A of the IDR slice, and a single NAL unit packet for each of the
+// following access units.
+func mustPacketizeRTPAccessUnits(t *testing.T, aus []RTPAccessUnit, seq uint16) []RTPPacket {
+	var pkts []RTPPacket
+	for _, au := range aus {
+		payloads, err := NewRTPPacketizer(12).PacketizeAccessUnit(au.NALUnits)
+		require.NoError(t, err)
+		for _, p := range payloads {
+			pkts = append(pkts, RTPPacket{
+				Version:        2,
+				Marker:         p.Marker,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      au.Timestamp,
+				Payload:        p.Payload,
+			})
+			seq++
+		}
+	}
+	require.Len(t, pkts, 6)
+	return pkts
+}
+
+func pushRTPPackets(t *testing.T, d *RTPDepacketizer, pkts []RTPPacket) []RTPAccessUnit {
+	var aus []RTPAccessUnit
+	for _, pkt := range pkts {
+		aus = append(aus, d.Push(pkt)...)
+	}
+	return append(aus, d.Flush()...)
+}
+
+func TestRTPDepacketizer_Push(t *testing.T) {
+	t.Run("in order", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits, aus)
+	})
+
+	t.Run("reordered across sequence number wrap around", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 0xfffe)
+		pkts[1], pkts[2] = pkts[2], pkts[1]
+		pkts[4], pkts[5] = pkts[5], pkts[4]
+		aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits, aus)
+	})
+
+	t.Run("duplicate and late packets", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		pkts = append(pkts[:2], append([]RTPPacket{pkts[1], pkts[0]}, pkts[2:]...)...)
+		aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits, aus)
+	})
+
+	t.Run("lost FU-A fragment", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		pkts = append(pkts[:2], pkts[3:]...)
+
+		d := NewRTPDepacketizer()
+		d.ReorderWindow = 2
+		var aus []RTPAccessUnit
+		for i, pkt := range pkts {
+			completed := d.Push(pkt)
+			if i < 4 {
+				// the loss is not found until the window is exceeded
+				assert.Empty(t, completed)
+			}
+			aus = append(aus, completed...)
+		}
+		assert.Equal(t, []RTPAccessUnit{
+			{
+				Timestamp:       0,
+				NALUnits:        rtpDepacketizerTestAccessUnits[0].NALUnits[:2],
+				LostPackets:     1,
+				DroppedNALUnits: 1,
+			},
+			rtpDepacketizerTestAccessUnits[1],
+			rtpDepacketizerTestAccessUnits[2],
+		}, aus)
+	})
+
+	t.Run("lost FU-A start fragment", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		pkts = append(pkts[:1], pkts[2:]...)
+		aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+		assert.Equal(t, []RTPAccessUnit{
+			{
+				Timestamp:       0,
+				NALUnits:        rtpDepacketizerTestAccessUnits[0].NALUnits[:2],
+				LostPackets:     1,
+				DroppedNALUnits: 1,
+			},
+			rtpDepacketizerTestAccessUnits[1],
+			rtpDepacketizerTestAccessUnits[2],
+		}, aus)
+	})
+
+	t.Run("sequence number jump of a restarted sender", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		restarted := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 40000)
+		pkts = append(pkts[:4], restarted[4:]...)
+		aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits, aus)
+	})
+
+	t.Run("single packet far from the sequence", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		stray := pkts[4]
+		stray.SequenceNumber += 20000
+		pkts = append(pkts[:4], append([]RTPPacket{stray}, pkts[4:]...)...)
+		aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits, aus)
+	})
+
+	t.Run("malformed packets", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		for _, payload := range [][]byte{
+			{0x19, 0x00, 0x01},       // unsupported packet type
+			{0x78, 0x00, 0x04, 0x67}, // invalid STAP-A
+			{0x78, 0x00, 0x01, 0x2e}, // truncated NAL unit header extension
+		} {
+			// in the middle of the FU-A fragments
+			pkts := append([]RTPPacket{}, pkts...)
+			pkts[2].Payload = payload
+			aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+			assert.Equal(t, []RTPAccessUnit{
+				{
+					Timestamp:        0,
+					NALUnits:         rtpDepacketizerTestAccessUnits[0].NALUnits[:2],
+					DroppedNALUnits:  1,
+					MalformedPackets: 1,
+				},
+				rtpDepacketizerTestAccessUnits[1],
+				rtpDepacketizerTestAccessUnits[2],
+			}, aus, "payload=%x", payload)
+		}
+
+		pkts[4].Payload = []byte{0x19, 0x00, 0x01}
+		aus := pushRTPPackets(t, NewRTPDepacketizer(), pkts)
+		assert.Equal(t, []RTPAccessUnit{
+			rtpDepacketizerTestAccessUnits[0],
+			{Timestamp: 3000, MalformedPackets: 1},
+			rtpDepacketizerTestAccessUnits[2],
+		}, aus)
+	})
+
+	t.Run("too large fragmented NAL unit", func(t *testing.T) {
+		pkts := mustPacketizeRTPAccessUnits(t, rtpDepacketizerTestAccessUnits, 100)
+		d := NewRTPDepacketizer()
+		d.MaxNALUnitSize = 20
+		aus := pushRTPPackets(t, d, pkts)
+		assert.Equal(t, []RTPAccessUnit{
+			{
+				Timestamp:        0,
+				NALUnits:         rtpDepacketizerTestAccessUnits[0].NALUnits[:2],
+				DroppedNALUnits:  1,
+				MalformedPackets: 1,
+			},
+			rtpDepacketizerTestAccessUnits[1],
+			rtpDepacketizerTestAccessUnits[2],
+		}, aus)
+
+		d = NewRTPDepacketizer()
+		d.MaxNALUnitSize = 26
+		aus = pushRTPPackets(t, d, pkts)
+		assert.Equal(t, rtpDepacketizerTestAccessUnits, aus)
+	})
+
+	t.Run("truncated NAL unit header extension", func(t *testing.T) {
+		pkt := RTPPacket{}
+		require.NoError(t, pkt.UnmarshalBinary([]byte("\x8000000000000.0")))
+		d := NewRTPDepacketizer()
+		assert.Empty(t, d.Push(pkt))
+		assert.Equal(t, []RTPAccessUnit{
+			{Timestamp: pkt.Timestamp, MalformedPackets: 1},
+		}, d.Flush())
+	})
+}
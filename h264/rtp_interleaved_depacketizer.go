@@ -0,0 +1,235 @@
+package h264
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// RTPInterleavedNALUnit is a NAL unit received in the interleaved mode with
+// its decoding order number.
+type RTPInterleavedNALUnit struct {
+	DON       uint16
+	Timestamp uint32
+	NALUnit   NALUnit
+}
+
+// RTPInterleavedDepacketizer reassembles NAL units from RTP packets of the
+// interleaved mode of RFC 6184 (packetization-mode=2): STAP-B, MTAP16,
+// MTAP24, FU-B and FU-A. NAL units are reordered into decoding order by DON
+// in the de-interleaving buffer. Malformed packets are dropped and counted in
+// MalformedPackets.
+type RTPInterleavedDepacketizer struct {
+	// DeintBufReq is sprop-deint-buf-req, the max bytes of NAL units held in
+	// the de-interleaving buffer.
+	DeintBufReq    int
+	MaxNALUnitSize int
+
+	// MalformedPackets is the number of packets dropped since their payloads
+	// could not be depacketized.
+	MalformedPackets int
+
+	started bool
+	// lastDON and lastAbsDON track the DON wrap around.
+	lastDON    uint16
+	lastAbsDON int64
+
+	// buffered is sorted by absDON
+	buffered     []rtpDeinterleavingEntry
+	bufferedSize int
+
+	fragment          []byte
+	fragmentDON       uint16
+	fragmentTimestamp uint32
+	fragmentNextSeq   uint16
+}
+
+type rtpDeinterleavingEntry struct {
+	nal    RTPInterleavedNALUnit
+	absDON int64
+	size   int
+}
+
+func NewRTPInterleavedDepacketizer(deintBufReq int) *RTPInterleavedDepacketizer {
+	return &RTPInterleavedDepacketizer{
+		DeintBufReq:    deintBufReq,
+		MaxNALUnitSize: DefaultRTPMaxNALUnitSize,
+	}
+}
+
+// Push adds pkt and returns NAL units leaving the de-interleaving buffer in
+// decoding order.
+func (d *RTPInterleavedDepacketizer) Push(pkt RTPPacket) []RTPInterleavedNALUnit {
+	units, err := d.processPayload(pkt)
+	if err != nil {
+		d.MalformedPackets++
+		// the fragmented NAL unit is broken as if the packet were lost
+		d.fragment = nil
+	}
+	// all NAL units of a packet are checked first so that a malformed packet
+	// adds none of them
+	for _, unit := range units {
+		d.push(unit)
+	}
+
+	var nals []RTPInterleavedNALUnit
+	for d.bufferedSize > d.DeintBufReq && len(d.buffered) > 0 {
+		nals = append(nals, d.pop())
+	}
+	return nals
+}
+
+// Flush returns all NAL units in the de-interleaving buffer in decoding
+// order.
+func (d *RTPInterleavedDepacketizer) Flush() []RTPInterleavedNALUnit {
+	d.fragment = nil
+	var nals []RTPInterleavedNALUnit
+	for len(d.buffered) > 0 {
+		nals = append(nals, d.pop())
+	}
+	return nals
+}
+
+// processPayload returns the NAL units completed by pkt. It returns none of
+// them with an error.
+func (d *RTPInterleavedDepacketizer) processPayload(pkt RTPPacket) ([]rtpDeinterleavingEntry, error) {
+	payload := pkt.Payload
+	if len(payload) == 0 {
+		return nil, errors.New("empty payload")
+	}
+
+	var units []rtpDeinterleavingEntry
+	switch t := payload[0] & 0x1f; t {
+	case RTPPacketTypeSTAPB:
+		if len(payload) < 3 {
+			return nil, errors.Errorf("invalid STAP-B length: len=%d", len(payload))
+		}
+		don := binary.BigEndian.Uint16(payload[1:3])
+		nals, err := splitSTAP(payload[3:])
+		if err != nil {
+			return nil, err
+		}
+		// DON of the following NAL units is incremented by 1
+		for i, nal := range nals {
+			unit, err := newRTPDeinterleavingEntry(nal, don+uint16(i), pkt.Timestamp)
+			if err != nil {
+				return nil, err
+			}
+			units = append(units, unit)
+		}
+	case RTPPacketTypeMTAP16, RTPPacketTypeMTAP24:
+		tsOffsetSize := 2
+		if t == RTPPacketTypeMTAP24 {
+			tsOffsetSize = 3
+		}
+		if len(payload) < 3 {
+			return nil, errors.Errorf("invalid MTAP length: len=%d", len(payload))
+		}
+		donb := binary.BigEndian.Uint16(payload[1:3])
+		aggregated, err := splitSTAP(payload[3:])
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range aggregated {
+			if len(b) <= 1+tsOffsetSize {
+				return nil, errors.Errorf("invalid multi-time aggregation unit length: len=%d", len(b))
+			}
+			var tsOffset uint32
+			for _, c := range b[1 : 1+tsOffsetSize] {
+				tsOffset = tsOffset<<8 | uint32(c)
+			}
+			unit, err := newRTPDeinterleavingEntry(b[1+tsOffsetSize:], donb+uint16(b[0]), pkt.Timestamp+tsOffset)
+			if err != nil {
+				return nil, err
+			}
+			units = append(units, unit)
+		}
+	case RTPPacketTypeFUB:
+		if len(payload) < 4 {
+			return nil, errors.Errorf("invalid FU-B length: len=%d", len(payload))
+		}
+		if payload[1]&0x80 == 0 {
+			return nil, errors.New("FU-B without start bit")
+		}
+		if payload[1]&0x40 != 0 {
+			return nil, errors.New("FU-B with end bit")
+		}
+		d.fragment = append([]byte{payload[0]&0xe0 | payload[1]&0x1f}, payload[4:]...)
+		d.fragmentDON = binary.BigEndian.Uint16(payload[2:4])
+		d.fragmentTimestamp = pkt.Timestamp
+		d.fragmentNextSeq = pkt.SequenceNumber + 1
+	case RTPPacketTypeFUA:
+		if len(payload) < 2 {
+			return nil, errors.Errorf("invalid FU-A length: len=%d", len(payload))
+		}
+		if payload[1]&0x80 != 0 {
+			return nil, errors.New("FU-A with start bit in interleaved mode")
+		}
+		if d.fragment == nil || pkt.SequenceNumber != d.fragmentNextSeq || pkt.Timestamp != d.fragmentTimestamp {
+			// a fragment is lost
+			d.fragment = nil
+			return nil, nil
+		}
+		if len(d.fragment)+len(payload)-2 > d.MaxNALUnitSize {
+			return nil, errors.Errorf("too large fragmented NAL unit: len=%d", len(d.fragment)+len(payload)-2)
+		}
+		d.fragment = append(d.fragment, payload[2:]...)
+		d.fragmentNextSeq++
+		if payload[1]&0x40 != 0 {
+			nal := d.fragment
+			d.fragment = nil
+			unit, err := newRTPDeinterleavingEntry(nal, d.fragmentDON, d.fragmentTimestamp)
+			if err != nil {
+				return nil, err
+			}
+			units = append(units, unit)
+		}
+	default:
+		return nil, errors.Errorf("unsupported packet type in interleaved mode: %d", t)
+	}
+	return units, nil
+}
+
+func newRTPDeinterleavingEntry(b []byte, don uint16, timestamp uint32) (rtpDeinterleavingEntry, error) {
+	nal := NALUnit{}
+	if err := nal.UnmarshalBinary(b); err != nil {
+		return rtpDeinterleavingEntry{}, err
+	}
+	return rtpDeinterleavingEntry{
+		nal: RTPInterleavedNALUnit{
+			DON:       don,
+			Timestamp: timestamp,
+			NALUnit:   nal,
+		},
+		size: len(b),
+	}, nil
+}
+
+// push inserts e into the de-interleaving buffer.
+func (d *RTPInterleavedDepacketizer) push(e rtpDeinterleavingEntry) {
+	// AbsDON, which does not wrap around
+	don := e.nal.DON
+	e.absDON = int64(don)
+	if d.started {
+		e.absDON = d.lastAbsDON + int64(int16(don-d.lastDON))
+	}
+	d.started = true
+	d.lastDON = don
+	d.lastAbsDON = e.absDON
+
+	i := len(d.buffered)
+	for i > 0 && d.buffered[i-1].absDON > e.absDON {
+		i--
+	}
+	d.buffered = append(d.buffered, rtpDeinterleavingEntry{})
+	copy(d.buffered[i+1:], d.buffered[i:])
+	d.buffered[i] = e
+	d.bufferedSize += e.size
+}
+
+func (d *RTPInterleavedDepacketizer) pop() RTPInterleavedNALUnit {
+	e := d.buffered[0]
+	d.buffered = d.buffered[1:]
+	d.bufferedSize -= e.size
+	return e.nal
+}
@@ -0,0 +1,159 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rtpInterleavedTestPackets = []RTPPacket{
+	{
+		SequenceNumber: 1,
+		Timestamp:      0,
+		Payload: []byte{
+			0x79,       /* 0b0 11 11001 STAP-B */
+			0xff, 0xfe, // DON
+			0x00, 0x04, 0x67, 0x42, 0xc0, 0x1e,
+			0x00, 0x02, 0x68, 0xce,
+		},
+	},
+	{
+		SequenceNumber: 2,
+		Timestamp:      0,
+		Payload: []byte{
+			0x7d,       /* 0b0 11 11101 FU-B */
+			0x85,       /* 0b1 0 0 00101 */
+			0x00, 0x00, // DON
+			0x88, 0x01, 0x02,
+		},
+	},
+	{
+		SequenceNumber: 3,
+		Timestamp:      0,
+		Payload: []byte{
+			0x7c, /* 0b0 11 11100 FU-A */
+			0x45, /* 0b0 1 0 00101 */
+			0x03, 0x04,
+		},
+	},
+	{
+		SequenceNumber: 4,
+		Timestamp:      3000,
+		Payload: []byte{
+			0x5b,       /* 0b0 10 11011 MTAP24 */
+			0x00, 0x01, // DONB
+			0x00, 0x07, 0x00, 0x00, 0x00, 0x00, 0x41, 0x9a, 0x01,
+			0x00, 0x07, 0x02, 0x00, 0x17, 0x70, 0x41, 0x9a, 0x03,
+		},
+	},
+	{
+		SequenceNumber: 5,
+		Timestamp:      6000,
+		Payload: []byte{
+			0x1a,       /* 0b0 00 11010 MTAP16 */
+			0x00, 0x02, // DONB
+			0x00, 0x06, 0x00, 0x00, 0x00, 0x01, 0x9e, 0x02,
+		},
+	},
+}
+
+var rtpInterleavedTestNALUnits = []RTPInterleavedNALUnit{
+	{
+		DON:       0xfffe,
+		Timestamp: 0,
+		NALUnit:   NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: []byte{0x42, 0xc0, 0x1e}},
+	},
+	{
+		DON:       0xffff,
+		Timestamp: 0,
+		NALUnit:   NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xce}},
+	},
+	{
+		DON:       0,
+		Timestamp: 0,
+		NALUnit:   NALUnit{NALRefIDC: 3, NALUnitType: NALUnitTypeIDRSlice, RBSPByte: []byte{0x88, 0x01, 0x02, 0x03, 0x04}},
+	},
+	{
+		DON:       1,
+		Timestamp: 3000,
+		NALUnit:   NALUnit{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a, 0x01}},
+	},
+	{
+		DON:       2,
+		Timestamp: 6000,
+		NALUnit:   NALUnit{NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9e, 0x02}},
+	},
+	{
+		DON:       3,
+		Timestamp: 9000,
+		NALUnit:   NALUnit{NALRefIDC: 2, NALUnitType: NALUnitTypeNonIDRSlice, RBSPByte: []byte{0x9a, 0x03}},
+	},
+}
+
+func TestRTPInterleavedDepacketizer_Push(t *testing.T) {
+	t.Run("de-interleave by DON", func(t *testing.T) {
+		d := NewRTPInterleavedDepacketizer(1000)
+		for _, pkt := range rtpInterleavedTestPackets {
+			assert.Empty(t, d.Push(pkt))
+		}
+		assert.Equal(t, rtpInterleavedTestNALUnits, d.Flush())
+		assert.Zero(t, d.MalformedPackets)
+	})
+
+	t.Run("buffer exceeds sprop-deint-buf-req", func(t *testing.T) {
+		d := NewRTPInterleavedDepacketizer(4)
+		assert.Equal(t, rtpInterleavedTestNALUnits[:1], d.Push(rtpInterleavedTestPackets[0]))
+		assert.Equal(t, rtpInterleavedTestNALUnits[1:2], d.Flush())
+	})
+
+	t.Run("lost FU-A fragment", func(t *testing.T) {
+		d := NewRTPInterleavedDepacketizer(1000)
+		for _, pkt := range []RTPPacket{
+			rtpInterleavedTestPackets[1],
+			{
+				SequenceNumber: 4,
+				Payload:        rtpInterleavedTestPackets[2].Payload,
+			},
+		} {
+			assert.Empty(t, d.Push(pkt))
+		}
+		assert.Empty(t, d.Flush())
+		assert.Zero(t, d.MalformedPackets)
+	})
+
+	t.Run("too large fragmented NAL unit", func(t *testing.T) {
+		d := NewRTPInterleavedDepacketizer(1000)
+		d.MaxNALUnitSize = 5
+		for _, pkt := range rtpInterleavedTestPackets[1:3] {
+			assert.Empty(t, d.Push(pkt))
+		}
+		assert.Empty(t, d.Flush())
+		assert.Equal(t, 1, d.MalformedPackets)
+	})
+
+	t.Run("malformed packets", func(t *testing.T) {
+		for _, pkts := range [][]RTPPacket{
+			{{Payload: []byte{0x18, 0x00, 0x01, 0x00, 0x01, 0x2e}}},                   // truncated NAL unit header extension in STAP-B
+			{{Payload: []byte{0x1a, 0x00, 0x01, 0x00, 0x04, 0x00, 0x00, 0x01, 0x2e}}}, // truncated NAL unit header extension in MTAP16
+			{
+				{SequenceNumber: 1, Payload: []byte{0x1d, 0x8e, 0x00, 0x01}}, // FU-B
+				{SequenceNumber: 2, Payload: []byte{0x1c, 0x4e}},             // FU-A
+			},
+			{{Payload: []byte{0x18, 0x00, 0x01, 0x00, 0x02, 0x68, 0xce, 0x00, 0x01, 0x2e}}},                   // STAP-B of a valid and a malformed NAL unit
+			{{Payload: []byte{0x1a, 0x00, 0x01, 0x00, 0x05, 0x00, 0x00, 0x00, 0x68, 0xce, 0x00, 0x01, 0x00}}}, // MTAP16 of a valid and a too short unit
+			{
+				{SequenceNumber: 1, Payload: []byte{0x7d, 0xc5, 0x00, 0x00, 0x88}}, // FU-B with end bit
+				{SequenceNumber: 2, Payload: []byte{0x7c, 0x45, 0x01}},             // FU-A
+			},
+			{{Payload: []byte{0x41, 0x9a}}},                   // single NAL unit packet
+			{{Payload: []byte{0x78, 0x00, 0x02, 0x68, 0xce}}}, // STAP-A
+		} {
+			d := NewRTPInterleavedDepacketizer(0)
+			for _, pkt := range pkts {
+				assert.Empty(t, d.Push(pkt))
+			}
+			assert.Empty(t, d.Flush())
+			assert.Equal(t, 1, d.MalformedPackets)
+		}
+	})
+}
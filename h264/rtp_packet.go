@@ -0,0 +1,134 @@
+package h264
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// RTPPacket is an RTP packet defined in RFC 3550.
+type RTPPacket struct {
+	Version        uint8
+	Marker         bool
+	PayloadType    uint8
+	SequenceNumber uint16
+	Timestamp      uint32
+	SSRC           uint32
+	CSRC           []uint32
+	Extension      *RTPHeaderExtension
+	Payload        []byte
+	// PaddingSize is the number of padding octets including the last one
+	// which holds the count. The padding bit is set when it is not 0.
+	PaddingSize uint8
+}
+
+type RTPHeaderExtension struct {
+	Profile uint16
+	// Data length must be a multiple of 4.
+	Data []byte
+}
+
+func (m RTPPacket) MarshalBinary() ([]byte, error) {
+	if len(m.CSRC) > 15 {
+		return nil, errors.Errorf("too many CSRC: len=%d", len(m.CSRC))
+	}
+	if m.Extension != nil && len(m.Extension.Data)%4 != 0 {
+		return nil, errors.Errorf("invalid header extension length: len=%d", len(m.Extension.Data))
+	}
+
+	l := 12 + 4*len(m.CSRC) + len(m.Payload) + int(m.PaddingSize)
+	if m.Extension != nil {
+		l += 4 + len(m.Extension.Data)
+	}
+	b := make([]byte, 12, l)
+
+	b[0] = m.Version<<6 | uint8(len(m.CSRC))
+	if m.PaddingSize > 0 {
+		b[0] |= 0x20
+	}
+	if m.Extension != nil {
+		b[0] |= 0x10
+	}
+	b[1] = m.PayloadType & 0x7f
+	if m.Marker {
+		b[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(b[2:4], m.SequenceNumber)
+	binary.BigEndian.PutUint32(b[4:8], m.Timestamp)
+	binary.BigEndian.PutUint32(b[8:12], m.SSRC)
+	for _, csrc := range m.CSRC {
+		b = append(b, byte(csrc>>24), byte(csrc>>16), byte(csrc>>8), byte(csrc))
+	}
+	if m.Extension != nil {
+		n := len(m.Extension.Data) / 4
+		b = append(b,
+			byte(m.Extension.Profile>>8), byte(m.Extension.Profile),
+			byte(n>>8), byte(n),
+		)
+		b = append(b, m.Extension.Data...)
+	}
+	b = append(b, m.Payload...)
+	if m.PaddingSize > 0 {
+		b = append(b, make([]byte, m.PaddingSize-1)...)
+		b = append(b, m.PaddingSize)
+	}
+
+	return b, nil
+}
+
+func (m *RTPPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < 12 {
+		return errors.Errorf("invalid binary length: len=%d", len(b))
+	}
+
+	m.Version = b[0] >> 6
+	padding := b[0]&0x20 != 0
+	extension := b[0]&0x10 != 0
+	csrcCount := int(b[0] & 0x0f)
+	m.Marker = b[1]&0x80 != 0
+	m.PayloadType = b[1] & 0x7f
+	m.SequenceNumber = binary.BigEndian.Uint16(b[2:4])
+	m.Timestamp = binary.BigEndian.Uint32(b[4:8])
+	m.SSRC = binary.BigEndian.Uint32(b[8:12])
+
+	ind := 12
+	if len(b) < ind+4*csrcCount {
+		return errors.Errorf("invalid CSRC count: count=%d, len=%d", csrcCount, len(b))
+	}
+	m.CSRC = nil
+	for i := 0; i < csrcCount; i++ {
+		m.CSRC = append(m.CSRC, binary.BigEndian.Uint32(b[ind:ind+4]))
+		ind += 4
+	}
+
+	m.Extension = nil
+	if extension {
+		if len(b) < ind+4 {
+			return errors.Errorf("invalid header extension: len=%d", len(b))
+		}
+		profile := binary.BigEndian.Uint16(b[ind : ind+2])
+		n := 4 * int(binary.BigEndian.Uint16(b[ind+2:ind+4]))
+		ind += 4
+		if len(b) < ind+n {
+			return errors.Errorf("invalid header extension length: length=%d, len=%d", n, len(b))
+		}
+		m.Extension = &RTPHeaderExtension{
+			Profile: profile,
+			Data:    b[ind : ind+n],
+		}
+		ind += n
+	}
+
+	end := len(b)
+	m.PaddingSize = 0
+	if padding {
+		m.PaddingSize = b[len(b)-1]
+		if m.PaddingSize == 0 || int(m.PaddingSize) > end-ind {
+			return errors.Errorf("invalid padding size: size=%d", m.PaddingSize)
+		}
+		end -= int(m.PaddingSize)
+	}
+	m.Payload = b[ind:end]
+
+	return nil
+}
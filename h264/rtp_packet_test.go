@@ -0,0 +1,103 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var RTPPacketTestData = []struct {
+	Name   string
+	Struct RTPPacket
+	Binary []byte
+}{
+	{
+		Name: "minimal",
+		Struct: RTPPacket{
+			Version:        2,
+			Marker:         true,
+			PayloadType:    96,
+			SequenceNumber: 0x1234,
+			Timestamp:      0x56789abc,
+			SSRC:           0xdeadbeef,
+			Payload:        []byte{0x41, 0x9a},
+		},
+		Binary: []byte{
+			0x80, /* 0b10 0 0 0000 */
+			0xe0, /* 0b1 1100000 */
+			0x12, 0x34,
+			0x56, 0x78, 0x9a, 0xbc,
+			0xde, 0xad, 0xbe, 0xef,
+			0x41, 0x9a,
+		},
+	},
+	{
+		Name: "with CSRC, header extension and padding",
+		Struct: RTPPacket{
+			Version:        2,
+			PayloadType:    97,
+			SequenceNumber: 1,
+			Timestamp:      2,
+			SSRC:           3,
+			CSRC:           []uint32{4, 5},
+			Extension: &RTPHeaderExtension{
+				Profile: 0xbede,
+				Data:    []byte{0x10, 0xff, 0x00, 0x00},
+			},
+			Payload:     []byte{0x09, 0x10},
+			PaddingSize: 3,
+		},
+		Binary: []byte{
+			0xb2, /* 0b10 1 1 0010 */
+			0x61,
+			0x00, 0x01,
+			0x00, 0x00, 0x00, 0x02,
+			0x00, 0x00, 0x00, 0x03,
+			// CSRC
+			0x00, 0x00, 0x00, 0x04,
+			0x00, 0x00, 0x00, 0x05,
+			// header extension
+			0xbe, 0xde, 0x00, 0x01,
+			0x10, 0xff, 0x00, 0x00,
+			// payload
+			0x09, 0x10,
+			// padding
+			0x00, 0x00, 0x03,
+		},
+	},
+}
+
+func TestRTPPacket_MarshalBinary(t *testing.T) {
+	for _, tt := range RTPPacketTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := tt.Struct.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+}
+
+func TestRTPPacket_UnmarshalBinary(t *testing.T) {
+	for _, tt := range RTPPacketTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := RTPPacket{}
+			err := s.UnmarshalBinary(tt.Binary)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, b := range [][]byte{
+			{0x80, 0x60, 0x00, 0x01},
+			// CSRC count exceeds
+			{0x81, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03},
+			// padding size exceeds
+			{0xa0, 0x60, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x03, 0x09, 0x03},
+		} {
+			s := RTPPacket{}
+			assert.Error(t, s.UnmarshalBinary(b))
+		}
+	})
+}
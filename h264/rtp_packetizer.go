@@ -0,0 +1,134 @@
+package h264
+
+import "github.com/pkg/errors"
+
+// NAL unit types of RTP payload structures (RFC 6184 5.2).
+const (
+	RTPPacketTypeSTAPA  = 24
+	RTPPacketTypeSTAPB  = 25
+	RTPPacketTypeMTAP16 = 26
+	RTPPacketTypeMTAP24 = 27
+	RTPPacketTypeFUA    = 28
+	RTPPacketTypeFUB    = 29
+)
+
+// RTPPayload is the payload of an RTP packet and its marker bit.
+type RTPPayload struct {
+	Payload []byte
+	Marker  bool
+}
+
+// RTPPacketizer packetizes access units into RTP payloads of the
+// non-interleaved mode of RFC 6184: single NAL unit packets, STAP-A and FU-A.
+type RTPPacketizer struct {
+	// MTU is the max size of a payload.
+	MTU int
+}
+
+func NewRTPPacketizer(mtu int) *RTPPacketizer {
+	return &RTPPacketizer{MTU: mtu}
+}
+
+// PacketizeAccessUnit returns the payloads of an access unit. The marker bit
+// is set on the last payload.
+func (p *RTPPacketizer) PacketizeAccessUnit(nals []NALUnit) ([]RTPPayload, error) {
+	raws := make([][]byte, len(nals))
+	for i := range nals {
+		b, err := nals[i].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		raws[i] = b
+	}
+	return p.PacketizeRaw(raws)
+}
+
+// PacketizeRaw is the same as PacketizeAccessUnit but takes the bytes of NAL
+// units including their NAL unit header.
+func (p *RTPPacketizer) PacketizeRaw(nals [][]byte) ([]RTPPayload, error) {
+	// the smallest payload which can carry a fragment
+	if p.MTU < 3 {
+		return nil, errors.Errorf("too small MTU: %d", p.MTU)
+	}
+
+	var payloads []RTPPayload
+	var aggregated [][]byte
+	// 1 byte of STAP-A NAL unit header
+	aggregatedSize := 1
+
+	flush := func() {
+		switch len(aggregated) {
+		case 0:
+		case 1:
+			payloads = append(payloads, RTPPayload{Payload: aggregated[0]})
+		default:
+			payloads = append(payloads, RTPPayload{Payload: marshalSTAPA(aggregated, aggregatedSize)})
+		}
+		aggregated = nil
+		aggregatedSize = 1
+	}
+
+	for _, nal := range nals {
+		if len(nal) == 0 {
+			return nil, errors.New("empty NAL unit")
+		}
+		if len(nal) > p.MTU {
+			flush()
+			payloads = append(payloads, fragmentFUA(nal, p.MTU)...)
+			continue
+		}
+		if aggregatedSize+2+len(nal) > p.MTU {
+			flush()
+		}
+		aggregated = append(aggregated, nal)
+		aggregatedSize += 2 + len(nal)
+	}
+	flush()
+
+	if len(payloads) > 0 {
+		payloads[len(payloads)-1].Marker = true
+	}
+	return payloads, nil
+}
+
+func marshalSTAPA(nals [][]byte, size int) []byte {
+	b := make([]byte, 1, size)
+	for _, nal := range nals {
+		// F bit is the OR and NRI is the max of the aggregated units
+		b[0] |= nal[0] & 0x80
+		if nal[0]&0x60 > b[0]&0x60 {
+			b[0] = b[0]&^0x60 | nal[0]&0x60
+		}
+		b = append(b, byte(len(nal)>>8), byte(len(nal)))
+		b = append(b, nal...)
+	}
+	b[0] |= RTPPacketTypeSTAPA
+	return b
+}
+
+func fragmentFUA(nal []byte, mtu int) []RTPPayload {
+	indicator := nal[0]&0xe0 | RTPPacketTypeFUA
+	nalUnitType := nal[0] & 0x1f
+
+	var payloads []RTPPayload
+	data := nal[1:]
+	for start := true; len(data) > 0; start = false {
+		n := mtu - 2
+		if n > len(data) {
+			n = len(data)
+		}
+		header := nalUnitType
+		if start {
+			header |= 0x80
+		}
+		if n == len(data) {
+			header |= 0x40
+		}
+		b := make([]byte, 0, 2+n)
+		b = append(b, indicator, header)
+		b = append(b, data[:n]...)
+		payloads = append(payloads, RTPPayload{Payload: b})
+		data = data[n:]
+	}
+	return payloads
+}
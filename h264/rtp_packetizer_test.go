@@ -0,0 +1,115 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var RTPPacketizerTestData = []struct {
+	Name     string
+	MTU      int
+	NALUnits [][]byte
+	Payloads []RTPPayload
+}{
+	{
+		Name: "single NAL unit packet",
+		MTU:  12,
+		NALUnits: [][]byte{
+			{0x41, 0x9a, 0x01},
+		},
+		Payloads: []RTPPayload{
+			{Payload: []byte{0x41, 0x9a, 0x01}, Marker: true},
+		},
+	},
+	{
+		Name: "STAP-A and FU-A",
+		MTU:  12,
+		NALUnits: [][]byte{
+			{0x67, 0x42, 0xc0, 0x1e},
+			{0x68, 0xce},
+			{
+				0x65,
+				0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a,
+				0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13,
+			},
+		},
+		Payloads: []RTPPayload{
+			{Payload: []byte{
+				0x78, /* 0b0 11 11000 */
+				0x00, 0x04, 0x67, 0x42, 0xc0, 0x1e,
+				0x00, 0x02, 0x68, 0xce,
+			}},
+			{Payload: []byte{
+				0x7c, /* 0b0 11 11100 */
+				0x85, /* 0b1 0 0 00101 */
+				0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a,
+			}},
+			{Payload: []byte{
+				0x7c, /* 0b0 11 11100 */
+				0x45, /* 0b0 1 0 00101 */
+				0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13,
+			}, Marker: true},
+		},
+	},
+	{
+		Name: "STAP-A takes the max NRI",
+		MTU:  12,
+		NALUnits: [][]byte{
+			{0x06, 0x05, 0x00, 0x80},
+			{0x21, 0x9a},
+		},
+		Payloads: []RTPPayload{
+			{Payload: []byte{
+				0x38, /* 0b0 01 11000 */
+				0x00, 0x04, 0x06, 0x05, 0x00, 0x80,
+				0x00, 0x02, 0x21, 0x9a,
+			}, Marker: true},
+		},
+	},
+	{
+		Name: "NAL units exceeding a STAP-A",
+		MTU:  8,
+		NALUnits: [][]byte{
+			{0x09, 0x10},
+			{0x06, 0x05, 0x00, 0x80},
+			{0x41, 0x9a, 0x01, 0x02, 0x03},
+		},
+		Payloads: []RTPPayload{
+			{Payload: []byte{0x09, 0x10}},
+			{Payload: []byte{0x06, 0x05, 0x00, 0x80}},
+			{Payload: []byte{0x41, 0x9a, 0x01, 0x02, 0x03}, Marker: true},
+		},
+	},
+}
+
+func TestRTPPacketizer_PacketizeRaw(t *testing.T) {
+	for _, tt := range RTPPacketizerTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			payloads, err := NewRTPPacketizer(tt.MTU).PacketizeRaw(tt.NALUnits)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Payloads, payloads)
+		})
+	}
+
+	t.Run("too small MTU", func(t *testing.T) {
+		_, err := NewRTPPacketizer(2).PacketizeRaw([][]byte{{0x41, 0x9a}})
+		assert.Error(t, err)
+	})
+}
+
+func TestRTPPacketizer_PacketizeAccessUnit(t *testing.T) {
+	payloads, err := NewRTPPacketizer(1200).PacketizeAccessUnit([]NALUnit{
+		{NALRefIDC: 3, NALUnitType: NALUnitTypeSequenceParameterSet, RBSPByte: []byte{0x42, 0xc0, 0x1e}},
+		{NALRefIDC: 3, NALUnitType: NALUnitTypePictureParameterSet, RBSPByte: []byte{0xce}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []RTPPayload{
+		{Payload: []byte{
+			0x78,
+			0x00, 0x04, 0x67, 0x42, 0xc0, 0x1e,
+			0x00, 0x02, 0x68, 0xce,
+		}, Marker: true},
+	}, payloads)
+}
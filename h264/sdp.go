@@ -0,0 +1,306 @@
+package h264
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ProfileLevelID is profile-level-id of the SDP format parameters (RFC 6184
+// 8.1).
+type ProfileLevelID struct {
+	ProfileIDC uint8
+	// ProfileIOP is the byte between profile_idc and level_idc in SPS.
+	ProfileIOP uint8
+	LevelIDC   uint8
+}
+
+// NewProfileLevelID returns the profile-level-id which sps conforms to.
+func NewProfileLevelID(sps SequenceParameterSet) ProfileLevelID {
+	return ProfileLevelID{
+		ProfileIDC: sps.ProfileIDC,
+		ProfileIOP: profileCompatibility(sps),
+		LevelIDC:   sps.LevelIDC,
+	}
+}
+
+func ParseProfileLevelID(s string) (ProfileLevelID, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 3 {
+		return ProfileLevelID{}, errors.Errorf("invalid profile-level-id: %q", s)
+	}
+	return ProfileLevelID{
+		ProfileIDC: b[0],
+		ProfileIOP: b[1],
+		LevelIDC:   b[2],
+	}, nil
+}
+
+func (m ProfileLevelID) String() string {
+	return hex.EncodeToString([]byte{m.ProfileIDC, m.ProfileIOP, m.LevelIDC})
+}
+
+// SDPFormatParameters is the format parameters of H.264 in an a=fmtp line
+// (RFC 6184 8.1). Numeric parameters are omitted when they are 0.
+type SDPFormatParameters struct {
+	ProfileLevelID         *ProfileLevelID
+	PacketizationMode      uint8
+	LevelAsymmetryAllowed  bool
+	SpropParameterSets     [][]byte
+	MaxMBPS                uint64
+	MaxSMBPS               uint64
+	MaxFS                  uint64
+	MaxCPB                 uint64
+	MaxDPB                 uint64
+	MaxBR                  uint64
+	RedundantPicCap        bool
+	SpropInterleavingDepth uint64
+	SpropDeintBufReq       uint64
+	DeintBufCap            uint64
+	SpropInitBufTime       uint64
+	SpropMaxDonDiff        uint64
+	MaxRcmdNALUSize        uint64
+	// Others holds the parameters not modelled above.
+	Others map[string]string
+}
+
+// NewSDPFormatParameters returns the parameters describing a stream of the
+// given SPS and PPS NAL units. profile-level-id is derived from the first
+// SPS.
+func NewSDPFormatParameters(spsNALUnits, ppsNALUnits [][]byte, packetizationMode uint8) (SDPFormatParameters, error) {
+	if len(spsNALUnits) == 0 {
+		return SDPFormatParameters{}, errors.New("sequence parameter set is not found")
+	}
+	nal := NALUnit{}
+	if err := nal.UnmarshalBinary(spsNALUnits[0]); err != nil {
+		return SDPFormatParameters{}, err
+	}
+	if nal.NALUnitType != NALUnitTypeSequenceParameterSet {
+		return SDPFormatParameters{}, errors.Errorf("not a sequence parameter set: nal_unit_type=%d", nal.NALUnitType)
+	}
+	sps := SequenceParameterSet{}
+	if err := sps.UnmarshalBinary(nal.RBSPByte); err != nil {
+		return SDPFormatParameters{}, errors.Wrap(err, "failed to unmarshal sequence parameter set")
+	}
+	profileLevelID := NewProfileLevelID(sps)
+
+	return SDPFormatParameters{
+		ProfileLevelID:     &profileLevelID,
+		PacketizationMode:  packetizationMode,
+		SpropParameterSets: append(append([][]byte{}, spsNALUnits...), ppsNALUnits...),
+	}, nil
+}
+
+// ParseSDPFormatParameters parses the parameters of an a=fmtp line. The
+// line may include "a=fmtp:<format> ".
+func ParseSDPFormatParameters(s string) (SDPFormatParameters, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "a=fmtp:") {
+		i := strings.IndexAny(s, " \t")
+		if i < 0 {
+			return SDPFormatParameters{}, nil
+		}
+		s = s[i+1:]
+	}
+
+	m := SDPFormatParameters{}
+	for _, param := range strings.Split(s, ";") {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+		kv := strings.SplitN(param, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := ""
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+		}
+		if err := m.set(key, value); err != nil {
+			return SDPFormatParameters{}, err
+		}
+	}
+	return m, nil
+}
+
+func (m *SDPFormatParameters) set(key, value string) error {
+	parseUint := func(v *uint64) error {
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return errors.Errorf("invalid %s: %q", key, value)
+		}
+		*v = n
+		return nil
+	}
+	parseFlag := func(v *bool) error {
+		switch value {
+		case "0":
+			*v = false
+		case "1":
+			*v = true
+		default:
+			return errors.Errorf("invalid %s: %q", key, value)
+		}
+		return nil
+	}
+
+	switch key {
+	case "profile-level-id":
+		profileLevelID, err := ParseProfileLevelID(value)
+		if err != nil {
+			return err
+		}
+		m.ProfileLevelID = &profileLevelID
+	case "packetization-mode":
+		n, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || n > 2 {
+			return errors.Errorf("invalid %s: %q", key, value)
+		}
+		m.PacketizationMode = uint8(n)
+	case "level-asymmetry-allowed":
+		return parseFlag(&m.LevelAsymmetryAllowed)
+	case "sprop-parameter-sets":
+		m.SpropParameterSets = nil
+		for _, s := range strings.Split(value, ",") {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return errors.Wrapf(err, "invalid %s: %q", key, value)
+			}
+			if len(b) == 0 {
+				return errors.Errorf("invalid %s: %q", key, value)
+			}
+			m.SpropParameterSets = append(m.SpropParameterSets, b)
+		}
+	case "max-mbps":
+		return parseUint(&m.MaxMBPS)
+	case "max-smbps":
+		return parseUint(&m.MaxSMBPS)
+	case "max-fs":
+		return parseUint(&m.MaxFS)
+	case "max-cpb":
+		return parseUint(&m.MaxCPB)
+	case "max-dpb":
+		return parseUint(&m.MaxDPB)
+	case "max-br":
+		return parseUint(&m.MaxBR)
+	case "redundant-pic-cap":
+		return parseFlag(&m.RedundantPicCap)
+	case "sprop-interleaving-depth":
+		return parseUint(&m.SpropInterleavingDepth)
+	case "sprop-deint-buf-req":
+		return parseUint(&m.SpropDeintBufReq)
+	case "deint-buf-cap":
+		return parseUint(&m.DeintBufCap)
+	case "sprop-init-buf-time":
+		return parseUint(&m.SpropInitBufTime)
+	case "sprop-max-don-diff":
+		return parseUint(&m.SpropMaxDonDiff)
+	case "max-rcmd-nalu-size":
+		return parseUint(&m.MaxRcmdNALUSize)
+	default:
+		if m.Others == nil {
+			m.Others = make(map[string]string)
+		}
+		m.Others[key] = value
+	}
+	return nil
+}
+
+// String returns the parameters joined by ";" as in an a=fmtp line.
+func (m SDPFormatParameters) String() string {
+	var params []string
+	if m.LevelAsymmetryAllowed {
+		params = append(params, "level-asymmetry-allowed=1")
+	}
+	params = append(params, fmt.Sprintf("packetization-mode=%d", m.PacketizationMode))
+	if m.ProfileLevelID != nil {
+		params = append(params, "profile-level-id="+m.ProfileLevelID.String())
+	}
+	if len(m.SpropParameterSets) > 0 {
+		sets := make([]string, len(m.SpropParameterSets))
+		for i := range m.SpropParameterSets {
+			sets[i] = base64.StdEncoding.EncodeToString(m.SpropParameterSets[i])
+		}
+		params = append(params, "sprop-parameter-sets="+strings.Join(sets, ","))
+	}
+	for _, p := range []struct {
+		key   string
+		value uint64
+	}{
+		{"max-mbps", m.MaxMBPS},
+		{"max-smbps", m.MaxSMBPS},
+		{"max-fs", m.MaxFS},
+		{"max-cpb", m.MaxCPB},
+		{"max-dpb", m.MaxDPB},
+		{"max-br", m.MaxBR},
+		{"sprop-interleaving-depth", m.SpropInterleavingDepth},
+		{"sprop-deint-buf-req", m.SpropDeintBufReq},
+		{"deint-buf-cap", m.DeintBufCap},
+		{"sprop-init-buf-time", m.SpropInitBufTime},
+		{"sprop-max-don-diff", m.SpropMaxDonDiff},
+		{"max-rcmd-nalu-size", m.MaxRcmdNALUSize},
+	} {
+		if p.value != 0 {
+			params = append(params, fmt.Sprintf("%s=%d", p.key, p.value))
+		}
+	}
+	if m.RedundantPicCap {
+		params = append(params, "redundant-pic-cap=1")
+	}
+	keys := make([]string, 0, len(m.Others))
+	for key := range m.Others {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		params = append(params, key+"="+m.Others[key])
+	}
+	return strings.Join(params, ";")
+}
+
+// FMTPLine returns the a=fmtp line for the payload type.
+func (m SDPFormatParameters) FMTPLine(payloadType uint8) string {
+	return fmt.Sprintf("a=fmtp:%d %s", payloadType, m)
+}
+
+// SpropSequenceParameterSets returns the SPSs in sprop-parameter-sets.
+func (m SDPFormatParameters) SpropSequenceParameterSets() ([]SequenceParameterSet, error) {
+	var spss []SequenceParameterSet
+	for i, b := range m.SpropParameterSets {
+		if len(b) == 0 {
+			return nil, errors.Errorf("empty sprop-parameter-sets entry: index=%d", i)
+		}
+		if b[0]&0x1f != NALUnitTypeSequenceParameterSet {
+			continue
+		}
+		nal := NALUnit{}
+		if err := nal.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+		sps := SequenceParameterSet{}
+		if err := sps.UnmarshalBinary(nal.RBSPByte); err != nil {
+			return nil, errors.Wrap(err, "failed to unmarshal sequence parameter set")
+		}
+		spss = append(spss, sps)
+	}
+	return spss, nil
+}
+
+// SpropPictureParameterSets returns the PPS NAL units in
+// sprop-parameter-sets.
+func (m SDPFormatParameters) SpropPictureParameterSets() ([][]byte, error) {
+	var ppss [][]byte
+	for i, b := range m.SpropParameterSets {
+		if len(b) == 0 {
+			return nil, errors.Errorf("empty sprop-parameter-sets entry: index=%d", i)
+		}
+		if b[0]&0x1f == NALUnitTypePictureParameterSet {
+			ppss = append(ppss, b)
+		}
+	}
+	return ppss, nil
+}
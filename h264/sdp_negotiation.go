@@ -0,0 +1,152 @@
+package h264
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Profile is a profile distinguished in the offer/answer of profile-level-id.
+type Profile uint8
+
+const (
+	ProfileUnknown Profile = iota
+	ProfileConstrainedBaseline
+	ProfileBaseline
+	ProfileMain
+	ProfileConstrainedHigh
+	ProfileHigh
+	ProfilePredictiveHigh444
+)
+
+// Level1b is the level of level 1b. level_idc 11 with constraint_set3_flag
+// in Baseline, Main and Extended profiles is also level 1b.
+const Level1b = 9
+
+// DefaultProfileLevelID is profile-level-id when it is absent, that is
+// Baseline profile level 1.0.
+var DefaultProfileLevelID = ProfileLevelID{ProfileIDC: 66, ProfileIOP: 0x00, LevelIDC: 10}
+
+// profilePatterns maps profile_idc and profile-iop to Profile. The bits of
+// profile-iop in mask must be equal to value.
+var profilePatterns = []struct {
+	profileIDC uint8
+	mask       uint8
+	value      uint8
+	profile    Profile
+}{
+	{66, 0x4f, 0x40, ProfileConstrainedBaseline},
+	{77, 0x8f, 0x80, ProfileConstrainedBaseline},
+	{88, 0xcf, 0xc0, ProfileConstrainedBaseline},
+	{66, 0x4f, 0x00, ProfileBaseline},
+	{88, 0xcf, 0x80, ProfileBaseline},
+	{77, 0xaf, 0x00, ProfileMain},
+	{100, 0xff, 0x00, ProfileHigh},
+	{100, 0xff, 0x0c, ProfileConstrainedHigh},
+	{244, 0xff, 0x00, ProfilePredictiveHigh444},
+}
+
+var validLevels = []uint8{Level1b, 10, 11, 12, 13, 20, 21, 22, 30, 31, 32, 40, 41, 42, 50, 51, 52, 60, 61, 62}
+
+// Profile returns the profile of m. A stream conforming to Baseline profile
+// with constraint_set1_flag is Constrained Baseline profile.
+func (m ProfileLevelID) Profile() Profile {
+	for _, p := range profilePatterns {
+		if m.ProfileIDC == p.profileIDC && m.ProfileIOP&p.mask == p.value {
+			return p.profile
+		}
+	}
+	return ProfileUnknown
+}
+
+// Level returns the level of m as level_idc. Level 1b is Level1b.
+func (m ProfileLevelID) Level() uint8 {
+	if m.LevelIDC == 11 && m.ProfileIOP&0x10 != 0 && hasLevel1bConstraintSet3(m.ProfileIDC) {
+		return Level1b
+	}
+	return m.LevelIDC
+}
+
+// WithLevel returns m with the level replaced. Level 1b is Level1b.
+func (m ProfileLevelID) WithLevel(level uint8) ProfileLevelID {
+	if hasLevel1bConstraintSet3(m.ProfileIDC) {
+		m.ProfileIOP &^= 0x10
+		if level == Level1b {
+			m.ProfileIOP |= 0x10
+			level = 11
+		}
+	}
+	m.LevelIDC = level
+	return m
+}
+
+func hasLevel1bConstraintSet3(profileIDC uint8) bool {
+	return profileIDC == 66 || profileIDC == 77 || profileIDC == 88
+}
+
+// isLowerLevel reports whether level a is lower than b. Level1b lies between
+// level 1.0 and level 1.1 while its value is the lowest.
+func isLowerLevel(a, b uint8) bool {
+	switch {
+	case a == Level1b:
+		return b != 10 && b != Level1b
+	case b == Level1b:
+		return a == 10
+	}
+	return a < b
+}
+
+func (m ProfileLevelID) validate() error {
+	if m.Profile() == ProfileUnknown {
+		return errors.Errorf("unsupported profile: profile-level-id=%s", m)
+	}
+	level := m.Level()
+	for _, l := range validLevels {
+		if l == level {
+			return nil
+		}
+	}
+	return errors.Errorf("unsupported level: profile-level-id=%s", m)
+}
+
+// profileLevelID returns profile-level-id of m or the default value.
+func (m SDPFormatParameters) profileLevelID() ProfileLevelID {
+	if m.ProfileLevelID == nil {
+		return DefaultProfileLevelID
+	}
+	return *m.ProfileLevelID
+}
+
+// IsCompatibleSDPFormatParameters reports whether a and b have the same
+// profile and packetization-mode, regardless of level.
+func IsCompatibleSDPFormatParameters(a, b SDPFormatParameters) bool {
+	pa, pb := a.profileLevelID(), b.profileLevelID()
+	if pa.validate() != nil || pb.validate() != nil {
+		return false
+	}
+	return pa.Profile() == pb.Profile() && a.PacketizationMode == b.PacketizationMode
+}
+
+// AnswerSDPFormatParameters returns the parameters to answer offer with
+// local, the parameters supported locally (RFC 6184 8.2.2). The level of the
+// answer is the lower one of the offer and local, or the local one when both
+// allow level asymmetry.
+func AnswerSDPFormatParameters(offer, local SDPFormatParameters) (SDPFormatParameters, error) {
+	if !IsCompatibleSDPFormatParameters(offer, local) {
+		return SDPFormatParameters{}, errors.Errorf(
+			"incompatible parameters: offer=%q, local=%q", offer, local,
+		)
+	}
+
+	answer := local
+	if offer.ProfileLevelID == nil && local.ProfileLevelID == nil {
+		return answer, nil
+	}
+
+	offerPLID, localPLID := offer.profileLevelID(), local.profileLevelID()
+	level := localPLID.Level()
+	if !(offer.LevelAsymmetryAllowed && local.LevelAsymmetryAllowed) && isLowerLevel(offerPLID.Level(), level) {
+		level = offerPLID.Level()
+	}
+	answerPLID := localPLID.WithLevel(level)
+	answer.ProfileLevelID = &answerPLID
+	return answer, nil
+}
@@ -0,0 +1,218 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseProfileLevelID(t *testing.T, s string) *ProfileLevelID {
+	p, err := ParseProfileLevelID(s)
+	require.NoError(t, err)
+	return &p
+}
+
+func TestProfileLevelID_Profile(t *testing.T) {
+	for _, tt := range []struct {
+		ProfileLevelID string
+		Profile        Profile
+		Level          uint8
+	}{
+		{"42e01f", ProfileConstrainedBaseline, 31},
+		{"42c01e", ProfileConstrainedBaseline, 30},
+		{"4d801f", ProfileConstrainedBaseline, 31},
+		{"58c01f", ProfileConstrainedBaseline, 31},
+		{"42001f", ProfileBaseline, 31},
+		{"42a01f", ProfileBaseline, 31},
+		{"58801f", ProfileBaseline, 31},
+		{"4d001f", ProfileMain, 31},
+		{"4d401f", ProfileMain, 31},
+		{"640c1f", ProfileConstrainedHigh, 31},
+		{"64001f", ProfileHigh, 31},
+		{"f4001f", ProfilePredictiveHigh444, 31},
+		{"42f00b", ProfileConstrainedBaseline, Level1b},
+		{"42100b", ProfileBaseline, Level1b},
+		{"4d100b", ProfileMain, Level1b},
+		{"640009", ProfileHigh, Level1b},
+		{"64000b", ProfileHigh, 11},
+		{"42e10b", ProfileUnknown, 11},
+		{"6e001f", ProfileUnknown, 31},
+	} {
+		t.Run(tt.ProfileLevelID, func(t *testing.T) {
+			p := mustParseProfileLevelID(t, tt.ProfileLevelID)
+			assert.Equal(t, tt.Profile, p.Profile())
+			assert.Equal(t, tt.Level, p.Level())
+		})
+	}
+
+	t.Run("from SequenceParameterSet", func(t *testing.T) {
+		sps := SequenceParameterSet{ProfileIDC: 66, ConstraintSet1Flag: true, LevelIDC: 31}
+		assert.Equal(t, ProfileConstrainedBaseline, NewProfileLevelID(sps).Profile())
+	})
+}
+
+func TestProfileLevelID_WithLevel(t *testing.T) {
+	for _, tt := range []struct {
+		ProfileLevelID string
+		Level          uint8
+		Expected       string
+	}{
+		{"42e01f", 30, "42e01e"},
+		{"42e01f", Level1b, "42f00b"},
+		{"42f00b", 11, "42e00b"},
+		{"4d001f", Level1b, "4d100b"},
+		{"64001f", Level1b, "640009"},
+	} {
+		t.Run(tt.ProfileLevelID, func(t *testing.T) {
+			assert.Equal(t, tt.Expected, mustParseProfileLevelID(t, tt.ProfileLevelID).WithLevel(tt.Level).String())
+		})
+	}
+}
+
+func TestIsCompatibleSDPFormatParameters(t *testing.T) {
+	for _, tt := range []struct {
+		Name       string
+		A          SDPFormatParameters
+		B          SDPFormatParameters
+		Compatible bool
+	}{
+		{
+			Name:       "same profile with different levels",
+			A:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+			B:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "4d800a"), PacketizationMode: 1},
+			Compatible: true,
+		},
+		{
+			Name:       "absent profile-level-id is Baseline",
+			A:          SDPFormatParameters{},
+			B:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42001f")},
+			Compatible: true,
+		},
+		{
+			Name:       "Baseline and Constrained Baseline",
+			A:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+			B:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42001f"), PacketizationMode: 1},
+			Compatible: false,
+		},
+		{
+			Name:       "different packetization-mode",
+			A:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 0},
+			B:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+			Compatible: false,
+		},
+		{
+			Name:       "unsupported level",
+			A:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f")},
+			B:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e0ff")},
+			Compatible: false,
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Compatible, IsCompatibleSDPFormatParameters(tt.A, tt.B))
+		})
+	}
+}
+
+func TestAnswerSDPFormatParameters(t *testing.T) {
+	for _, tt := range []struct {
+		Name           string
+		Offer          SDPFormatParameters
+		Local          SDPFormatParameters
+		ProfileLevelID *ProfileLevelID
+	}{
+		{
+			Name:           "lower level of offer",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01e"), PacketizationMode: 1},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+			ProfileLevelID: mustParseProfileLevelID(t, "42e01e"),
+		},
+		{
+			Name:           "lower level of local",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e034"), PacketizationMode: 1},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+			ProfileLevelID: mustParseProfileLevelID(t, "42e01f"),
+		},
+		{
+			Name:           "level asymmetry allowed",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e00a"), PacketizationMode: 1, LevelAsymmetryAllowed: true},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1, LevelAsymmetryAllowed: true},
+			ProfileLevelID: mustParseProfileLevelID(t, "42e01f"),
+		},
+		{
+			Name:           "level asymmetry allowed only by offer",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e00a"), PacketizationMode: 1, LevelAsymmetryAllowed: true},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+			ProfileLevelID: mustParseProfileLevelID(t, "42e00a"),
+		},
+		{
+			Name:           "level 1b",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42f00b"), PacketizationMode: 1},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+			ProfileLevelID: mustParseProfileLevelID(t, "42f00b"),
+		},
+		{
+			Name:           "level 1b is lower than level 1.1",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e00b"), PacketizationMode: 1},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42f00b"), PacketizationMode: 1},
+			ProfileLevelID: mustParseProfileLevelID(t, "42f00b"),
+		},
+		{
+			Name:           "level 1b is higher than level 1.0",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42f00b"), PacketizationMode: 1},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e00a"), PacketizationMode: 1},
+			ProfileLevelID: mustParseProfileLevelID(t, "42e00a"),
+		},
+		{
+			Name:           "level 1.0 is lower than level 1b",
+			Offer:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e00a"), PacketizationMode: 1},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42f00b"), PacketizationMode: 1},
+			ProfileLevelID: mustParseProfileLevelID(t, "42e00a"),
+		},
+		{
+			Name:           "absent profile-level-id in offer",
+			Offer:          SDPFormatParameters{},
+			Local:          SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42001f")},
+			ProfileLevelID: mustParseProfileLevelID(t, "42000a"),
+		},
+		{
+			Name:           "absent profile-level-id in both",
+			Offer:          SDPFormatParameters{},
+			Local:          SDPFormatParameters{},
+			ProfileLevelID: nil,
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			answer, err := AnswerSDPFormatParameters(tt.Offer, tt.Local)
+			require.NoError(t, err)
+			assert.Equal(t, tt.ProfileLevelID, answer.ProfileLevelID)
+			assert.Equal(t, tt.Local.PacketizationMode, answer.PacketizationMode)
+			assert.Equal(t, tt.Local.LevelAsymmetryAllowed, answer.LevelAsymmetryAllowed)
+		})
+	}
+
+	t.Run("incompatible", func(t *testing.T) {
+		_, err := AnswerSDPFormatParameters(
+			SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "64001f"), PacketizationMode: 1},
+			SDPFormatParameters{ProfileLevelID: mustParseProfileLevelID(t, "42e01f"), PacketizationMode: 1},
+		)
+		assert.Error(t, err)
+	})
+}
+
+func TestIsLowerLevel(t *testing.T) {
+	for _, tt := range []struct {
+		A, B     uint8
+		Expected bool
+	}{
+		{10, Level1b, true},
+		{Level1b, 10, false},
+		{Level1b, 11, true},
+		{11, Level1b, false},
+		{Level1b, Level1b, false},
+		{10, 11, true},
+		{31, 30, false},
+	} {
+		assert.Equal(t, tt.Expected, isLowerLevel(tt.A, tt.B), "a=%d, b=%d", tt.A, tt.B)
+	}
+}
@@ -0,0 +1,147 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	sdpTestSPSNALUnit = []byte{0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40}
+	sdpTestPPSNALUnit = []byte{0x68, 0xce, 0x38, 0x80}
+)
+
+func TestProfileLevelID(t *testing.T) {
+	p, err := ParseProfileLevelID("42E01F")
+	require.NoError(t, err)
+	assert.Equal(t, ProfileLevelID{ProfileIDC: 66, ProfileIOP: 0xe0, LevelIDC: 31}, p)
+	assert.Equal(t, "42e01f", p.String())
+
+	for _, s := range []string{"", "42e0", "42e01f00", "42e0zz"} {
+		_, err := ParseProfileLevelID(s)
+		assert.Error(t, err, s)
+	}
+}
+
+var SDPFormatParametersTestData = []struct {
+	Name   string
+	Struct SDPFormatParameters
+	String string
+}{
+	{
+		Name:   "empty struct",
+		Struct: SDPFormatParameters{},
+		String: "packetization-mode=0",
+	},
+	{
+		Name: "sprop-parameter-sets",
+		Struct: SDPFormatParameters{
+			ProfileLevelID:     &ProfileLevelID{ProfileIDC: 66, ProfileIOP: 0xc0, LevelIDC: 30},
+			PacketizationMode:  1,
+			SpropParameterSets: [][]byte{sdpTestSPSNALUnit, sdpTestPPSNALUnit},
+		},
+		String: "packetization-mode=1;profile-level-id=42c01e;sprop-parameter-sets=Z0LAHtoCgPZA,aM44gA==",
+	},
+	{
+		Name: "all parameters",
+		Struct: SDPFormatParameters{
+			ProfileLevelID:         &ProfileLevelID{ProfileIDC: 100, ProfileIOP: 0x00, LevelIDC: 40},
+			PacketizationMode:      2,
+			LevelAsymmetryAllowed:  true,
+			MaxMBPS:                245760,
+			MaxSMBPS:               245760,
+			MaxFS:                  8192,
+			MaxCPB:                 25000,
+			MaxDPB:                 12288,
+			MaxBR:                  20000,
+			RedundantPicCap:        true,
+			SpropInterleavingDepth: 3,
+			SpropDeintBufReq:       64000,
+			DeintBufCap:            128000,
+			SpropInitBufTime:       90000,
+			SpropMaxDonDiff:        10,
+			MaxRcmdNALUSize:        1400,
+			Others:                 map[string]string{"x-foo": "bar"},
+		},
+		String: "level-asymmetry-allowed=1;packetization-mode=2;profile-level-id=640028;" +
+			"max-mbps=245760;max-smbps=245760;max-fs=8192;max-cpb=25000;max-dpb=12288;max-br=20000;" +
+			"sprop-interleaving-depth=3;sprop-deint-buf-req=64000;deint-buf-cap=128000;" +
+			"sprop-init-buf-time=90000;sprop-max-don-diff=10;max-rcmd-nalu-size=1400;" +
+			"redundant-pic-cap=1;x-foo=bar",
+	},
+}
+
+func TestSDPFormatParameters_String(t *testing.T) {
+	for _, tt := range SDPFormatParametersTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.String, tt.Struct.String())
+		})
+	}
+}
+
+func TestParseSDPFormatParameters(t *testing.T) {
+	for _, tt := range SDPFormatParametersTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s, err := ParseSDPFormatParameters(tt.String)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+
+	t.Run("a=fmtp line", func(t *testing.T) {
+		s, err := ParseSDPFormatParameters("a=fmtp:96 profile-level-id=42c01e; packetization-mode=1; sprop-parameter-sets=Z0LAHtoCgPZA,aM44gA==\r\n")
+		require.NoError(t, err)
+		assert.Equal(t, SDPFormatParametersTestData[1].Struct, s)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{
+			"profile-level-id=42c0",
+			"packetization-mode=3",
+			"max-fs=-1",
+			"level-asymmetry-allowed=yes",
+			"sprop-parameter-sets=Z0LAHtoCgPZA,!!",
+			"sprop-parameter-sets=Z0LAHtoCgPZA,",
+			"sprop-parameter-sets=,Z0I=",
+		} {
+			_, err := ParseSDPFormatParameters(s)
+			assert.Error(t, err, s)
+		}
+	})
+}
+
+func TestNewSDPFormatParameters(t *testing.T) {
+	s, err := NewSDPFormatParameters([][]byte{sdpTestSPSNALUnit}, [][]byte{sdpTestPPSNALUnit}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, SDPFormatParametersTestData[1].Struct, s)
+	assert.Equal(t, "a=fmtp:96 "+SDPFormatParametersTestData[1].String, s.FMTPLine(96))
+
+	_, err = NewSDPFormatParameters(nil, [][]byte{sdpTestPPSNALUnit}, 1)
+	assert.Error(t, err)
+	_, err = NewSDPFormatParameters([][]byte{sdpTestPPSNALUnit}, nil, 1)
+	assert.Error(t, err)
+}
+
+func TestSDPFormatParameters_SpropParameterSets(t *testing.T) {
+	s, err := ParseSDPFormatParameters(SDPFormatParametersTestData[1].String)
+	require.NoError(t, err)
+
+	spss, err := s.SpropSequenceParameterSets()
+	require.NoError(t, err)
+	require.Len(t, spss, 1)
+	assert.Equal(t, uint8(66), spss[0].ProfileIDC)
+	assert.Equal(t, uint8(30), spss[0].LevelIDC)
+	assert.Equal(t, uint64(39), spss[0].PicWidthInMbsMinus1)
+	ppss, err := s.SpropPictureParameterSets()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{sdpTestPPSNALUnit}, ppss)
+
+	t.Run("empty entry", func(t *testing.T) {
+		s := SDPFormatParameters{SpropParameterSets: [][]byte{{}, sdpTestSPSNALUnit}}
+		_, err := s.SpropSequenceParameterSets()
+		assert.Error(t, err)
+		_, err = s.SpropPictureParameterSets()
+		assert.Error(t, err)
+	})
+}
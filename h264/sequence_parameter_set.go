@@ -70,8 +70,7 @@ func (m SequenceParameterSet) MarshalBinary() ([]byte, error) {
 		return nil, err
 	}
 
-	switch m.ProfileIDC {
-	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+	if hasChromaFormatIDC(m.ProfileIDC) {
 		if _, err := writeExponentialGolombCoding(w, Uint64ToGolombCodeNum(m.ChromaFormatIDC)); err != nil {
 			return nil, err
 		}
@@ -102,10 +101,8 @@ func (m SequenceParameterSet) MarshalBinary() ([]byte, error) {
 					return nil, err
 				}
 				if m.SequenceScalingListPresentFlag[i] {
-					for j := range m.ScalingListDeltaScales[i] {
-						if _, err := writeExponentialGolombCoding(w, Int64ToGolombCodeNum(m.ScalingListDeltaScales[i][j])); err != nil {
-							return nil, err
-						}
+					if err := writeScalingList(w, m.ScalingListDeltaScales[i]); err != nil {
+						return nil, err
 					}
 				}
 			}
@@ -245,8 +242,7 @@ func (m *SequenceParameterSet) UnmarshalBinary(b []byte) error {
 		return err
 	}
 	m.SequenceParamterSetID = GolombCodeNumToUint64(g)
-	switch m.ProfileIDC {
-	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+	if hasChromaFormatIDC(m.ProfileIDC) {
 		g, err = readExponentialGolombCoding(r)
 		if err != nil {
 			return err
@@ -289,28 +285,9 @@ func (m *SequenceParameterSet) UnmarshalBinary(b []byte) error {
 					return err
 				}
 				if m.SequenceScalingListPresentFlag[i] {
-					var sizeOfScalingList int
-					if i < 6 {
-						sizeOfScalingList = 16
-					} else {
-						sizeOfScalingList = 64
-					}
-					m.ScalingListDeltaScales[i] = make([]int64, 0, sizeOfScalingList)
-
-					lastScale := int64(8)
-					nextScale := int64(8)
-					for j := 0; j < sizeOfScalingList; j++ {
-						if nextScale != 0 {
-							g, err = readExponentialGolombCoding(r)
-							if err != nil {
-								return err
-							}
-							m.ScalingListDeltaScales[i] = append(m.ScalingListDeltaScales[i], GolombCodeNumToInt64(g))
-							nextScale = (lastScale + m.ScalingListDeltaScales[i][j] + 256) % 256
-						}
-						if nextScale != 0 {
-							lastScale = nextScale
-						}
+					m.ScalingListDeltaScales[i], err = readScalingList(r, sizeOfScalingList(i))
+					if err != nil {
+						return err
 					}
 				}
 			}
@@ -443,3 +420,104 @@ func (m *SequenceParameterSet) UnmarshalBinary(b []byte) error {
 
 	return nil
 }
+
+func sizeOfScalingList(i int) int {
+	if i < 6 {
+		return 16
+	}
+	return 64
+}
+
+func writeScalingList(w *bitWriter, deltaScales []int64) error {
+	for j := range deltaScales {
+		if _, err := writeExponentialGolombCoding(w, Int64ToGolombCodeNum(deltaScales[j])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readScalingList(r *bitReader, size int) ([]int64, error) {
+	deltaScales := make([]int64, 0, size)
+
+	lastScale := int64(8)
+	nextScale := int64(8)
+	for j := 0; j < size; j++ {
+		if nextScale != 0 {
+			g, err := readExponentialGolombCoding(r)
+			if err != nil {
+				return nil, err
+			}
+			deltaScales = append(deltaScales, GolombCodeNumToInt64(g))
+			nextScale = (lastScale + deltaScales[j] + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+	return deltaScales, nil
+}
+
+func hasChromaFormatIDC(profileIDC uint8) bool {
+	switch profileIDC {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		return true
+	}
+	return false
+}
+
+// ChromaArrayType returns ChromaArrayType, inferring chroma_format_idc as 1
+// when it is not present.
+func (m SequenceParameterSet) ChromaArrayType() uint64 {
+	if !hasChromaFormatIDC(m.ProfileIDC) {
+		return 1
+	}
+	if m.SeparateColourPlaneFlag {
+		return 0
+	}
+	return m.ChromaFormatIDC
+}
+
+// VUI returns vui_parameters() of the SPS if present.
+func (m SequenceParameterSet) VUI() (VideoUsabilityInformation, bool) {
+	if !m.VUIParametersPresentFlag || len(m.VUIs) == 0 {
+		return VideoUsabilityInformation{}, false
+	}
+	return m.VUIs[0], true
+}
+
+// Width returns the width of decoded frames in luma samples after the frame
+// cropping.
+func (m SequenceParameterSet) Width() uint64 {
+	cropUnitX, _ := m.cropUnit()
+	return (m.PicWidthInMbsMinus1+1)*16 - cropUnitX*(m.FrameCropLeftOffset+m.FrameCropRightOffset)
+}
+
+// Height returns the height of decoded frames in luma samples after the
+// frame cropping.
+func (m SequenceParameterSet) Height() uint64 {
+	_, cropUnitY := m.cropUnit()
+	frameHeightInMbs := (m.PicHeightInMapUnitsMinus1 + 1) * m.frameHeightFactor()
+	return frameHeightInMbs*16 - cropUnitY*(m.FrameCropTopOffset+m.FrameCropBottomOffset)
+}
+
+// frameHeightFactor is 2 - frame_mbs_only_flag.
+func (m SequenceParameterSet) frameHeightFactor() uint64 {
+	if m.FrameMbsOnlyFlag {
+		return 1
+	}
+	return 2
+}
+
+// cropUnit returns CropUnitX and CropUnitY (7-19 to 7-22).
+func (m SequenceParameterSet) cropUnit() (uint64, uint64) {
+	switch m.ChromaArrayType() {
+	case 0:
+		return 1, m.frameHeightFactor()
+	case 1:
+		return 2, 2 * m.frameHeightFactor()
+	case 2:
+		return 2, m.frameHeightFactor()
+	}
+	return 1, m.frameHeightFactor()
+}
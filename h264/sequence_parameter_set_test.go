@@ -1104,3 +1104,70 @@ func TestSequenceParameterSet_UnmarshalBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestSequenceParameterSet_Width(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Struct SequenceParameterSet
+		Width  uint64
+		Height uint64
+	}{
+		{
+			Name: "without cropping",
+			Struct: SequenceParameterSet{
+				ProfileIDC:                66,
+				PicWidthInMbsMinus1:       39,
+				PicHeightInMapUnitsMinus1: 29,
+				FrameMbsOnlyFlag:          true,
+			},
+			Width:  640,
+			Height: 480,
+		},
+		{
+			Name: "4:2:0 progressive",
+			Struct: SequenceParameterSet{
+				ProfileIDC:                100,
+				ChromaFormatIDC:           1,
+				PicWidthInMbsMinus1:       119,
+				PicHeightInMapUnitsMinus1: 67,
+				FrameMbsOnlyFlag:          true,
+				FrameCroppingFlag:         true,
+				FrameCropBottomOffset:     4,
+			},
+			Width:  1920,
+			Height: 1080,
+		},
+		{
+			Name: "4:2:0 interlaced",
+			Struct: SequenceParameterSet{
+				ProfileIDC:                77,
+				PicWidthInMbsMinus1:       119,
+				PicHeightInMapUnitsMinus1: 33,
+				FrameCroppingFlag:         true,
+				FrameCropBottomOffset:     2,
+			},
+			Width:  1920,
+			Height: 1080,
+		},
+		{
+			Name: "4:4:4",
+			Struct: SequenceParameterSet{
+				ProfileIDC:                244,
+				ChromaFormatIDC:           3,
+				PicWidthInMbsMinus1:       7,
+				PicHeightInMapUnitsMinus1: 7,
+				FrameMbsOnlyFlag:          true,
+				FrameCroppingFlag:         true,
+				FrameCropRightOffset:      2,
+				FrameCropBottomOffset:     3,
+			},
+			Width:  126,
+			Height: 125,
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.Width, tt.Struct.Width())
+			assert.Equal(t, tt.Height, tt.Struct.Height())
+		})
+	}
+}
@@ -0,0 +1,559 @@
+package h264
+
+import (
+	"math/bits"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SliceTypeP  = 0
+	SliceTypeB  = 1
+	SliceTypeI  = 2
+	SliceTypeSP = 3
+	SliceTypeSI = 4
+)
+
+type SliceHeader struct {
+	FirstMbInSlice               uint64
+	SliceType                    uint64
+	PictureParameterSetID        uint64
+	ColourPlaneID                uint8
+	FrameNum                     uint64
+	FieldPicFlag                 bool
+	BottomFieldFlag              bool
+	IDRPicID                     uint64
+	PicOrderCntLsb               uint64
+	DeltaPicOrderCntBottom       int64
+	DeltaPicOrderCnt             [2]int64
+	RedundantPicCnt              uint64
+	DirectSpatialMvPredFlag      bool
+	NumRefIdxActiveOverrideFlag  bool
+	NumRefIdxL0ActiveMinus1      uint64
+	NumRefIdxL1ActiveMinus1      uint64
+	RefPicListModificationFlagL0 bool
+	RefPicListModificationsL0    []RefPicListModification
+	RefPicListModificationFlagL1 bool
+	RefPicListModificationsL1    []RefPicListModification
+	PredWeightTable              *PredWeightTable
+	DecRefPicMarking             *DecRefPicMarking
+	CABACInitIDC                 uint64
+	SliceQPDelta                 int64
+	SPForSwitchFlag              bool
+	SliceQSDelta                 int64
+	DisableDeblockingFilterIDC   uint64
+	SliceAlphaC0OffsetDiv2       int64
+	SliceBetaOffsetDiv2          int64
+	SliceGroupChangeCycle        uint64
+
+	// SliceDataBitOffset is the bit offset in RBSPByte where slice_data()
+	// begins.
+	SliceDataBitOffset int
+}
+
+// RefPicListModification is an entry of ref_pic_list_modification() or
+// ref_pic_list_mvc_modification() except for the terminating
+// modification_of_pic_nums_idc equal to 3.
+type RefPicListModification struct {
+	ModificationOfPicNumsIDC uint64
+	AbsDiffPicNumMinus1      uint64
+	LongTermPicNum           uint64
+	AbsDiffViewIdxMinus1     uint64
+}
+
+type PredWeightTable struct {
+	LumaLog2WeightDenom   uint64
+	ChromaLog2WeightDenom uint64
+	L0                    []PredWeight
+	L1                    []PredWeight
+}
+
+type PredWeight struct {
+	LumaWeightFlag   bool
+	LumaWeight       int64
+	LumaOffset       int64
+	ChromaWeightFlag bool
+	ChromaWeight     [2]int64
+	ChromaOffset     [2]int64
+}
+
+type DecRefPicMarking struct {
+	NoOutputOfPriorPicsFlag       bool
+	LongTermReferenceFlag         bool
+	AdaptiveRefPicMarkingModeFlag bool
+	// MemoryManagementControlOperations does not include the terminating
+	// memory_management_control_operation equal to 0.
+	MemoryManagementControlOperations []MemoryManagementControlOperation
+}
+
+type MemoryManagementControlOperation struct {
+	MemoryManagementControlOperation uint64
+	DifferenceOfPicNumsMinus1        uint64
+	LongTermPicNum                   uint64
+	LongTermFrameIdx                 uint64
+	MaxLongTermFrameIdxPlus1         uint64
+}
+
+// IDRPicFlag derives IdrPicFlag of a slice NAL unit.
+func IDRPicFlag(nal NALUnit) bool {
+	switch nal.NALUnitType {
+	case NALUnitTypeIDRSlice:
+		return true
+	case NALUnitTypeSliceExtension, NALUnitTypeSliceExtensionForDepthView:
+		if nal.MVCExtension != nil {
+			return !nal.MVCExtension.NonIDRFlag
+		}
+		if nal.SVCExtension != nil {
+			return nal.SVCExtension.IDRFlag
+		}
+		if nal.AVC3dExtension != nil {
+			return !nal.AVC3dExtension.NonIDRFlag
+		}
+	}
+	return false
+}
+
+// UnmarshalNALUnit decodes slice_header() of a slice NAL unit (nal_unit_type
+// 1, 5, or 20 and 21 with the MVC header extension) using the SPS and PPS in
+// force.
+func (m *SliceHeader) UnmarshalNALUnit(nal NALUnit, spsLookup SequenceParameterSetLookup, ppsLookup PictureParameterSetLookup) error {
+	switch nal.NALUnitType {
+	case NALUnitTypeNonIDRSlice, NALUnitTypeIDRSlice:
+	case NALUnitTypeSliceExtension, NALUnitTypeSliceExtensionForDepthView:
+		if nal.MVCExtension == nil {
+			return errors.Errorf("unsupported NAL unit header extension: nal_unit_type=%d", nal.NALUnitType)
+		}
+	default:
+		return errors.Errorf("not a slice NAL unit: nal_unit_type=%d", nal.NALUnitType)
+	}
+	idrPicFlag := IDRPicFlag(nal)
+
+	var err error
+	var g uint64
+	r := newBitReader(nal.RBSPByte)
+
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.FirstMbInSlice = GolombCodeNumToUint64(g)
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.SliceType = GolombCodeNumToUint64(g)
+	if m.SliceType > 9 {
+		return errors.Errorf("invalid slice_type: %d", m.SliceType)
+	}
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.PictureParameterSetID = GolombCodeNumToUint64(g)
+
+	pps, ok := ppsLookup(m.PictureParameterSetID)
+	if !ok {
+		return errors.Errorf("picture parameter set is not found: id=%d", m.PictureParameterSetID)
+	}
+	sps, ok := spsLookup(pps.SequenceParameterSetID)
+	if !ok {
+		return errors.Errorf("sequence parameter set is not found: id=%d", pps.SequenceParameterSetID)
+	}
+
+	sliceType := m.SliceType % 5
+
+	if sps.SeparateColourPlaneFlag {
+		g, err = r.ReadBits(2)
+		if err != nil {
+			return err
+		}
+		m.ColourPlaneID = uint8(g)
+	}
+	m.FrameNum, err = r.ReadBits(int(sps.Log2MaxFrameNumMinus4) + 4)
+	if err != nil {
+		return err
+	}
+	if !sps.FrameMbsOnlyFlag {
+		m.FieldPicFlag, err = r.ReadBit()
+		if err != nil {
+			return err
+		}
+		if m.FieldPicFlag {
+			m.BottomFieldFlag, err = r.ReadBit()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if idrPicFlag {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return err
+		}
+		m.IDRPicID = GolombCodeNumToUint64(g)
+	}
+	if sps.PicOrderCntType == 0 {
+		m.PicOrderCntLsb, err = r.ReadBits(int(sps.Log2MaxPicOrderCntLsbMinus4) + 4)
+		if err != nil {
+			return err
+		}
+		if pps.BottomFieldPicOrderInFramePresentFlag && !m.FieldPicFlag {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return err
+			}
+			m.DeltaPicOrderCntBottom = GolombCodeNumToInt64(g)
+		}
+	}
+	if sps.PicOrderCntType == 1 && !sps.DeltaPicOrderAlwaysZeroFlag {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return err
+		}
+		m.DeltaPicOrderCnt[0] = GolombCodeNumToInt64(g)
+		if pps.BottomFieldPicOrderInFramePresentFlag && !m.FieldPicFlag {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return err
+			}
+			m.DeltaPicOrderCnt[1] = GolombCodeNumToInt64(g)
+		}
+	}
+	if pps.RedundantPicCntPresentFlag {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return err
+		}
+		m.RedundantPicCnt = GolombCodeNumToUint64(g)
+	}
+	if sliceType == SliceTypeB {
+		m.DirectSpatialMvPredFlag, err = r.ReadBit()
+		if err != nil {
+			return err
+		}
+	}
+	m.NumRefIdxL0ActiveMinus1 = pps.NumRefIdxL0DefaultActiveMinus1
+	m.NumRefIdxL1ActiveMinus1 = pps.NumRefIdxL1DefaultActiveMinus1
+	switch sliceType {
+	case SliceTypeP, SliceTypeSP, SliceTypeB:
+		m.NumRefIdxActiveOverrideFlag, err = r.ReadBit()
+		if err != nil {
+			return err
+		}
+		if m.NumRefIdxActiveOverrideFlag {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return err
+			}
+			m.NumRefIdxL0ActiveMinus1 = GolombCodeNumToUint64(g)
+			if sliceType == SliceTypeB {
+				g, err = readExponentialGolombCoding(r)
+				if err != nil {
+					return err
+				}
+				m.NumRefIdxL1ActiveMinus1 = GolombCodeNumToUint64(g)
+			}
+		}
+	}
+	// the range of 7.4.3, which is doubled for fields
+	maxNumRefIdxActiveMinus1 := uint64(15)
+	if m.FieldPicFlag {
+		maxNumRefIdxActiveMinus1 = 31
+	}
+	if m.NumRefIdxL0ActiveMinus1 > maxNumRefIdxActiveMinus1 ||
+		(sliceType == SliceTypeB && m.NumRefIdxL1ActiveMinus1 > maxNumRefIdxActiveMinus1) {
+		return errors.Errorf("invalid num_ref_idx_active_minus1: l0=%d, l1=%d", m.NumRefIdxL0ActiveMinus1, m.NumRefIdxL1ActiveMinus1)
+	}
+	mvc := nal.NALUnitType == NALUnitTypeSliceExtension || nal.NALUnitType == NALUnitTypeSliceExtensionForDepthView
+	if sliceType != SliceTypeI && sliceType != SliceTypeSI {
+		m.RefPicListModificationFlagL0, err = r.ReadBit()
+		if err != nil {
+			return err
+		}
+		if m.RefPicListModificationFlagL0 {
+			m.RefPicListModificationsL0, err = readRefPicListModifications(r, mvc)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if sliceType == SliceTypeB {
+		m.RefPicListModificationFlagL1, err = r.ReadBit()
+		if err != nil {
+			return err
+		}
+		if m.RefPicListModificationFlagL1 {
+			m.RefPicListModificationsL1, err = readRefPicListModifications(r, mvc)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if (pps.WeightedPredFlag && (sliceType == SliceTypeP || sliceType == SliceTypeSP)) ||
+		(pps.WeightedBipredIDC == 1 && sliceType == SliceTypeB) {
+		t, err := readPredWeightTable(r, sps.ChromaArrayType(), sliceType, m.NumRefIdxL0ActiveMinus1, m.NumRefIdxL1ActiveMinus1)
+		if err != nil {
+			return err
+		}
+		m.PredWeightTable = &t
+	}
+	if nal.NALRefIDC != 0 {
+		d, err := readDecRefPicMarking(r, idrPicFlag)
+		if err != nil {
+			return err
+		}
+		m.DecRefPicMarking = &d
+	}
+	if pps.EntropyCodingModeFlag && sliceType != SliceTypeI && sliceType != SliceTypeSI {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return err
+		}
+		m.CABACInitIDC = GolombCodeNumToUint64(g)
+	}
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return err
+	}
+	m.SliceQPDelta = GolombCodeNumToInt64(g)
+	if sliceType == SliceTypeSP || sliceType == SliceTypeSI {
+		if sliceType == SliceTypeSP {
+			m.SPForSwitchFlag, err = r.ReadBit()
+			if err != nil {
+				return err
+			}
+		}
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return err
+		}
+		m.SliceQSDelta = GolombCodeNumToInt64(g)
+	}
+	if pps.DeblockingFilterControlPresentFlag {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return err
+		}
+		m.DisableDeblockingFilterIDC = GolombCodeNumToUint64(g)
+		if m.DisableDeblockingFilterIDC != 1 {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return err
+			}
+			m.SliceAlphaC0OffsetDiv2 = GolombCodeNumToInt64(g)
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return err
+			}
+			m.SliceBetaOffsetDiv2 = GolombCodeNumToInt64(g)
+		}
+	}
+	if pps.NumSliceGroupsMinus1 > 0 && pps.SliceGroupMapType >= 3 && pps.SliceGroupMapType <= 5 {
+		picSizeInMapUnits := (sps.PicWidthInMbsMinus1 + 1) * (sps.PicHeightInMapUnitsMinus1 + 1)
+		if pps.SliceGroupChangeRateMinus1 >= picSizeInMapUnits {
+			return errors.Errorf("invalid slice_group_change_rate_minus1: %d", pps.SliceGroupChangeRateMinus1)
+		}
+		m.SliceGroupChangeCycle, err = r.ReadBits(sliceGroupChangeCycleBitLength(picSizeInMapUnits, pps.SliceGroupChangeRateMinus1+1))
+		if err != nil {
+			return err
+		}
+	}
+
+	m.SliceDataBitOffset = r.BitOffset()
+
+	return nil
+}
+
+// sliceGroupChangeCycleBitLength returns
+// Ceil(Log2(PicSizeInMapUnits ÷ SliceGroupChangeRate + 1)).
+func sliceGroupChangeCycleBitLength(picSizeInMapUnits, sliceGroupChangeRate uint64) int {
+	// Ceil(Log2(x + 1)) is the bit length of Ceil(x)
+	q := picSizeInMapUnits / sliceGroupChangeRate
+	if picSizeInMapUnits%sliceGroupChangeRate != 0 {
+		q++
+	}
+	return bits.Len64(q)
+}
+
+func readRefPicListModifications(r *bitReader, mvc bool) ([]RefPicListModification, error) {
+	var mm []RefPicListModification
+	for {
+		g, err := readExponentialGolombCoding(r)
+		if err != nil {
+			return nil, err
+		}
+		m := RefPicListModification{
+			ModificationOfPicNumsIDC: GolombCodeNumToUint64(g),
+		}
+		switch m.ModificationOfPicNumsIDC {
+		case 0, 1:
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return nil, err
+			}
+			m.AbsDiffPicNumMinus1 = GolombCodeNumToUint64(g)
+		case 2:
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return nil, err
+			}
+			m.LongTermPicNum = GolombCodeNumToUint64(g)
+		case 3:
+			return mm, nil
+		case 4, 5:
+			if !mvc {
+				return nil, errors.Errorf("invalid modification_of_pic_nums_idc: %d", m.ModificationOfPicNumsIDC)
+			}
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return nil, err
+			}
+			m.AbsDiffViewIdxMinus1 = GolombCodeNumToUint64(g)
+		default:
+			return nil, errors.Errorf("invalid modification_of_pic_nums_idc: %d", m.ModificationOfPicNumsIDC)
+		}
+		mm = append(mm, m)
+	}
+}
+
+func readPredWeightTable(r *bitReader, chromaArrayType uint64, sliceType uint64, numRefIdxL0ActiveMinus1, numRefIdxL1ActiveMinus1 uint64) (m PredWeightTable, err error) {
+	var g uint64
+
+	g, err = readExponentialGolombCoding(r)
+	if err != nil {
+		return m, err
+	}
+	m.LumaLog2WeightDenom = GolombCodeNumToUint64(g)
+	if chromaArrayType != 0 {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return m, err
+		}
+		m.ChromaLog2WeightDenom = GolombCodeNumToUint64(g)
+	}
+	m.L0, err = readPredWeights(r, chromaArrayType, numRefIdxL0ActiveMinus1)
+	if err != nil {
+		return m, err
+	}
+	if sliceType == SliceTypeB {
+		m.L1, err = readPredWeights(r, chromaArrayType, numRefIdxL1ActiveMinus1)
+		if err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+func readPredWeights(r *bitReader, chromaArrayType uint64, numRefIdxActiveMinus1 uint64) ([]PredWeight, error) {
+	var err error
+	var g uint64
+
+	ww := make([]PredWeight, numRefIdxActiveMinus1+1)
+	for i := range ww {
+		ww[i].LumaWeightFlag, err = r.ReadBit()
+		if err != nil {
+			return nil, err
+		}
+		if ww[i].LumaWeightFlag {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return nil, err
+			}
+			ww[i].LumaWeight = GolombCodeNumToInt64(g)
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return nil, err
+			}
+			ww[i].LumaOffset = GolombCodeNumToInt64(g)
+		}
+		if chromaArrayType != 0 {
+			ww[i].ChromaWeightFlag, err = r.ReadBit()
+			if err != nil {
+				return nil, err
+			}
+			if ww[i].ChromaWeightFlag {
+				for j := 0; j < 2; j++ {
+					g, err = readExponentialGolombCoding(r)
+					if err != nil {
+						return nil, err
+					}
+					ww[i].ChromaWeight[j] = GolombCodeNumToInt64(g)
+					g, err = readExponentialGolombCoding(r)
+					if err != nil {
+						return nil, err
+					}
+					ww[i].ChromaOffset[j] = GolombCodeNumToInt64(g)
+				}
+			}
+		}
+	}
+	return ww, nil
+}
+
+func readDecRefPicMarking(r *bitReader, idrPicFlag bool) (m DecRefPicMarking, err error) {
+	var g uint64
+
+	if idrPicFlag {
+		m.NoOutputOfPriorPicsFlag, err = r.ReadBit()
+		if err != nil {
+			return m, err
+		}
+		m.LongTermReferenceFlag, err = r.ReadBit()
+		if err != nil {
+			return m, err
+		}
+		return m, nil
+	}
+
+	m.AdaptiveRefPicMarkingModeFlag, err = r.ReadBit()
+	if err != nil {
+		return m, err
+	}
+	if !m.AdaptiveRefPicMarkingModeFlag {
+		return m, nil
+	}
+	for {
+		g, err = readExponentialGolombCoding(r)
+		if err != nil {
+			return m, err
+		}
+		o := MemoryManagementControlOperation{
+			MemoryManagementControlOperation: GolombCodeNumToUint64(g),
+		}
+		if o.MemoryManagementControlOperation == 0 {
+			return m, nil
+		}
+		if o.MemoryManagementControlOperation == 1 || o.MemoryManagementControlOperation == 3 {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return m, err
+			}
+			o.DifferenceOfPicNumsMinus1 = GolombCodeNumToUint64(g)
+		}
+		if o.MemoryManagementControlOperation == 2 {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return m, err
+			}
+			o.LongTermPicNum = GolombCodeNumToUint64(g)
+		}
+		if o.MemoryManagementControlOperation == 3 || o.MemoryManagementControlOperation == 6 {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return m, err
+			}
+			o.LongTermFrameIdx = GolombCodeNumToUint64(g)
+		}
+		if o.MemoryManagementControlOperation == 4 {
+			g, err = readExponentialGolombCoding(r)
+			if err != nil {
+				return m, err
+			}
+			o.MaxLongTermFrameIdxPlus1 = GolombCodeNumToUint64(g)
+		}
+		if o.MemoryManagementControlOperation > 6 {
+			return m, errors.Errorf("invalid memory_management_control_operation: %d", o.MemoryManagementControlOperation)
+		}
+		m.MemoryManagementControlOperations = append(m.MemoryManagementControlOperations, o)
+	}
+}
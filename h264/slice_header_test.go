@@ -0,0 +1,399 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sliceHeaderTestParameterSets = ParameterSets{
+	SequenceParameterSets: map[uint64]SequenceParameterSet{
+		0: {
+			ProfileIDC:                66,
+			FrameMbsOnlyFlag:          true,
+			PicWidthInMbsMinus1:       3,
+			PicHeightInMapUnitsMinus1: 2,
+		},
+		1: {
+			ProfileIDC:            77,
+			SequenceParamterSetID: 1,
+			PicOrderCntType:       1,
+		},
+		2: {
+			ProfileIDC:                244,
+			SequenceParamterSetID:     2,
+			ChromaFormatIDC:           3,
+			SeparateColourPlaneFlag:   true,
+			PicOrderCntType:           2,
+			PicWidthInMbsMinus1:       9,
+			PicHeightInMapUnitsMinus1: 4,
+		},
+	},
+	PictureParameterSets: map[uint64]PictureParameterSet{
+		0: {},
+		1: {
+			PictureParameterSetID: 1,
+			WeightedPredFlag:      true,
+		},
+		2: {
+			PictureParameterSetID:                 2,
+			SequenceParameterSetID:                1,
+			EntropyCodingModeFlag:                 true,
+			BottomFieldPicOrderInFramePresentFlag: true,
+			NumRefIdxL1DefaultActiveMinus1:        1,
+			DeblockingFilterControlPresentFlag:    true,
+		},
+		3: {
+			PictureParameterSetID:      3,
+			SequenceParameterSetID:     2,
+			NumSliceGroupsMinus1:       1,
+			SliceGroupMapType:          4,
+			SliceGroupChangeRateMinus1: 3,
+			RedundantPicCntPresentFlag: true,
+		},
+	},
+}
+
+var SliceHeaderTestData = []struct {
+	Name    string
+	NALUnit NALUnit
+	Header  []Bit
+	Struct  SliceHeader
+}{
+	{
+		Name: "IDR I slice",
+		NALUnit: NALUnit{
+			NALRefIDC:   3,
+			NALUnitType: NALUnitTypeIDRSlice,
+		},
+		Header: []Bit{
+			l,                   // FirstMbInSlice
+			o, o, o, l, o, o, o, // SliceType
+			l,          // PictureParameterSetID
+			o, o, o, o, // FrameNum
+			o, l, o, // IDRPicID
+			o, o, o, o, // PicOrderCntLsb
+			o,             // NoOutputOfPriorPicsFlag
+			o,             // LongTermReferenceFlag
+			o, o, l, o, l, // SliceQPDelta
+		},
+		Struct: SliceHeader{
+			SliceType:        7,
+			IDRPicID:         1,
+			DecRefPicMarking: &DecRefPicMarking{},
+			SliceQPDelta:     -2,
+		},
+	},
+	{
+		Name: "P slice with modifications, weights and MMCOs",
+		NALUnit: NALUnit{
+			NALRefIDC:   2,
+			NALUnitType: NALUnitTypeNonIDRSlice,
+		},
+		Header: []Bit{
+			o, o, l, l, o, // FirstMbInSlice
+			l,       // SliceType
+			o, l, o, // PictureParameterSetID
+			o, o, l, l, // FrameNum
+			o, l, l, o, // PicOrderCntLsb
+			l,       // NumRefIdxActiveOverrideFlag
+			o, l, o, // NumRefIdxL0ActiveMinus1
+			l,          // RefPicListModificationFlagL0
+			l, o, l, l, // ModificationOfPicNumsIDC, AbsDiffPicNumMinus1
+			o, l, l, l, // ModificationOfPicNumsIDC, LongTermPicNum
+			o, o, l, o, o, // ModificationOfPicNumsIDC
+			l,       // LumaLog2WeightDenom
+			o, l, o, // ChromaLog2WeightDenom
+			l, o, l, o, o, l, l, o, // L0[0]
+			o, l, l, l, o, l, o, l, // L0[1]
+			l,       // AdaptiveRefPicMarkingModeFlag
+			o, l, o, // MemoryManagementControlOperation
+			l,             // DifferenceOfPicNumsMinus1
+			o, o, l, l, l, // MemoryManagementControlOperation
+			o, l, o, // LongTermFrameIdx
+			l, // MemoryManagementControlOperation
+			l, // SliceQPDelta
+		},
+		Struct: SliceHeader{
+			FirstMbInSlice:               5,
+			SliceType:                    SliceTypeP,
+			PictureParameterSetID:        1,
+			FrameNum:                     3,
+			PicOrderCntLsb:               6,
+			NumRefIdxActiveOverrideFlag:  true,
+			NumRefIdxL0ActiveMinus1:      1,
+			RefPicListModificationFlagL0: true,
+			RefPicListModificationsL0: []RefPicListModification{
+				{ModificationOfPicNumsIDC: 0, AbsDiffPicNumMinus1: 2},
+				{ModificationOfPicNumsIDC: 2, LongTermPicNum: 0},
+			},
+			PredWeightTable: &PredWeightTable{
+				ChromaLog2WeightDenom: 1,
+				L0: []PredWeight{
+					{LumaWeightFlag: true, LumaWeight: 1, LumaOffset: -1},
+					{ChromaWeightFlag: true, ChromaWeight: [2]int64{0, 1}},
+				},
+			},
+			DecRefPicMarking: &DecRefPicMarking{
+				AdaptiveRefPicMarkingModeFlag: true,
+				MemoryManagementControlOperations: []MemoryManagementControlOperation{
+					{MemoryManagementControlOperation: 1},
+					{MemoryManagementControlOperation: 6, LongTermFrameIdx: 1},
+				},
+			},
+		},
+	},
+	{
+		Name: "non-reference B slice with CABAC and deblocking",
+		NALUnit: NALUnit{
+			NALUnitType: NALUnitTypeNonIDRSlice,
+		},
+		Header: []Bit{
+			l,       // FirstMbInSlice
+			o, l, o, // SliceType
+			o, l, l, // PictureParameterSetID
+			o, o, o, l, // FrameNum
+			o,       // FieldPicFlag
+			o, l, l, // DeltaPicOrderCnt[0]
+			o, o, l, o, o, // DeltaPicOrderCnt[1]
+			l,       // DirectSpatialMvPredFlag
+			o,       // NumRefIdxActiveOverrideFlag
+			o,       // RefPicListModificationFlagL0
+			o,       // RefPicListModificationFlagL1
+			o, l, l, // CABACInitIDC
+			o, l, o, // SliceQPDelta
+			l,       // DisableDeblockingFilterIDC
+			o, l, l, // SliceAlphaC0OffsetDiv2
+			o, l, o, // SliceBetaOffsetDiv2
+		},
+		Struct: SliceHeader{
+			SliceType:               SliceTypeB,
+			PictureParameterSetID:   2,
+			FrameNum:                1,
+			DeltaPicOrderCnt:        [2]int64{-1, 2},
+			DirectSpatialMvPredFlag: true,
+			NumRefIdxL1ActiveMinus1: 1,
+			CABACInitIDC:            2,
+			SliceQPDelta:            1,
+			SliceAlphaC0OffsetDiv2:  -1,
+			SliceBetaOffsetDiv2:     1,
+		},
+	},
+	{
+		Name: "IDR SI field slice with colour plane and slice group change cycle",
+		NALUnit: NALUnit{
+			NALRefIDC:   1,
+			NALUnitType: NALUnitTypeIDRSlice,
+		},
+		Header: []Bit{
+			l,             // FirstMbInSlice
+			o, o, l, o, l, // SliceType
+			o, o, l, o, o, // PictureParameterSetID
+			l, o, // ColourPlaneID
+			o, o, o, o, // FrameNum
+			l,       // FieldPicFlag
+			l,       // BottomFieldFlag
+			l,       // IDRPicID
+			l,       // RedundantPicCnt
+			o,       // NoOutputOfPriorPicsFlag
+			l,       // LongTermReferenceFlag
+			l,       // SliceQPDelta
+			o, l, l, // SliceQSDelta
+			o, l, o, l, // SliceGroupChangeCycle
+		},
+		Struct: SliceHeader{
+			SliceType:             SliceTypeSI,
+			PictureParameterSetID: 3,
+			ColourPlaneID:         2,
+			FieldPicFlag:          true,
+			BottomFieldFlag:       true,
+			DecRefPicMarking: &DecRefPicMarking{
+				LongTermReferenceFlag: true,
+			},
+			SliceQSDelta:          -1,
+			SliceGroupChangeCycle: 5,
+		},
+	},
+	{
+		Name: "MVC slice extension",
+		NALUnit: NALUnit{
+			NALUnitType:  NALUnitTypeSliceExtension,
+			MVCExtension: &NALUnitHeaderMVCExtension{},
+		},
+		Header: []Bit{
+			l,             // FirstMbInSlice
+			o, o, l, l, o, // SliceType
+			l,          // PictureParameterSetID
+			o, o, o, o, // FrameNum
+			l,          // IDRPicID
+			o, o, o, o, // PicOrderCntLsb
+			o,             // NumRefIdxActiveOverrideFlag
+			l,             // RefPicListModificationFlagL0
+			o, o, l, o, l, // ModificationOfPicNumsIDC
+			l,             // AbsDiffViewIdxMinus1
+			o, o, l, o, o, // ModificationOfPicNumsIDC
+			l, // SliceQPDelta
+		},
+		Struct: SliceHeader{
+			SliceType:                    5,
+			RefPicListModificationFlagL0: true,
+			RefPicListModificationsL0: []RefPicListModification{
+				{ModificationOfPicNumsIDC: 4},
+			},
+		},
+	},
+}
+
+func TestSliceHeader_UnmarshalNALUnit(t *testing.T) {
+	for _, tt := range SliceHeaderTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			nal := tt.NALUnit
+			nal.RBSPByte = mustBitToBytes(append(
+				append([]Bit{}, tt.Header...),
+				l, o, l, l, // slice_data
+			)...)
+			want := tt.Struct
+			want.SliceDataBitOffset = len(tt.Header)
+
+			s := SliceHeader{}
+			err := s.UnmarshalNALUnit(
+				nal,
+				sliceHeaderTestParameterSets.SequenceParameterSet,
+				sliceHeaderTestParameterSets.PictureParameterSet,
+			)
+			require.NoError(t, err)
+			assert.Equal(t, want, s)
+		})
+	}
+}
+
+func TestSliceHeader_UnmarshalNALUnit_error(t *testing.T) {
+	for _, tt := range []struct {
+		Name    string
+		NALUnit NALUnit
+	}{
+		{
+			Name: "not a slice",
+			NALUnit: NALUnit{
+				NALUnitType: NALUnitTypeSEI,
+				RBSPByte:    mustBitToBytes(l, l, l, l),
+			},
+		},
+		{
+			Name: "SVC extension",
+			NALUnit: NALUnit{
+				NALUnitType:  NALUnitTypeSliceExtension,
+				SVCExtension: &NALUnitHeaderSVCExtension{},
+				RBSPByte:     mustBitToBytes(l, l, l, l),
+			},
+		},
+		{
+			Name: "PPS is not found",
+			NALUnit: NALUnit{
+				NALUnitType: NALUnitTypeNonIDRSlice,
+				RBSPByte: mustBitToBytes(
+					l,                   // FirstMbInSlice
+					l,                   // SliceType
+					o, o, o, l, o, o, o, // PictureParameterSetID
+				),
+			},
+		},
+		{
+			Name: "invalid slice_type",
+			NALUnit: NALUnit{
+				NALUnitType: NALUnitTypeNonIDRSlice,
+				RBSPByte: mustBitToBytes(
+					l,                   // FirstMbInSlice
+					o, o, o, l, o, l, l, // SliceType = 10
+					l,          // PictureParameterSetID
+					o, o, o, o, // FrameNum
+					o, o, o, o, // PicOrderCntLsb
+					l,
+				),
+			},
+		},
+		{
+			Name: "too large num_ref_idx_l0_active_minus1",
+			NALUnit: NALUnit{
+				NALUnitType: NALUnitTypeNonIDRSlice,
+				RBSPByte: mustBitToBytes(
+					l,          // FirstMbInSlice
+					l,          // SliceType
+					l,          // PictureParameterSetID
+					o, o, o, o, // FrameNum
+					o, o, o, o, // PicOrderCntLsb
+					l,                         // NumRefIdxActiveOverrideFlag
+					o, o, o, o, l, o, o, o, l, // NumRefIdxL0ActiveMinus1 = 16
+					o, // RefPicListModificationFlagL0
+					o, // AdaptiveRefPicMarkingModeFlag
+					l, // SliceQPDelta
+				),
+			},
+		},
+		{
+			Name: "truncated",
+			NALUnit: NALUnit{
+				NALUnitType: NALUnitTypeNonIDRSlice,
+				RBSPByte:    mustBitToBytes(l, l, l, o, o, o),
+			},
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := SliceHeader{}
+			err := s.UnmarshalNALUnit(
+				tt.NALUnit,
+				sliceHeaderTestParameterSets.SequenceParameterSet,
+				sliceHeaderTestParameterSets.PictureParameterSet,
+			)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSliceHeader_UnmarshalNALUnit_sliceGroupChangeRate(t *testing.T) {
+	nal := NALUnit{
+		NALRefIDC:   1,
+		NALUnitType: NALUnitTypeIDRSlice,
+		RBSPByte: mustBitToBytes(
+			l,             // FirstMbInSlice
+			o, o, l, o, l, // SliceType
+			o, o, l, o, o, // PictureParameterSetID
+			l, o, // ColourPlaneID
+			o, o, o, o, // FrameNum
+			l,       // FieldPicFlag
+			l,       // BottomFieldFlag
+			l,       // IDRPicID
+			l,       // RedundantPicCnt
+			o,       // NoOutputOfPriorPicsFlag
+			l,       // LongTermReferenceFlag
+			l,       // SliceQPDelta
+			o, l, l, // SliceQSDelta
+			o, l, o, l, // SliceGroupChangeCycle
+		),
+	}
+	for _, rate := range []uint64{50, 1 << 32, 1<<64 - 1} {
+		pps := sliceHeaderTestParameterSets.PictureParameterSets[3]
+		pps.SliceGroupChangeRateMinus1 = rate
+		s := SliceHeader{}
+		err := s.UnmarshalNALUnit(
+			nal,
+			sliceHeaderTestParameterSets.SequenceParameterSet,
+			func(uint64) (PictureParameterSet, bool) { return pps, true },
+		)
+		assert.Error(t, err, rate)
+	}
+}
+
+func TestSliceGroupChangeCycleBitLength(t *testing.T) {
+	for picSizeInMapUnits := uint64(1); picSizeInMapUnits <= 300; picSizeInMapUnits++ {
+		for sliceGroupChangeRate := uint64(1); sliceGroupChangeRate <= picSizeInMapUnits; sliceGroupChangeRate++ {
+			want := 0
+			for sliceGroupChangeRate<<uint(want) < picSizeInMapUnits+sliceGroupChangeRate {
+				want++
+			}
+			assert.Equal(t, want, sliceGroupChangeCycleBitLength(picSizeInMapUnits, sliceGroupChangeRate))
+		}
+	}
+	assert.Equal(t, 33, sliceGroupChangeCycleBitLength(1<<32, 1))
+}
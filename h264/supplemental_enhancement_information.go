@@ -0,0 +1,132 @@
+package h264
+
+import "github.com/pkg/errors"
+
+const (
+	SEIPayloadTypeBufferingPeriod           = 0
+	SEIPayloadTypePicTiming                 = 1
+	SEIPayloadTypePanScanRect               = 2
+	SEIPayloadTypeFillerPayload             = 3
+	SEIPayloadTypeUserDataRegisteredITUTT35 = 4
+	SEIPayloadTypeUserDataUnregistered      = 5
+	SEIPayloadTypeRecoveryPoint             = 6
+)
+
+// SupplementalEnhancementInformation is sei_rbsp, the RBSP of a NAL unit
+// whose nal_unit_type is 6.
+type SupplementalEnhancementInformation struct {
+	Messages []SEIMessage
+}
+
+type SEIMessage struct {
+	PayloadType uint64
+	PayloadByte []byte
+}
+
+func (m SupplementalEnhancementInformation) MarshalBinary() ([]byte, error) {
+
+	w := newBitWriter()
+
+	for i := range m.Messages {
+		if err := writeSEIMessageValue(w, m.Messages[i].PayloadType); err != nil {
+			return nil, err
+		}
+		if err := writeSEIMessageValue(w, uint64(len(m.Messages[i].PayloadByte))); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(m.Messages[i].PayloadByte); err != nil {
+			return nil, err
+		}
+	}
+
+	// trailing bits
+	if _, err := w.WriteBit(BitOne); err != nil {
+		return nil, err
+	}
+
+	return w.Bytes(), nil
+}
+
+func (m *SupplementalEnhancementInformation) UnmarshalBinary(b []byte) error {
+	r := newBitReader(b)
+
+	m.Messages = nil
+	for r.MoreRBSPData() {
+		payloadType, err := readSEIMessageValue(r)
+		if err != nil {
+			return errors.Wrap(err, "failed to read payloadType")
+		}
+		payloadSize, err := readSEIMessageValue(r)
+		if err != nil {
+			return errors.Wrap(err, "failed to read payloadSize")
+		}
+		if payloadSize > uint64(len(b)-r.BitOffset()/8) {
+			return errors.Errorf("invalid payload size: payloadType=%d, payloadSize=%d", payloadType, payloadSize)
+		}
+		payload, err := r.ReadBytes(int(payloadSize))
+		if err != nil {
+			return err
+		}
+		m.Messages = append(m.Messages, SEIMessage{
+			PayloadType: payloadType,
+			PayloadByte: payload,
+		})
+	}
+
+	return nil
+}
+
+// writeSEIMessageValue writes payloadType or payloadSize as a sequence of
+// ff_byte followed by the last byte.
+func writeSEIMessageValue(w *bitWriter, v uint64) error {
+	for ; v >= 0xff; v -= 0xff {
+		if err := w.WriteByte(0xff); err != nil {
+			return err
+		}
+	}
+	return w.WriteByte(byte(v))
+}
+
+func readSEIMessageValue(r *bitReader) (uint64, error) {
+	var v uint64
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v += uint64(b)
+		if b != 0xff {
+			return v, nil
+		}
+	}
+}
+
+// SEIPayloadDecoder decodes the payload bytes of a sei_message.
+type SEIPayloadDecoder func(payload []byte) (interface{}, error)
+
+// SEIPayloadRegistry dispatches SEI messages to the decoder registered for
+// their payload type. The zero value is ready to use.
+type SEIPayloadRegistry struct {
+	decoders map[uint64]SEIPayloadDecoder
+}
+
+func (r *SEIPayloadRegistry) Register(payloadType uint64, decoder SEIPayloadDecoder) {
+	if r.decoders == nil {
+		r.decoders = make(map[uint64]SEIPayloadDecoder)
+	}
+	r.decoders[payloadType] = decoder
+}
+
+// Decode returns the payload decoded by the registered decoder, or m itself
+// when no decoder is registered for m.PayloadType.
+func (r *SEIPayloadRegistry) Decode(m SEIMessage) (interface{}, error) {
+	decoder, ok := r.decoders[m.PayloadType]
+	if !ok {
+		return m, nil
+	}
+	v, err := decoder(m.PayloadByte)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode sei payload: payloadType=%d", m.PayloadType)
+	}
+	return v, nil
+}
@@ -0,0 +1,158 @@
+package h264
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var SupplementalEnhancementInformationTestData = []struct {
+	Name   string
+	Struct SupplementalEnhancementInformation
+	Binary []byte
+}{
+	{
+		Name: "single message",
+		Struct: SupplementalEnhancementInformation{
+			Messages: []SEIMessage{
+				{
+					PayloadType: SEIPayloadTypeRecoveryPoint,
+					PayloadByte: []byte{0x84},
+				},
+			},
+		},
+		Binary: []byte{
+			0x06, 0x01, 0x84,
+			0x80, // trailing bits
+		},
+	},
+	{
+		Name: "multiple messages",
+		Struct: SupplementalEnhancementInformation{
+			Messages: []SEIMessage{
+				{
+					PayloadType: SEIPayloadTypeBufferingPeriod,
+					PayloadByte: []byte{0x01, 0x02},
+				},
+				{
+					PayloadType: SEIPayloadTypePicTiming,
+					PayloadByte: []byte{},
+				},
+			},
+		},
+		Binary: []byte{
+			0x00, 0x02, 0x01, 0x02,
+			0x01, 0x00,
+			0x80, // trailing bits
+		},
+	},
+	{
+		Name: "extended payloadType and payloadSize",
+		Struct: SupplementalEnhancementInformation{
+			Messages: []SEIMessage{
+				{
+					PayloadType: 0xff + 0xff + 0x02,
+					PayloadByte: bytes.Repeat([]byte{0xaa}, 0xff),
+				},
+			},
+		},
+		Binary: append(append(
+			[]byte{
+				0xff, 0xff, 0x02, // payloadType
+				0xff, 0x00, // payloadSize
+			},
+			bytes.Repeat([]byte{0xaa}, 0xff)...),
+			0x80, // trailing bits
+		),
+	},
+}
+
+func TestSupplementalEnhancementInformation_MarshalBinary(t *testing.T) {
+	for _, tt := range SupplementalEnhancementInformationTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			b, err := tt.Struct.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, tt.Binary, b)
+		})
+	}
+}
+
+func TestSupplementalEnhancementInformation_UnmarshalBinary(t *testing.T) {
+	for _, tt := range SupplementalEnhancementInformationTestData {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := SupplementalEnhancementInformation{}
+			err := s.UnmarshalBinary(tt.Binary)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Struct, s)
+		})
+	}
+
+	t.Run("truncated payload", func(t *testing.T) {
+		s := SupplementalEnhancementInformation{}
+		err := s.UnmarshalBinary([]byte{0x05, 0x10, 0x00, 0x80})
+		assert.Error(t, err)
+	})
+}
+
+func TestSupplementalEnhancementInformation_NALUnitRoundTrip(t *testing.T) {
+	sei := SupplementalEnhancementInformation{
+		Messages: []SEIMessage{
+			{
+				PayloadType: SEIPayloadTypeUserDataUnregistered,
+				PayloadByte: []byte{
+					0x00, 0x00, 0x01,
+					0x00, 0x00, 0x03,
+					0x00, 0x00, 0x00,
+				},
+			},
+		},
+	}
+	rbsp, err := sei.MarshalBinary()
+	require.NoError(t, err)
+
+	b, err := NALUnit{
+		NALUnitType: NALUnitTypeSEI,
+		RBSPByte:    rbsp,
+	}.MarshalBinary()
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(b[1:], []byte{0x00, 0x00, 0x01}))
+
+	nal := NALUnit{}
+	require.NoError(t, nal.UnmarshalBinary(b))
+	got := SupplementalEnhancementInformation{}
+	require.NoError(t, got.UnmarshalBinary(nal.RBSPByte))
+	assert.Equal(t, sei, got)
+}
+
+func TestSEIPayloadRegistry_Decode(t *testing.T) {
+	type recoveryPoint struct {
+		RecoveryFrameCnt uint64
+	}
+
+	r := SEIPayloadRegistry{}
+	r.Register(SEIPayloadTypeRecoveryPoint, func(payload []byte) (interface{}, error) {
+		g, err := readExponentialGolombCoding(newBitReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		return recoveryPoint{RecoveryFrameCnt: g}, nil
+	})
+	r.Register(SEIPayloadTypePicTiming, func(payload []byte) (interface{}, error) {
+		return nil, errors.New("broken")
+	})
+
+	v, err := r.Decode(SEIMessage{PayloadType: SEIPayloadTypeRecoveryPoint, PayloadByte: []byte{0x40}})
+	require.NoError(t, err)
+	assert.Equal(t, recoveryPoint{RecoveryFrameCnt: 1}, v)
+
+	unknown := SEIMessage{PayloadType: SEIPayloadTypeUserDataUnregistered, PayloadByte: []byte{0x01}}
+	v, err = r.Decode(unknown)
+	require.NoError(t, err)
+	assert.Equal(t, unknown, v)
+
+	_, err = r.Decode(SEIMessage{PayloadType: SEIPayloadTypePicTiming})
+	assert.Error(t, err)
+}
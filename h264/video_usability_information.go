@@ -355,3 +355,28 @@ func readVideoUsabilityInformation(r *bitReader) (m VideoUsabilityInformation, e
 	}
 	return m, err
 }
+
+// sampleAspectRatios is Table E-1 indexed by aspect_ratio_idc.
+var sampleAspectRatios = [][2]uint16{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+// SampleAspectRatio returns the horizontal and vertical sizes of the sample
+// aspect ratio. It returns false when the ratio is unspecified.
+func (m VideoUsabilityInformation) SampleAspectRatio() (uint16, uint16, bool) {
+	if !m.AspectRatioInfoPresentFlag {
+		return 0, 0, false
+	}
+	if m.AspectRatioIdc == ExtendedSAR {
+		if m.SarWidth == 0 || m.SarHeight == 0 {
+			return 0, 0, false
+		}
+		return m.SarWidth, m.SarHeight, true
+	}
+	if m.AspectRatioIdc == 0 || int(m.AspectRatioIdc) >= len(sampleAspectRatios) {
+		return 0, 0, false
+	}
+	sar := sampleAspectRatios[m.AspectRatioIdc]
+	return sar[0], sar[1], true
+}
@@ -375,3 +375,28 @@ func TestVideoUsabilityInformation_UnmarshalBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestVideoUsabilityInformation_SampleAspectRatio(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Struct VideoUsabilityInformation
+		Width  uint16
+		Height uint16
+		OK     bool
+	}{
+		{"not present", VideoUsabilityInformation{}, 0, 0, false},
+		{"unspecified", VideoUsabilityInformation{AspectRatioInfoPresentFlag: true}, 0, 0, false},
+		{"1:1", VideoUsabilityInformation{AspectRatioInfoPresentFlag: true, AspectRatioIdc: 1}, 1, 1, true},
+		{"40:33", VideoUsabilityInformation{AspectRatioInfoPresentFlag: true, AspectRatioIdc: 5}, 40, 33, true},
+		{"2:1", VideoUsabilityInformation{AspectRatioInfoPresentFlag: true, AspectRatioIdc: 16}, 2, 1, true},
+		{"reserved", VideoUsabilityInformation{AspectRatioInfoPresentFlag: true, AspectRatioIdc: 17}, 0, 0, false},
+		{"extended", VideoUsabilityInformation{AspectRatioInfoPresentFlag: true, AspectRatioIdc: ExtendedSAR, SarWidth: 4, SarHeight: 3}, 4, 3, true},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			w, h, ok := tt.Struct.SampleAspectRatio()
+			assert.Equal(t, tt.OK, ok)
+			assert.Equal(t, tt.Width, w)
+			assert.Equal(t, tt.Height, h)
+		})
+	}
+}